@@ -17,14 +17,19 @@
 package main
 
 import (
+	"fmt"
 	"github.com/spf13/cobra"
+	"github.com/suecodelabs/cnfuzz/src/internal/api"
 	"github.com/suecodelabs/cnfuzz/src/internal/controller"
 	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence/postgres"
 	"github.com/suecodelabs/cnfuzz/src/pkg/config"
 	"github.com/suecodelabs/cnfuzz/src/pkg/health"
 	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
 	"log"
+	"net/http"
+	"os"
 )
 
 type Command struct {
@@ -67,6 +72,8 @@ https://github.com/suecodelabs/cnfuzz`,
 	cmd.command.PersistentFlags().StringVar(&cmd.Args.dDocIp, "ddoc-ip", cmd.Args.dDocIp, "Overwrite the IP address cnfuzz uses to get the discovery doc (useful for developers)")
 	cmd.command.PersistentFlags().Int32Var(&cmd.Args.dDocPort, "ddoc-port", cmd.Args.dDocPort, "DDocOverwrites the port cnfuzz uses to get the discovery doc (useful for developers)")
 
+	cmd.command.AddCommand(createRefuzzCommand())
+
 	cmd.command.Run = func(_ *cobra.Command, _ []string) {
 		config.CreateRunConfig(cmd.Args.isDebug, false, cmd.Args.localConfig)
 		l := logger.CreateLogger(config.RunCnf.IsDebugMode, config.RunCnf.LogLevel)
@@ -91,18 +98,61 @@ func run(l logger.Logger, args Args) {
 	}
 
 	hc := health.NewChecker(l)
+	client := k8s.CreateClientset(l, !config.RunCnf.LocalK8sConfig)
 
 	var strg *persistence.Storage
 	if cnf.CacheSolution == persistence.Redis.String() {
 		l.V(logger.InfoLevel).Info("using redis for storage", "configStorageValue", cnf.CacheSolution)
-		strg = persistence.InitRedisCache(l, cnf.RedisConfig.HostName, cnf.RedisConfig.Port, hc)
+		if cnf.RedisConfig == nil {
+			l.FatalError(fmt.Errorf("missing redis config"), "failed to initialize storage")
+		}
+		strg, err = persistence.InitRedisCache(l, cnf.RedisConfig, hc)
+		if err != nil {
+			l.FatalError(err, "failed to initialize redis storage")
+		}
+	} else if cnf.CacheSolution == persistence.Postgres.String() {
+		l.V(logger.InfoLevel).Info("using postgres for storage", "configStorageValue", cnf.CacheSolution)
+		if cnf.PostgresConfig == nil {
+			l.FatalError(fmt.Errorf("missing postgres config"), "failed to initialize storage")
+		}
+		pgCnf := cnf.PostgresConfig
+		dataSource := postgres.ConnectionString(pgCnf.HostName, pgCnf.Port, pgCnf.Database, pgCnf.Username, os.Getenv(pgCnf.PasswordEnv), pgCnf.SslMode)
+		strg, err = persistence.InitPostgresCache(l, dataSource, hc)
+		if err != nil {
+			l.FatalError(err, "failed to initialize postgres storage")
+		}
+	} else if cnf.CacheSolution == persistence.Kubernetes.String() {
+		l.V(logger.InfoLevel).Info("using kubernetes for storage", "configStorageValue", cnf.CacheSolution)
+		namespace := k8s.CurrentNamespace()
+		if cnf.KubernetesConfig != nil && len(cnf.KubernetesConfig.Namespace) > 0 {
+			namespace = cnf.KubernetesConfig.Namespace
+		}
+		strg = persistence.InitKubernetesCache(l, client, namespace, hc)
+	} else if cnf.CacheSolution == persistence.File.String() {
+		l.V(logger.InfoLevel).Info("using file for storage", "configStorageValue", cnf.CacheSolution)
+		if cnf.FileConfig == nil || len(cnf.FileConfig.Path) == 0 {
+			l.FatalError(fmt.Errorf("missing file path"), "failed to initialize storage")
+		}
+		strg, err = persistence.InitFileCache(l, cnf.FileConfig, hc)
+		if err != nil {
+			l.FatalError(err, "failed to initialize file storage")
+		}
 	} else {
 		l.V(logger.DebugLevel).Info("using in_memory for storage", "configStorageValue", cnf.CacheSolution)
 		strg = persistence.InitMemoryCache(l)
 	}
 
+	// the metrics are served by the server of the health checks
+	http.Handle(controller.MetricsPath, controller.CreateMetricsHandler(l, client))
 	go health.Serv(hc)
-	client := k8s.CreateClientset(l, !config.RunCnf.LocalK8sConfig)
+	if cnf.ApiConfig != nil && cnf.ApiConfig.Enabled {
+		refuzzer := controller.NewController(l, client, strg, cnf, overwrites)
+		server, err := api.CreateServer(l, client, strg, cnf.ApiConfig, refuzzer)
+		if err != nil {
+			l.FatalError(err, "failed to create API server")
+		}
+		go server.Serv(cnf.ApiConfig.Address)
+	}
 	// Start fuzzing!
 	err = controller.StartController(l, strg, cnf, overwrites, client)
 	if err != nil {
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/suecodelabs/cnfuzz/src/internal/api"
+	"os"
+	"strings"
+	"time"
+)
+
+// RefuzzArgs arguments of the refuzz command
+type RefuzzArgs struct {
+	apiUrl    string
+	username  string
+	token     string
+	image     string
+	pod       string
+	namespace string
+}
+
+// createRefuzzCommand creates the command that asks a running cnfuzz instance to fuzz images again
+func createRefuzzCommand() *cobra.Command {
+	args := &RefuzzArgs{
+		apiUrl: "http://localhost:8081",
+	}
+	command := &cobra.Command{
+		Use:   "refuzz <flags>",
+		Short: "Fuzz an already fuzzed image, pod or namespace again",
+		Long: `Fuzz an already fuzzed image, pod or namespace again using the API of a running cnfuzz instance.
+The password for --username is read from the CNFUZZ_API_PASSWORD environment variable.`,
+		RunE: func(command *cobra.Command, _ []string) error {
+			return refuzz(command, *args)
+		},
+	}
+	command.Flags().StringVar(&args.apiUrl, "api-url", args.apiUrl, "URL of the cnfuzz API")
+	command.Flags().StringVar(&args.username, "username", args.username, "Username for the API, the password is read from CNFUZZ_API_PASSWORD")
+	command.Flags().StringVar(&args.token, "token", args.token, "Bearer token for the API (default $CNFUZZ_API_TOKEN)")
+	command.Flags().StringVar(&args.image, "image", args.image, "Image to fuzz again in the format <hash type>:<hash>")
+	command.Flags().StringVar(&args.pod, "pod", args.pod, "Pod to fuzz again in the format <namespace>/<name>")
+	command.Flags().StringVarP(&args.namespace, "namespace", "n", args.namespace, "Namespace of which all pods are fuzzed again")
+	return command
+}
+
+func refuzz(command *cobra.Command, args RefuzzArgs) error {
+	req := api.RefuzzRequest{Image: args.image, Namespace: args.namespace}
+	if len(args.pod) > 0 {
+		namespace, name, found := strings.Cut(args.pod, "/")
+		if !found || len(namespace) == 0 || len(name) == 0 {
+			return fmt.Errorf("pod %s isn't in the format <namespace>/<name>", args.pod)
+		}
+		req.Namespace = namespace
+		req.Pod = name
+	}
+	if len(req.Image) == 0 && len(req.Namespace) == 0 {
+		return errors.New("one of --image, --pod or --namespace is required")
+	}
+
+	secret := args.token
+	if len(secret) == 0 {
+		secret = os.Getenv("CNFUZZ_API_TOKEN")
+	}
+	if len(args.username) > 0 {
+		secret = os.Getenv("CNFUZZ_API_PASSWORD")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := api.CreateClient(args.apiUrl, args.username, secret, nil).Refuzz(ctx, req)
+	if err != nil {
+		return err
+	}
+	for _, image := range result.Images {
+		command.Printf("image %s will be fuzzed again\n", image)
+	}
+	for _, pod := range result.Pods {
+		command.Printf("fuzzing pod %s\n", pod)
+	}
+	return nil
+}
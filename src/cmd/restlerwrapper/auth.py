@@ -1,5 +0,0 @@
-#!/usr/bin/env python3
-import sys
-
-print("{'" + sys.argv[1] + "': {  }}")
-print(sys.argv[2])
@@ -22,6 +22,7 @@ import (
 	"github.com/suecodelabs/cnfuzz/src/internal/restler"
 	"github.com/suecodelabs/cnfuzz/src/pkg/config"
 	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/openapi"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/job"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
 	"log"
 	"os"
@@ -42,6 +43,15 @@ type Args struct {
 	timeBudget      string
 	dDocIp          string
 	dryRun          bool
+	authScheme      string
+	jwtKeyId        string
+	jwtAlgorithm    string
+	jwtClaims       string
+	jwtLifetime     string
+	fuzzRun         string
+	// fuzzRunNamespace namespace of the fuzz run, the namespace of the target when empty
+	fuzzRunNamespace string
+	operations       []string
 }
 
 func main() {
@@ -63,6 +73,12 @@ https://github.com/suecodelabs/cnfuzz`,
 			timeBudget:      "1",
 			dDocIp:          "",
 			dryRun:          false,
+			authScheme:      "",
+			jwtKeyId:        "",
+			jwtAlgorithm:    "",
+			jwtClaims:       "",
+			jwtLifetime:     "",
+			fuzzRun:         "",
 		},
 	}
 
@@ -74,6 +90,14 @@ https://github.com/suecodelabs/cnfuzz`,
 	cmd.command.PersistentFlags().Int32Var(&cmd.Args.targetPort, "port", cmd.Args.targetPort, "Set the port of the target service")
 	cmd.command.PersistentFlags().StringVar(&cmd.Args.timeBudget, "time-budget", cmd.Args.timeBudget, "Set the time budget for RESTler")
 	cmd.command.PersistentFlags().StringVar(&cmd.Args.dDocIp, "ddoc-ip", cmd.Args.dDocIp, "Dev flag: Overwrite the IP that is used to get the OpenApi doc")
+	cmd.command.PersistentFlags().StringVar(&cmd.Args.authScheme, "auth-scheme", cmd.Args.authScheme, "Key of the preferred security scheme, used when an endpoint accepts multiple schemes")
+	cmd.command.PersistentFlags().StringVar(&cmd.Args.jwtKeyId, "jwt-key-id", cmd.Args.jwtKeyId, "Key id (kid) of locally minted JWTs, the key itself is read from the "+job.JwtKeyEnv+" environment variable")
+	cmd.command.PersistentFlags().StringVar(&cmd.Args.jwtAlgorithm, "jwt-algorithm", cmd.Args.jwtAlgorithm, "Signing algorithm of locally minted JWTs (HS256, HS384, HS512, RS256, RS384, RS512 or ES256)")
+	cmd.command.PersistentFlags().StringVar(&cmd.Args.jwtClaims, "jwt-claims", cmd.Args.jwtClaims, "JSON claims template of locally minted JWTs")
+	cmd.command.PersistentFlags().StringVar(&cmd.Args.jwtLifetime, "jwt-lifetime", cmd.Args.jwtLifetime, "Lifetime of locally minted JWTs (e.g. 30m)")
+	cmd.command.PersistentFlags().StringVar(&cmd.Args.fuzzRun, "fuzz-run", cmd.Args.fuzzRun, "Name of the fuzz run (ConfigMap in the namespace of the target) that gets the results as status")
+	cmd.command.PersistentFlags().StringVar(&cmd.Args.fuzzRunNamespace, "fuzz-run-namespace", cmd.Args.fuzzRunNamespace, "Namespace of the fuzz run when it isn't the namespace of the target, e.g. when the target is a sandbox copy of the workload")
+	cmd.command.PersistentFlags().StringArrayVar(&cmd.Args.operations, "operation", cmd.Args.operations, "Only fuzz this operation in the format '<METHOD> <path>', can be repeated, all operations are fuzzed when not set")
 	cmd.command.PersistentFlags().BoolVar(&cmd.dryRun, "dry-run", cmd.Args.dryRun, "Dev flag: Do a dry run, run without executing the Restler commands")
 
 	cmd.command.Run = func(_ *cobra.Command, _ []string) {
@@ -96,14 +120,26 @@ func run(l logger.Logger, args Args) {
 		ports = append(ports, args.targetPort)
 	}
 	l.V(logger.DebugLevel).Info("fetching info from target ...")
-	info := api_info.CollectInfo(l, args.targetPod, args.targetNamespace, args.dDocIp, args.dDocLoc, ports)
+	authSettings := api_info.AuthSettings{
+		PreferredScheme: args.authScheme,
+		JwtKey:          os.Getenv(job.JwtKeyEnv),
+		JwtKeyId:        args.jwtKeyId,
+		JwtAlgorithm:    args.jwtAlgorithm,
+		JwtClaims:       args.jwtClaims,
+		JwtLifetime:     args.jwtLifetime,
+	}
+	info := api_info.CollectInfo(l, args.targetPod, args.targetNamespace, args.dDocIp, args.dDocLoc, ports, authSettings)
 	if !args.dryRun {
 		l.V(logger.DebugLevel).Info("writing OpenApi document to a file so Restler can pick it up later")
 		writeDocToFile(l, info.UnparsedApiDoc, "/openapi")
 	}
 
 	l.V(logger.DebugLevel).Info("executing Restler commands")
-	restler.ExecuteRestlerCmds(l, config.RunCnf.IsDryRun, args.timeBudget, info)
+	fuzzRunNamespace := args.fuzzRunNamespace
+	if len(fuzzRunNamespace) == 0 {
+		fuzzRunNamespace = args.targetNamespace
+	}
+	restler.ExecuteRestlerCmds(l, config.RunCnf.IsDryRun, args.timeBudget, info, args.fuzzRun, fuzzRunNamespace, args.operations)
 	l.V(logger.InfoLevel).Info("job finished, exiting now ...")
 }
 
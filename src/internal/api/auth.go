@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/auth"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// authenticator checks the credentials of API requests
+type authenticator struct {
+	username string
+	secret   string
+	jwt      *auth.JwtVerifier
+}
+
+// createAuthenticator creates an authenticator from the auth config of the API, secrets are read from environment variables
+func createAuthenticator(cnf *config.ApiAuthConfig) (*authenticator, error) {
+	a := &authenticator{}
+	if cnf == nil {
+		return a, nil
+	}
+	a.username = cnf.Username
+	if len(cnf.SecretEnv) > 0 {
+		a.secret = os.Getenv(cnf.SecretEnv)
+		if len(a.secret) == 0 {
+			return nil, fmt.Errorf("environment variable %s with the secret of the API is empty", cnf.SecretEnv)
+		}
+	} else if len(a.username) > 0 {
+		return nil, fmt.Errorf("API username %s doesn't have a secret_env with its password", a.username)
+	}
+	if cnf.Jwt != nil {
+		key := os.Getenv(cnf.Jwt.KeyEnv)
+		if len(key) == 0 {
+			return nil, fmt.Errorf("environment variable %s with the JWT key of the API is empty", cnf.Jwt.KeyEnv)
+		}
+		verifier, err := auth.CreateJwtVerifier(cnf.Jwt.Algorithm, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+	return a, nil
+}
+
+// enabled checks if requests have to be authenticated
+func (a *authenticator) enabled() bool {
+	return len(a.secret) > 0 || a.jwt != nil
+}
+
+// authenticate checks the basic auth credentials or the bearer token of a request
+func (a *authenticator) authenticate(r *http.Request) bool {
+	if !a.enabled() {
+		return true
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		return len(a.username) > 0 && equal(username, a.username) && equal(password, a.secret)
+	}
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return false
+	}
+	token := strings.TrimSpace(header[7:])
+	if len(a.username) == 0 && len(a.secret) > 0 && equal(token, a.secret) {
+		return true
+	}
+	if a.jwt != nil {
+		_, err := a.jwt.Verify(token, time.Now())
+		return err == nil
+	}
+	return false
+}
+
+// wrap only passes authenticated requests to next
+func (a *authenticator) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.authenticate(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(a.username) > 0 {
+			// lets browsers ask for the credentials when the UI calls the API
+			w.Header().Set("WWW-Authenticate", `Basic realm="cnfuzz"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cnfuzz"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// equal compares secrets in constant time
+func equal(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/auth"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// authenticated sends a request for the images with header and returns the status of the response
+func authenticated(server *Server, header string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/images", nil)
+	if len(header) > 0 {
+		req.Header.Set("Authorization", header)
+	}
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, req)
+	return resp.Code
+}
+
+func TestBasicAuth(t *testing.T) {
+	t.Setenv("CNFUZZ_TEST_API_SECRET", "secret")
+	server := createTestServer(t, nil)
+	var err error
+	server.auth, err = createAuthenticator(&config.ApiAuthConfig{Username: "admin", SecretEnv: "CNFUZZ_TEST_API_SECRET"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/images", nil)
+	req.SetBasicAuth("admin", "secret")
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req.SetBasicAuth("admin", "wrong")
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, `Basic realm="cnfuzz"`, resp.Header().Get("WWW-Authenticate"))
+
+	// the password isn't accepted as bearer token
+	assert.Equal(t, http.StatusUnauthorized, authenticated(server, "Bearer secret"))
+	// the UI doesn't require authentication
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestBearerAndJwtAuth(t *testing.T) {
+	t.Setenv("CNFUZZ_TEST_API_TOKEN", "token")
+	t.Setenv("CNFUZZ_TEST_API_JWT_KEY", "jwt-key")
+	server := createTestServer(t, nil)
+	var err error
+	server.auth, err = createAuthenticator(&config.ApiAuthConfig{
+		SecretEnv: "CNFUZZ_TEST_API_TOKEN",
+		Jwt:       &config.ApiJwtConfig{Algorithm: auth.HS256, KeyEnv: "CNFUZZ_TEST_API_JWT_KEY"},
+	})
+	require.NoError(t, err)
+
+	tSource, err := auth.JwtTokenSource(auth.JwtOptions{Key: []byte("jwt-key"), Lifetime: time.Minute}, "admin")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	otherSource, err := auth.JwtTokenSource(auth.JwtOptions{Key: []byte("other-key")}, "admin")
+	require.NoError(t, err)
+	otherTok, err := otherSource.Token()
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, authenticated(server, "Bearer token"))
+	assert.Equal(t, http.StatusOK, authenticated(server, "Bearer "+tok.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, authenticated(server, "Bearer "+otherTok.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, authenticated(server, "Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, authenticated(server, ""))
+}
+
+func TestCreateAuthenticator(t *testing.T) {
+	a, err := createAuthenticator(nil)
+	require.NoError(t, err)
+	assert.False(t, a.enabled())
+
+	_, err = createAuthenticator(&config.ApiAuthConfig{Username: "admin"})
+	assert.Error(t, err, "username without password")
+
+	_, err = createAuthenticator(&config.ApiAuthConfig{SecretEnv: "CNFUZZ_TEST_MISSING_SECRET"})
+	assert.Error(t, err, "empty secret")
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/controller"
+	"net/http"
+	"strings"
+)
+
+// Client client of the cnfuzz API
+type Client struct {
+	url      string
+	username string
+	// secret password when username is set, otherwise a bearer token
+	secret string
+	client *http.Client
+}
+
+// CreateClient creates a client for the API at url, username and secret are optional
+func CreateClient(url string, username string, secret string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		url:      strings.TrimSuffix(url, "/"),
+		username: username,
+		secret:   secret,
+		client:   client,
+	}
+}
+
+// Refuzz asks cnfuzz to fuzz an image, a pod or all pods inside a namespace again
+func (c *Client) Refuzz(ctx context.Context, req RefuzzRequest) (controller.RefuzzResult, error) {
+	result := controller.RefuzzResult{}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return result, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+PathPrefix+"refuzz", bytes.NewReader(body))
+	if err != nil {
+		return result, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if len(c.username) > 0 {
+		httpReq.SetBasicAuth(c.username, c.secret)
+	} else if len(c.secret) > 0 {
+		httpReq.Header.Set("Authorization", "Bearer "+c.secret)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		apiErr := errorResponse{}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return result, fmt.Errorf("re-fuzz request failed with status %d: %s", resp.StatusCode, apiErr.Error)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
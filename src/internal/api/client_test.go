@@ -0,0 +1,42 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientRefuzz(t *testing.T) {
+	refuzzer := &fakeRefuzzer{}
+	server := httptest.NewServer(createTestServer(t, refuzzer).Handler())
+	defer server.Close()
+	client := CreateClient(server.URL+"/", "", "", server.Client())
+
+	result, err := client.Refuzz(context.TODO(), RefuzzRequest{Namespace: "default", Pod: "todo-api"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default/todo-api"}, result.Pods)
+	assert.Equal(t, []RefuzzRequest{{Namespace: "default", Pod: "todo-api"}}, refuzzer.requests)
+
+	_, err = client.Refuzz(context.TODO(), RefuzzRequest{Image: "sha256:unknown"})
+	assert.ErrorContains(t, err, "status 404")
+	_, err = client.Refuzz(context.TODO(), RefuzzRequest{})
+	assert.ErrorContains(t, err, "status 400")
+}
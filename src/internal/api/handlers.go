@@ -0,0 +1,342 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/controller"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/report"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Image container image with its fuzz status, where it ran and the result of its last fuzz run
+type Image struct {
+	// Key key of the image in the format <hash type>:<hash>
+	Key           string         `json:"key"`
+	Hash          string         `json:"hash"`
+	HashType      string         `json:"hashType"`
+	Status        string         `json:"status"`
+	Names         []string       `json:"names,omitempty"`
+	FirstSeen     time.Time      `json:"firstSeen"`
+	LastSeen      time.Time      `json:"lastSeen"`
+	Pods          []string       `json:"pods,omitempty"`
+	Namespaces    []string       `json:"namespaces,omitempty"`
+	LastRun       string         `json:"lastRun,omitempty"`
+	LastRunResult string         `json:"lastRunResult,omitempty"`
+	LastRunTime   *time.Time     `json:"lastRunTime,omitempty"`
+	Findings      map[string]int `json:"findings,omitempty"`
+	SpecHash      string         `json:"specHash,omitempty"`
+}
+
+// Run fuzz run of a pod
+type Run struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Status    k8s.FuzzRunStatus `json:"status"`
+}
+
+// RefuzzRequest request to re-fuzz an image, a pod or all pods inside a namespace
+type RefuzzRequest struct {
+	// Image key of the image in the format <hash type>:<hash>
+	Image     string `json:"image,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Pod name of the pod inside Namespace, all pods inside the namespace when empty
+	Pod string `json:"pod,omitempty"`
+}
+
+func toImage(image model.ContainerImage) Image {
+	return Image{
+		Key:           image.Key(),
+		Hash:          image.Hash,
+		HashType:      image.HashType,
+		Status:        image.Status.String(),
+		Names:         image.Names,
+		FirstSeen:     image.FirstSeen,
+		LastSeen:      image.LastSeen,
+		Pods:          image.Pods,
+		Namespaces:    image.Namespaces,
+		LastRun:       image.LastRun,
+		LastRunResult: image.LastRunResult,
+		LastRunTime:   image.LastRunTime,
+		Findings:      image.Findings,
+		SpecHash:      image.SpecHash,
+	}
+}
+
+// listImages GET images?status=<status>
+func (s *Server) listImages(w http.ResponseWriter, r *http.Request) {
+	if !s.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	images, err := s.storage.ContainerImageCache.GetAll(r.Context())
+	if err != nil {
+		s.l.V(logger.ImportantLevel).Error(err, "failed to get images for the API")
+		s.writeError(w, http.StatusInternalServerError, "failed to get images")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	result := make([]Image, 0, len(images))
+	for _, image := range images {
+		if len(status) > 0 && image.Status.String() != status {
+			continue
+		}
+		result = append(result, toImage(*image))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	s.writeJson(w, http.StatusOK, result)
+}
+
+// image GET images/<key> and POST images/<key>/refuzz
+func (s *Server) image(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, PathPrefix+"images/")
+	refuzz := strings.HasSuffix(key, "/refuzz")
+	key = strings.TrimSuffix(key, "/refuzz")
+	if strings.Contains(key, "/") || !strings.Contains(key, ":") {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if refuzz {
+		if s.allowMethods(w, r, http.MethodPost) {
+			result, err := s.refuzz.RefuzzImage(r.Context(), key)
+			s.writeRefuzzResult(w, result, err)
+		}
+		return
+	}
+	if !s.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	image, found, err := s.storage.ContainerImageCache.GetByKey(r.Context(), key)
+	if err != nil {
+		s.l.V(logger.ImportantLevel).Error(err, "failed to get image for the API", "image", key)
+		s.writeError(w, http.StatusInternalServerError, "failed to get image")
+		return
+	}
+	if !found {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("image %s is unknown", key))
+		return
+	}
+	s.writeJson(w, http.StatusOK, toImage(*image))
+}
+
+// refuzzRequest POST refuzz with a RefuzzRequest
+func (s *Server) refuzzRequest(w http.ResponseWriter, r *http.Request) {
+	if !s.allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	req := RefuzzRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid re-fuzz request: "+err.Error())
+		return
+	}
+	var result controller.RefuzzResult
+	var err error
+	switch {
+	case len(req.Image) > 0:
+		result, err = s.refuzz.RefuzzImage(r.Context(), req.Image)
+	case len(req.Namespace) > 0:
+		result, err = s.refuzz.RefuzzPods(r.Context(), req.Namespace, req.Pod)
+	default:
+		s.writeError(w, http.StatusBadRequest, "re-fuzz request needs an image or a namespace")
+		return
+	}
+	s.writeRefuzzResult(w, result, err)
+}
+
+// writeRefuzzResult writes the result of a re-fuzz
+func (s *Server) writeRefuzzResult(w http.ResponseWriter, result controller.RefuzzResult, err error) {
+	if errors.Is(err, controller.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		s.l.V(logger.ImportantLevel).Error(err, "failed to re-fuzz")
+		s.writeError(w, http.StatusInternalServerError, "failed to re-fuzz")
+		return
+	}
+	s.writeJson(w, http.StatusAccepted, result)
+}
+
+// listRuns GET runs?namespace=<namespace>&pod=<pod>
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	if !s.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	selector := k8s.FuzzRunLabel
+	if pod := r.URL.Query().Get("pod"); len(pod) > 0 {
+		// the name ends up inside the label selector, so it can't be anything else than a label value
+		if errs := validation.IsValidLabelValue(pod); len(errs) > 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid pod name %q: %s", pod, strings.Join(errs, ", ")))
+			return
+		}
+		selector = fmt.Sprintf("%s,%s=%s", selector, k8s.FuzzRunPodLabel, pod)
+	}
+	list, err := s.client.CoreV1().ConfigMaps(r.URL.Query().Get("namespace")).List(r.Context(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		s.l.V(logger.ImportantLevel).Error(err, "failed to list fuzz runs for the API")
+		s.writeError(w, http.StatusInternalServerError, "failed to list fuzz runs")
+		return
+	}
+	runs := make([]Run, 0, len(list.Items))
+	for i := range list.Items {
+		run, err := toRun(&list.Items[i])
+		if err != nil {
+			s.l.V(logger.DebugLevel).Error(err, "ignoring fuzz run with invalid status", "fuzzRun", list.Items[i].Name)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	// most recent runs first
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Status.StartTime.After(runs[j].Status.StartTime)
+	})
+	s.writeJson(w, http.StatusOK, runs)
+}
+
+// run GET runs/<namespace>/<name>, GET runs/<namespace>/<name>/findings and GET runs/<namespace>/<name>/report?format=<markdown|html>
+func (s *Server) run(w http.ResponseWriter, r *http.Request) {
+	if !s.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, PathPrefix+"runs/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || len(parts) == 3 && parts[2] != "findings" && parts[2] != "report" {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	cm, err := s.client.CoreV1().ConfigMaps(parts[0]).Get(r.Context(), parts[1], metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) || err == nil && len(cm.Labels[k8s.FuzzRunLabel]) == 0 {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("fuzz run %s/%s doesn't exist", parts[0], parts[1]))
+		return
+	} else if err != nil {
+		s.l.V(logger.ImportantLevel).Error(err, "failed to get fuzz run for the API", "fuzzRun", parts[1], "namespace", parts[0])
+		s.writeError(w, http.StatusInternalServerError, "failed to get fuzz run")
+		return
+	}
+
+	if len(parts) == 3 && parts[2] == "report" {
+		s.writeReport(w, r, cm)
+		return
+	}
+	if len(parts) == 3 {
+		runFindings, err := controller.GetFuzzRunFindings(cm)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if runFindings == nil {
+			runFindings = []findings.Finding{}
+		}
+		s.writeJson(w, http.StatusOK, runFindings)
+		return
+	}
+	run, err := toRun(cm)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJson(w, http.StatusOK, run)
+}
+
+// writeReport renders the run report of a completed fuzz run as Markdown, or as HTML when the format query parameter is html
+func (s *Server) writeReport(w http.ResponseWriter, r *http.Request, cm *apiv1.ConfigMap) {
+	runReport, err := controller.GetFuzzRunReport(cm)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if runReport == nil {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("fuzz run %s/%s has no report", cm.Namespace, cm.Name))
+		return
+	}
+	contentType := "text/markdown; charset=utf-8"
+	write := report.WriteMarkdownReport
+	switch r.URL.Query().Get("format") {
+	case "", "markdown":
+	case "html":
+		contentType = "text/html; charset=utf-8"
+		write = report.WriteHtmlReport
+	default:
+		s.writeError(w, http.StatusBadRequest, "report format has to be markdown or html")
+		return
+	}
+	// the report is rendered before writing the response, so a failure still gets an error response
+	body := &bytes.Buffer{}
+	if err := write(body, *runReport); err != nil {
+		s.l.V(logger.ImportantLevel).Error(err, "failed to render report for the API", "fuzzRun", cm.Name, "namespace", cm.Namespace)
+		s.writeError(w, http.StatusInternalServerError, "failed to render report")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := body.WriteTo(w); err != nil {
+		s.l.V(logger.DebugLevel).Error(err, "failed to write API response")
+	}
+}
+
+// listFindings GET findings?target=<namespace>/<name>&status=<open|fixed>
+func (s *Server) listFindings(w http.ResponseWriter, r *http.Request) {
+	if !s.allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	var records []findings.Record
+	var err error
+	if target := r.URL.Query().Get("target"); len(target) > 0 {
+		records, err = s.storage.FindingsStore.GetByTarget(r.Context(), target)
+	} else {
+		records, err = s.storage.FindingsStore.GetAll(r.Context())
+	}
+	if err != nil {
+		s.l.V(logger.ImportantLevel).Error(err, "failed to get findings for the API")
+		s.writeError(w, http.StatusInternalServerError, "failed to get findings")
+		return
+	}
+	status := findings.RecordStatus(r.URL.Query().Get("status"))
+	result := make([]findings.Record, 0, len(records))
+	for _, record := range records {
+		if len(status) == 0 || record.Status == status {
+			result = append(result, record)
+		}
+	}
+	s.writeJson(w, http.StatusOK, result)
+}
+
+func toRun(cm *apiv1.ConfigMap) (Run, error) {
+	status, err := k8s.GetFuzzRunStatus(cm)
+	if err != nil {
+		return Run{}, err
+	}
+	return Run{
+		Name:      cm.Name,
+		Namespace: cm.Namespace,
+		Status:    status,
+	}, nil
+}
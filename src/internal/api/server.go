@@ -0,0 +1,140 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package api serves a read-only REST API and a web UI with the images, fuzz runs and findings known to the controller
+package api
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"github.com/suecodelabs/cnfuzz/src/internal/controller"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"io/fs"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	"strings"
+)
+
+// DefaultAddress address the API listens on when no address is configured
+const DefaultAddress = ":8081"
+
+// PathPrefix prefix of all API endpoints
+const PathPrefix = "/api/v1/"
+
+//go:embed ui
+var uiFiles embed.FS
+
+// Refuzzer resets fuzzed images and fuzzes their pods again
+type Refuzzer interface {
+	RefuzzImage(ctx context.Context, key string) (controller.RefuzzResult, error)
+	// RefuzzPods re-fuzzes a pod, or all pods inside the namespace when name is empty
+	RefuzzPods(ctx context.Context, namespace string, name string) (controller.RefuzzResult, error)
+}
+
+// Server serves the API and the web UI
+type Server struct {
+	l       logger.Logger
+	client  kubernetes.Interface
+	storage *persistence.Storage
+	refuzz  Refuzzer
+	auth    *authenticator
+}
+
+// CreateServer creates the API server, refuzz handles the re-fuzz requests
+func CreateServer(l logger.Logger, client kubernetes.Interface, storage *persistence.Storage, cnf *config.ApiConfig, refuzz Refuzzer) (*Server, error) {
+	var authCnf *config.ApiAuthConfig
+	if cnf != nil {
+		authCnf = cnf.Auth
+	}
+	auth, err := createAuthenticator(authCnf)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.enabled() {
+		l.V(logger.ImportantLevel).Info("API doesn't require authentication")
+	}
+	return &Server{
+		l:       l,
+		client:  client,
+		storage: storage,
+		refuzz:  refuzz,
+		auth:    auth,
+	}, nil
+}
+
+// Handler returns the handler of the API and the web UI
+// the static files of the UI don't contain any data, so only the API requires authentication
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc(PathPrefix+"images", s.listImages)
+	api.HandleFunc(PathPrefix+"images/", s.image)
+	api.HandleFunc(PathPrefix+"runs", s.listRuns)
+	api.HandleFunc(PathPrefix+"runs/", s.run)
+	api.HandleFunc(PathPrefix+"findings", s.listFindings)
+	api.HandleFunc(PathPrefix+"refuzz", s.refuzzRequest)
+
+	ui, _ := fs.Sub(uiFiles, "ui")
+	mux := http.NewServeMux()
+	mux.Handle(PathPrefix, s.auth.wrap(api))
+	mux.Handle("/", http.FileServer(http.FS(ui)))
+	return mux
+}
+
+// Serv starts the API server on address
+// warning: this function is blocking
+func (s *Server) Serv(address string) {
+	if len(address) == 0 {
+		address = DefaultAddress
+	}
+	s.l.V(logger.InfoLevel).Info("starting API server", "address", address)
+	if err := http.ListenAndServe(address, s.Handler()); err != nil {
+		s.l.FatalError(err, "failed to start webserver for the API")
+	}
+}
+
+// errorResponse body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJson writes obj as JSON response
+func (s *Server) writeJson(w http.ResponseWriter, status int, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		s.l.V(logger.DebugLevel).Error(err, "failed to write API response")
+	}
+}
+
+// writeError writes an error response
+func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+	s.writeJson(w, status, errorResponse{Error: message})
+}
+
+// allowMethods checks if the method of the request is allowed and writes an error response when it isn't
+func (s *Server) allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	s.writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" isn't allowed")
+	return false
+}
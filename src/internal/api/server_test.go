@@ -0,0 +1,230 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/controller"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/internal/report"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testImageHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+// createTestServer creates a server with a fuzzed image, a completed fuzz run with its report and its finding
+func createTestServer(t *testing.T, refuzz Refuzzer) *Server {
+	l := logger.CreateDebugLogger()
+	ctx := context.TODO()
+	storage := persistence.InitMemoryCache(l)
+	image, _ := model.CreateContainerImage(testImageHash, "sha256", model.Fuzzed)
+	require.NoError(t, storage.ContainerImageCache.Create(ctx, image))
+
+	client := fake.NewSimpleClientset()
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default", Labels: map[string]string{"app": "todo"}},
+		Status: apiv1.PodStatus{ContainerStatuses: []apiv1.ContainerStatus{
+			{Name: "api", ImageID: "docker-pullable://localhost:5000/todo-api@sha256:" + testImageHash},
+		}},
+	}
+	run, err := k8s.CreateFuzzRun(ctx, l, client, pod, "cnfuzz-job-todo-api", "default", k8s.FuzzJobOptions{})
+	require.NoError(t, err)
+	found := []findings.Finding{{Checker: "main_driver", Severity: findings.MediumSeverity, StatusCode: "500", Method: "GET", Endpoint: "/todo"}}
+	data, err := json.Marshal(found)
+	require.NoError(t, err)
+	reportData, err := json.Marshal(report.RunReport{PodName: "todo-api", Namespace: "default", ApiTitle: "Todo API"})
+	require.NoError(t, err)
+	err = k8s.CompleteFuzzRun(ctx, l, client, "default", run.Name, data, reportData, func(status *k8s.FuzzRunStatus) {
+		status.Reports = report.ReportLocations("default", run.Name)
+	})
+	require.NoError(t, err)
+	_, err = persistence.RecordFindings(ctx, storage.FindingsStore, findings.Run{Target: "default/todo", Images: []string{"sha256:" + testImageHash}}, found)
+	require.NoError(t, err)
+
+	server, err := CreateServer(l, client, storage, nil, refuzz)
+	require.NoError(t, err)
+	return server
+}
+
+// fakeRefuzzer records the re-fuzz requests
+type fakeRefuzzer struct {
+	requests []RefuzzRequest
+}
+
+func (r *fakeRefuzzer) RefuzzImage(_ context.Context, key string) (controller.RefuzzResult, error) {
+	r.requests = append(r.requests, RefuzzRequest{Image: key})
+	if key != "sha256:"+testImageHash {
+		return controller.RefuzzResult{}, fmt.Errorf("image %s: %w", key, controller.ErrNotFound)
+	}
+	return controller.RefuzzResult{Images: []string{key}, Pods: []string{"default/todo-api"}}, nil
+}
+
+func (r *fakeRefuzzer) RefuzzPods(_ context.Context, namespace string, name string) (controller.RefuzzResult, error) {
+	r.requests = append(r.requests, RefuzzRequest{Namespace: namespace, Pod: name})
+	return controller.RefuzzResult{Images: []string{"sha256:" + testImageHash}, Pods: []string{namespace + "/todo-api"}}, nil
+}
+
+// get sends a request to the server and decodes the JSON response into out
+func get(t *testing.T, server *Server, method string, path string, out any) int {
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(method, path, nil))
+	if out != nil && resp.Code < 300 {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.Code
+}
+
+func TestImages(t *testing.T) {
+	server := createTestServer(t, nil)
+	key := "sha256:" + testImageHash
+
+	var images []Image
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/images", &images))
+	assert.Equal(t, []Image{{Key: key, Hash: testImageHash, HashType: "sha256", Status: "fuzzed"}}, images)
+
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/images?status=not_fuzzed", &images))
+	assert.Empty(t, images)
+
+	image := Image{}
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/images/"+key, &image))
+	assert.Equal(t, key, image.Key)
+
+	assert.Equal(t, http.StatusNotFound, get(t, server, http.MethodGet, "/api/v1/images/sha256:unknown", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, get(t, server, http.MethodDelete, "/api/v1/images/"+key, nil))
+}
+
+func TestRefuzz(t *testing.T) {
+	refuzzer := &fakeRefuzzer{}
+	server := createTestServer(t, refuzzer)
+	key := "sha256:" + testImageHash
+
+	assert.Equal(t, http.StatusMethodNotAllowed, get(t, server, http.MethodGet, "/api/v1/images/"+key+"/refuzz", nil))
+
+	result := controller.RefuzzResult{}
+	assert.Equal(t, http.StatusAccepted, get(t, server, http.MethodPost, "/api/v1/images/"+key+"/refuzz", &result))
+	assert.Equal(t, []string{key}, result.Images)
+	assert.Equal(t, []string{"default/todo-api"}, result.Pods)
+	assert.Equal(t, http.StatusNotFound, get(t, server, http.MethodPost, "/api/v1/images/sha256:unknown/refuzz", nil))
+
+	post := func(body string) int {
+		resp := httptest.NewRecorder()
+		server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/api/v1/refuzz", strings.NewReader(body)))
+		return resp.Code
+	}
+	assert.Equal(t, http.StatusAccepted, post(`{"namespace": "default", "pod": "todo-api"}`))
+	assert.Equal(t, http.StatusAccepted, post(`{"namespace": "default"}`))
+	assert.Equal(t, http.StatusAccepted, post(`{"image": "`+key+`"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{}`))
+	assert.Equal(t, http.StatusBadRequest, post(`not json`))
+	assert.Equal(t, []RefuzzRequest{
+		{Image: key},
+		{Image: "sha256:unknown"},
+		{Namespace: "default", Pod: "todo-api"},
+		{Namespace: "default"},
+		{Image: key},
+	}, refuzzer.requests)
+}
+
+func TestRuns(t *testing.T) {
+	server := createTestServer(t, nil)
+
+	var runs []Run
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/runs", &runs))
+	require.Len(t, runs, 1)
+	assert.Equal(t, "cnfuzz-run-todo-api", runs[0].Name)
+	assert.Equal(t, k8s.FuzzRunCompleted, runs[0].Status.Phase)
+	assert.Equal(t, "default/todo", runs[0].Status.Target)
+
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/runs?namespace=default&pod=todo-api", &runs))
+	assert.Len(t, runs, 1)
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/runs?namespace=other", &runs))
+	assert.Empty(t, runs)
+	// the pod name can't change the label selector
+	assert.Equal(t, http.StatusBadRequest, get(t, server, http.MethodGet, "/api/v1/runs?pod=todo-api,cnfuzz/pod!=todo-api", nil))
+
+	run := Run{}
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/runs/default/cnfuzz-run-todo-api", &run))
+	assert.Equal(t, "todo-api", run.Status.Pod)
+
+	var runFindings []findings.Finding
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/runs/default/cnfuzz-run-todo-api/findings", &runFindings))
+	require.Len(t, runFindings, 1)
+	assert.Equal(t, "main_driver", runFindings[0].Checker)
+
+	assert.Equal(t, http.StatusNotFound, get(t, server, http.MethodGet, "/api/v1/runs/default/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, get(t, server, http.MethodGet, "/api/v1/runs/default/cnfuzz-run-todo-api/reports", nil))
+}
+
+func TestRunReport(t *testing.T) {
+	server := createTestServer(t, nil)
+
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/runs/default/cnfuzz-run-todo-api/report", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/markdown; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Body.String(), "Todo API")
+	assert.Contains(t, resp.Body.String(), "main_driver")
+
+	resp = httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/runs/default/cnfuzz-run-todo-api/report?format=html", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Body.String(), "<html")
+	assert.Contains(t, resp.Body.String(), "main_driver")
+
+	assert.Equal(t, http.StatusBadRequest, get(t, server, http.MethodGet, "/api/v1/runs/default/cnfuzz-run-todo-api/report?format=pdf", nil))
+	assert.Equal(t, http.StatusNotFound, get(t, server, http.MethodGet, "/api/v1/runs/default/unknown/report", nil))
+}
+
+func TestFindings(t *testing.T) {
+	server := createTestServer(t, nil)
+
+	var records []findings.Record
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/findings", &records))
+	require.Len(t, records, 1)
+	assert.Equal(t, "default/todo", records[0].Target)
+
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/findings?target=default/todo&status=open", &records))
+	assert.Len(t, records, 1)
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/findings?status=fixed", &records))
+	assert.Empty(t, records)
+	assert.Equal(t, http.StatusOK, get(t, server, http.MethodGet, "/api/v1/findings?target=default/other", &records))
+	assert.Empty(t, records)
+}
+
+func TestUi(t *testing.T) {
+	server := createTestServer(t, nil)
+
+	resp := httptest.NewRecorder()
+	server.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.True(t, strings.Contains(resp.Body.String(), "<title>cnfuzz</title>"))
+}
@@ -18,6 +18,7 @@ package api_info
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/suecodelabs/cnfuzz/src/pkg/auth"
 	"github.com/suecodelabs/cnfuzz/src/pkg/config"
@@ -25,23 +26,42 @@ import (
 	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/openapi"
 	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 )
 
 // TargetInfo info about a target pod for fuzzing.
 type TargetInfo struct {
+	Pod            *corev1.Pod
 	TargetAddr     string
 	Annos          k8s.Annotations
 	ApiDesc        *discovery.WebApiDescription
 	UnparsedApiDoc openapi.UnParsedOpenApiDoc
-	TokenSource    auth.ITokenSource
+	TokenSources   auth.TokenSources
+	// Identities token sources for extra identities, used to find authorization bugs between identities
+	Identities []auth.IdentityTokenSources
+}
+
+// AuthSettings auth settings passed to the restlerwrapper, the annotations of the target pod take precedence over these
+type AuthSettings struct {
+	// PreferredScheme key of the preferred security scheme
+	PreferredScheme string
+	// JwtKey signing key of JWTs, the job reads it from the secret of the jwt-key-secret annotation or of the config
+	JwtKey       string
+	JwtKeyId     string
+	JwtAlgorithm string
+	JwtClaims    string
+	JwtLifetime  string
 }
 
 // CollectInfo collects info from target pod.
 // returns TargetInfo.
-func CollectInfo(l logger.Logger, targetPodName, targetNamespace, dDocIp string, dDocLoc string, ports []int32) TargetInfo {
+func CollectInfo(l logger.Logger, targetPodName, targetNamespace, dDocIp string, dDocLoc string, ports []int32, authSettings AuthSettings) TargetInfo {
 	l.V(logger.DebugLevel).Info("getting pod info")
 	pod := GetPod(l, targetPodName, targetNamespace, config.RunCnf.LocalK8sConfig)
 	targetAddr := fmt.Sprintf("%s.%s.pod", strings.ReplaceAll(pod.Status.PodIP, ".", "-"), pod.Namespace)
@@ -64,15 +84,26 @@ func CollectInfo(l logger.Logger, targetPodName, targetNamespace, dDocIp string,
 	apiDoc, apiDesc := GetOpenApiDoc(l, oAAddr, ports, oaLocs)
 	l.V(logger.DebugLevel).Info("found OpenApi document")
 
-	l.V(logger.DebugLevel).Info("creating auth token source from pod annotations and OpenApi document")
-	tokenSource := CreateTokenSource(l, apiDesc, annos.Username, annos.Secret)
+	l.V(logger.DebugLevel).Info("creating auth token sources from pod annotations and OpenApi document")
+	authScheme := authSettings.PreferredScheme
+	if len(annos.AuthScheme) > 0 {
+		authScheme = annos.AuthScheme
+	}
+	authOpts, err := CreateAuthOptions(annos, authSettings, apiDesc)
+	if err != nil {
+		l.FatalError(err, "invalid auth options")
+	}
+	tokenSources := CreateTokenSources(l, apiDesc, CreateCredentialSet(annos), authScheme, authOpts)
+	identities := auth.CreateIdentityTokenSources(l, apiDesc.SecuritySchemes, CreateIdentities(annos), authScheme, authOpts)
 
 	return TargetInfo{
+		Pod:            pod,
 		TargetAddr:     targetAddr,
 		Annos:          annos,
 		ApiDesc:        apiDesc,
 		UnparsedApiDoc: apiDoc,
-		TokenSource:    tokenSource,
+		TokenSources:   tokenSources,
+		Identities:     identities,
 	}
 }
 
@@ -108,14 +139,187 @@ func GetOpenApiDoc(l logger.Logger, host string, ports []int32, oaLocs []string)
 	return apiDoc, apiDesc
 }
 
-// CreateTokenSource creates a auth.ITokenSource from a discovery.WebApiDescription, username and secret.
-// auth.ITokenSource that this function returns can be nil. This happens when the API doesn't have any security info specified.
-func CreateTokenSource(l logger.Logger, apiDesc *discovery.WebApiDescription, username, secret string) auth.ITokenSource {
-	// Tokensource can be nil !!! this means the API doesn't have any security (specified in the discovery doc ...)
-	tokenSource, authErr := auth.CreateTokenSourceFromSchemas(l, apiDesc.SecuritySchemes, username, secret) // TODO cnf.AuthConfig.Username, cnf.AuthConfig.Secret)
-	if authErr != nil {
-		l.FatalError(authErr, "error while building auth token source")
+// CreateCredentialSet creates an auth.CredentialSet from the credentials inside the pod annotations.
+func CreateCredentialSet(annos k8s.Annotations) auth.CredentialSet {
+	return createCredentialSet(annos.Username, annos.Secret, annos.SchemeUsernames, annos.SchemeSecrets)
+}
+
+// CreateIdentities creates an auth.Identity for every extra identity inside the pod annotations, ordered by name.
+func CreateIdentities(annos k8s.Annotations) []auth.Identity {
+	names := make([]string, 0, len(annos.Identities))
+	for name := range annos.Identities {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	return tokenSource
+	identities := make([]auth.Identity, 0, len(names))
+	for _, name := range names {
+		identityAnnos := annos.Identities[name]
+		identities = append(identities, auth.Identity{
+			Name:        name,
+			Credentials: createCredentialSet(identityAnnos.Username, identityAnnos.Secret, identityAnnos.SchemeUsernames, identityAnnos.SchemeSecrets),
+		})
+	}
+	return identities
+}
+
+// createCredentialSet creates an auth.CredentialSet from default credentials and scheme specific usernames and secrets
+func createCredentialSet(username string, secret string, schemeUsernames map[string]string, schemeSecrets map[string]string) auth.CredentialSet {
+	creds := auth.CredentialSet{
+		Default: auth.Credentials{
+			Username: username,
+			Secret:   secret,
+		},
+		Schemes: make(map[string]auth.Credentials),
+	}
+	for key, secret := range schemeSecrets {
+		schemeCreds := creds.Schemes[key]
+		schemeCreds.Secret = secret
+		creds.Schemes[key] = schemeCreds
+	}
+	for key, username := range schemeUsernames {
+		schemeCreds := creds.Schemes[key]
+		schemeCreds.Username = username
+		creds.Schemes[key] = schemeCreds
+	}
+	return creds
+}
+
+// CreateAuthOptions creates auth.Options from the pod annotations, the AuthSettings and the login operation of the API.
+// JWTs are only minted when a signing key is available.
+func CreateAuthOptions(annos k8s.Annotations, settings AuthSettings, apiDesc *discovery.WebApiDescription) (auth.Options, error) {
+	loginOpts, err := CreateLoginOptions(annos, apiDesc)
+	if err != nil {
+		return auth.Options{}, err
+	}
+	opts := auth.Options{
+		Login: loginOpts,
+		OpenIdConnect: auth.OpenIdConnectOptions{
+			GrantType:    annos.Oidc.GrantType,
+			ClientId:     annos.Oidc.ClientId,
+			ClientSecret: annos.Oidc.ClientSecret,
+			Scopes:       annos.Oidc.Scopes,
+		},
+	}
+
+	// the fuzz job gets the key from the secret of the annotations or the config, it is never read from an annotation
+	key := settings.JwtKey
+	if len(key) == 0 {
+		return opts, nil
+	}
+	jwtOpts := &auth.JwtOptions{
+		Algorithm: firstNonEmpty(annos.Jwt.Algorithm, settings.JwtAlgorithm),
+		Key:       []byte(key),
+		KeyId:     firstNonEmpty(annos.Jwt.KeyId, settings.JwtKeyId),
+		Claims:    firstNonEmpty(annos.Jwt.Claims, settings.JwtClaims),
+	}
+	if lifetime := firstNonEmpty(annos.Jwt.Lifetime, settings.JwtLifetime); len(lifetime) > 0 {
+		parsed, err := time.ParseDuration(lifetime)
+		if err != nil {
+			return opts, fmt.Errorf("JWT lifetime '%s' is invalid: %w", lifetime, err)
+		}
+		jwtOpts.Lifetime = parsed
+	}
+	opts.Jwt = jwtOpts
+	return opts, nil
+}
+
+// CreateLoginOptions creates auth.LoginOptions for the login endpoint of the API.
+// The login operation marked inside the OpenAPI doc is overridden by the login YAML annotation,
+// which in turn is overridden by the separate login annotations. Relative login URLs are resolved against the API.
+// Returns nil when no login endpoint is configured.
+func CreateLoginOptions(annos k8s.Annotations, apiDesc *discovery.WebApiDescription) (*auth.LoginOptions, error) {
+	opts := auth.LoginOptions{}
+	configured := false
+	if endpoint := apiDesc.LoginEndpoint(); endpoint != nil {
+		configured = true
+		mergeLoginOptions(&opts, auth.LoginOptions{
+			Method:      endpoint.Method,
+			Url:         apiDesc.BasePath + endpoint.Path,
+			Body:        endpoint.Login.Body,
+			ContentType: endpoint.Login.ContentType,
+			TokenPath:   endpoint.Login.TokenPath,
+			TokenRegex:  endpoint.Login.TokenRegex,
+			ExpiryPath:  endpoint.Login.ExpiryPath,
+			ExpiryRegex: endpoint.Login.ExpiryRegex,
+			TokenType:   endpoint.Login.TokenType,
+		})
+	}
+	if len(annos.Login.Config) > 0 {
+		configured = true
+		yamlOpts := auth.LoginOptions{}
+		if err := yaml.Unmarshal([]byte(annos.Login.Config), &yamlOpts); err != nil {
+			return nil, fmt.Errorf("failed to parse the %s annotation: %w", k8s.LoginAnno, err)
+		}
+		mergeLoginOptions(&opts, yamlOpts)
+	}
+	loginAnnos := annos.Login
+	loginAnnos.Config = ""
+	if loginAnnos != (k8s.LoginAnnotations{}) {
+		configured = true
+		mergeLoginOptions(&opts, auth.LoginOptions{
+			Method:      loginAnnos.Method,
+			Url:         loginAnnos.Url,
+			Body:        loginAnnos.Body,
+			ContentType: loginAnnos.ContentType,
+			TokenPath:   loginAnnos.TokenPath,
+			TokenRegex:  loginAnnos.TokenRegex,
+			ExpiryPath:  loginAnnos.ExpiryPath,
+			ExpiryRegex: loginAnnos.ExpiryRegex,
+			TokenType:   loginAnnos.TokenType,
+		})
+	}
+
+	if !configured {
+		return nil, nil
+	}
+	if len(opts.Url) == 0 {
+		return nil, errors.New("login options are configured, but the login URL is missing")
+	}
+	loginUrl, err := url.Parse(opts.Url)
+	if err != nil {
+		return nil, fmt.Errorf("login URL '%s' is invalid: %w", opts.Url, err)
+	}
+	base := url.URL{Scheme: apiDesc.DiscoveryDoc.Scheme, Host: apiDesc.DiscoveryDoc.Host}
+	opts.Url = base.ResolveReference(loginUrl).String()
+	return &opts, nil
+}
+
+// mergeLoginOptions overrides the options in dst with the options that are set in src
+func mergeLoginOptions(dst *auth.LoginOptions, src auth.LoginOptions) {
+	dst.Method = firstNonEmpty(src.Method, dst.Method)
+	dst.Url = firstNonEmpty(src.Url, dst.Url)
+	dst.Body = firstNonEmpty(src.Body, dst.Body)
+	dst.ContentType = firstNonEmpty(src.ContentType, dst.ContentType)
+	dst.TokenPath = firstNonEmpty(src.TokenPath, dst.TokenPath)
+	dst.TokenRegex = firstNonEmpty(src.TokenRegex, dst.TokenRegex)
+	dst.ExpiryPath = firstNonEmpty(src.ExpiryPath, dst.ExpiryPath)
+	dst.ExpiryRegex = firstNonEmpty(src.ExpiryRegex, dst.ExpiryRegex)
+	dst.TokenType = firstNonEmpty(src.TokenType, dst.TokenType)
+	for key, value := range src.Headers {
+		if dst.Headers == nil {
+			dst.Headers = make(map[string]string)
+		}
+		dst.Headers[key] = value
+	}
+}
+
+// firstNonEmpty returns the first value that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+// CreateTokenSources creates auth.TokenSources from a discovery.WebApiDescription and a set of credentials.
+// auth.TokenSources that this function returns can be empty. This happens when the API doesn't have any security info specified.
+func CreateTokenSources(l logger.Logger, apiDesc *discovery.WebApiDescription, creds auth.CredentialSet, preferredScheme string, opts auth.Options) auth.TokenSources {
+	tokenSources := auth.CreateTokenSources(l, apiDesc.SecuritySchemes, creds, preferredScheme, opts)
+	if tokenSources.IsEmpty() && len(apiDesc.SecuritySchemes) > 0 {
+		l.V(logger.ImportantLevel).Info("API has security schemes, but no token source could be created for any of them")
+	}
+	return tokenSources
 }
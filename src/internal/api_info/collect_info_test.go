@@ -0,0 +1,91 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api_info
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/auth"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"net/url"
+	"testing"
+)
+
+func createLoginApiDesc(login *discovery.LoginOperation) *discovery.WebApiDescription {
+	docUrl, _ := url.Parse("http://10-0-0-1.default.pod:8080/swagger/doc.json")
+	return &discovery.WebApiDescription{
+		DiscoveryDoc: *docUrl,
+		BasePath:     "/api",
+		Endpoints: []discovery.Endpoint{
+			{Path: "/todo", Method: "GET"},
+			{Path: "/login", Method: "POST", Login: login},
+		},
+	}
+}
+
+func TestCreateLoginOptionsNone(t *testing.T) {
+	opts, err := CreateLoginOptions(k8s.Annotations{}, createLoginApiDesc(nil))
+	assert.NoError(t, err)
+	assert.Nil(t, opts)
+}
+
+func TestCreateLoginOptionsFromSpec(t *testing.T) {
+	opts, err := CreateLoginOptions(k8s.Annotations{}, createLoginApiDesc(&discovery.LoginOperation{TokenPath: "$.token"}))
+	require.NoError(t, err)
+	assert.Equal(t, &auth.LoginOptions{
+		Method:    "POST",
+		Url:       "http://10-0-0-1.default.pod:8080/api/login",
+		TokenPath: "$.token",
+	}, opts)
+}
+
+func TestCreateLoginOptionsOverrides(t *testing.T) {
+	annos := k8s.Annotations{
+		Login: k8s.LoginAnnotations{
+			Config: `
+url: /auth/login
+token_path: $.data.token
+headers:
+  X-Client: cnfuzz
+`,
+			TokenPath: "$.access",
+		},
+	}
+	opts, err := CreateLoginOptions(annos, createLoginApiDesc(&discovery.LoginOperation{TokenType: "raw"}))
+	require.NoError(t, err)
+	assert.Equal(t, &auth.LoginOptions{
+		Method:    "POST",
+		Url:       "http://10-0-0-1.default.pod:8080/auth/login",
+		TokenPath: "$.access",
+		TokenType: "raw",
+		Headers:   map[string]string{"X-Client": "cnfuzz"},
+	}, opts)
+
+	annos.Login.Url = "https://login.example.com/token"
+	opts, err = CreateLoginOptions(annos, createLoginApiDesc(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "https://login.example.com/token", opts.Url)
+}
+
+func TestCreateLoginOptionsInvalid(t *testing.T) {
+	_, err := CreateLoginOptions(k8s.Annotations{Login: k8s.LoginAnnotations{TokenPath: "$.token"}}, createLoginApiDesc(nil))
+	assert.Error(t, err, "missing url")
+
+	_, err = CreateLoginOptions(k8s.Annotations{Login: k8s.LoginAnnotations{Config: "url: [unclosed"}}, createLoginApiDesc(nil))
+	assert.Error(t, err, "invalid yaml")
+}
@@ -19,7 +19,9 @@ package controller
 import (
 	"context"
 	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/issues"
 	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/notify"
 	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
 	"github.com/suecodelabs/cnfuzz/src/pkg/config"
 	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
@@ -30,6 +32,7 @@ import (
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"net/http"
 	"time"
 )
 
@@ -42,10 +45,22 @@ type controller struct {
 	config     *config.CnFuzzConfig
 	overwrites config.DDocOverwrites
 	handleFunc func(l logger.Logger, clientSet kubernetes.Interface, storage *persistence.Storage, config *config.CnFuzzConfig, overwrites config.DDocOverwrites, pod *apiv1.Pod)
+	runFunc    func(l logger.Logger, clientSet kubernetes.Interface, storage *persistence.Storage, notifier *notify.Dispatcher, issueSyncer *issues.Syncer, run *apiv1.ConfigMap)
+	notifier   *notify.Dispatcher
+	issues     *issues.Syncer
 }
 
 // NewController is used to create an instance of controller.
 func NewController(l logger.Logger, client kubernetes.Interface, storage *persistence.Storage, config *config.CnFuzzConfig, overwrites config.DDocOverwrites) *controller {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	notifier, err := notify.CreateDispatcher(config.Notifications, httpClient)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to create notifiers, notifications are disabled")
+	}
+	issueSyncer, err := issues.CreateSyncerFromConfig(config.IssuesConfig, httpClient)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to create issue trackers, issues are disabled")
+	}
 	return &controller{
 		log:        l,
 		client:     client,
@@ -53,6 +68,9 @@ func NewController(l logger.Logger, client kubernetes.Interface, storage *persis
 		config:     config,
 		overwrites: overwrites,
 		handleFunc: handlePodEvent,
+		runFunc:    handleFuzzRun,
+		notifier:   notifier,
+		issues:     issueSyncer,
 	}
 }
 
@@ -60,6 +78,10 @@ func (c controller) handleEvent(pod *apiv1.Pod) {
 	c.handleFunc(c.log, c.client, c.storage, c.config, c.overwrites, pod)
 }
 
+func (c controller) handleRunEvent(run *apiv1.ConfigMap) {
+	c.runFunc(c.log, c.client, c.storage, c.notifier, c.issues, run)
+}
+
 // StartController start informers that listen for Kubernetes events and let the EventHandler react on the events.
 func StartController(l logger.Logger, storage *persistence.Storage, config *config.CnFuzzConfig, overwrites config.DDocOverwrites, client kubernetes.Interface) (err error) {
 	myEventHandler := NewController(l, client, storage, config, overwrites)
@@ -68,12 +90,38 @@ func StartController(l logger.Logger, storage *persistence.Storage, config *conf
 	podInformer := factory.Core().V1().Pods().Informer()
 	podInformer.AddEventHandler(myEventHandler)
 
+	// only fuzz runs are of interest, not all config maps
+	runFactory := informers.NewSharedInformerFactoryWithOptions(client, time.Hour*24, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = k8s.FuzzRunLabel
+	}))
+	runInformer := runFactory.Core().V1().ConfigMaps().Informer()
+	runInformer.AddEventHandler(myEventHandler)
+
+	if err := k8s.PrepareJobNamespace(context.TODO(), l, client, config); err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to prepare the namespace of the fuzz jobs")
+	}
+
+	// images stuck in being fuzzed are recovered before the informers start, so their pods are fuzzed again by the first pod events
+	recovery := newRecoverer(l, client, storage.ContainerImageCache)
+	// the ready timeout is validated when the config is loaded
+	recovery.sandboxReadyTimeout, _ = config.SandboxConfig.GetReadyTimeout()
+	result, recoverErr := recovery.recover(context.TODO(), true, time.Now().UTC())
+	logRecover(l, result, recoverErr)
+	recoveryInterval, intervalErr := config.RecoveryConfig.GetInterval()
+	if intervalErr != nil {
+		l.V(logger.ImportantLevel).Error(intervalErr, "periodic recovery of images that are being fuzzed is disabled")
+	}
+
 	l.V(logger.InfoLevel).Info("starting to listen for events")
 
 	stopChan := make(chan struct{})
 	defer close(stopChan)
 	factory.Start(stopChan)
-	if !cache.WaitForCacheSync(stopChan, podInformer.HasSynced) {
+	runFactory.Start(stopChan)
+	go runRefuzzScheduler(*myEventHandler, config.RefuzzConfig, stopChan)
+	go runRecovery(recovery, recoveryInterval, stopChan)
+	go runJobRetention(l, client, config.RestlerWrapperConfig.JobConfig, stopChan)
+	if !cache.WaitForCacheSync(stopChan, podInformer.HasSynced, runInformer.HasSynced) {
 		l.V(logger.ImportantLevel).Info("failed to wait for cache from cluster")
 		return
 	}
@@ -86,6 +134,8 @@ func (c controller) OnAdd(obj any) {
 	switch object := obj.(type) {
 	case *apiv1.Pod:
 		c.handleEvent(object)
+	case *apiv1.ConfigMap:
+		c.handleRunEvent(object)
 	default:
 		return
 	}
@@ -104,6 +154,8 @@ func (c controller) OnUpdate(oldObj any, newObj any) {
 			}
 		} */
 		c.handleEvent(newObject)
+	case *apiv1.ConfigMap:
+		c.handleRunEvent(newObject)
 	// case *apiv1.PodTemplate:
 	// This could mean an entire different image or maybe just a name change
 	// Fuzzer will notice any significant changes through regular Pod events
@@ -166,9 +218,17 @@ func handlePodEvent(l logger.Logger, client kubernetes.Interface, storage *persi
 		}
 	}
 
-	_, containsUnfuzzedImages := containsUnfuzzedImages(l, pod, storage.ContainerImageCache)
+	if len(annos.Refuzz) > 0 {
+		refuzzByAnnotation(context.TODO(), l, client, storage.ContainerImageCache, pod, annos.Refuzz)
+	}
+
+	images, containsUnfuzzedImages := containsUnfuzzedImages(l, pod, storage.ContainerImageCache)
 	if !containsUnfuzzedImages {
 		l.V(logger.DebugLevel).Info("pod contains no images that hasn't been fuzzed yet", "podName", pod.Name, "podNamespace", pod.Namespace)
+		doc, operations, refuzz := checkSpecChange(l, storage.ContainerImageCache, config.RefuzzConfig, overwrites, pod, images, time.Now().UTC())
+		if refuzz {
+			go startFuzzJob(l, client, storage.ContainerImageCache, config, pod, images, doc, operations, false)
+		}
 		return
 	}
 	l.V(logger.DebugLevel).Info("pod contains unfuzzed images", "podName", pod.Name, "podNamespace", pod.Namespace)
@@ -176,7 +236,7 @@ func handlePodEvent(l logger.Logger, client kubernetes.Interface, storage *persi
 
 	/* TODO singleInstance and k8s job options
 	if singleInstance { */
-	go k8s.StartFuzzJob(l, client, config, overwrites, pod) // TODO
+	go startFuzzing(l, client, storage.ContainerImageCache, config, overwrites, pod, images) // TODO
 	/* } else {
 		startKubernetesJob()
 	}*/
@@ -218,14 +278,19 @@ func containsUnfuzzedImages(l logger.Logger, pod *apiv1.Pod, cache persistence.C
 			}
 
 		} else { // Image has already been added before
+			// Remember where the image was seen
+			changed := foundImage.Observe(image)
 			// Check if there is still an unfuzzed version inside the pod
-			if foundImage.Status == model.NotFuzzed {
+			unfuzzed := foundImage.Status == model.NotFuzzed
+			if unfuzzed {
 				// Update the status to being fuzzed
 				foundImage.Status = model.BeingFuzzed
-				updateErr := cache.Update(context.TODO(), image)
+			}
+			if unfuzzed || changed {
+				updateErr := cache.Update(context.TODO(), *foundImage)
 				if updateErr != nil {
-					l.V(logger.ImportantLevel).Error(err, "error while trying to update the status of an image inside cache to \"beingfuzzed\"", "imageHash", image.Hash)
-				} else {
+					l.V(logger.ImportantLevel).Error(updateErr, "error while trying to update the image inside cache", "imageHash", image.Hash, "status", foundImage.Status.String())
+				} else if unfuzzed {
 					containsUnfuzzedImages = true
 				}
 			}
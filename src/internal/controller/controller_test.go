@@ -109,5 +109,9 @@ func TestContainsUnfuzzedImages(t *testing.T) {
 	for _, image := range allImages2 {
 		assert.Equal(t, model.Fuzzed, image.Status)
 	}
+	// the name of the image is remembered
+	storedImage, _, err := imageRepo.GetByKey(context.TODO(), existingImage.Key())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{existingImageName + ":latest"}, storedImage.Names)
 
 }
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/internal/issues"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/notify"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/internal/report"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// handleFuzzRun records the findings of a completed fuzz run, syncs their issues, marks the images of the run as fuzzed and notifies about the run
+// the sandbox of a completed or failed run is removed
+// runs that are still running or were already recorded are ignored
+func handleFuzzRun(l logger.Logger, client kubernetes.Interface, storage *persistence.Storage, notifier *notify.Dispatcher, issueSyncer *issues.Syncer, run *apiv1.ConfigMap) {
+	status, err := k8s.GetFuzzRunStatus(run)
+	if err != nil {
+		l.V(logger.InfoLevel).Error(err, "ignoring fuzz run with invalid status", "fuzzRun", run.Name, "namespace", run.Namespace)
+		return
+	}
+	if status.Phase == k8s.FuzzRunFailed {
+		removeSandbox(l, client, run, status)
+		return
+	}
+	if status.Phase != k8s.FuzzRunCompleted || status.Recorded {
+		return
+	}
+	removeSandbox(l, client, run, status)
+
+	found, err := GetFuzzRunFindings(run)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to read the findings of fuzz run", "fuzzRun", run.Name, "namespace", run.Namespace)
+		return
+	}
+	// the run is marked as recorded before the findings are stored, so the findings, notifications and issues of a run
+	// aren't duplicated when the run is handled again after a conflict or a failure
+	if !claimFuzzRun(l, client, run) {
+		return
+	}
+	recordRun := findings.Run{Target: status.Target, Images: status.Images, Operations: status.Operations, Incomplete: status.OmittedFindings > 0}
+	changes, err := persistence.RecordFindings(context.TODO(), storage.FindingsStore, recordRun, found)
+	if err != nil {
+		// the findings stay with the run, the recovery resets the images of the run so they are fuzzed again
+		l.V(logger.ImportantLevel).Error(err, "failed to record the findings of fuzz run", "fuzzRun", run.Name, "namespace", run.Namespace)
+		setFuzzRunMessage(l, client, run, "failed to record the findings: "+err.Error())
+		return
+	}
+	for _, record := range changes.New {
+		l.V(logger.ImportantLevel).Info("new finding", "target", status.Target, "checker", record.Finding.Checker, "severity", record.Finding.Severity, "operation", record.Finding.Operation(), "fingerprint", record.Fingerprint)
+	}
+	for _, record := range changes.Fixed {
+		l.V(logger.InfoLevel).Info("finding is fixed", "target", status.Target, "checker", record.Finding.Checker, "operation", record.Finding.Operation(), "fingerprint", record.Fingerprint)
+	}
+	l.V(logger.InfoLevel).Info("recorded findings of fuzz run", "fuzzRun", run.Name, "target", status.Target, "new", len(changes.New), "known", len(changes.Known), "fixed", len(changes.Fixed))
+
+	issueSyncer.Sync(context.TODO(), l, storage.FindingsStore, status.Repository, changes)
+	markImagesFuzzed(l, storage.ContainerImageCache, run.Namespace+"/"+run.Name, status)
+
+	err = k8s.UpdateFuzzRunStatus(context.TODO(), client, run.Namespace, run.Name, nil, func(status *k8s.FuzzRunStatus) {
+		status.NewFindings = len(changes.New)
+		status.FixedFindings = len(changes.Fixed)
+	})
+	if err != nil {
+		l.V(logger.InfoLevel).Error(err, "failed to add the number of new and fixed findings to fuzz run", "fuzzRun", run.Name, "namespace", run.Namespace)
+	}
+
+	notifier.Dispatch(context.TODO(), l, notify.Event{
+		Run:       run.Name,
+		Namespace: run.Namespace,
+		Pod:       status.Pod,
+		Target:    status.Target,
+		Findings:  found,
+		New:       changes.New,
+		Fixed:     changes.Fixed,
+		Reports:   status.Reports,
+	})
+}
+
+// claimFuzzRun marks a completed fuzz run as recorded, returns false when the run was already recorded or couldn't be marked
+func claimFuzzRun(l logger.Logger, client kubernetes.Interface, run *apiv1.ConfigMap) bool {
+	claimed := false
+	err := k8s.UpdateFuzzRunStatus(context.TODO(), client, run.Namespace, run.Name, nil, func(status *k8s.FuzzRunStatus) {
+		claimed = !status.Recorded
+		status.Recorded = true
+	})
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to mark fuzz run as recorded", "fuzzRun", run.Name, "namespace", run.Namespace)
+		return false
+	}
+	return claimed
+}
+
+// setFuzzRunMessage sets the message of a fuzz run
+func setFuzzRunMessage(l logger.Logger, client kubernetes.Interface, run *apiv1.ConfigMap, message string) {
+	err := k8s.UpdateFuzzRunStatus(context.TODO(), client, run.Namespace, run.Name, nil, func(status *k8s.FuzzRunStatus) {
+		status.Message = message
+	})
+	if err != nil {
+		l.V(logger.InfoLevel).Error(err, "failed to set the message of fuzz run", "fuzzRun", run.Name, "namespace", run.Namespace)
+	}
+}
+
+// removeSandbox removes the sandbox of a fuzz run that is done, the recovery retries when this fails
+func removeSandbox(l logger.Logger, client kubernetes.Interface, run *apiv1.ConfigMap, status k8s.FuzzRunStatus) {
+	if len(status.Sandbox) == 0 {
+		return
+	}
+	if err := k8s.DeleteSandbox(context.TODO(), client, status.Sandbox); err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to remove the sandbox of fuzz run", "fuzzRun", run.Name, "namespace", run.Namespace, "sandbox", status.Sandbox)
+	}
+}
+
+// GetFuzzRunFindings reads the findings of a completed fuzz run
+func GetFuzzRunFindings(run *apiv1.ConfigMap) ([]findings.Finding, error) {
+	data, found := run.Data[k8s.FuzzRunFindingsKey]
+	if !found {
+		return nil, nil
+	}
+	var runFindings []findings.Finding
+	if err := json.Unmarshal([]byte(data), &runFindings); err != nil {
+		return nil, fmt.Errorf("failed to decode findings of fuzz run %s: %w", run.Name, err)
+	}
+	return runFindings, nil
+}
+
+// GetFuzzRunReport reads the run report of a completed fuzz run together with its findings
+// returns nil when the run has no report
+func GetFuzzRunReport(run *apiv1.ConfigMap) (*report.RunReport, error) {
+	data, found := run.Data[k8s.FuzzRunReportKey]
+	if !found {
+		return nil, nil
+	}
+	runReport := &report.RunReport{}
+	if err := json.Unmarshal([]byte(data), runReport); err != nil {
+		return nil, fmt.Errorf("failed to decode report of fuzz run %s: %w", run.Name, err)
+	}
+	runFindings, err := GetFuzzRunFindings(run)
+	if err != nil {
+		return nil, err
+	}
+	runReport.Findings = runFindings
+	return runReport, nil
+}
+
+// markImagesFuzzed updates the status of the images of a completed fuzz run to fuzzed and stores the result of the run with the images
+func markImagesFuzzed(l logger.Logger, cache persistence.Cache[model.ContainerImage], run string, status k8s.FuzzRunStatus) {
+	completed := time.Now().UTC()
+	if status.CompletionTime != nil {
+		completed = *status.CompletionTime
+	}
+	for _, key := range status.Images {
+		image, found, err := cache.GetByKey(context.TODO(), key)
+		if err != nil || !found {
+			l.V(logger.InfoLevel).Error(err, "failed to find fuzzed image inside cache", "image", key)
+			continue
+		}
+		image.Status = model.Fuzzed
+		image.RecordRun(run, string(status.Phase), status.Findings, completed)
+		if err := cache.Update(context.TODO(), *image); err != nil {
+			l.V(logger.ImportantLevel).Error(err, "error while trying to update the status of an image inside cache to \"fuzzed\"", "image", key)
+		}
+	}
+}
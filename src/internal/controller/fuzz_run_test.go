@@ -0,0 +1,172 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/internal/issues"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/notify"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testImageHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestOnUpdateFuzzRun(t *testing.T) {
+	calledHandle := false
+	c := controller{}
+	c.runFunc = func(l logger.Logger, clientSet kubernetes.Interface, storage *persistence.Storage, notifier *notify.Dispatcher, issueSyncer *issues.Syncer, run *apiv1.ConfigMap) {
+		calledHandle = true
+	}
+	c.OnUpdate(&apiv1.ConfigMap{}, &apiv1.ConfigMap{})
+	assert.True(t, calledHandle)
+}
+
+func TestHandleFuzzRun(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	ctx := context.TODO()
+	storage := persistence.InitMemoryCache(l)
+	image, _ := model.CreateContainerImage(testImageHash, "sha256", model.BeingFuzzed)
+	require.NoError(t, storage.ContainerImageCache.Create(ctx, image))
+
+	var received []map[string]interface{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		received = append(received, payload)
+	}))
+	defer receiver.Close()
+	notifier, err := notify.CreateDispatcher([]config.NotifierConfig{{Name: "hook", Type: config.WebhookNotifier, Url: receiver.URL}}, receiver.Client())
+	require.NoError(t, err)
+
+	client := fake.NewSimpleClientset()
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default", Labels: map[string]string{"app": "todo"}},
+		Status: apiv1.PodStatus{ContainerStatuses: []apiv1.ContainerStatus{
+			{Name: "api", ImageID: "docker-pullable://localhost:5000/todo-api@sha256:" + testImageHash},
+		}},
+	}
+	run, err := k8s.CreateFuzzRun(ctx, l, client, pod, "cnfuzz-job-todo-api", "default", k8s.FuzzJobOptions{})
+	require.NoError(t, err)
+
+	// running runs are ignored
+	handleFuzzRun(l, client, storage, notifier, nil, run)
+	records, err := storage.FindingsStore.GetByTarget(ctx, "default/todo")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	found := []findings.Finding{{Checker: "main_driver", Severity: findings.MediumSeverity, StatusCode: "500", Method: "GET", Endpoint: "/todo"}}
+	data, err := json.Marshal(found)
+	require.NoError(t, err)
+	err = k8s.UpdateFuzzRunStatus(ctx, client, "default", run.Name, map[string]string{k8s.FuzzRunFindingsKey: string(data)}, func(status *k8s.FuzzRunStatus) {
+		status.Phase = k8s.FuzzRunCompleted
+	})
+	require.NoError(t, err)
+	run, err = client.CoreV1().ConfigMaps("default").Get(ctx, run.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	stale := run
+	handleFuzzRun(l, client, storage, notifier, nil, run)
+	records, err = storage.FindingsStore.GetByTarget(ctx, "default/todo")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, found[0].Fingerprint(), records[0].Fingerprint)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, records[0].Images)
+
+	storedImage, _, err := storage.ContainerImageCache.GetByKey(ctx, "sha256:"+testImageHash)
+	require.NoError(t, err)
+	assert.Equal(t, model.Fuzzed, storedImage.Status)
+	assert.Equal(t, "default/"+run.Name, storedImage.LastRun)
+	assert.Equal(t, string(k8s.FuzzRunCompleted), storedImage.LastRunResult)
+	assert.NotNil(t, storedImage.LastRunTime)
+
+	run, err = client.CoreV1().ConfigMaps("default").Get(ctx, run.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	status, err := k8s.GetFuzzRunStatus(run)
+	require.NoError(t, err)
+	assert.True(t, status.Recorded)
+	assert.Equal(t, 1, status.NewFindings)
+	require.Len(t, received, 1)
+	assert.Equal(t, "default/todo", received[0]["target"])
+
+	// recorded runs are ignored, also when the event still has the run from before it was recorded
+	handleFuzzRun(l, client, storage, notifier, nil, run)
+	handleFuzzRun(l, client, storage, notifier, nil, stale)
+	records, err = storage.FindingsStore.GetByTarget(ctx, "default/todo")
+	require.NoError(t, err)
+	assert.Equal(t, 1, records[0].Occurrences)
+	assert.Len(t, received, 1)
+}
+
+func TestHandleFuzzRunRemovesSandbox(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	ctx := context.TODO()
+	storage := persistence.InitMemoryCache(l)
+	now := time.Now().UTC()
+	client := fake.NewSimpleClientset(
+		createRun(t, "cnfuzz-run-todo-api", k8s.FuzzRunStatus{Phase: k8s.FuzzRunRunning, Target: "default/todo-api", Sandbox: "cnfuzz-sandbox-running"}, ""),
+		createRun(t, "cnfuzz-run-shop-api", k8s.FuzzRunStatus{Phase: k8s.FuzzRunFailed, Target: "default/shop-api", Sandbox: "cnfuzz-sandbox-failed", CompletionTime: &now}, ""),
+		createSandboxNamespace("cnfuzz-sandbox-running", now),
+		createSandboxNamespace("cnfuzz-sandbox-failed", now),
+	)
+	for _, name := range []string{"cnfuzz-run-todo-api", "cnfuzz-run-shop-api"} {
+		run, err := client.CoreV1().ConfigMaps("default").Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		handleFuzzRun(l, client, storage, nil, nil, run)
+	}
+
+	_, err := client.CoreV1().Namespaces().Get(ctx, "cnfuzz-sandbox-running", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = client.CoreV1().Namespaces().Get(ctx, "cnfuzz-sandbox-failed", metav1.GetOptions{})
+	assert.Error(t, err)
+}
+
+func TestGetFuzzRunReport(t *testing.T) {
+	run := &apiv1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cnfuzz-run-todo-api"}, Data: map[string]string{}}
+	runReport, err := GetFuzzRunReport(run)
+	require.NoError(t, err)
+	assert.Nil(t, runReport)
+
+	run.Data[k8s.FuzzRunReportKey] = `{"PodName": "todo-api", "Coverage": {"endpoints": [{"method": "GET", "endpoint": "/todo", "status": "succeeded"}]}}`
+	run.Data[k8s.FuzzRunFindingsKey] = `[{"checker": "main_driver", "statusCode": "500"}]`
+	runReport, err = GetFuzzRunReport(run)
+	require.NoError(t, err)
+	require.NotNil(t, runReport)
+	assert.Equal(t, "todo-api", runReport.PodName)
+	assert.Len(t, runReport.Coverage.Endpoints, 1)
+	require.Len(t, runReport.Findings, 1)
+	assert.Equal(t, "main_driver", runReport.Findings[0].Checker)
+
+	run.Data[k8s.FuzzRunReportKey] = "{"
+	_, err = GetFuzzRunReport(run)
+	assert.Error(t, err)
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/job"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"time"
+)
+
+// finishedObject fuzz job or fuzz run that completed or failed
+type finishedObject struct {
+	namespace string
+	name      string
+	finished  time.Time
+}
+
+// jobFinishTime returns when a job completed or failed, false when it is still running
+func jobFinishTime(j *batchv1.Job) (time.Time, bool) {
+	for _, condition := range j.Status.Conditions {
+		if condition.Status != apiv1.ConditionTrue || (condition.Type != batchv1.JobComplete && condition.Type != batchv1.JobFailed) {
+			continue
+		}
+		if j.Status.CompletionTime != nil {
+			return j.Status.CompletionTime.Time, true
+		}
+		if !condition.LastTransitionTime.IsZero() {
+			return condition.LastTransitionTime.Time, true
+		}
+		return j.CreationTimestamp.Time, true
+	}
+	return time.Time{}, false
+}
+
+// outsideRetention returns the finished objects that fall outside the retention, finished holds the objects per namespace the retention applies to
+func outsideRetention(finished map[string][]finishedObject, retention config.JobRetentionConfig, maxAge time.Duration, now time.Time) []finishedObject {
+	namespaces := make([]string, 0, len(finished))
+	for namespace := range finished {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	var expired []finishedObject
+	for _, namespace := range namespaces {
+		objects := finished[namespace]
+		// newest first, so the objects that are kept come first
+		sort.Slice(objects, func(i, j int) bool {
+			if objects[i].finished.Equal(objects[j].finished) {
+				return objects[i].name < objects[j].name
+			}
+			return objects[i].finished.After(objects[j].finished)
+		})
+		for i, object := range objects {
+			tooMany := retention.Keep > 0 && i >= retention.Keep
+			tooOld := maxAge > 0 && now.Sub(object.finished) > maxAge
+			if tooMany || tooOld {
+				expired = append(expired, object)
+			}
+		}
+	}
+	return expired
+}
+
+// collectJobs removes the finished fuzz jobs that fall outside the retention, running jobs are never removed
+// the retention applies per namespace of the targets of the jobs
+// returns the removed jobs in the format <namespace>/<name>
+func collectJobs(ctx context.Context, l logger.Logger, client kubernetes.Interface, retention config.JobRetentionConfig, now time.Time) ([]string, error) {
+	maxAge, err := retention.GetMaxAge()
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := client.BatchV1().Jobs(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: job.JobLabel})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the fuzz jobs: %w", err)
+	}
+	finished := make(map[string][]finishedObject)
+	for i := range jobs.Items {
+		j := &jobs.Items[i]
+		if finishTime, done := jobFinishTime(j); done {
+			// jobs inside a dedicated namespace are kept per namespace of their target
+			namespace := j.Namespace
+			if target, found := j.Labels[job.TargetNamespaceLabel]; found {
+				namespace = target
+			}
+			finished[namespace] = append(finished[namespace], finishedObject{namespace: j.Namespace, name: j.Name, finished: finishTime})
+		}
+	}
+
+	var removed []string
+	propagation := metav1.DeletePropagationBackground
+	for _, fj := range outsideRetention(finished, retention, maxAge, now) {
+		err := client.BatchV1().Jobs(fj.namespace).Delete(ctx, fj.name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			l.V(logger.ImportantLevel).Error(err, "failed to remove finished fuzz job", "job", fj.name, "namespace", fj.namespace)
+			continue
+		}
+		removed = append(removed, fj.namespace+"/"+fj.name)
+	}
+	return removed, nil
+}
+
+// collectRuns removes the finished fuzz runs that fall outside the retention, the jobs that belong to a run are removed with it
+// running runs and completed runs whose findings aren't recorded yet are never removed. The newest run and the newest
+// completed run of every target are kept as well, the refuzz annotation and the spec diff of the next run compare against them.
+// returns the removed runs in the format <namespace>/<name>
+func collectRuns(ctx context.Context, l logger.Logger, client kubernetes.Interface, retention config.JobRetentionConfig, now time.Time) ([]string, error) {
+	maxAge, err := retention.GetMaxAge()
+	if err != nil {
+		return nil, err
+	}
+	runs, err := client.CoreV1().ConfigMaps(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: k8s.FuzzRunLabel})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the fuzz runs: %w", err)
+	}
+	statuses := make(map[*apiv1.ConfigMap]k8s.FuzzRunStatus)
+	newest := make(map[string]*apiv1.ConfigMap)
+	newestCompleted := make(map[string]*apiv1.ConfigMap)
+	for i := range runs.Items {
+		run := &runs.Items[i]
+		status, err := k8s.GetFuzzRunStatus(run)
+		if err != nil {
+			continue
+		}
+		statuses[run] = status
+		if previous, found := newest[status.Target]; !found || status.StartTime.After(statuses[previous].StartTime) {
+			newest[status.Target] = run
+		}
+		if previous, found := newestCompleted[status.Target]; status.Phase == k8s.FuzzRunCompleted && (!found || status.StartTime.After(statuses[previous].StartTime)) {
+			newestCompleted[status.Target] = run
+		}
+	}
+	kept := make(map[*apiv1.ConfigMap]bool)
+	for _, run := range newest {
+		kept[run] = true
+	}
+	for _, run := range newestCompleted {
+		kept[run] = true
+	}
+
+	finished := make(map[string][]finishedObject)
+	for run, status := range statuses {
+		done := status.Phase == k8s.FuzzRunFailed || status.Phase == k8s.FuzzRunCompleted && status.Recorded
+		if !done || kept[run] {
+			continue
+		}
+		finishTime := status.StartTime
+		if status.CompletionTime != nil {
+			finishTime = *status.CompletionTime
+		}
+		finished[run.Namespace] = append(finished[run.Namespace], finishedObject{namespace: run.Namespace, name: run.Name, finished: finishTime})
+	}
+
+	var removed []string
+	propagation := metav1.DeletePropagationBackground
+	for _, fr := range outsideRetention(finished, retention, maxAge, now) {
+		err := client.CoreV1().ConfigMaps(fr.namespace).Delete(ctx, fr.name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			l.V(logger.ImportantLevel).Error(err, "failed to remove finished fuzz run", "fuzzRun", fr.name, "namespace", fr.namespace)
+			continue
+		}
+		removed = append(removed, fr.namespace+"/"+fr.name)
+	}
+	return removed, nil
+}
+
+// runJobRetention removes the finished fuzz runs and fuzz jobs outside the retention every interval until stop is closed
+func runJobRetention(l logger.Logger, client kubernetes.Interface, cnf *config.JobConfig, stop <-chan struct{}) {
+	if cnf == nil || cnf.Retention == nil {
+		return
+	}
+	retention := *cnf.Retention
+	maxAge, err := retention.GetMaxAge()
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "removing finished fuzz runs and jobs is disabled")
+		return
+	}
+	interval, err := retention.GetInterval()
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "removing finished fuzz runs and jobs is disabled")
+		return
+	}
+	if retention.Keep == 0 && maxAge == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			removedRuns, err := collectRuns(context.TODO(), l, client, retention, now)
+			if err != nil {
+				l.V(logger.ImportantLevel).Error(err, "failed to remove finished fuzz runs")
+			} else if len(removedRuns) > 0 {
+				l.V(logger.InfoLevel).Info("removed finished fuzz runs", "fuzzRuns", removedRuns)
+			}
+			removed, err := collectJobs(context.TODO(), l, client, retention, now)
+			if err != nil {
+				l.V(logger.ImportantLevel).Error(err, "failed to remove finished fuzz jobs")
+			} else if len(removed) > 0 {
+				l.V(logger.InfoLevel).Info("removed finished fuzz jobs", "jobs", removed)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/job"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+// createFuzzJob creates a fuzz job that finished at finished, or is still running when finished is zero
+func createFuzzJob(namespace string, name string, finished time.Time) *batchv1.Job {
+	j := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{job.JobLabel: "true"}}}
+	if !finished.IsZero() {
+		completion := metav1.NewTime(finished)
+		j.Status.CompletionTime = &completion
+		j.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: apiv1.ConditionTrue}}
+	}
+	return j
+}
+
+func TestCollectJobs(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	now := time.Now().UTC()
+	client := fake.NewSimpleClientset(
+		createFuzzJob("default", "cnfuzz-job-todo-api-aaaaa", now.Add(-3*time.Hour)),
+		createFuzzJob("default", "cnfuzz-job-todo-api-bbbbb", now.Add(-2*time.Hour)),
+		createFuzzJob("default", "cnfuzz-job-todo-api-ccccc", now.Add(-time.Hour)),
+		createFuzzJob("default", "cnfuzz-job-todo-api-ddddd", time.Time{}),
+		createFuzzJob("shop", "cnfuzz-job-shop-api-aaaaa", now.Add(-48*time.Hour)),
+		// not a fuzz job
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "default"}, Status: batchv1.JobStatus{
+			Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: apiv1.ConditionTrue}},
+		}},
+	)
+
+	removed, err := collectJobs(context.TODO(), l, client, config.JobRetentionConfig{Keep: 2}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default/cnfuzz-job-todo-api-aaaaa"}, removed)
+
+	removed, err = collectJobs(context.TODO(), l, client, config.JobRetentionConfig{MaxAge: "24h"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shop/cnfuzz-job-shop-api-aaaaa"}, removed)
+
+	jobs, err := client.BatchV1().Jobs("").List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, j := range jobs.Items {
+		names = append(names, j.Name)
+	}
+	assert.ElementsMatch(t, []string{"cnfuzz-job-todo-api-bbbbb", "cnfuzz-job-todo-api-ccccc", "cnfuzz-job-todo-api-ddddd", "backup"}, names)
+}
+
+func TestCollectJobsInJobNamespace(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	now := time.Now().UTC()
+	targetJob := func(target string, name string, finished time.Time) *batchv1.Job {
+		j := createFuzzJob("cnfuzz-jobs", name, finished)
+		j.Labels[job.TargetNamespaceLabel] = target
+		return j
+	}
+	client := fake.NewSimpleClientset(
+		targetJob("default", "cnfuzz-job-todo-api-aaaaa", now.Add(-2*time.Hour)),
+		targetJob("default", "cnfuzz-job-todo-api-bbbbb", now.Add(-time.Hour)),
+		targetJob("shop", "cnfuzz-job-shop-api-aaaaa", now.Add(-3*time.Hour)),
+	)
+
+	// the jobs are kept per namespace of their target
+	removed, err := collectJobs(context.TODO(), l, client, config.JobRetentionConfig{Keep: 1}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cnfuzz-jobs/cnfuzz-job-todo-api-aaaaa"}, removed)
+}
+
+func TestCollectRuns(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	now := time.Now().UTC()
+	run := func(name string, target string, phase k8s.FuzzRunPhase, recorded bool, finished time.Time) *apiv1.ConfigMap {
+		completion := finished
+		return createRun(t, name, k8s.FuzzRunStatus{Phase: phase, Target: target, Recorded: recorded, StartTime: finished.Add(-time.Hour), CompletionTime: &completion}, "{}")
+	}
+	client := fake.NewSimpleClientset(
+		run("cnfuzz-run-todo-api-aaaaa", "default/todo-api", k8s.FuzzRunCompleted, true, now.Add(-5*time.Hour)),
+		run("cnfuzz-run-todo-api-bbbbb", "default/todo-api", k8s.FuzzRunFailed, false, now.Add(-4*time.Hour)),
+		run("cnfuzz-run-todo-api-ccccc", "default/todo-api", k8s.FuzzRunCompleted, true, now.Add(-3*time.Hour)),
+		// the findings of this run aren't recorded yet
+		run("cnfuzz-run-todo-api-ddddd", "default/todo-api", k8s.FuzzRunCompleted, false, now.Add(-2*time.Hour)),
+		// the newest run of the target
+		run("cnfuzz-run-todo-api-eeeee", "default/todo-api", k8s.FuzzRunFailed, false, now.Add(-time.Hour)),
+		// the only run of another target
+		run("cnfuzz-run-user-api-aaaaa", "default/user-api", k8s.FuzzRunFailed, false, now.Add(-48*time.Hour)),
+		createRun(t, "cnfuzz-run-todo-api-fffff", k8s.FuzzRunStatus{Phase: k8s.FuzzRunRunning, Target: "default/todo-api", StartTime: now.Add(-48 * time.Hour)}, "{}"),
+	)
+
+	removed, err := collectRuns(context.TODO(), l, client, config.JobRetentionConfig{MaxAge: "270m"}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default/cnfuzz-run-todo-api-aaaaa"}, removed)
+
+	removed, err = collectRuns(context.TODO(), l, client, config.JobRetentionConfig{Keep: 1}, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default/cnfuzz-run-todo-api-bbbbb"}, removed)
+
+	runs, err := client.CoreV1().ConfigMaps("").List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, r := range runs.Items {
+		names = append(names, r.Name)
+	}
+	assert.ElementsMatch(t, []string{"cnfuzz-run-todo-api-ccccc", "cnfuzz-run-todo-api-ddddd", "cnfuzz-run-todo-api-eeeee", "cnfuzz-run-user-api-aaaaa", "cnfuzz-run-todo-api-fffff"}, names)
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/suecodelabs/cnfuzz/src/internal/report"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	"time"
+)
+
+// MetricsPath path of the Prometheus metrics of the fuzz runs, served next to the health checks
+const MetricsPath = "/metrics"
+
+// CreateMetricsHandler creates the handler that serves the coverage, findings and timings of the newest completed fuzz run of every pod
+// the metrics are computed from the runs on every scrape, so they are gone together with the runs
+func CreateMetricsHandler(l logger.Logger, client kubernetes.Interface) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gatherers, err := gatherRunMetrics(r.Context(), l, client)
+		if err != nil {
+			l.V(logger.ImportantLevel).Error(err, "failed to gather the metrics of the fuzz runs")
+			http.Error(w, "failed to gather metrics", http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// gatherRunMetrics creates a registry with the metrics of the run report of the newest completed fuzz run of every pod
+func gatherRunMetrics(ctx context.Context, l logger.Logger, client kubernetes.Interface) (prometheus.Gatherers, error) {
+	list, err := client.CoreV1().ConfigMaps("").List(ctx, metav1.ListOptions{LabelSelector: k8s.FuzzRunLabel})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fuzz runs: %w", err)
+	}
+	newest := make(map[string]*apiv1.ConfigMap)
+	completed := make(map[string]time.Time)
+	for i := range list.Items {
+		run := &list.Items[i]
+		status, err := k8s.GetFuzzRunStatus(run)
+		if err != nil || status.Phase != k8s.FuzzRunCompleted || status.CompletionTime == nil {
+			continue
+		}
+		pod := run.Namespace + "/" + status.Pod
+		if last, found := completed[pod]; found && !status.CompletionTime.After(last) {
+			continue
+		}
+		newest[pod] = run
+		completed[pod] = *status.CompletionTime
+	}
+
+	gatherers := make(prometheus.Gatherers, 0, len(newest))
+	for _, run := range newest {
+		runReport, err := GetFuzzRunReport(run)
+		if err != nil || runReport == nil {
+			l.V(logger.DebugLevel).Info("fuzz run has no report to compute metrics from", "fuzzRun", run.Name, "namespace", run.Namespace, "error", err)
+			continue
+		}
+		registry, err := report.CreateMetricsRegistry(*runReport)
+		if err != nil {
+			return nil, err
+		}
+		gatherers = append(gatherers, registry)
+	}
+	return gatherers, nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/coverage"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/internal/report"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	ctx := context.TODO()
+	client := fake.NewSimpleClientset()
+	pod := &apiv1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default"}}
+	runReport := report.RunReport{
+		PodName:   "todo-api",
+		Namespace: "default",
+		Coverage: coverage.Coverage{Endpoints: []coverage.EndpointCoverage{
+			{Method: "GET", Endpoint: "/todo", Status: coverage.Succeeded},
+			{Method: "POST", Endpoint: "/todo", Status: coverage.Failed, Reason: coverage.AuthReason},
+		}},
+	}
+	completeRun := func(jobName string, found []findings.Finding) {
+		run, err := k8s.CreateFuzzRun(ctx, l, client, pod, jobName, "default", k8s.FuzzJobOptions{})
+		require.NoError(t, err)
+		findingsData, err := json.Marshal(found)
+		require.NoError(t, err)
+		reportData, err := json.Marshal(runReport)
+		require.NoError(t, err)
+		require.NoError(t, k8s.CompleteFuzzRun(ctx, l, client, "default", run.Name, findingsData, reportData, func(status *k8s.FuzzRunStatus) {}))
+	}
+	completeRun("cnfuzz-job-todo-api-aaaaa", nil)
+	completeRun("cnfuzz-job-todo-api-bbbbb", []findings.Finding{{Checker: "main_driver", Severity: findings.HighSeverity, StatusCode: "500"}})
+	// runs that are still running have no metrics
+	_, err := k8s.CreateFuzzRun(ctx, l, client, pod, "cnfuzz-job-todo-api-ccccc", "default", k8s.FuzzJobOptions{})
+	require.NoError(t, err)
+
+	resp := httptest.NewRecorder()
+	CreateMetricsHandler(l, client).ServeHTTP(resp, httptest.NewRequest(http.MethodGet, MetricsPath, nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	metrics := resp.Body.String()
+	assert.Contains(t, metrics, `cnfuzz_operations{namespace="default",pod="todo-api",status="succeeded"} 1`)
+	assert.Contains(t, metrics, `cnfuzz_operation_status{endpoint="/todo",method="POST",namespace="default",pod="todo-api",reason="auth",status="failed"} 1`)
+	// only the newest completed run of the pod is exported
+	assert.Contains(t, metrics, `cnfuzz_findings{namespace="default",pod="todo-api",severity="high"} 1`)
+}
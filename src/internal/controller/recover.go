@@ -0,0 +1,314 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"time"
+)
+
+// jobStartGracePeriod time between creating the fuzz run and creating its job, a run without a job isn't recovered before
+const jobStartGracePeriod = time.Minute
+
+// RecoverResult images that were stuck in being fuzzed and the fuzz runs that were marked failed
+type RecoverResult struct {
+	// Reset keys of images without a fuzz run that were reset to not fuzzed, their pods are fuzzed again
+	Reset []string `json:"reset"`
+	// Failed keys of images whose fuzz job failed or disappeared, they are marked fuzzed with a failed run
+	Failed []string `json:"failed"`
+	// Runs fuzz runs that were marked failed in the format <namespace>/<name>
+	Runs []string `json:"runs"`
+	// Sandboxes sandbox namespaces that were removed because no running fuzz run uses them
+	Sandboxes []string `json:"sandboxes"`
+}
+
+// recoverer finds images that stay "being fuzzed" because the controller or their fuzz job died
+type recoverer struct {
+	l      logger.Logger
+	client kubernetes.Interface
+	cache  persistence.ContainerImageCache
+	// suspects images that were being fuzzed without a fuzz run during the previous pass, a fuzz job may still have been starting for them
+	suspects map[string]bool
+	// sandboxReadyTimeout time the job of a run with a sandbox can start later, while the copy of the workload becomes ready
+	sandboxReadyTimeout time.Duration
+}
+
+func newRecoverer(l logger.Logger, client kubernetes.Interface, cache persistence.ContainerImageCache) *recoverer {
+	return &recoverer{l: l, client: client, cache: cache}
+}
+
+// recover recovers the images that are being fuzzed and removes the sandboxes that aren't used anymore
+func (r *recoverer) recover(ctx context.Context, startup bool, now time.Time) (RecoverResult, error) {
+	result, err := r.recoverImages(ctx, startup, now)
+	if err != nil {
+		return result, err
+	}
+	// after the images, so the sandboxes of runs that just failed are removed as well
+	result.Sandboxes, err = r.removeSandboxes(ctx, now)
+	return result, err
+}
+
+// recoverImages checks the images that are being fuzzed against the fuzz runs and their jobs.
+// Only the newest run of an image counts, the runs of earlier fuzz jobs are kept as history.
+// Images of runs that are still running or that completed but weren't recorded yet are left alone, handleFuzzRun records completed runs.
+// Runs whose job is gone or ended without completing the run are marked failed, and their images are marked fuzzed with the failed run.
+// Images without a run (or whose newest run was already recorded) are reset to not fuzzed,
+// at startup right away, otherwise when they were without a run during the previous pass as well.
+func (r *recoverer) recoverImages(ctx context.Context, startup bool, now time.Time) (RecoverResult, error) {
+	result := RecoverResult{}
+	images, err := r.cache.GetAll(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to get the images: %w", err)
+	}
+	stuck := make(map[string]*model.ContainerImage)
+	for _, image := range images {
+		if image.Status == model.BeingFuzzed {
+			stuck[image.Key()] = image
+		}
+	}
+	if len(stuck) == 0 {
+		r.suspects = nil
+		return result, nil
+	}
+
+	runs, err := r.client.CoreV1().ConfigMaps(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: k8s.FuzzRunLabel})
+	if err != nil {
+		return result, fmt.Errorf("failed to list the fuzz runs: %w", err)
+	}
+	statuses := make(map[*apiv1.ConfigMap]k8s.FuzzRunStatus)
+	var related []*apiv1.ConfigMap
+	for i := range runs.Items {
+		status, err := k8s.GetFuzzRunStatus(&runs.Items[i])
+		if err == nil && containsAny(stuck, status.Images) {
+			statuses[&runs.Items[i]] = status
+			related = append(related, &runs.Items[i])
+		}
+	}
+	// newest runs first
+	sort.SliceStable(related, func(i, j int) bool {
+		return statuses[related[i]].StartTime.After(statuses[related[j]].StartTime)
+	})
+	seen := make(map[string]bool)
+	busy := make(map[string]bool)
+	failedRuns := make(map[string]string)
+	for _, run := range related {
+		status := statuses[run]
+		// the images this run is the newest run of
+		var images []string
+		for _, image := range status.Images {
+			if !seen[image] {
+				seen[image] = true
+				images = append(images, image)
+			}
+		}
+		runName := run.Namespace + "/" + run.Name
+		switch status.Phase {
+		case k8s.FuzzRunCompleted:
+			if !status.Recorded {
+				markAll(busy, images, true)
+			}
+		case k8s.FuzzRunFailed:
+			markAll(failedRuns, images, runName)
+		case k8s.FuzzRunRunning:
+			alive, reason := r.jobAlive(ctx, status.GetJobNamespace(run.Namespace), status, now)
+			if alive {
+				markAll(busy, images, true)
+				continue
+			}
+			failed, err := failRun(ctx, r.client, run, reason, now)
+			if err != nil {
+				r.l.V(logger.ImportantLevel).Error(err, "failed to mark fuzz run as failed", "fuzzRun", run.Name, "namespace", run.Namespace)
+				continue
+			}
+			if !failed {
+				// the run changed since it was listed, it is checked again during the next pass
+				markAll(busy, images, true)
+				continue
+			}
+			r.l.V(logger.ImportantLevel).Info("fuzz run failed", "fuzzRun", run.Name, "namespace", run.Namespace, "reason", reason)
+			result.Runs = append(result.Runs, runName)
+			markAll(failedRuns, images, runName)
+		}
+	}
+
+	keys := make([]string, 0, len(stuck))
+	for key := range stuck {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	suspects := make(map[string]bool)
+	for _, key := range keys {
+		image := stuck[key]
+		if busy[key] {
+			continue
+		}
+		if run, found := failedRuns[key]; found {
+			image.Status = model.Fuzzed
+			image.RecordRun(run, string(k8s.FuzzRunFailed), nil, now)
+			if err := r.cache.Update(ctx, *image); err != nil {
+				r.l.V(logger.ImportantLevel).Error(err, "failed to mark image with a failed fuzz run", "image", key)
+				continue
+			}
+			result.Failed = append(result.Failed, key)
+		} else if startup || r.suspects[key] {
+			image.Status = model.NotFuzzed
+			if err := r.cache.Update(ctx, *image); err != nil {
+				r.l.V(logger.ImportantLevel).Error(err, "error while trying to update the status of an image inside cache to \"notfuzzed\"", "image", key)
+				continue
+			}
+			result.Reset = append(result.Reset, key)
+		} else {
+			suspects[key] = true
+		}
+	}
+	r.suspects = suspects
+	return result, nil
+}
+
+// jobAlive returns whether the job of a running fuzz run can still complete the run, and the reason when it can't
+func (r *recoverer) jobAlive(ctx context.Context, namespace string, status k8s.FuzzRunStatus, now time.Time) (bool, string) {
+	grace := jobStartGracePeriod
+	if len(status.Sandbox) > 0 {
+		grace += r.sandboxReadyTimeout
+	}
+	if len(status.Job) == 0 {
+		return now.Sub(status.StartTime) < grace, "fuzz run has no job"
+	}
+	job, err := r.client.BatchV1().Jobs(namespace).Get(ctx, status.Job, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return now.Sub(status.StartTime) < grace, "fuzz job doesn't exist"
+	} else if err != nil {
+		r.l.V(logger.InfoLevel).Error(err, "failed to get fuzz job, assuming it is still running", "job", status.Job, "namespace", namespace)
+		return true, ""
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != apiv1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobFailed:
+			return false, fmt.Sprintf("fuzz job failed: %s %s", condition.Reason, condition.Message)
+		case batchv1.JobComplete:
+			return false, "fuzz job completed without completing the fuzz run"
+		}
+	}
+	return true, ""
+}
+
+// removeSandboxes removes the sandbox namespaces that no running fuzz run uses, because the run is done or the controller died before the run started
+// returns the removed namespaces
+func (r *recoverer) removeSandboxes(ctx context.Context, now time.Time) ([]string, error) {
+	runs, err := r.client.CoreV1().ConfigMaps(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: k8s.FuzzRunLabel})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the fuzz runs: %w", err)
+	}
+	used := make(map[string]bool)
+	for i := range runs.Items {
+		status, err := k8s.GetFuzzRunStatus(&runs.Items[i])
+		if err == nil && status.Phase == k8s.FuzzRunRunning && len(status.Sandbox) > 0 {
+			used[status.Sandbox] = true
+		}
+	}
+	// listed after the runs, a sandbox of a run that started in between is younger than the grace period
+	sandboxes, err := r.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: k8s.SandboxLabel})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the sandboxes: %w", err)
+	}
+	var removed []string
+	for _, sandbox := range sandboxes.Items {
+		if used[sandbox.Name] || now.Sub(sandbox.CreationTimestamp.Time) < jobStartGracePeriod || sandbox.Status.Phase == apiv1.NamespaceTerminating {
+			continue
+		}
+		if err := k8s.DeleteSandbox(ctx, r.client, sandbox.Name); err != nil {
+			r.l.V(logger.ImportantLevel).Error(err, "failed to remove sandbox", "namespace", sandbox.Name)
+			continue
+		}
+		removed = append(removed, sandbox.Name)
+	}
+	return removed, nil
+}
+
+// failRun marks a running fuzz run as failed, returns false when the run isn't running anymore
+func failRun(ctx context.Context, client kubernetes.Interface, run *apiv1.ConfigMap, reason string, now time.Time) (bool, error) {
+	failed := false
+	err := k8s.UpdateFuzzRunStatus(ctx, client, run.Namespace, run.Name, nil, func(status *k8s.FuzzRunStatus) {
+		failed = status.Phase == k8s.FuzzRunRunning
+		if failed {
+			status.Phase = k8s.FuzzRunFailed
+			status.Message = reason
+			status.CompletionTime = &now
+		}
+	})
+	return failed, err
+}
+
+func containsAny(images map[string]*model.ContainerImage, keys []string) bool {
+	for _, key := range keys {
+		if _, found := images[key]; found {
+			return true
+		}
+	}
+	return false
+}
+
+func markAll[T any](marks map[string]T, keys []string, value T) {
+	for _, key := range keys {
+		marks[key] = value
+	}
+}
+
+// runRecovery recovers the images that are being fuzzed every interval until stop is closed
+func runRecovery(r *recoverer, interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			result, err := r.recover(context.TODO(), false, now.UTC())
+			logRecover(r.l, result, err)
+		}
+	}
+}
+
+func logRecover(l logger.Logger, result RecoverResult, err error) {
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to recover images that are being fuzzed")
+		return
+	}
+	if len(result.Reset) > 0 || len(result.Failed) > 0 {
+		l.V(logger.ImportantLevel).Info("recovered images that were stuck in being fuzzed", "reset", result.Reset, "failed", result.Failed, "failedRuns", result.Runs)
+	}
+	if len(result.Sandboxes) > 0 {
+		l.V(logger.InfoLevel).Info("removed sandboxes that aren't used anymore", "sandboxes", result.Sandboxes)
+	}
+}
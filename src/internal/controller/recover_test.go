@@ -0,0 +1,250 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+// createRecoverer creates a recoverer with an image that is being fuzzed and the given cluster objects
+func createRecoverer(t *testing.T, objects ...runtime.Object) (*recoverer, *persistence.Storage) {
+	l := logger.CreateDebugLogger()
+	storage := persistence.InitMemoryCache(l)
+	image, _ := model.CreateContainerImage(testImageHash, "sha256", model.BeingFuzzed)
+	require.NoError(t, storage.ContainerImageCache.Create(context.TODO(), image))
+	return newRecoverer(l, fake.NewSimpleClientset(objects...), storage.ContainerImageCache), storage
+}
+
+func createRecoverRun(t *testing.T, phase k8s.FuzzRunPhase, job string, started time.Time) *apiv1.ConfigMap {
+	return createRun(t, "cnfuzz-run-todo-api", k8s.FuzzRunStatus{
+		Phase:     phase,
+		Target:    "default/todo-api",
+		Images:    []string{"sha256:" + testImageHash},
+		Job:       job,
+		StartTime: started,
+	}, "")
+}
+
+func createRecoverJob(conditions ...batchv1.JobCondition) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "cnfuzz-job-todo-api", Namespace: "default"},
+		Status:     batchv1.JobStatus{Conditions: conditions},
+	}
+}
+
+func getImage(t *testing.T, storage *persistence.Storage) *model.ContainerImage {
+	image, found, err := storage.ContainerImageCache.GetByKey(context.TODO(), "sha256:"+testImageHash)
+	require.NoError(t, err)
+	require.True(t, found)
+	return image
+}
+
+func getRunStatus(t *testing.T, r *recoverer) k8s.FuzzRunStatus {
+	run, err := r.client.CoreV1().ConfigMaps("default").Get(context.TODO(), "cnfuzz-run-todo-api", metav1.GetOptions{})
+	require.NoError(t, err)
+	status, err := k8s.GetFuzzRunStatus(run)
+	require.NoError(t, err)
+	return status
+}
+
+func TestRecoverActiveJob(t *testing.T) {
+	now := time.Now().UTC()
+	r, storage := createRecoverer(t, createRecoverRun(t, k8s.FuzzRunRunning, "cnfuzz-job-todo-api", now.Add(-time.Hour)), createRecoverJob())
+
+	for _, startup := range []bool{true, false, false} {
+		result, err := r.recover(context.TODO(), startup, now)
+		require.NoError(t, err)
+		assert.Empty(t, result.Reset)
+		assert.Empty(t, result.Failed)
+	}
+	assert.Equal(t, model.BeingFuzzed, getImage(t, storage).Status)
+	assert.Equal(t, k8s.FuzzRunRunning, getRunStatus(t, r).Phase)
+}
+
+func TestRecoverMissingJob(t *testing.T) {
+	now := time.Now().UTC()
+	// the job of a new run may not be created yet
+	r, storage := createRecoverer(t, createRecoverRun(t, k8s.FuzzRunRunning, "cnfuzz-job-todo-api", now.Add(-10*time.Second)))
+	result, err := r.recover(context.TODO(), true, now)
+	require.NoError(t, err)
+	assert.Empty(t, result.Runs)
+	assert.Equal(t, model.BeingFuzzed, getImage(t, storage).Status)
+
+	later := now.Add(2 * jobStartGracePeriod)
+	result, err = r.recover(context.TODO(), false, later)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default/cnfuzz-run-todo-api"}, result.Runs)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Failed)
+
+	status := getRunStatus(t, r)
+	assert.Equal(t, k8s.FuzzRunFailed, status.Phase)
+	assert.Equal(t, "fuzz job doesn't exist", status.Message)
+	require.NotNil(t, status.CompletionTime)
+
+	image := getImage(t, storage)
+	assert.Equal(t, model.Fuzzed, image.Status)
+	assert.Equal(t, "default/cnfuzz-run-todo-api", image.LastRun)
+	assert.Equal(t, string(k8s.FuzzRunFailed), image.LastRunResult)
+}
+
+func TestRecoverFailedJob(t *testing.T) {
+	now := time.Now().UTC()
+	job := createRecoverJob(batchv1.JobCondition{Type: batchv1.JobFailed, Status: apiv1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit"})
+	r, storage := createRecoverer(t, createRecoverRun(t, k8s.FuzzRunRunning, job.Name, now), job)
+
+	result, err := r.recover(context.TODO(), false, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Failed)
+	assert.Equal(t, "fuzz job failed: BackoffLimitExceeded Job has reached the specified backoff limit", getRunStatus(t, r).Message)
+	assert.Equal(t, model.Fuzzed, getImage(t, storage).Status)
+}
+
+func TestRecoverFailedRun(t *testing.T) {
+	now := time.Now().UTC()
+	r, storage := createRecoverer(t, createRecoverRun(t, k8s.FuzzRunFailed, "cnfuzz-job-todo-api", now))
+
+	result, err := r.recover(context.TODO(), false, now)
+	require.NoError(t, err)
+	assert.Empty(t, result.Runs)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Failed)
+	assert.Equal(t, string(k8s.FuzzRunFailed), getImage(t, storage).LastRunResult)
+}
+
+func TestRecoverCompletedRun(t *testing.T) {
+	now := time.Now().UTC()
+	r, storage := createRecoverer(t, createRecoverRun(t, k8s.FuzzRunCompleted, "cnfuzz-job-todo-api", now))
+
+	result, err := r.recover(context.TODO(), true, now)
+	require.NoError(t, err)
+	assert.Empty(t, result.Reset)
+	assert.Empty(t, result.Failed)
+	assert.Equal(t, model.BeingFuzzed, getImage(t, storage).Status)
+}
+
+func TestRecoverWithoutRun(t *testing.T) {
+	now := time.Now().UTC()
+
+	// the first pass only suspects the image, the controller may be starting a fuzz job for it
+	r, storage := createRecoverer(t)
+	result, err := r.recover(context.TODO(), false, now)
+	require.NoError(t, err)
+	assert.Empty(t, result.Reset)
+	assert.Equal(t, model.BeingFuzzed, getImage(t, storage).Status)
+
+	result, err = r.recover(context.TODO(), false, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Reset)
+	assert.Equal(t, model.NotFuzzed, getImage(t, storage).Status)
+
+	// nothing is running during startup, so the image is reset right away
+	r, storage = createRecoverer(t)
+	result, err = r.recover(context.TODO(), true, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Reset)
+	assert.Equal(t, model.NotFuzzed, getImage(t, storage).Status)
+}
+
+func TestRecoverRunHistory(t *testing.T) {
+	now := time.Now().UTC()
+	history := func(name string, phase k8s.FuzzRunPhase, started time.Time, recorded bool) *apiv1.ConfigMap {
+		return createRun(t, name, k8s.FuzzRunStatus{
+			Phase:     phase,
+			Target:    "default/todo-api",
+			Images:    []string{"sha256:" + testImageHash},
+			Job:       "cnfuzz-job-todo-api",
+			StartTime: started,
+			Recorded:  recorded,
+		}, "")
+	}
+
+	// the failed run is older than the running run of the image
+	r, storage := createRecoverer(t,
+		history("cnfuzz-run-todo-api-aaaaa", k8s.FuzzRunFailed, now.Add(-2*time.Hour), false),
+		history("cnfuzz-run-todo-api-bbbbb", k8s.FuzzRunRunning, now.Add(-time.Hour), false),
+		createRecoverJob())
+	result, err := r.recover(context.TODO(), true, now)
+	require.NoError(t, err)
+	assert.Empty(t, result.Failed)
+	assert.Empty(t, result.Reset)
+	assert.Equal(t, model.BeingFuzzed, getImage(t, storage).Status)
+
+	// the newest run failed, the older completed run doesn't keep the image busy
+	r, storage = createRecoverer(t,
+		history("cnfuzz-run-todo-api-aaaaa", k8s.FuzzRunFailed, now.Add(-time.Hour), false),
+		history("cnfuzz-run-todo-api-bbbbb", k8s.FuzzRunCompleted, now.Add(-2*time.Hour), true))
+	result, err = r.recover(context.TODO(), true, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Failed)
+	assert.Equal(t, "default/cnfuzz-run-todo-api-aaaaa", getImage(t, storage).LastRun)
+
+	// the newest run was already recorded, the image is being fuzzed again without a run
+	r, storage = createRecoverer(t, history("cnfuzz-run-todo-api-bbbbb", k8s.FuzzRunCompleted, now.Add(-time.Hour), true))
+	result, err = r.recover(context.TODO(), true, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Reset)
+	assert.Equal(t, model.NotFuzzed, getImage(t, storage).Status)
+}
+
+func createSandboxNamespace(name string, created time.Time) *apiv1.Namespace {
+	return &apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:              name,
+		Labels:            map[string]string{k8s.SandboxLabel: "default"},
+		CreationTimestamp: metav1.NewTime(created),
+	}}
+}
+
+func TestRecoverSandboxes(t *testing.T) {
+	now := time.Now().UTC()
+	run := createRun(t, "cnfuzz-run-todo-api", k8s.FuzzRunStatus{
+		Phase:     k8s.FuzzRunRunning,
+		Target:    "default/todo-api",
+		Images:    []string{"sha256:" + testImageHash},
+		Job:       "cnfuzz-job-todo-api",
+		Sandbox:   "cnfuzz-sandbox-used",
+		StartTime: now.Add(-time.Hour),
+	}, "")
+	r, _ := createRecoverer(t, run, createRecoverJob(),
+		createSandboxNamespace("cnfuzz-sandbox-used", now.Add(-time.Hour)),
+		createSandboxNamespace("cnfuzz-sandbox-orphan", now.Add(-time.Hour)),
+		createSandboxNamespace("cnfuzz-sandbox-young", now),
+		&apiv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))}},
+	)
+
+	result, err := r.recover(context.TODO(), false, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cnfuzz-sandbox-orphan"}, result.Sandboxes)
+	namespaces, err := r.client.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, ns := range namespaces.Items {
+		names = append(names, ns.Name)
+	}
+	assert.ElementsMatch(t, []string{"cnfuzz-sandbox-used", "cnfuzz-sandbox-young", "shop"}, names)
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/util"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"github.com/suecodelabs/cnfuzz/src/pkg/schedule"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// ErrNotFound the image or pod to re-fuzz doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// ttlCheckInterval how often the fuzz runs are checked for expired images
+const ttlCheckInterval = 10 * time.Minute
+
+// RefuzzResult images that were reset to not fuzzed and pods that are fuzzed again
+type RefuzzResult struct {
+	// Images keys of the reset images
+	Images []string `json:"images"`
+	// Pods pods that are fuzzed again in the format <namespace>/<name>
+	Pods []string `json:"pods"`
+}
+
+// RefuzzImage resets a fuzzed image and fuzzes the running pods with the image again
+func (c controller) RefuzzImage(ctx context.Context, key string) (RefuzzResult, error) {
+	_, found, err := c.storage.ContainerImageCache.GetByKey(ctx, key)
+	if err != nil {
+		return RefuzzResult{}, fmt.Errorf("failed to get image %s: %w", key, err)
+	}
+	if !found {
+		return RefuzzResult{}, fmt.Errorf("image %s: %w", key, ErrNotFound)
+	}
+	return c.refuzzImages(ctx, []string{key})
+}
+
+// RefuzzPods resets the fuzzed images of a pod, or of all pods inside the namespace when name is empty, and fuzzes the pods again
+func (c controller) RefuzzPods(ctx context.Context, namespace string, name string) (RefuzzResult, error) {
+	var pods []apiv1.Pod
+	if len(name) > 0 {
+		pod, err := c.client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return RefuzzResult{}, fmt.Errorf("pod %s/%s: %w", namespace, name, ErrNotFound)
+		} else if err != nil {
+			return RefuzzResult{}, fmt.Errorf("failed to get pod %s/%s: %w", namespace, name, err)
+		}
+		pods = []apiv1.Pod{*pod}
+	} else {
+		list, err := c.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return RefuzzResult{}, fmt.Errorf("failed to list the pods inside namespace %s: %w", namespace, err)
+		}
+		pods = list.Items
+	}
+
+	var keys []string
+	for i := range pods {
+		keys = append(keys, podImageKeys(c.log, &pods[i])...)
+	}
+	result := RefuzzResult{
+		Images: resetImages(ctx, c.log, c.storage.ContainerImageCache, keys),
+	}
+	for i := range pods {
+		result.Pods = append(result.Pods, c.triggerPod(&pods[i]))
+	}
+	return result, nil
+}
+
+// RefuzzFuzzed resets all fuzzed images and fuzzes the running pods with these images again
+func (c controller) RefuzzFuzzed(ctx context.Context) (RefuzzResult, error) {
+	images, err := c.storage.ContainerImageCache.GetAll(ctx)
+	if err != nil {
+		return RefuzzResult{}, fmt.Errorf("failed to get images: %w", err)
+	}
+	var keys []string
+	for _, image := range images {
+		if image.Status == model.Fuzzed {
+			key, _ := image.String()
+			keys = append(keys, key)
+		}
+	}
+	return c.refuzzImages(ctx, keys)
+}
+
+// RefuzzExpired resets the fuzzed images whose last fuzz run is older than ttl and fuzzes the running pods with these images again
+// the time of the last run is kept with the image, so it doesn't depend on the fuzz runs that are still around
+// fuzzed images without a run time were fuzzed before it was kept, they are fuzzed again right away
+func (c controller) RefuzzExpired(ctx context.Context, ttl time.Duration, now time.Time) (RefuzzResult, error) {
+	images, err := c.storage.ContainerImageCache.GetAll(ctx)
+	if err != nil {
+		return RefuzzResult{}, fmt.Errorf("failed to get images: %w", err)
+	}
+	var keys []string
+	for _, image := range images {
+		if image.Status != model.Fuzzed {
+			continue
+		}
+		if image.LastRunTime == nil || now.Sub(*image.LastRunTime) >= ttl {
+			keys = append(keys, image.Key())
+		}
+	}
+	if len(keys) == 0 {
+		return RefuzzResult{}, nil
+	}
+	return c.refuzzImages(ctx, keys)
+}
+
+// refuzzImages resets images and fuzzes the running pods with the reset images again
+func (c controller) refuzzImages(ctx context.Context, keys []string) (RefuzzResult, error) {
+	result := RefuzzResult{
+		Images: resetImages(ctx, c.log, c.storage.ContainerImageCache, keys),
+	}
+	if len(result.Images) == 0 {
+		return result, nil
+	}
+	reset := make(map[string]bool, len(result.Images))
+	for _, key := range result.Images {
+		reset[key] = true
+	}
+	pods, err := c.client.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return result, fmt.Errorf("failed to list the pods with the reset images: %w", err)
+	}
+	for i := range pods.Items {
+		for _, key := range podImageKeys(c.log, &pods.Items[i]) {
+			if reset[key] {
+				result.Pods = append(result.Pods, c.triggerPod(&pods.Items[i]))
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// triggerPod handles a pod like it was just created, returns the pod in the format <namespace>/<name>
+func (c controller) triggerPod(pod *apiv1.Pod) string {
+	go c.handleEvent(pod)
+	return pod.Namespace + "/" + pod.Name
+}
+
+// resetImages sets the status of fuzzed images back to not fuzzed and returns the keys of the reset images
+// images that are being fuzzed are left alone, so a running fuzz job isn't started twice
+func resetImages(ctx context.Context, l logger.Logger, cache persistence.Cache[model.ContainerImage], keys []string) []string {
+	var reset []string
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		image, found, err := cache.GetByKey(ctx, key)
+		if err != nil {
+			l.V(logger.ImportantLevel).Error(err, "failed to get image from cache", "image", key)
+			continue
+		}
+		if !found || image.Status != model.Fuzzed {
+			continue
+		}
+		image.Status = model.NotFuzzed
+		if err := cache.Update(ctx, *image); err != nil {
+			l.V(logger.ImportantLevel).Error(err, "error while trying to update the status of an image inside cache to \"notfuzzed\"", "image", key)
+			continue
+		}
+		l.V(logger.InfoLevel).Info("image will be fuzzed again", "image", key)
+		reset = append(reset, key)
+	}
+	return reset
+}
+
+// podImageKeys returns the keys of the images of a pod in the format <hash type>:<hash>
+func podImageKeys(l logger.Logger, pod *apiv1.Pod) []string {
+	var keys []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if len(status.ImageID) == 0 {
+			continue
+		}
+		hash, hashType := util.SplitImageId(l, status.ImageID)
+		keys = append(keys, fmt.Sprintf("%s:%s", hashType, hash))
+	}
+	return keys
+}
+
+// refuzzByAnnotation resets the images of a pod when the refuzz annotation of the pod has a value that no fuzz run of its target started with
+func refuzzByAnnotation(ctx context.Context, l logger.Logger, client kubernetes.Interface, cache persistence.Cache[model.ContainerImage], pod *apiv1.Pod, token string) {
+	runs, err := client.CoreV1().ConfigMaps(pod.Namespace).List(ctx, metav1.ListOptions{LabelSelector: k8s.FuzzRunLabel})
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to list fuzz runs, ignoring refuzz annotation", "podName", pod.Name, "podNamespace", pod.Namespace)
+		return
+	}
+	target := k8s.FuzzRunTarget(pod)
+	for i := range runs.Items {
+		status, err := k8s.GetFuzzRunStatus(&runs.Items[i])
+		if err == nil && status.Target == target && status.RefuzzToken == token {
+			return
+		}
+	}
+	if reset := resetImages(ctx, l, cache, podImageKeys(l, pod)); len(reset) > 0 {
+		l.V(logger.InfoLevel).Info("refuzz annotation changed, fuzzing images again", "podName", pod.Name, "podNamespace", pod.Namespace, "images", reset)
+	}
+}
+
+// runRefuzzScheduler re-fuzzes the fuzzed images on the configured schedule and after the configured TTL until stop is closed
+func runRefuzzScheduler(c controller, cnf *config.RefuzzConfig, stop <-chan struct{}) {
+	if cnf == nil {
+		return
+	}
+	var cron *schedule.Cron
+	if len(cnf.Schedule) > 0 {
+		var err error
+		if cron, err = schedule.ParseCron(cnf.Schedule); err != nil {
+			c.log.V(logger.ImportantLevel).Error(err, "scheduled re-fuzzing is disabled")
+		}
+	}
+	ttl, err := cnf.GetTtl()
+	if err != nil {
+		c.log.V(logger.ImportantLevel).Error(err, "re-fuzzing after a TTL is disabled")
+	}
+	if cron == nil && ttl == 0 {
+		return
+	}
+
+	var next, lastTtlCheck time.Time
+	if cron != nil {
+		next = cron.Next(time.Now())
+		c.log.V(logger.InfoLevel).Info("scheduled re-fuzzing of fuzzed images", "schedule", cnf.Schedule, "next", next)
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if cron != nil && !next.IsZero() && !now.Before(next) {
+				result, err := c.RefuzzFuzzed(context.TODO())
+				logRefuzz(c.log, "schedule", result, err)
+				next = cron.Next(now)
+			}
+			if ttl > 0 && now.Sub(lastTtlCheck) >= ttlCheckInterval {
+				result, err := c.RefuzzExpired(context.TODO(), ttl, now)
+				logRefuzz(c.log, "ttl", result, err)
+				lastTtlCheck = now
+			}
+		}
+	}
+}
+
+func logRefuzz(l logger.Logger, reason string, result RefuzzResult, err error) {
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to re-fuzz images", "reason", reason)
+		return
+	}
+	if len(result.Images) > 0 {
+		l.V(logger.InfoLevel).Info("re-fuzzing images", "reason", reason, "images", result.Images, "pods", result.Pods)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"sort"
+	"testing"
+	"time"
+)
+
+const otherImageHash = "729610843b7af92d6c481af4e066cb3d4dfabbe8de7d29f58e8cff2f7170115b"
+
+func createImagePod(namespace string, name string, hash string) *apiv1.Pod {
+	return &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"app": name}},
+		Status: apiv1.PodStatus{ContainerStatuses: []apiv1.ContainerStatus{
+			{Name: "api", ImageID: "docker-pullable://localhost:5000/" + name + "@sha256:" + hash},
+		}},
+	}
+}
+
+// createRefuzzController creates a controller with two fuzzed images and a pod for each image, handled pods are sent to the channel
+func createRefuzzController(t *testing.T) (controller, chan string) {
+	l := logger.CreateDebugLogger()
+	storage := persistence.InitMemoryCache(l)
+	for _, hash := range []string{testImageHash, otherImageHash} {
+		image, _ := model.CreateContainerImage(hash, "sha256", model.Fuzzed)
+		require.NoError(t, storage.ContainerImageCache.Create(context.TODO(), image))
+	}
+	client := fake.NewSimpleClientset(createImagePod("default", "todo-api", testImageHash), createImagePod("shop", "shop-api", otherImageHash))
+	handled := make(chan string, 10)
+	c := controller{log: l, client: client, storage: storage}
+	c.handleFunc = func(l logger.Logger, clientSet kubernetes.Interface, storage *persistence.Storage, config *config.CnFuzzConfig, overwrites config.DDocOverwrites, pod *apiv1.Pod) {
+		handled <- pod.Namespace + "/" + pod.Name
+	}
+	return c, handled
+}
+
+func imageStatus(t *testing.T, c controller, hash string) model.ImageFuzzStatus {
+	image, found, err := c.storage.ContainerImageCache.GetByKey(context.TODO(), "sha256:"+hash)
+	require.NoError(t, err)
+	require.True(t, found)
+	return image.Status
+}
+
+func TestRefuzzImage(t *testing.T) {
+	c, handled := createRefuzzController(t)
+
+	result, err := c.RefuzzImage(context.TODO(), "sha256:"+testImageHash)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Images)
+	assert.Equal(t, []string{"default/todo-api"}, result.Pods)
+	assert.Equal(t, "default/todo-api", <-handled)
+	assert.Equal(t, model.NotFuzzed, imageStatus(t, c, testImageHash))
+	assert.Equal(t, model.Fuzzed, imageStatus(t, c, otherImageHash))
+
+	_, err = c.RefuzzImage(context.TODO(), "sha256:unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRefuzzPods(t *testing.T) {
+	c, handled := createRefuzzController(t)
+
+	result, err := c.RefuzzPods(context.TODO(), "shop", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + otherImageHash}, result.Images)
+	assert.Equal(t, []string{"shop/shop-api"}, result.Pods)
+	assert.Equal(t, "shop/shop-api", <-handled)
+	assert.Equal(t, model.NotFuzzed, imageStatus(t, c, otherImageHash))
+
+	result, err = c.RefuzzPods(context.TODO(), "default", "todo-api")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default/todo-api"}, result.Pods)
+	assert.Equal(t, "default/todo-api", <-handled)
+	assert.Equal(t, model.NotFuzzed, imageStatus(t, c, testImageHash))
+
+	_, err = c.RefuzzPods(context.TODO(), "default", "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRefuzzFuzzed(t *testing.T) {
+	c, handled := createRefuzzController(t)
+	beingFuzzed, _ := model.CreateContainerImage(testImageHash, "sha256", model.BeingFuzzed)
+	require.NoError(t, c.storage.ContainerImageCache.Update(context.TODO(), beingFuzzed))
+
+	result, err := c.RefuzzFuzzed(context.TODO())
+	require.NoError(t, err)
+	// images that are being fuzzed aren't reset
+	assert.Equal(t, []string{"sha256:" + otherImageHash}, result.Images)
+	assert.Equal(t, "shop/shop-api", <-handled)
+	assert.Equal(t, model.BeingFuzzed, imageStatus(t, c, testImageHash))
+}
+
+func TestRefuzzExpired(t *testing.T) {
+	c, handled := createRefuzzController(t)
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	for hash, completed := range map[string]time.Time{testImageHash: now.Add(-time.Hour), otherImageHash: now.Add(-48 * time.Hour)} {
+		image, _, err := c.storage.ContainerImageCache.GetByKey(ctx, "sha256:"+hash)
+		require.NoError(t, err)
+		image.RecordRun("default/cnfuzz-run-x", string(k8s.FuzzRunCompleted), nil, completed)
+		require.NoError(t, c.storage.ContainerImageCache.Update(ctx, *image))
+	}
+
+	// the fuzz runs of the images are gone, the images know when they were fuzzed
+	result, err := c.RefuzzExpired(ctx, 24*time.Hour, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + otherImageHash}, result.Images)
+	assert.Equal(t, "shop/shop-api", <-handled)
+	assert.Equal(t, model.Fuzzed, imageStatus(t, c, testImageHash))
+
+	result, err = c.RefuzzExpired(ctx, 30*time.Minute, now)
+	require.NoError(t, err)
+	sort.Strings(result.Images)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Images, "the other image was already reset")
+}
+
+func TestRefuzzExpiredWithoutRunTime(t *testing.T) {
+	c, _ := createRefuzzController(t)
+	ctx := context.TODO()
+	image, _, err := c.storage.ContainerImageCache.GetByKey(ctx, "sha256:"+otherImageHash)
+	require.NoError(t, err)
+	image.Status = model.BeingFuzzed
+	require.NoError(t, c.storage.ContainerImageCache.Update(ctx, *image))
+
+	// images that are being fuzzed aren't reset
+	result, err := c.RefuzzExpired(ctx, 24*time.Hour, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256:" + testImageHash}, result.Images)
+	assert.Equal(t, model.BeingFuzzed, imageStatus(t, c, otherImageHash))
+}
+
+func TestRefuzzByAnnotation(t *testing.T) {
+	c, _ := createRefuzzController(t)
+	ctx := context.TODO()
+	pod := createImagePod("default", "todo-api", testImageHash)
+	pod.Annotations = map[string]string{"cnfuzz/refuzz": "1"}
+	_, err := k8s.CreateFuzzRun(ctx, c.log, c.client, pod, "job", pod.Namespace, k8s.FuzzJobOptions{})
+	require.NoError(t, err)
+
+	// a run of the target already started with this token
+	refuzzByAnnotation(ctx, c.log, c.client, c.storage.ContainerImageCache, pod, "1")
+	assert.Equal(t, model.Fuzzed, imageStatus(t, c, testImageHash))
+
+	pod.Annotations["cnfuzz/refuzz"] = "2"
+	refuzzByAnnotation(ctx, c.log, c.client, c.storage.ContainerImageCache, pod, "2")
+	assert.Equal(t, model.NotFuzzed, imageStatus(t, c, testImageHash))
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/diff"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/openapi"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// startFuzzing discovers the OpenAPI doc of a pod and starts fuzzing the pod with it
+// with differential fuzzing only the operations that changed since the previous run of the workload are fuzzed
+func startFuzzing(l logger.Logger, client kubernetes.Interface, cache persistence.Cache[model.ContainerImage], cnf *config.CnFuzzConfig, overwrites config.DDocOverwrites, pod *apiv1.Pod, images []model.ContainerImage) {
+	doc, err := k8s.DiscoverOpenApiDoc(l, overwrites, pod)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to discover the OpenAPI doc, not fuzzing pod", "podName", pod.Name, "podNamespace", pod.Namespace)
+		return
+	}
+	differential := cnf.DifferentialConfig != nil && cnf.DifferentialConfig.Enabled
+	startFuzzJob(l, client, cache, cnf, pod, images, doc, nil, differential)
+}
+
+// startFuzzJob remembers the spec that the images are fuzzed against and starts the fuzz job for the pod
+// the job only fuzzes the given operations, or all operations when there are none.
+// The spec is compared with the spec of the previous run of the workload, with differential the job only fuzzes the changed operations.
+func startFuzzJob(l logger.Logger, client kubernetes.Interface, cache persistence.Cache[model.ContainerImage], cnf *config.CnFuzzConfig, pod *apiv1.Pod, images []model.ContainerImage, doc openapi.UnParsedOpenApiDoc, operations []string, differential bool) {
+	opts := k8s.FuzzJobOptions{}
+	desc, err := openapi.ParseOpenApiDoc(l, doc)
+	if err != nil {
+		l.V(logger.InfoLevel).Error(err, "failed to parse the OpenAPI doc, spec changes of the pod can't be detected", "podName", pod.Name, "podNamespace", pod.Namespace)
+	} else {
+		recordSpec(l, cache, images, desc.Hash(), desc.OperationHashes(), time.Now().UTC())
+		if opts.Spec, err = doc.DocFile.MarshalJSON(); err != nil {
+			l.V(logger.InfoLevel).Error(err, "failed to encode the OpenAPI doc for the fuzz run", "podName", pod.Name, "podNamespace", pod.Namespace)
+		}
+		opts.SpecDiff = compareWithPreviousRun(context.TODO(), l, client, pod, doc, desc)
+	}
+	if differential && len(operations) == 0 && opts.SpecDiff != nil {
+		operations = opts.SpecDiff.Operations()
+	}
+	opts.Operations = operations
+	if len(operations) > 0 && cnf.DifferentialConfig != nil {
+		opts.TimeBudget = cnf.DifferentialConfig.TimeBudget
+	}
+	if err := k8s.StartFuzzJob(l, client, cnf, pod, doc, opts); err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to start fuzz job", "podName", pod.Name, "podNamespace", pod.Namespace)
+	}
+}
+
+// compareWithPreviousRun compares the spec with the spec of the most recent completed run of the workload of the pod
+// returns nil when there is no previous run with a spec or when nothing changed
+func compareWithPreviousRun(ctx context.Context, l logger.Logger, client kubernetes.Interface, pod *apiv1.Pod, doc openapi.UnParsedOpenApiDoc, desc *discovery.WebApiDescription) *diff.Diff {
+	runs, err := client.CoreV1().ConfigMaps(pod.Namespace).List(ctx, metav1.ListOptions{LabelSelector: k8s.FuzzRunLabel})
+	if err != nil {
+		l.V(logger.InfoLevel).Error(err, "failed to list the previous fuzz runs", "podName", pod.Name, "podNamespace", pod.Namespace)
+		return nil
+	}
+	target := k8s.FuzzRunTarget(pod)
+	var previous *apiv1.ConfigMap
+	var previousTime time.Time
+	for i := range runs.Items {
+		status, err := k8s.GetFuzzRunStatus(&runs.Items[i])
+		if err != nil || status.Target != target || status.Phase != k8s.FuzzRunCompleted || status.CompletionTime == nil {
+			continue
+		}
+		if _, found := runs.Items[i].Data[k8s.FuzzRunSpecKey]; found && status.CompletionTime.After(previousTime) {
+			previous = &runs.Items[i]
+			previousTime = *status.CompletionTime
+		}
+	}
+	if previous == nil {
+		return nil
+	}
+
+	previousDoc, err := openapi.UnMarshalOpenApiDoc(l, []byte(previous.Data[k8s.FuzzRunSpecKey]), doc.Uri)
+	var previousDesc *discovery.WebApiDescription
+	if err == nil {
+		previousDesc, err = openapi.ParseOpenApiDoc(l, previousDoc)
+	}
+	if err != nil {
+		l.V(logger.InfoLevel).Error(err, "failed to read the spec of the previous fuzz run", "fuzzRun", previous.Name, "podNamespace", pod.Namespace)
+		return nil
+	}
+	specDiff := diff.Compare(previousDesc, desc)
+	if specDiff.IsEmpty() {
+		return nil
+	}
+	l.V(logger.InfoLevel).Info("OpenAPI spec changed since the previous fuzz run", "target", target, "previousRun", previous.Name, "added", specDiff.Added, "removed", specDiff.Removed, "changed", specDiff.Changed)
+	for _, change := range specDiff.Breaking() {
+		l.V(logger.ImportantLevel).Info("breaking change in OpenAPI spec", "target", target, "operation", change.Operation, "kind", change.Kind, "name", change.Name, "change", change.Message)
+	}
+	return &specDiff
+}
+
+// checkSpecChange checks if the OpenAPI spec served by a pod with fuzzed images changed since the images were fuzzed
+// the spec is checked at most once per spec check interval, when it changed the images are marked as being fuzzed again
+// returns the discovered doc and the operations to fuzz, all operations have to be fuzzed when there are none
+func checkSpecChange(l logger.Logger, cache persistence.Cache[model.ContainerImage], cnf *config.RefuzzConfig, overwrites config.DDocOverwrites, pod *apiv1.Pod, images []model.ContainerImage, now time.Time) (doc openapi.UnParsedOpenApiDoc, operations []string, refuzz bool) {
+	if cnf == nil || len(cnf.SpecChanges) == 0 || len(images) == 0 {
+		return doc, nil, false
+	}
+	interval, err := cnf.GetSpecCheckInterval()
+	if err != nil {
+		interval = config.DefaultSpecCheckInterval
+	}
+	due := false
+	var previous model.ContainerImage
+	for _, image := range images {
+		if image.Status != model.Fuzzed {
+			// the images are being fuzzed or will be fuzzed anyway
+			return doc, nil, false
+		}
+		if image.SpecCheckTime == nil || now.Sub(*image.SpecCheckTime) >= interval {
+			due = true
+		}
+		if len(previous.SpecHash) == 0 {
+			previous = image
+		}
+	}
+	if !due {
+		return doc, nil, false
+	}
+
+	doc, err = k8s.DiscoverOpenApiDoc(l, overwrites, pod)
+	var desc *discovery.WebApiDescription
+	if err == nil {
+		desc, err = openapi.ParseOpenApiDoc(l, doc)
+	}
+	if err != nil {
+		l.V(logger.InfoLevel).Error(err, "failed to get the OpenAPI spec for detecting spec changes", "podName", pod.Name, "podNamespace", pod.Namespace)
+		recordSpec(l, cache, images, "", nil, now)
+		return doc, nil, false
+	}
+
+	hash, hashes := desc.Hash(), desc.OperationHashes()
+	if len(previous.SpecHash) == 0 || previous.SpecHash == hash {
+		// images that were fuzzed before their spec was recorded get the current spec as baseline
+		recordSpec(l, cache, images, hash, hashes, now)
+		return doc, nil, false
+	}
+	if cnf.SpecChanges == config.SpecChangesChanged && len(previous.SpecOperations) > 0 {
+		operations = discovery.ChangedOperations(previous.SpecOperations, hashes)
+		if len(operations) == 0 {
+			l.V(logger.InfoLevel).Info("OpenAPI spec changed without new or changed operations, not fuzzing pod again", "podName", pod.Name, "podNamespace", pod.Namespace)
+			recordSpec(l, cache, images, hash, hashes, now)
+			return doc, nil, false
+		}
+	}
+
+	l.V(logger.InfoLevel).Info("OpenAPI spec changed since the images were fuzzed, fuzzing pod again", "podName", pod.Name, "podNamespace", pod.Namespace, "operations", operations)
+	for _, image := range images {
+		image.Status = model.BeingFuzzed
+		image.SpecCheckTime = &now
+		if err := cache.Update(context.TODO(), image); err != nil {
+			l.V(logger.ImportantLevel).Error(err, "error while trying to update the status of an image inside cache to \"beingfuzzed\"", "image", image.Key())
+			return doc, nil, false
+		}
+	}
+	return doc, operations, true
+}
+
+// recordSpec stores the spec hashes and the time the spec was checked with the images, the hashes are kept when hash is empty
+func recordSpec(l logger.Logger, cache persistence.Cache[model.ContainerImage], images []model.ContainerImage, hash string, operations map[string]string, checked time.Time) {
+	for _, img := range images {
+		image, found, err := cache.GetByKey(context.TODO(), img.Key())
+		if err != nil || !found {
+			l.V(logger.InfoLevel).Error(err, "failed to find image inside cache", "image", img.Key())
+			continue
+		}
+		if len(hash) > 0 {
+			image.RecordSpec(hash, operations, checked)
+		} else {
+			image.SpecCheckTime = &checked
+		}
+		if err := cache.Update(context.TODO(), *image); err != nil {
+			l.V(logger.ImportantLevel).Error(err, "error while trying to store the spec of an image inside cache", "image", img.Key())
+		}
+	}
+}
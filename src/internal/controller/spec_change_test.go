@@ -0,0 +1,165 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/openapi"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const specV1 = `{
+  "openapi": "3.0.3",
+  "info": {"title": "todo api", "version": "1.0"},
+  "paths": {
+    "/todos": {
+      "get": {"responses": {"200": {"description": "ok"}}}
+    }
+  }
+}`
+
+const specV2 = `{
+  "openapi": "3.0.3",
+  "info": {"title": "todo api", "version": "1.1"},
+  "paths": {
+    "/todos": {
+      "get": {"responses": {"200": {"description": "ok"}}},
+      "post": {"responses": {"201": {"description": "created"}}}
+    }
+  }
+}`
+
+func TestCheckSpecChange(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	ctx := context.TODO()
+	spec := specV1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(spec))
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverUrl.Port())
+	overwrites := config.DDocOverwrites{DiscoveryDocIP: serverUrl.Hostname(), DiscoveryDocPort: int32(port)}
+
+	storage := persistence.InitMemoryCache(l)
+	image, _ := model.CreateContainerImage(testImageHash, "sha256", model.Fuzzed)
+	require.NoError(t, storage.ContainerImageCache.Create(ctx, image))
+	cache := storage.ContainerImageCache
+	pod := createImagePod("default", "todo-api", testImageHash)
+	cnf := &config.RefuzzConfig{SpecChanges: config.SpecChangesChanged, SpecCheckInterval: "1h"}
+	now := time.Now().UTC()
+	getImage := func() model.ContainerImage {
+		stored, _, err := cache.GetByKey(ctx, image.Key())
+		require.NoError(t, err)
+		return *stored
+	}
+
+	// the first check records the spec as baseline
+	_, _, refuzz := checkSpecChange(l, cache, cnf, overwrites, pod, []model.ContainerImage{getImage()}, now)
+	assert.False(t, refuzz)
+	baseline := getImage()
+	assert.NotEmpty(t, baseline.SpecHash)
+	assert.Contains(t, baseline.SpecOperations, "GET /todos")
+
+	// the spec isn't checked again within the interval
+	spec = specV2
+	_, _, refuzz = checkSpecChange(l, cache, cnf, overwrites, pod, []model.ContainerImage{getImage()}, now.Add(time.Minute))
+	assert.False(t, refuzz)
+	assert.Equal(t, baseline.SpecHash, getImage().SpecHash)
+
+	_, operations, refuzz := checkSpecChange(l, cache, cnf, overwrites, pod, []model.ContainerImage{getImage()}, now.Add(2*time.Hour))
+	assert.True(t, refuzz)
+	assert.Equal(t, []string{"POST /todos"}, operations)
+	assert.Equal(t, model.BeingFuzzed, getImage().Status)
+
+	// images that are being fuzzed aren't checked
+	_, _, refuzz = checkSpecChange(l, cache, cnf, overwrites, pod, []model.ContainerImage{getImage()}, now.Add(4*time.Hour))
+	assert.False(t, refuzz)
+
+	// full runs don't limit the operations
+	stored := getImage()
+	stored.Status = model.Fuzzed
+	require.NoError(t, cache.Update(ctx, stored))
+	cnf.SpecChanges = config.SpecChangesFull
+	_, operations, refuzz = checkSpecChange(l, cache, cnf, overwrites, pod, []model.ContainerImage{getImage()}, now.Add(6*time.Hour))
+	assert.True(t, refuzz)
+	assert.Empty(t, operations)
+
+	// detecting spec changes is disabled by default
+	_, _, refuzz = checkSpecChange(l, cache, &config.RefuzzConfig{}, overwrites, pod, []model.ContainerImage{stored}, now.Add(8*time.Hour))
+	assert.False(t, refuzz)
+}
+
+// createRun creates a fuzz run ConfigMap with the status and the spec
+func createRun(t *testing.T, name string, status k8s.FuzzRunStatus, spec string) *apiv1.ConfigMap {
+	data, err := json.Marshal(status)
+	require.NoError(t, err)
+	return &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{k8s.FuzzRunLabel: "true"}},
+		Data:       map[string]string{k8s.FuzzRunStatusKey: string(data), k8s.FuzzRunSpecKey: spec},
+	}
+}
+
+func TestCompareWithPreviousRun(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	pod := createImagePod("default", "todo-api", testImageHash)
+	uri, _ := url.Parse("http://todo-api/openapi.json")
+	doc, err := openapi.UnMarshalOpenApiDoc(l, []byte(specV2), uri)
+	require.NoError(t, err)
+	desc, err := openapi.ParseOpenApiDoc(l, doc)
+	require.NoError(t, err)
+
+	// no previous run
+	client := fake.NewSimpleClientset()
+	assert.Nil(t, compareWithPreviousRun(context.TODO(), l, client, pod, doc, desc))
+
+	target := k8s.FuzzRunTarget(pod)
+	older := time.Now().UTC().Add(-2 * time.Hour)
+	newer := older.Add(time.Hour)
+	client = fake.NewSimpleClientset(
+		createRun(t, "cnfuzz-run-old", k8s.FuzzRunStatus{Phase: k8s.FuzzRunCompleted, Target: target, CompletionTime: &older}, specV2),
+		createRun(t, "cnfuzz-run-previous", k8s.FuzzRunStatus{Phase: k8s.FuzzRunCompleted, Target: target, CompletionTime: &newer}, specV1),
+		createRun(t, "cnfuzz-run-running", k8s.FuzzRunStatus{Phase: k8s.FuzzRunRunning, Target: target}, specV2),
+		createRun(t, "cnfuzz-run-other", k8s.FuzzRunStatus{Phase: k8s.FuzzRunCompleted, Target: "default/shop-api", CompletionTime: &newer}, specV2),
+	)
+	specDiff := compareWithPreviousRun(context.TODO(), l, client, pod, doc, desc)
+	require.NotNil(t, specDiff)
+	assert.Equal(t, []string{"POST /todos"}, specDiff.Added)
+	assert.Empty(t, specDiff.Removed)
+	assert.Equal(t, []string{"POST /todos"}, specDiff.Operations())
+	assert.Empty(t, specDiff.Breaking())
+
+	// the same spec as the previous run
+	client = fake.NewSimpleClientset(createRun(t, "cnfuzz-run-previous", k8s.FuzzRunStatus{Phase: k8s.FuzzRunCompleted, Target: target, CompletionTime: &newer}, specV2))
+	assert.Nil(t, compareWithPreviousRun(context.TODO(), l, client, pod, doc, desc))
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package coverage describes how much of an API was exercised during a fuzz run
+package coverage
+
+import (
+	"sort"
+	"strings"
+)
+
+// Status of an operation after fuzzing
+type Status string
+
+const (
+	// Succeeded the operation returned a 2xx response at least once
+	Succeeded Status = "succeeded"
+	// Failed the operation was attempted but never returned a 2xx response
+	Failed Status = "failed"
+	// NotAttempted the fuzzer never sent a request for the operation
+	NotAttempted Status = "not-attempted"
+)
+
+// BlockingReason reason why an operation never succeeded
+type BlockingReason string
+
+const (
+	// AuthReason the API rejected the credentials (401 or 403)
+	AuthReason BlockingReason = "auth"
+	// DependencyReason a request that creates a resource the operation depends on failed
+	DependencyReason BlockingReason = "dependency"
+	// InvalidBodyReason the API rejected the request as invalid (4xx)
+	InvalidBodyReason BlockingReason = "invalid-body"
+	// ServerErrorReason the API returned a server error (5xx)
+	ServerErrorReason BlockingReason = "server-error"
+	// NotRenderedReason the fuzzer didn't render a request for the operation
+	NotRenderedReason BlockingReason = "not-rendered"
+	// UnknownReason the operation never succeeded, but the response doesn't tell why (e.g. a 3xx or no response at all)
+	UnknownReason BlockingReason = "unknown"
+)
+
+// ReasonOfStatusCode derives why an operation didn't succeed from the status code of its response
+func ReasonOfStatusCode(statusCode string) BlockingReason {
+	switch {
+	case statusCode == "401" || statusCode == "403":
+		return AuthReason
+	case strings.HasPrefix(statusCode, "5"):
+		return ServerErrorReason
+	case strings.HasPrefix(statusCode, "4"):
+		return InvalidBodyReason
+	default:
+		return UnknownReason
+	}
+}
+
+// EndpointCoverage coverage of a single operation of the API
+type EndpointCoverage struct {
+	Method   string `json:"method"`
+	Endpoint string `json:"endpoint"`
+	Status   Status `json:"status"`
+	// StatusCode status code of the last response to the operation
+	StatusCode string `json:"statusCode,omitempty"`
+	// Reason why the operation never succeeded, empty when it succeeded
+	Reason BlockingReason `json:"reason,omitempty"`
+	// Message error message of the fuzzer or status text of the API
+	Message string `json:"message,omitempty"`
+}
+
+// Attempted checks if the fuzzer sent requests for the operation
+func (e EndpointCoverage) Attempted() bool {
+	return e.Status != NotAttempted
+}
+
+// Coverage coverage of all operations of an API
+type Coverage struct {
+	Endpoints []EndpointCoverage `json:"endpoints"`
+}
+
+// Summary coverage numbers of a fuzz run
+type Summary struct {
+	Total     int `json:"total"`
+	Attempted int `json:"attempted"`
+	Succeeded int `json:"succeeded"`
+	// Blocked number of operations that never succeeded per reason
+	Blocked map[BlockingReason]int `json:"blocked,omitempty"`
+}
+
+// Summary counts the operations per status and blocking reason
+func (c Coverage) Summary() Summary {
+	summary := Summary{Total: len(c.Endpoints)}
+	for _, endpoint := range c.Endpoints {
+		if endpoint.Attempted() {
+			summary.Attempted++
+		}
+		if endpoint.Status == Succeeded {
+			summary.Succeeded++
+			continue
+		}
+		if summary.Blocked == nil {
+			summary.Blocked = make(map[BlockingReason]int)
+		}
+		summary.Blocked[endpoint.Reason]++
+	}
+	return summary
+}
+
+// Percentage returns the part of the operations that succeeded as percentage
+func (s Summary) Percentage() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Succeeded) / float64(s.Total) * 100
+}
+
+// Sort sorts the operations by endpoint and method
+func (c Coverage) Sort() {
+	sort.Slice(c.Endpoints, func(i, j int) bool {
+		if c.Endpoints[i].Endpoint != c.Endpoints[j].Endpoint {
+			return c.Endpoints[i].Endpoint < c.Endpoints[j].Endpoint
+		}
+		return c.Endpoints[i].Method < c.Endpoints[j].Method
+	})
+}
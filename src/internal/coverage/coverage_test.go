@@ -0,0 +1,109 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package coverage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReasonOfStatusCode(t *testing.T) {
+	tests := []struct {
+		statusCode string
+		want       BlockingReason
+	}{
+		{"401", AuthReason},
+		{"403", AuthReason},
+		{"400", InvalidBodyReason},
+		{"404", InvalidBodyReason},
+		{"422", InvalidBodyReason},
+		{"500", ServerErrorReason},
+		{"503", ServerErrorReason},
+		{"302", UnknownReason},
+		{"", UnknownReason},
+	}
+	for _, tt := range tests {
+		t.Run(tt.statusCode, func(t *testing.T) {
+			assert.Equal(t, tt.want, ReasonOfStatusCode(tt.statusCode))
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		endpoints  []EndpointCoverage
+		want       Summary
+		percentage float64
+	}{
+		{
+			name: "no operations",
+			want: Summary{},
+		},
+		{
+			name: "all succeeded",
+			endpoints: []EndpointCoverage{
+				{Method: "GET", Endpoint: "/todo", Status: Succeeded},
+				{Method: "POST", Endpoint: "/todo", Status: Succeeded},
+			},
+			want:       Summary{Total: 2, Attempted: 2, Succeeded: 2},
+			percentage: 100,
+		},
+		{
+			name: "blocked operations are counted per reason",
+			endpoints: []EndpointCoverage{
+				{Method: "GET", Endpoint: "/todo", Status: Succeeded},
+				{Method: "POST", Endpoint: "/todo", Status: Failed, Reason: AuthReason},
+				{Method: "PUT", Endpoint: "/todo/{id}", Status: Failed, Reason: AuthReason},
+				{Method: "DELETE", Endpoint: "/todo/{id}", Status: NotAttempted, Reason: NotRenderedReason},
+			},
+			want:       Summary{Total: 4, Attempted: 3, Succeeded: 1, Blocked: map[BlockingReason]int{AuthReason: 2, NotRenderedReason: 1}},
+			percentage: 25,
+		},
+		{
+			name: "none succeeded",
+			endpoints: []EndpointCoverage{
+				{Method: "GET", Endpoint: "/todo", Status: Failed, Reason: ServerErrorReason},
+				{Method: "POST", Endpoint: "/todo", Status: Failed, Reason: DependencyReason},
+				{Method: "DELETE", Endpoint: "/todo", Status: Failed, Reason: UnknownReason},
+			},
+			want:       Summary{Total: 3, Attempted: 3, Blocked: map[BlockingReason]int{ServerErrorReason: 1, DependencyReason: 1, UnknownReason: 1}},
+			percentage: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := Coverage{Endpoints: tt.endpoints}.Summary()
+			assert.Equal(t, tt.want, summary)
+			assert.InDelta(t, tt.percentage, summary.Percentage(), 0.001)
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	c := Coverage{Endpoints: []EndpointCoverage{
+		{Method: "POST", Endpoint: "/todo"},
+		{Method: "DELETE", Endpoint: "/todo/{id}"},
+		{Method: "GET", Endpoint: "/todo"},
+	}}
+	c.Sort()
+	assert.Equal(t, []EndpointCoverage{
+		{Method: "GET", Endpoint: "/todo"},
+		{Method: "POST", Endpoint: "/todo"},
+		{Method: "DELETE", Endpoint: "/todo/{id}"},
+	}, c.Endpoints)
+}
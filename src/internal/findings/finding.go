@@ -0,0 +1,62 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package findings
+
+// Severity of a finding
+type Severity string
+
+const (
+	HighSeverity   Severity = "high"
+	MediumSeverity Severity = "medium"
+	LowSeverity    Severity = "low"
+)
+
+// Finding a bug that was found while fuzzing an API
+type Finding struct {
+	// Checker name of the fuzzer checker that found the bug
+	Checker  string   `json:"checker"`
+	Severity Severity `json:"severity"`
+	// StatusCode status code (class) of the response that triggered the bug, e.g. 500 or 20x
+	StatusCode string `json:"statusCode"`
+	// Method and Endpoint operation inside the OpenAPI doc that triggered the bug, empty when it is unknown
+	Method   string `json:"method,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	// BugHash hash of the bug calculated by the fuzzer
+	BugHash      string `json:"bugHash,omitempty"`
+	Reproducible bool   `json:"reproducible"`
+	// File fuzzer file with the details of the bug
+	File string `json:"file,omitempty"`
+	// ReproSequence requests that reproduce the bug, the last request triggers the bug
+	ReproSequence []ReproStep `json:"reproSequence,omitempty"`
+}
+
+// ReproStep a single request inside a repro sequence
+type ReproStep struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Request string `json:"request"`
+	// ResponseStatus status line of the response to the request
+	ResponseStatus string `json:"responseStatus,omitempty"`
+}
+
+// Operation returns the operation that triggered the bug in the format '<method> <endpoint>'
+func (f Finding) Operation() string {
+	if len(f.Endpoint) == 0 {
+		return ""
+	}
+	return f.Method + " " + f.Endpoint
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package findings
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fingerprint returns a hash that identifies the bug across fuzz runs and images
+// it is calculated from the operation, the checker, the status code and the structure of the body of the request that triggered the bug,
+// so values that are generated by the fuzzer don't change the fingerprint
+func (f Finding) Fingerprint() string {
+	method, endpoint := f.Method, f.Endpoint
+	body := ""
+	if steps := len(f.ReproSequence); steps > 0 {
+		last := f.ReproSequence[steps-1]
+		if len(endpoint) == 0 {
+			method, endpoint = last.Method, NormalizePath(last.Path)
+		}
+		body = NormalizeBody(requestBody(last.Request))
+	}
+	hash := sha256.New()
+	for _, part := range []string{strings.ToUpper(method), endpoint, f.Checker, f.StatusCode, body} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// NormalizePath removes the query and replaces numeric path segments with a placeholder
+func NormalizePath(path string) string {
+	path = strings.SplitN(path, "?", 2)[0]
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if _, err := strconv.ParseFloat(segment, 64); err == nil {
+			segments[i] = "{n}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// NormalizeBody reduces a JSON body to its structure, e.g. {"id":1,"tags":["a"]} becomes {"id":number,"tags":[string]}
+// bodies that aren't JSON are ignored, they mostly contain values generated by the fuzzer
+func NormalizeBody(body string) string {
+	var value interface{}
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return ""
+	}
+	builder := &strings.Builder{}
+	writeStructure(builder, value)
+	return builder.String()
+}
+
+// writeStructure writes the structure of a decoded JSON value
+func writeStructure(builder *strings.Builder, value interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		builder.WriteString("{")
+		for i, key := range keys {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(strconv.Quote(key) + ":")
+			writeStructure(builder, typed[key])
+		}
+		builder.WriteString("}")
+	case []interface{}:
+		builder.WriteString("[")
+		if len(typed) > 0 {
+			writeStructure(builder, typed[0])
+		}
+		builder.WriteString("]")
+	case string:
+		builder.WriteString("string")
+	case float64:
+		builder.WriteString("number")
+	case bool:
+		builder.WriteString("boolean")
+	default:
+		builder.WriteString("null")
+	}
+}
+
+// requestBody returns the body of a raw HTTP request
+func requestBody(request string) string {
+	parts := strings.SplitN(request, "\n\n", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package findings
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func createTestFinding(body string) Finding {
+	return Finding{
+		Checker:    "main_driver",
+		Severity:   MediumSeverity,
+		StatusCode: "500",
+		Method:     "POST",
+		Endpoint:   "/todo",
+		ReproSequence: []ReproStep{
+			{Method: "POST", Path: "/api/todo", Request: "POST /api/todo HTTP/1.1\nContent-Type: application/json\n\n" + body},
+		},
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := createTestFinding(`{"title":"fuzzstring","done":false}`).Fingerprint()
+	assert.Len(t, fingerprint, 64)
+
+	// fuzzed values and the order of the keys don't matter
+	assert.Equal(t, fingerprint, createTestFinding(`{"done":true, "title":"other"}`).Fingerprint())
+	// the structure of the body does
+	assert.NotEqual(t, fingerprint, createTestFinding(`{"title":"fuzzstring"}`).Fingerprint())
+
+	otherStatus := createTestFinding(`{"title":"fuzzstring","done":false}`)
+	otherStatus.StatusCode = "502"
+	assert.NotEqual(t, fingerprint, otherStatus.Fingerprint())
+
+	// without an operation the normalized path of the request is used
+	first := Finding{Checker: "main_driver", StatusCode: "500", ReproSequence: []ReproStep{{Method: "GET", Path: "/todo/1?q=a"}}}
+	second := Finding{Checker: "main_driver", StatusCode: "500", ReproSequence: []ReproStep{{Method: "GET", Path: "/todo/2"}}}
+	assert.Equal(t, first.Fingerprint(), second.Fingerprint())
+}
+
+func TestNormalizeBody(t *testing.T) {
+	assert.Equal(t, `{"done":boolean,"due":null,"id":number,"owner":{"name":string},"tags":[string]}`,
+		NormalizeBody(`{"id":1,"tags":["a","b"],"owner":{"name":"x"},"done":true,"due":null}`))
+	assert.Equal(t, "[]", NormalizeBody(`[]`))
+	assert.Empty(t, NormalizeBody("fuzzstring"))
+}
+
+func TestNormalizePath(t *testing.T) {
+	assert.Equal(t, "/todo/{n}/items", NormalizePath("/todo/12/items?limit=5"))
+	assert.Equal(t, "/todo/latest", NormalizePath("/todo/latest"))
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package findings
+
+import (
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"sort"
+	"time"
+)
+
+// RecordStatus status of a finding across fuzz runs
+type RecordStatus string
+
+const (
+	// OpenStatus the finding was reproduced by the last fuzz run of its target
+	OpenStatus RecordStatus = "open"
+	// FixedStatus the finding wasn't reproduced anymore after the target was deployed with different images
+	FixedStatus RecordStatus = "fixed"
+)
+
+// Record history of a finding of a single target across fuzz runs
+type Record struct {
+	// Target workload the finding belongs to, in the format <namespace>/<name>
+	Target      string `json:"target"`
+	Fingerprint string `json:"fingerprint"`
+	// Finding last occurrence of the finding
+	Finding Finding      `json:"finding"`
+	Status  RecordStatus `json:"status"`
+	// Images images of the target during the last fuzz run that found the finding
+	Images []string `json:"images,omitempty"`
+	// FixedIn images of the target during the fuzz run that didn't find the finding anymore
+	FixedIn     []string  `json:"fixedIn,omitempty"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+	Occurrences int       `json:"occurrences"`
+	// Issue issue of the finding inside the repository of the target, nil when no issue was opened
+	Issue *IssueRef `json:"issue,omitempty"`
+}
+
+// IssueRef reference to an issue inside an issue tracker
+type IssueRef struct {
+	// Provider issue tracker of the issue, e.g. github or gitlab
+	Provider string `json:"provider"`
+	// Repository path of the repository of the issue, e.g. suecodelabs/cnfuzz
+	Repository string `json:"repository"`
+	// Number number of the issue inside the repository (iid for GitLab)
+	Number int    `json:"number"`
+	Url    string `json:"url,omitempty"`
+}
+
+// Key returns the key of the record, unique across targets
+func (r Record) Key() string {
+	return RecordKey(r.Target, r.Fingerprint)
+}
+
+// RecordKey returns the key of the record of a finding of a target
+func RecordKey(target string, fingerprint string) string {
+	return target + "/" + fingerprint
+}
+
+// Changes result of comparing the findings of a fuzz run with the known findings of its target
+type Changes struct {
+	// New findings that weren't known, or were fixed before
+	New []Record
+	// Known findings that were already open
+	Known []Record
+	// Fixed open findings that weren't found while fuzzing different images
+	Fixed []Record
+}
+
+// Run fuzz run whose findings are compared with the known findings of its target
+type Run struct {
+	// Target workload that was fuzzed, in the format <namespace>/<name>
+	Target string
+	// Images keys of the images of the target during the run
+	Images []string
+	// Operations operations the run was limited to in the format <METHOD> <path>, all operations were fuzzed when empty
+	Operations []string
+	// Incomplete the run didn't keep all its findings, so it can't tell which findings are fixed
+	Incomplete bool
+}
+
+// canFix checks if the run can fix a finding, it has to have kept all its findings and fuzzed the operation of the finding
+// findings of an unknown operation are only fuzzed by runs without limits
+func (r Run) canFix(finding Finding) bool {
+	if r.Incomplete {
+		return false
+	}
+	if len(r.Operations) == 0 {
+		return true
+	}
+	if len(finding.Endpoint) == 0 {
+		return false
+	}
+	operation := discovery.OperationKey(finding.Method, finding.Endpoint)
+	for _, fuzzed := range r.Operations {
+		if fuzzed == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconcile compares the findings of a fuzz run with the known records of its target
+// open findings are only considered fixed when the run fuzzed different images, so a flaky bug doesn't flip between open and fixed,
+// and when the run fuzzed their operation, so a run that is limited to some operations leaves the findings of the other operations open
+// a run with incomplete findings doesn't fix any finding
+func Reconcile(known []Record, run Run, found []Finding, now time.Time) Changes {
+	target, images := run.Target, run.Images
+	byFingerprint := make(map[string]Record, len(known))
+	for _, record := range known {
+		byFingerprint[record.Fingerprint] = record
+	}
+
+	changes := Changes{}
+	seen := make(map[string]bool, len(found))
+	for _, finding := range found {
+		fingerprint := finding.Fingerprint()
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+
+		record, exists := byFingerprint[fingerprint]
+		if !exists {
+			changes.New = append(changes.New, Record{
+				Target:      target,
+				Fingerprint: fingerprint,
+				Finding:     finding,
+				Status:      OpenStatus,
+				Images:      images,
+				FirstSeen:   now,
+				LastSeen:    now,
+				Occurrences: 1,
+			})
+			continue
+		}
+		wasFixed := record.Status == FixedStatus
+		record.Finding = finding
+		record.Status = OpenStatus
+		record.Images = images
+		record.FixedIn = nil
+		record.LastSeen = now
+		record.Occurrences++
+		if wasFixed {
+			changes.New = append(changes.New, record)
+		} else {
+			changes.Known = append(changes.Known, record)
+		}
+	}
+
+	for _, record := range known {
+		if seen[record.Fingerprint] || record.Status != OpenStatus || sameImages(record.Images, images) || !run.canFix(record.Finding) {
+			continue
+		}
+		record.Status = FixedStatus
+		record.FixedIn = images
+		changes.Fixed = append(changes.Fixed, record)
+	}
+	return changes
+}
+
+// sameImages checks if two sets of images are equal
+func sameImages(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package findings
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	firstRun := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	serverError := createTestFinding(`{"title":"fuzzstring"}`)
+	useAfterFree := Finding{Checker: "UseAfterFreeChecker", StatusCode: "20x", Method: "GET", Endpoint: "/todo/{id}"}
+
+	// first run, everything is new
+	changes := Reconcile(nil, Run{Target: "default/todo", Images: []string{"sha256:1"}}, []Finding{serverError, useAfterFree, serverError}, firstRun)
+	require.Len(t, changes.New, 2)
+	assert.Empty(t, changes.Known)
+	assert.Empty(t, changes.Fixed)
+	assert.Equal(t, OpenStatus, changes.New[0].Status)
+	assert.Equal(t, "default/todo/"+serverError.Fingerprint(), changes.New[0].Key())
+	known := changes.New
+
+	// same images without the server error, a flaky bug isn't fixed
+	secondRun := firstRun.Add(time.Hour)
+	changes = Reconcile(known, Run{Target: "default/todo", Images: []string{"sha256:1"}}, []Finding{useAfterFree}, secondRun)
+	assert.Empty(t, changes.New)
+	require.Len(t, changes.Known, 1)
+	assert.Equal(t, 2, changes.Known[0].Occurrences)
+	assert.Equal(t, firstRun, changes.Known[0].FirstSeen)
+	assert.Equal(t, secondRun, changes.Known[0].LastSeen)
+	assert.Empty(t, changes.Fixed)
+
+	// new image without the server error
+	changes = Reconcile(known, Run{Target: "default/todo", Images: []string{"sha256:2"}}, []Finding{useAfterFree}, secondRun)
+	require.Len(t, changes.Fixed, 1)
+	assert.Equal(t, serverError.Fingerprint(), changes.Fixed[0].Fingerprint)
+	assert.Equal(t, FixedStatus, changes.Fixed[0].Status)
+	assert.Equal(t, []string{"sha256:2"}, changes.Fixed[0].FixedIn)
+
+	// a fixed finding that comes back is new again
+	known = []Record{changes.Fixed[0], changes.Known[0]}
+	changes = Reconcile(known, Run{Target: "default/todo", Images: []string{"sha256:3"}}, []Finding{serverError, useAfterFree}, secondRun.Add(time.Hour))
+	require.Len(t, changes.New, 1)
+	assert.Equal(t, OpenStatus, changes.New[0].Status)
+	assert.Empty(t, changes.New[0].FixedIn)
+	assert.Len(t, changes.Known, 1)
+	assert.Empty(t, changes.Fixed)
+}
+
+func TestReconcileDifferentialRun(t *testing.T) {
+	firstRun := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	serverError := createTestFinding(`{"title":"fuzzstring"}`)
+	useAfterFree := Finding{Checker: "UseAfterFreeChecker", StatusCode: "20x", Method: "get", Endpoint: "/todo/{id}"}
+	unknownOperation := Finding{Checker: "main_driver", StatusCode: "500"}
+	changes := Reconcile(nil, Run{Target: "default/todo", Images: []string{"sha256:1"}}, []Finding{serverError, useAfterFree, unknownOperation}, firstRun)
+	require.Len(t, changes.New, 3)
+	known := changes.New
+
+	// a new image that only fuzzed the changed operation, the findings of the other operations stay open
+	run := Run{Target: "default/todo", Images: []string{"sha256:2"}, Operations: []string{"GET /todo/{id}"}}
+	changes = Reconcile(known, run, nil, firstRun.Add(time.Hour))
+	assert.Empty(t, changes.New)
+	assert.Empty(t, changes.Known)
+	require.Len(t, changes.Fixed, 1)
+	assert.Equal(t, useAfterFree.Fingerprint(), changes.Fixed[0].Fingerprint)
+
+	// a new image that fuzzed all operations fixes everything
+	changes = Reconcile(known, Run{Target: "default/todo", Images: []string{"sha256:3"}}, nil, firstRun.Add(2*time.Hour))
+	assert.Len(t, changes.Fixed, 3)
+}
+
+func TestReconcileIncompleteRun(t *testing.T) {
+	firstRun := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	serverError := createTestFinding(`{"title":"fuzzstring"}`)
+	useAfterFree := Finding{Checker: "UseAfterFreeChecker", StatusCode: "20x", Method: "GET", Endpoint: "/todo/{id}"}
+	changes := Reconcile(nil, Run{Target: "default/todo", Images: []string{"sha256:1"}}, []Finding{serverError, useAfterFree}, firstRun)
+	known := changes.New
+
+	// the findings that were left out of the run may still be there
+	changes = Reconcile(known, Run{Target: "default/todo", Images: []string{"sha256:2"}, Incomplete: true}, []Finding{useAfterFree}, firstRun.Add(time.Hour))
+	assert.Len(t, changes.Known, 1)
+	assert.Empty(t, changes.Fixed)
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package findings
+
+import (
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"net/url"
+	"strings"
+)
+
+// RedactedValue replaces the credentials inside the requests of findings
+const RedactedValue = "REDACTED"
+
+// credentialHeaders headers that carry credentials for every API, cookies are redacted as a whole
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// Redactor removes credentials from the requests that RESTler logs, before they are stored with the findings
+type Redactor struct {
+	// headers lower case names of the headers with credentials
+	headers map[string]bool
+	// query names of the query parameters with credentials
+	query map[string]bool
+}
+
+// CreateRedactor creates a Redactor for the common credential headers and the apiKey headers and query parameters of the API
+func CreateRedactor(apiDesc *discovery.WebApiDescription) Redactor {
+	redactor := Redactor{headers: make(map[string]bool), query: make(map[string]bool)}
+	for _, header := range credentialHeaders {
+		redactor.headers[strings.ToLower(header)] = true
+	}
+	if apiDesc == nil {
+		return redactor
+	}
+	for _, schema := range apiDesc.SecuritySchemes {
+		if schema.Type != discovery.ApiKeySecSchemaType || len(schema.Name) == 0 {
+			continue
+		}
+		switch strings.ToLower(schema.In) {
+		case "query":
+			redactor.query[schema.Name] = true
+		case "header":
+			redactor.headers[strings.ToLower(schema.Name)] = true
+		}
+	}
+	return redactor
+}
+
+// Redact replaces the values of the credential headers and query parameters inside a raw HTTP request
+func (r Redactor) Redact(request string) string {
+	head, body, hasBody := strings.Cut(request, "\n\n")
+	lines := strings.Split(head, "\n")
+	lines[0] = r.redactRequestLine(lines[0])
+	for i := 1; i < len(lines); i++ {
+		name, _, found := strings.Cut(lines[i], ":")
+		if found && r.headers[strings.ToLower(strings.TrimSpace(name))] {
+			lines[i] = name + ": " + RedactedValue
+		}
+	}
+	redacted := strings.Join(lines, "\n")
+	if hasBody {
+		redacted += "\n\n" + body
+	}
+	return redacted
+}
+
+// redactRequestLine replaces the values of the credential query parameters inside the target of a request line
+func (r Redactor) redactRequestLine(line string) string {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || len(r.query) == 0 {
+		return line
+	}
+	path, query, found := strings.Cut(parts[1], "?")
+	if !found {
+		return line
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && r.query[unescaped] {
+			params[i] = name + "=" + RedactedValue
+		}
+	}
+	parts[1] = path + "?" + strings.Join(params, "&")
+	return strings.Join(parts, " ")
+}
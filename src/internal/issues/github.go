@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package issues
+
+import (
+	"context"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"net/http"
+	"strings"
+)
+
+// GithubProvider provider name of GitHub issues
+const GithubProvider = "github"
+
+// GithubTracker manages issues with the GitHub REST API
+// https://docs.github.com/en/rest/issues
+type GithubTracker struct {
+	apiUrl string
+	token  string
+	client *http.Client
+}
+
+// CreateGithubTracker creates a tracker for the GitHub (Enterprise) API at apiUrl, e.g. https://api.github.com
+func CreateGithubTracker(apiUrl string, token string, client *http.Client) *GithubTracker {
+	return &GithubTracker{
+		apiUrl: strings.TrimSuffix(apiUrl, "/"),
+		token:  token,
+		client: client,
+	}
+}
+
+type githubIssue struct {
+	Number  int    `json:"number"`
+	HtmlUrl string `json:"html_url"`
+}
+
+// CreateIssue opens an issue inside a GitHub repository
+func (t *GithubTracker) CreateIssue(ctx context.Context, repository string, issue Issue) (findings.IssueRef, error) {
+	body := map[string]interface{}{
+		"title": issue.Title,
+		"body":  issue.Body,
+	}
+	if len(issue.Labels) > 0 {
+		body["labels"] = issue.Labels
+	}
+	created := githubIssue{}
+	if err := doJson(ctx, t.client, http.MethodPost, t.issuesUrl(repository), t.headers(), body, &created); err != nil {
+		return findings.IssueRef{}, fmt.Errorf("failed to create GitHub issue in %s: %w", repository, err)
+	}
+	return findings.IssueRef{
+		Provider:   GithubProvider,
+		Repository: repository,
+		Number:     created.Number,
+		Url:        created.HtmlUrl,
+	}, nil
+}
+
+// UpdateIssue updates the title and body of a GitHub issue and reopens it
+func (t *GithubTracker) UpdateIssue(ctx context.Context, ref findings.IssueRef, issue Issue) error {
+	body := map[string]interface{}{
+		"title": issue.Title,
+		"body":  issue.Body,
+		"state": "open",
+	}
+	if err := doJson(ctx, t.client, http.MethodPatch, t.issueUrl(ref), t.headers(), body, nil); err != nil {
+		return fmt.Errorf("failed to update GitHub issue %s#%d: %w", ref.Repository, ref.Number, err)
+	}
+	return nil
+}
+
+// CloseIssue comments on a GitHub issue and closes it as completed
+func (t *GithubTracker) CloseIssue(ctx context.Context, ref findings.IssueRef, comment string) error {
+	if err := doJson(ctx, t.client, http.MethodPost, t.issueUrl(ref)+"/comments", t.headers(), map[string]string{"body": comment}, nil); err != nil {
+		return fmt.Errorf("failed to comment on GitHub issue %s#%d: %w", ref.Repository, ref.Number, err)
+	}
+	body := map[string]string{
+		"state":        "closed",
+		"state_reason": "completed",
+	}
+	if err := doJson(ctx, t.client, http.MethodPatch, t.issueUrl(ref), t.headers(), body, nil); err != nil {
+		return fmt.Errorf("failed to close GitHub issue %s#%d: %w", ref.Repository, ref.Number, err)
+	}
+	return nil
+}
+
+func (t *GithubTracker) issuesUrl(repository string) string {
+	return fmt.Sprintf("%s/repos/%s/issues", t.apiUrl, repository)
+}
+
+func (t *GithubTracker) issueUrl(ref findings.IssueRef) string {
+	return fmt.Sprintf("%s/%d", t.issuesUrl(ref.Repository), ref.Number)
+}
+
+func (t *GithubTracker) headers() map[string]string {
+	return map[string]string{
+		"Accept":        "application/vnd.github+json",
+		"Authorization": "Bearer " + t.token,
+	}
+}
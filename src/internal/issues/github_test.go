@@ -0,0 +1,78 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package issues
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type receivedRequest struct {
+	Method string
+	Uri    string
+	Body   map[string]interface{}
+}
+
+// createApiServer creates a server that records the requests it receives and responds with response
+func createApiServer(t *testing.T, received *[]receivedRequest, response string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		*received = append(*received, receivedRequest{Method: r.Method, Uri: r.RequestURI, Body: body})
+		assert.NotEmpty(t, r.Header.Get("Authorization")+r.Header.Get("PRIVATE-TOKEN"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+}
+
+func TestGithubTracker(t *testing.T) {
+	var received []receivedRequest
+	server := createApiServer(t, &received, `{"number": 42, "html_url": "https://github.com/suecodelabs/todo/issues/42"}`)
+	defer server.Close()
+	tracker := CreateGithubTracker(server.URL+"/", "token", server.Client())
+	ctx := context.TODO()
+
+	ref, err := tracker.CreateIssue(ctx, "suecodelabs/todo", Issue{Title: "title", Body: "body", Labels: []string{"cnfuzz"}})
+	require.NoError(t, err)
+	assert.Equal(t, findings.IssueRef{Provider: GithubProvider, Repository: "suecodelabs/todo", Number: 42, Url: "https://github.com/suecodelabs/todo/issues/42"}, ref)
+
+	require.NoError(t, tracker.UpdateIssue(ctx, ref, Issue{Title: "title", Body: "new body"}))
+	require.NoError(t, tracker.CloseIssue(ctx, ref, "fixed"))
+
+	require.Len(t, received, 4)
+	assert.Equal(t, receivedRequest{http.MethodPost, "/repos/suecodelabs/todo/issues", map[string]interface{}{"title": "title", "body": "body", "labels": []interface{}{"cnfuzz"}}}, received[0])
+	assert.Equal(t, receivedRequest{http.MethodPatch, "/repos/suecodelabs/todo/issues/42", map[string]interface{}{"title": "title", "body": "new body", "state": "open"}}, received[1])
+	assert.Equal(t, receivedRequest{http.MethodPost, "/repos/suecodelabs/todo/issues/42/comments", map[string]interface{}{"body": "fixed"}}, received[2])
+	assert.Equal(t, receivedRequest{http.MethodPatch, "/repos/suecodelabs/todo/issues/42", map[string]interface{}{"state": "closed", "state_reason": "completed"}}, received[3])
+}
+
+func TestGithubTrackerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	tracker := CreateGithubTracker(server.URL, "token", server.Client())
+
+	_, err := tracker.CreateIssue(context.TODO(), "suecodelabs/todo", Issue{Title: "title"})
+	assert.ErrorContains(t, err, "404")
+}
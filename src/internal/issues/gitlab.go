@@ -0,0 +1,111 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package issues
+
+import (
+	"context"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitlabProvider provider name of GitLab issues
+const GitlabProvider = "gitlab"
+
+// GitlabTracker manages issues with the GitLab REST API
+// https://docs.gitlab.com/ee/api/issues.html
+type GitlabTracker struct {
+	apiUrl string
+	token  string
+	client *http.Client
+}
+
+// CreateGitlabTracker creates a tracker for the GitLab API at apiUrl, e.g. https://gitlab.com/api/v4
+func CreateGitlabTracker(apiUrl string, token string, client *http.Client) *GitlabTracker {
+	return &GitlabTracker{
+		apiUrl: strings.TrimSuffix(apiUrl, "/"),
+		token:  token,
+		client: client,
+	}
+}
+
+type gitlabIssue struct {
+	Iid    int    `json:"iid"`
+	WebUrl string `json:"web_url"`
+}
+
+// CreateIssue opens an issue inside a GitLab project
+func (t *GitlabTracker) CreateIssue(ctx context.Context, repository string, issue Issue) (findings.IssueRef, error) {
+	body := map[string]string{
+		"title":       issue.Title,
+		"description": issue.Body,
+	}
+	if len(issue.Labels) > 0 {
+		body["labels"] = strings.Join(issue.Labels, ",")
+	}
+	created := gitlabIssue{}
+	if err := doJson(ctx, t.client, http.MethodPost, t.issuesUrl(repository), t.headers(), body, &created); err != nil {
+		return findings.IssueRef{}, fmt.Errorf("failed to create GitLab issue in %s: %w", repository, err)
+	}
+	return findings.IssueRef{
+		Provider:   GitlabProvider,
+		Repository: repository,
+		Number:     created.Iid,
+		Url:        created.WebUrl,
+	}, nil
+}
+
+// UpdateIssue updates the title and description of a GitLab issue and reopens it
+func (t *GitlabTracker) UpdateIssue(ctx context.Context, ref findings.IssueRef, issue Issue) error {
+	body := map[string]string{
+		"title":       issue.Title,
+		"description": issue.Body,
+		"state_event": "reopen",
+	}
+	if err := doJson(ctx, t.client, http.MethodPut, t.issueUrl(ref), t.headers(), body, nil); err != nil {
+		return fmt.Errorf("failed to update GitLab issue %s#%d: %w", ref.Repository, ref.Number, err)
+	}
+	return nil
+}
+
+// CloseIssue adds a note to a GitLab issue and closes it
+func (t *GitlabTracker) CloseIssue(ctx context.Context, ref findings.IssueRef, comment string) error {
+	if err := doJson(ctx, t.client, http.MethodPost, t.issueUrl(ref)+"/notes", t.headers(), map[string]string{"body": comment}, nil); err != nil {
+		return fmt.Errorf("failed to comment on GitLab issue %s#%d: %w", ref.Repository, ref.Number, err)
+	}
+	if err := doJson(ctx, t.client, http.MethodPut, t.issueUrl(ref), t.headers(), map[string]string{"state_event": "close"}, nil); err != nil {
+		return fmt.Errorf("failed to close GitLab issue %s#%d: %w", ref.Repository, ref.Number, err)
+	}
+	return nil
+}
+
+// issuesUrl url of the issues of a project, the project path is url encoded as GitLab expects
+func (t *GitlabTracker) issuesUrl(repository string) string {
+	return fmt.Sprintf("%s/projects/%s/issues", t.apiUrl, url.PathEscape(repository))
+}
+
+func (t *GitlabTracker) issueUrl(ref findings.IssueRef) string {
+	return fmt.Sprintf("%s/%d", t.issuesUrl(ref.Repository), ref.Number)
+}
+
+func (t *GitlabTracker) headers() map[string]string {
+	return map[string]string{
+		"PRIVATE-TOKEN": t.token,
+	}
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package issues
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"net/http"
+	"testing"
+)
+
+func TestGitlabTracker(t *testing.T) {
+	var received []receivedRequest
+	server := createApiServer(t, &received, `{"iid": 7, "web_url": "https://gitlab.com/group/sub/todo/-/issues/7"}`)
+	defer server.Close()
+	tracker := CreateGitlabTracker(server.URL+"/api/v4", "token", server.Client())
+	ctx := context.TODO()
+
+	ref, err := tracker.CreateIssue(ctx, "group/sub/todo", Issue{Title: "title", Body: "body", Labels: []string{"cnfuzz", "security"}})
+	require.NoError(t, err)
+	assert.Equal(t, findings.IssueRef{Provider: GitlabProvider, Repository: "group/sub/todo", Number: 7, Url: "https://gitlab.com/group/sub/todo/-/issues/7"}, ref)
+
+	require.NoError(t, tracker.UpdateIssue(ctx, ref, Issue{Title: "title", Body: "new body"}))
+	require.NoError(t, tracker.CloseIssue(ctx, ref, "fixed"))
+
+	require.Len(t, received, 4)
+	assert.Equal(t, receivedRequest{http.MethodPost, "/api/v4/projects/group%2Fsub%2Ftodo/issues", map[string]interface{}{"title": "title", "description": "body", "labels": "cnfuzz,security"}}, received[0])
+	assert.Equal(t, receivedRequest{http.MethodPut, "/api/v4/projects/group%2Fsub%2Ftodo/issues/7", map[string]interface{}{"title": "title", "description": "new body", "state_event": "reopen"}}, received[1])
+	assert.Equal(t, receivedRequest{http.MethodPost, "/api/v4/projects/group%2Fsub%2Ftodo/issues/7/notes", map[string]interface{}{"body": "fixed"}}, received[2])
+	assert.Equal(t, receivedRequest{http.MethodPut, "/api/v4/projects/group%2Fsub%2Ftodo/issues/7", map[string]interface{}{"state_event": "close"}}, received[3])
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package issues
+
+import (
+	"context"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	DefaultGithubHost     = "github.com"
+	DefaultGithubApiUrl   = "https://api.github.com"
+	DefaultGithubTokenEnv = "GITHUB_TOKEN"
+	DefaultGitlabHost     = "gitlab.com"
+	DefaultGitlabTokenEnv = "GITLAB_TOKEN"
+)
+
+// Syncer keeps the issues of findings in sync with the findings of fuzz runs
+type Syncer struct {
+	// trackers issue trackers by the host of their repositories
+	trackers map[string]Tracker
+	labels   []string
+}
+
+// CreateSyncer creates a syncer that uses the trackers of the hosts of the repositories
+func CreateSyncer(trackers map[string]Tracker, labels []string) *Syncer {
+	return &Syncer{
+		trackers: trackers,
+		labels:   labels,
+	}
+}
+
+// CreateSyncerFromConfig creates a syncer with the configured GitHub and GitLab trackers, returns nil when issues aren't configured
+func CreateSyncerFromConfig(cnf *config.IssuesConfig, client *http.Client) (*Syncer, error) {
+	if cnf == nil {
+		return nil, nil
+	}
+	trackers := make(map[string]Tracker)
+	if cnf.Github != nil {
+		host := valueOrDefault(cnf.Github.Host, DefaultGithubHost)
+		apiUrl := cnf.Github.ApiUrl
+		if len(apiUrl) == 0 {
+			apiUrl = DefaultGithubApiUrl
+			if host != DefaultGithubHost {
+				// GitHub Enterprise Server
+				apiUrl = fmt.Sprintf("https://%s/api/v3", host)
+			}
+		}
+		token, err := getToken(valueOrDefault(cnf.Github.TokenEnv, DefaultGithubTokenEnv))
+		if err != nil {
+			return nil, err
+		}
+		trackers[host] = CreateGithubTracker(apiUrl, token, client)
+	}
+	if cnf.Gitlab != nil {
+		host := valueOrDefault(cnf.Gitlab.Host, DefaultGitlabHost)
+		apiUrl := valueOrDefault(cnf.Gitlab.ApiUrl, fmt.Sprintf("https://%s/api/v4", host))
+		token, err := getToken(valueOrDefault(cnf.Gitlab.TokenEnv, DefaultGitlabTokenEnv))
+		if err != nil {
+			return nil, err
+		}
+		trackers[host] = CreateGitlabTracker(apiUrl, token, client)
+	}
+	return CreateSyncer(trackers, cnf.Labels), nil
+}
+
+// Sync opens issues for new findings, updates the issues of known findings and closes the issues of fixed findings
+// issue references of new issues are stored with the findings, failing issues don't stop the others
+func (s *Syncer) Sync(ctx context.Context, l logger.Logger, store persistence.FindingsStore, repository string, changes findings.Changes) {
+	if s == nil {
+		return
+	}
+	if len(repository) == 0 {
+		l.V(logger.DebugLevel).Info("target doesn't have a repository, not syncing issues")
+		return
+	}
+	host, path, err := ParseRepository(repository)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "not syncing issues")
+		return
+	}
+	tracker, found := s.trackers[host]
+	if !found {
+		l.V(logger.InfoLevel).Info("no issue tracker configured for repository host, not syncing issues", "host", host, "repository", repository)
+		return
+	}
+
+	for _, records := range [][]findings.Record{changes.New, changes.Known} {
+		for _, record := range records {
+			if err := s.openIssue(ctx, tracker, store, path, record); err != nil {
+				l.V(logger.ImportantLevel).Error(err, "failed to open issue of finding", "fingerprint", record.Fingerprint, "repository", path)
+			}
+		}
+	}
+	for _, record := range changes.Fixed {
+		if record.Issue == nil {
+			continue
+		}
+		if err := tracker.CloseIssue(ctx, *record.Issue, FixedComment(record)); err != nil {
+			l.V(logger.ImportantLevel).Error(err, "failed to close issue of fixed finding", "fingerprint", record.Fingerprint, "issue", record.Issue.Url)
+			continue
+		}
+		l.V(logger.InfoLevel).Info("closed issue of fixed finding", "fingerprint", record.Fingerprint, "issue", record.Issue.Url)
+	}
+}
+
+// openIssue creates the issue of a finding or updates and reopens its existing issue
+func (s *Syncer) openIssue(ctx context.Context, tracker Tracker, store persistence.FindingsStore, repository string, record findings.Record) error {
+	issue := s.CreateIssueContent(record)
+	if record.Issue != nil {
+		return tracker.UpdateIssue(ctx, *record.Issue, issue)
+	}
+	ref, err := tracker.CreateIssue(ctx, repository, issue)
+	if err != nil {
+		return err
+	}
+	record.Issue = &ref
+	if err := store.Update(ctx, record); err != nil {
+		return fmt.Errorf("failed to store issue %s with finding %s: %w", ref.Url, record.Key(), err)
+	}
+	return nil
+}
+
+// CreateIssueContent creates the title and markdown body of the issue of a finding
+// the body contains the fingerprint of the finding and the requests that reproduce it, without their credentials
+func (s *Syncer) CreateIssueContent(record findings.Record) Issue {
+	finding := record.Finding
+	// the requests are redacted when the findings are created, this also redacts the credential headers
+	// of findings that were stored before that
+	redactor := findings.CreateRedactor(nil)
+	operation := finding.Operation()
+	if len(operation) == 0 {
+		operation = "unknown operation"
+	}
+
+	body := &strings.Builder{}
+	fmt.Fprintf(body, "<!-- cnfuzz-fingerprint: %s -->\n", record.Fingerprint)
+	fmt.Fprintf(body, "cnfuzz found a **%s** severity bug in `%s` while fuzzing `%s`.\n\n", finding.Severity, record.Target, operation)
+	fmt.Fprintf(body, "| | |\n|---|---|\n")
+	fmt.Fprintf(body, "| Checker | %s |\n", finding.Checker)
+	fmt.Fprintf(body, "| Status code | %s |\n", finding.StatusCode)
+	fmt.Fprintf(body, "| Reproducible | %t |\n", finding.Reproducible)
+	fmt.Fprintf(body, "| First seen | %s |\n", record.FirstSeen.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(body, "| Last seen | %s |\n", record.LastSeen.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(body, "| Occurrences | %d |\n", record.Occurrences)
+	fmt.Fprintf(body, "| Images | %s |\n", strings.Join(record.Images, "<br>"))
+	fmt.Fprintf(body, "| Fingerprint | `%s` |\n", record.Fingerprint)
+
+	if len(finding.ReproSequence) > 0 {
+		fmt.Fprintf(body, "\n### Steps to reproduce\n")
+		for i, step := range finding.ReproSequence {
+			fmt.Fprintf(body, "\n**Step %d:** `%s %s`", i+1, step.Method, step.Path)
+			if len(step.ResponseStatus) > 0 {
+				fmt.Fprintf(body, " → `%s`", step.ResponseStatus)
+			}
+			fmt.Fprintf(body, "\n\n```http\n%s\n```\n", strings.TrimSpace(redactor.Redact(step.Request)))
+		}
+	}
+
+	return Issue{
+		Title:  fmt.Sprintf("[cnfuzz] %s: %s returns %s", finding.Checker, operation, finding.StatusCode),
+		Body:   body.String(),
+		Labels: s.labels,
+	}
+}
+
+// FixedComment creates the comment that is placed on the issue of a fixed finding before it is closed
+func FixedComment(record findings.Record) string {
+	return fmt.Sprintf("cnfuzz didn't reproduce this finding anymore while fuzzing `%s` with images %s, closing the issue.", record.Target, strings.Join(record.FixedIn, ", "))
+}
+
+// getToken reads an access token from an environment variable
+func getToken(env string) (string, error) {
+	token := os.Getenv(env)
+	if len(token) == 0 {
+		return "", fmt.Errorf("environment variable %s with the access token of the issue tracker is empty", env)
+	}
+	return token, nil
+}
+
+func valueOrDefault(value string, def string) string {
+	if len(value) == 0 {
+		return def
+	}
+	return value
+}
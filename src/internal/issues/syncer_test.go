@@ -0,0 +1,172 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package issues
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"net/http"
+	"testing"
+)
+
+// fakeTracker keeps issues in memory
+type fakeTracker struct {
+	issues map[int]Issue
+	open   map[int]bool
+	closed map[int]string
+}
+
+func createFakeTracker() *fakeTracker {
+	return &fakeTracker{issues: make(map[int]Issue), open: make(map[int]bool), closed: make(map[int]string)}
+}
+
+func (t *fakeTracker) CreateIssue(_ context.Context, repository string, issue Issue) (findings.IssueRef, error) {
+	number := len(t.issues) + 1
+	t.issues[number] = issue
+	t.open[number] = true
+	return findings.IssueRef{Provider: "fake", Repository: repository, Number: number, Url: fmt.Sprintf("https://git.example.com/%s/issues/%d", repository, number)}, nil
+}
+
+func (t *fakeTracker) UpdateIssue(_ context.Context, ref findings.IssueRef, issue Issue) error {
+	t.issues[ref.Number] = issue
+	t.open[ref.Number] = true
+	return nil
+}
+
+func (t *fakeTracker) CloseIssue(_ context.Context, ref findings.IssueRef, comment string) error {
+	t.open[ref.Number] = false
+	t.closed[ref.Number] = comment
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	ctx := context.TODO()
+	store := persistence.InitMemoryCache(l).FindingsStore
+	tracker := createFakeTracker()
+	syncer := CreateSyncer(map[string]Tracker{"git.example.com": tracker}, []string{"cnfuzz"})
+	repository := "https://git.example.com/suecodelabs/todo.git"
+	target := "default/todo"
+
+	found := []findings.Finding{{
+		Checker:    "main_driver",
+		Severity:   findings.MediumSeverity,
+		StatusCode: "500",
+		Method:     "POST",
+		Endpoint:   "/todo",
+		ReproSequence: []findings.ReproStep{
+			{Method: "POST", Path: "/todo", Request: "POST /todo HTTP/1.1\r\n\r\n{\"name\": null}", ResponseStatus: "HTTP/1.1 500 Internal Server Error"},
+		},
+	}}
+	changes, err := persistence.RecordFindings(ctx, store, findings.Run{Target: target, Images: []string{"sha256:a"}}, found)
+	require.NoError(t, err)
+	syncer.Sync(ctx, l, store, repository, changes)
+
+	require.Len(t, tracker.issues, 1)
+	assert.True(t, tracker.open[1])
+	assert.Equal(t, "[cnfuzz] main_driver: POST /todo returns 500", tracker.issues[1].Title)
+	assert.Equal(t, []string{"cnfuzz"}, tracker.issues[1].Labels)
+	assert.Contains(t, tracker.issues[1].Body, "cnfuzz-fingerprint: "+found[0].Fingerprint())
+	assert.Contains(t, tracker.issues[1].Body, "{\"name\": null}")
+	records, err := store.GetByTarget(ctx, target)
+	require.NoError(t, err)
+	require.NotNil(t, records[0].Issue)
+	assert.Equal(t, "suecodelabs/todo", records[0].Issue.Repository)
+
+	// the same finding updates the existing issue
+	changes, err = persistence.RecordFindings(ctx, store, findings.Run{Target: target, Images: []string{"sha256:a"}}, found)
+	require.NoError(t, err)
+	syncer.Sync(ctx, l, store, repository, changes)
+	assert.Len(t, tracker.issues, 1)
+	assert.Contains(t, tracker.issues[1].Body, "| Occurrences | 2 |")
+
+	// a newer image without the finding closes the issue
+	changes, err = persistence.RecordFindings(ctx, store, findings.Run{Target: target, Images: []string{"sha256:b"}}, nil)
+	require.NoError(t, err)
+	syncer.Sync(ctx, l, store, repository, changes)
+	assert.False(t, tracker.open[1])
+	assert.Contains(t, tracker.closed[1], "sha256:b")
+
+	// the finding coming back reopens the issue
+	changes, err = persistence.RecordFindings(ctx, store, findings.Run{Target: target, Images: []string{"sha256:c"}}, found)
+	require.NoError(t, err)
+	syncer.Sync(ctx, l, store, repository, changes)
+	assert.Len(t, tracker.issues, 1)
+	assert.True(t, tracker.open[1])
+}
+
+func TestCreateIssueContentRedactsCredentials(t *testing.T) {
+	syncer := CreateSyncer(nil, nil)
+	record := findings.Record{Finding: findings.Finding{
+		Checker:    "main_driver",
+		StatusCode: "500",
+		Method:     "GET",
+		Endpoint:   "/todo",
+		ReproSequence: []findings.ReproStep{
+			{Method: "GET", Path: "/todo", Request: "GET /todo HTTP/1.1\nAuthorization: Bearer secret-token\nCookie: session=secret-session\nAccept: application/json"},
+		},
+	}}
+
+	issue := syncer.CreateIssueContent(record)
+	assert.NotContains(t, issue.Body, "secret-token")
+	assert.NotContains(t, issue.Body, "secret-session")
+	assert.Contains(t, issue.Body, "Authorization: "+findings.RedactedValue)
+	assert.Contains(t, issue.Body, "Accept: application/json")
+}
+
+func TestSyncWithoutTracker(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	ctx := context.TODO()
+	store := persistence.InitMemoryCache(l).FindingsStore
+	tracker := createFakeTracker()
+	syncer := CreateSyncer(map[string]Tracker{"git.example.com": tracker}, nil)
+
+	changes, err := persistence.RecordFindings(ctx, store, findings.Run{Target: "default/todo", Images: []string{"sha256:a"}}, []findings.Finding{{Checker: "main_driver", StatusCode: "500"}})
+	require.NoError(t, err)
+	syncer.Sync(ctx, l, store, "", changes)
+	syncer.Sync(ctx, l, store, "github.com/suecodelabs/todo", changes)
+	assert.Empty(t, tracker.issues)
+
+	var nilSyncer *Syncer
+	nilSyncer.Sync(ctx, l, store, "git.example.com/suecodelabs/todo", changes)
+}
+
+func TestCreateSyncerFromConfig(t *testing.T) {
+	syncer, err := CreateSyncerFromConfig(nil, http.DefaultClient)
+	require.NoError(t, err)
+	assert.Nil(t, syncer)
+
+	_, err = CreateSyncerFromConfig(&config.IssuesConfig{Github: &config.IssueTrackerConfig{TokenEnv: "CNFUZZ_TEST_MISSING_TOKEN"}}, http.DefaultClient)
+	assert.Error(t, err)
+
+	t.Setenv("CNFUZZ_TEST_TOKEN", "token")
+	syncer, err = CreateSyncerFromConfig(&config.IssuesConfig{
+		Github: &config.IssueTrackerConfig{Host: "github.example.com", TokenEnv: "CNFUZZ_TEST_TOKEN"},
+		Gitlab: &config.IssueTrackerConfig{TokenEnv: "CNFUZZ_TEST_TOKEN"},
+	}, http.DefaultClient)
+	require.NoError(t, err)
+	require.IsType(t, &GithubTracker{}, syncer.trackers["github.example.com"])
+	assert.Equal(t, "https://github.example.com/api/v3", syncer.trackers["github.example.com"].(*GithubTracker).apiUrl)
+	require.IsType(t, &GitlabTracker{}, syncer.trackers[DefaultGitlabHost])
+	assert.Equal(t, "https://gitlab.com/api/v4", syncer.trackers[DefaultGitlabHost].(*GitlabTracker).apiUrl)
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package issues opens, updates and closes an issue in the repository of a workload for every finding
+package issues
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Issue content of an issue about a finding
+type Issue struct {
+	Title  string
+	Body   string
+	Labels []string
+}
+
+// Tracker is an interface for the API of an issue tracker like GitHub or GitLab
+type Tracker interface {
+	// CreateIssue opens an issue inside a repository, repository is the path of the repository, e.g. suecodelabs/cnfuzz
+	CreateIssue(ctx context.Context, repository string, issue Issue) (findings.IssueRef, error)
+	// UpdateIssue updates the title and body of an issue and reopens it when it was closed
+	UpdateIssue(ctx context.Context, ref findings.IssueRef, issue Issue) error
+	// CloseIssue closes an issue after commenting on it
+	CloseIssue(ctx context.Context, ref findings.IssueRef, comment string) error
+}
+
+// ParseRepository splits a repository url into its host and path
+// https urls, ssh urls (git@host:path) and urls without a scheme are supported, a .git suffix is removed
+func ParseRepository(repository string) (host string, path string, err error) {
+	repository = strings.TrimSpace(repository)
+	if strings.HasPrefix(repository, "git@") {
+		repository = "ssh://" + strings.Replace(strings.TrimPrefix(repository, "git@"), ":", "/", 1)
+	} else if !strings.Contains(repository, "://") {
+		repository = "https://" + repository
+	}
+	parsed, err := url.Parse(repository)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid repository %s: %w", repository, err)
+	}
+	path = strings.TrimSuffix(strings.Trim(parsed.Path, "/"), ".git")
+	if len(parsed.Hostname()) == 0 || !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("repository %s should be in the format <host>/<owner>/<name>", repository)
+	}
+	return parsed.Hostname(), path, nil
+}
+
+// doJson sends a request with a JSON body to an API and decodes the JSON response into out, out can be nil
+func doJson(ctx context.Context, client *http.Client, method string, url string, headers map[string]string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request body: %w", err)
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s got status %d: %s", method, url, resp.StatusCode, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, url, err)
+	}
+	return nil
+}
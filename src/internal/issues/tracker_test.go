@@ -0,0 +1,44 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package issues
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseRepository(t *testing.T) {
+	tests := []struct {
+		repository string
+		host       string
+		path       string
+	}{
+		{"https://github.com/suecodelabs/cnfuzz", "github.com", "suecodelabs/cnfuzz"},
+		{"https://github.com/suecodelabs/cnfuzz.git", "github.com", "suecodelabs/cnfuzz"},
+		{"github.com/suecodelabs/cnfuzz/", "github.com", "suecodelabs/cnfuzz"},
+		{"git@gitlab.example.com:group/sub/project.git", "gitlab.example.com", "group/sub/project"},
+	}
+	for _, test := range tests {
+		host, path, err := ParseRepository(test.repository)
+		assert.NoError(t, err, test.repository)
+		assert.Equal(t, test.host, host, test.repository)
+		assert.Equal(t, test.path, path, test.repository)
+	}
+
+	_, _, err := ParseRepository("github.com/cnfuzz")
+	assert.Error(t, err)
+}
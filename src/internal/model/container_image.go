@@ -17,6 +17,7 @@
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	kutil "github.com/suecodelabs/cnfuzz/src/pkg/k8s/util"
@@ -24,6 +25,7 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type ImageFuzzStatus int
@@ -34,11 +36,52 @@ const (
 	BeingFuzzed
 )
 
-// ContainerImage container image struct that contains a fuzz status
+// String returns the name of the status
+func (s ImageFuzzStatus) String() string {
+	switch s {
+	case NotFuzzed:
+		return "not_fuzzed"
+	case Fuzzed:
+		return "fuzzed"
+	case BeingFuzzed:
+		return "being_fuzzed"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// maxSeen maximum number of names, pods and namespaces that are kept for an image, the oldest are dropped first
+	maxSeen = 20
+	// seenResolution LastSeen is only updated when it is older than this, so not every pod event needs a write
+	seenResolution = time.Hour
+)
+
+// ContainerImage container image struct that contains a fuzz status and metadata about where the image ran and how it was fuzzed
 type ContainerImage struct {
-	Hash     string
-	HashType string
-	Status   ImageFuzzStatus
+	Hash     string          `json:"hash"`
+	HashType string          `json:"hashType"`
+	Status   ImageFuzzStatus `json:"status"`
+	// Names image names and tags the image was seen with
+	Names     []string  `json:"names,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// Pods pods the image ran in, in the format <namespace>/<name>
+	Pods       []string `json:"pods,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	// LastRun last fuzz run of the image in the format <namespace>/<name>
+	LastRun string `json:"lastRun,omitempty"`
+	// LastRunResult phase the last fuzz run ended with
+	LastRunResult string     `json:"lastRunResult,omitempty"`
+	LastRunTime   *time.Time `json:"lastRunTime,omitempty"`
+	// Findings number of findings of the last fuzz run per severity
+	Findings map[string]int `json:"findings,omitempty"`
+	// SpecHash hash of the OpenAPI spec the image was fuzzed against
+	SpecHash string `json:"specHash,omitempty"`
+	// SpecOperations hashes of the operations inside the OpenAPI spec the image was fuzzed against
+	SpecOperations map[string]string `json:"specOperations,omitempty"`
+	// SpecCheckTime last time the OpenAPI spec served by the image was compared with SpecHash
+	SpecCheckTime *time.Time `json:"specCheckTime,omitempty"`
 }
 
 // Verify verifies if this model is valid, model is not valid if some non nullable properties are empty or nil
@@ -54,18 +97,59 @@ func (img ContainerImage) Verify() error {
 
 // String ContainerImage to string representation
 func (img ContainerImage) String() (key string, status string) {
-	return fmt.Sprintf("%s:%s", img.HashType, img.Hash), strconv.Itoa(int(img.Status))
+	return img.Key(), strconv.Itoa(int(img.Status))
+}
+
+// Key returns the key of the image in the format hashtype:hash
+func (img ContainerImage) Key() string {
+	return fmt.Sprintf("%s:%s", img.HashType, img.Hash)
+}
+
+// Marshal ContainerImage to its key and a JSON representation of the whole record
+func (img ContainerImage) Marshal() (key string, value string, err error) {
+	data, err := json.Marshal(img)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode container image %s: %w", img.Key(), err)
+	}
+	return img.Key(), string(data), nil
+}
+
+// hashLengths length of the hex encoded digests of the known hash types
+var hashLengths = map[string]int{
+	"sha256": 64,
+	"sha384": 96,
+	"sha512": 128,
+}
+
+// IsImageKey checks if key is in the format hashtype:hash with a known hash type and a hex encoded digest
+// stores that share their keys with other data use it to tell the keys of images apart
+func IsImageKey(key string) bool {
+	hashType, hash, found := strings.Cut(key, ":")
+	if !found || len(hash) != hashLengths[hashType] {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
 }
 
 // ContainerImageFromString create ContainerImage from a string in format hashtype:hash and a string representing the status as an int
+// the key has to be a valid image key and the status one of the known statuses
 func ContainerImageFromString(hashString string, statusString string) (image ContainerImage, convErr error) {
-	hashSplit := strings.Split(hashString, ":")
-	hashType := hashSplit[0]
-	hash := hashSplit[1]
+	if !IsImageKey(hashString) {
+		return ContainerImage{}, fmt.Errorf("container image key %s isn't in the format hashtype:hash", hashString)
+	}
+	hashType, hash, _ := strings.Cut(hashString, ":")
 	status, convErr := strconv.ParseInt(statusString, 10, 16)
 	if convErr != nil {
 		return ContainerImage{}, convErr
 	}
+	if status < int64(NotFuzzed) || status > int64(BeingFuzzed) {
+		return ContainerImage{}, fmt.Errorf("container image %s has unknown status %d", hashString, status)
+	}
 	return ContainerImage{
 		Hash:     hash,
 		HashType: hashType,
@@ -73,6 +157,111 @@ func ContainerImageFromString(hashString string, statusString string) (image Con
 	}, nil
 }
 
+// ContainerImageFromValue create ContainerImage from its key and a value created by Marshal
+// values in the legacy format, where the value is only the status as an int, are converted
+func ContainerImageFromValue(key string, value string) (image ContainerImage, legacy bool, err error) {
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		image, err = ContainerImageFromString(key, value)
+		return image, true, err
+	}
+	if err := json.Unmarshal([]byte(value), &image); err != nil {
+		return ContainerImage{}, false, fmt.Errorf("failed to decode container image %s: %w", key, err)
+	}
+	if image.Key() != key {
+		return ContainerImage{}, false, fmt.Errorf("container image record %s is stored under key %s", image.Key(), key)
+	}
+	return image, false, nil
+}
+
+// Copy returns a deep copy of the image, so the copy can be changed without changing the original
+func (img ContainerImage) Copy() ContainerImage {
+	img.Names = append([]string(nil), img.Names...)
+	img.Pods = append([]string(nil), img.Pods...)
+	img.Namespaces = append([]string(nil), img.Namespaces...)
+	if img.LastRunTime != nil {
+		lastRunTime := *img.LastRunTime
+		img.LastRunTime = &lastRunTime
+	}
+	if img.SpecCheckTime != nil {
+		specCheckTime := *img.SpecCheckTime
+		img.SpecCheckTime = &specCheckTime
+	}
+	if img.Findings != nil {
+		counts := make(map[string]int, len(img.Findings))
+		for severity, count := range img.Findings {
+			counts[severity] = count
+		}
+		img.Findings = counts
+	}
+	if img.SpecOperations != nil {
+		operations := make(map[string]string, len(img.SpecOperations))
+		for operation, hash := range img.SpecOperations {
+			operations[operation] = hash
+		}
+		img.SpecOperations = operations
+	}
+	return img
+}
+
+// Observe merges where another record of the same image was seen into this image
+// returns whether the image changed enough to be worth storing
+func (img *ContainerImage) Observe(seen ContainerImage) (changed bool) {
+	for _, name := range seen.Names {
+		img.Names, changed = addSeen(img.Names, name, changed)
+	}
+	for _, pod := range seen.Pods {
+		img.Pods, changed = addSeen(img.Pods, pod, changed)
+	}
+	for _, namespace := range seen.Namespaces {
+		img.Namespaces, changed = addSeen(img.Namespaces, namespace, changed)
+	}
+	if !seen.FirstSeen.IsZero() && (img.FirstSeen.IsZero() || seen.FirstSeen.Before(img.FirstSeen)) {
+		img.FirstSeen = seen.FirstSeen
+		changed = true
+	}
+	if seen.LastSeen.Sub(img.LastSeen) >= seenResolution || (changed && seen.LastSeen.After(img.LastSeen)) {
+		img.LastSeen = seen.LastSeen
+		changed = true
+	}
+	return changed
+}
+
+// addSeen adds a value to the end of a list of seen values, a known value is moved to the end so the oldest are dropped first
+func addSeen(list []string, value string, changed bool) ([]string, bool) {
+	if len(value) == 0 {
+		return list, changed
+	}
+	result := make([]string, 0, len(list)+1)
+	for _, item := range list {
+		if item != value {
+			result = append(result, item)
+		}
+	}
+	if len(result) == len(list) {
+		changed = true
+	}
+	result = append(result, value)
+	if len(result) > maxSeen {
+		result = result[len(result)-maxSeen:]
+	}
+	return result, changed
+}
+
+// RecordSpec stores the hash and the operation hashes of the OpenAPI spec the image is fuzzed against
+func (img *ContainerImage) RecordSpec(hash string, operations map[string]string, checked time.Time) {
+	img.SpecHash = hash
+	img.SpecOperations = operations
+	img.SpecCheckTime = &checked
+}
+
+// RecordRun stores the result of a fuzz run of the image
+func (img *ContainerImage) RecordRun(run string, result string, findings map[string]int, completed time.Time) {
+	img.LastRun = run
+	img.LastRunResult = result
+	img.LastRunTime = &completed
+	img.Findings = findings
+}
+
 // CreateContainerImage create a ContainerImage from a hash, hashtype and fuzz status
 func CreateContainerImage(hash string, hashType string, status ImageFuzzStatus) (ContainerImage, error) {
 	img := ContainerImage{
@@ -84,8 +273,10 @@ func CreateContainerImage(hash string, hashType string, status ImageFuzzStatus)
 }
 
 // CreateContainerImagesFromPod extracts container info from a pod and converts their images to ContainerImages
+// the images contain the name of the image and the pod, so they can be merged into known images with Observe
 func CreateContainerImagesFromPod(l logger.Logger, pod *apiv1.Pod) ([]ContainerImage, error) {
 	var images []ContainerImage
+	now := time.Now().UTC()
 mainloop:
 	for _, status := range pod.Status.ContainerStatuses {
 		if len(status.ImageID) == 0 || len(status.Image) == 0 {
@@ -98,8 +289,9 @@ mainloop:
 		hash, hashType := kutil.SplitImageId(l, status.ImageID)
 
 		// Look for duplicate image hashes/versions
-		for _, image := range images {
+		for i, image := range images {
 			if image.Hash == hash {
+				images[i].Names, _ = addSeen(image.Names, status.Image, false)
 				// Image already exists in the image array, so avoid creating a duplicate
 				continue mainloop
 			}
@@ -114,6 +306,11 @@ mainloop:
 			return nil, createErr
 		}
 
+		newImage.Names = []string{status.Image}
+		newImage.Pods = []string{pod.Namespace + "/" + pod.Name}
+		newImage.Namespaces = []string{pod.Namespace}
+		newImage.FirstSeen = now
+		newImage.LastSeen = now
 		l.V(logger.PerformanceTestLevel).Info("found image inside pod", "imageHash", newImage.Hash)
 		images = append(images, newImage)
 	}
@@ -22,7 +22,9 @@ import (
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
 	apiv1 "k8s.io/api/core/v1"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCreateContainerImagesFromPod(t *testing.T) {
@@ -107,3 +109,94 @@ func TestContainerImageFromString(t *testing.T) {
 		assert.Equal(t, status, createdImg.Status)
 	}
 }
+
+func TestContainerImageFromValue(t *testing.T) {
+	hash := "afa27b44d43b02a9fea41d13cedc2e4016cfcf87c5dbf990e593669aa8ce286d"
+	lastRunTime := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	image := ContainerImage{
+		Hash:          hash,
+		HashType:      "sha256",
+		Status:        Fuzzed,
+		Names:         []string{"localhost:5000/todo-api:latest"},
+		Pods:          []string{"default/todo-api-5d8f"},
+		Namespaces:    []string{"default"},
+		LastRun:       "default/cnfuzz-run-todo-api-5d8f",
+		LastRunResult: "Completed",
+		LastRunTime:   &lastRunTime,
+		Findings:      map[string]int{"high": 1},
+	}
+	key, value, err := image.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:"+hash, key)
+
+	decoded, legacy, err := ContainerImageFromValue(key, value)
+	assert.NoError(t, err)
+	assert.False(t, legacy)
+	assert.Equal(t, image, decoded)
+
+	decoded, legacy, err = ContainerImageFromValue(key, "1")
+	assert.NoError(t, err)
+	assert.True(t, legacy)
+	assert.Equal(t, ContainerImage{Hash: hash, HashType: "sha256", Status: Fuzzed}, decoded)
+
+	_, _, err = ContainerImageFromValue("sha256:other", value)
+	assert.Error(t, err, "the record has to match its key")
+
+	// values of other applications that look like legacy values aren't images
+	for key, value := range map[string]string{
+		"session:12345":             "1",
+		"sha256:other":              "1",
+		"md5:" + hash[:32]:          "1",
+		"sha256:" + hash:            "7",
+		"sha256:" + hash[:63] + "G": "0",
+	} {
+		_, _, err = ContainerImageFromValue(key, value)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestIsImageKey(t *testing.T) {
+	hash := "afa27b44d43b02a9fea41d13cedc2e4016cfcf87c5dbf990e593669aa8ce286d"
+	assert.True(t, IsImageKey("sha256:"+hash))
+	assert.True(t, IsImageKey("sha512:"+hash+hash))
+	assert.False(t, IsImageKey(hash))
+	assert.False(t, IsImageKey("sha256:"+hash[:10]))
+	assert.False(t, IsImageKey("sha256:"+strings.ToUpper(hash)))
+	assert.False(t, IsImageKey("user:1234"))
+}
+
+func TestContainerImage_Observe(t *testing.T) {
+	first := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	image := ContainerImage{Hash: "abc", HashType: "sha256", Names: []string{"todo-api:1"}, Pods: []string{"default/a"}, Namespaces: []string{"default"}, FirstSeen: first, LastSeen: first}
+
+	seen := ContainerImage{Hash: "abc", HashType: "sha256", Names: []string{"todo-api:1"}, Pods: []string{"default/a"}, Namespaces: []string{"default"}, FirstSeen: first.Add(time.Minute), LastSeen: first.Add(time.Minute)}
+	assert.False(t, image.Observe(seen), "nothing new was seen")
+	assert.Equal(t, first, image.LastSeen)
+
+	seen.Pods = []string{"shop/b"}
+	seen.Namespaces = []string{"shop"}
+	assert.True(t, image.Observe(seen))
+	assert.Equal(t, []string{"default/a", "shop/b"}, image.Pods)
+	assert.Equal(t, []string{"default", "shop"}, image.Namespaces)
+	assert.Equal(t, first, image.FirstSeen)
+	assert.Equal(t, first.Add(time.Minute), image.LastSeen)
+
+	seen.LastSeen = first.Add(2 * time.Hour)
+	assert.True(t, image.Observe(seen), "last seen is outdated")
+	assert.Equal(t, seen.LastSeen, image.LastSeen)
+
+	for i := 0; i < maxSeen+5; i++ {
+		image.Observe(ContainerImage{Pods: []string{fmt.Sprintf("default/pod-%d", i)}})
+	}
+	assert.Len(t, image.Pods, maxSeen)
+	assert.Equal(t, fmt.Sprintf("default/pod-%d", maxSeen+4), image.Pods[maxSeen-1])
+}
+
+func TestContainerImage_Copy(t *testing.T) {
+	image := ContainerImage{Hash: "abc", HashType: "sha256", Pods: []string{"default/a"}, Findings: map[string]int{"high": 1}}
+	imageCopy := image.Copy()
+	imageCopy.Pods[0] = "default/b"
+	imageCopy.Findings["high"] = 2
+	assert.Equal(t, "default/a", image.Pods[0])
+	assert.Equal(t, 1, image.Findings["high"])
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notify
+
+import "github.com/suecodelabs/cnfuzz/src/internal/findings"
+
+// webhookFinding finding inside the payload of a generic webhook
+type webhookFinding struct {
+	Fingerprint string            `json:"fingerprint"`
+	Checker     string            `json:"checker"`
+	Severity    findings.Severity `json:"severity"`
+	StatusCode  string            `json:"statusCode"`
+	Method      string            `json:"method,omitempty"`
+	Endpoint    string            `json:"endpoint,omitempty"`
+}
+
+// webhookPayload payload of a generic JSON webhook
+type webhookPayload struct {
+	Text      string           `json:"text"`
+	Run       string           `json:"run"`
+	Namespace string           `json:"namespace"`
+	Pod       string           `json:"pod"`
+	Target    string           `json:"target"`
+	Findings  int              `json:"findings"`
+	New       []webhookFinding `json:"new"`
+	Fixed     []webhookFinding `json:"fixed"`
+	Reports   []string         `json:"reports,omitempty"`
+}
+
+// formatWebhook creates the payload of a generic webhook, it contains the message and the new and fixed findings
+func formatWebhook(message string, event Event) interface{} {
+	return webhookPayload{
+		Text:      message,
+		Run:       event.Run,
+		Namespace: event.Namespace,
+		Pod:       event.Pod,
+		Target:    event.Target,
+		Findings:  len(event.Findings),
+		New:       toWebhookFindings(event.New),
+		Fixed:     toWebhookFindings(event.Fixed),
+		Reports:   event.Reports,
+	}
+}
+
+func toWebhookFindings(records []findings.Record) []webhookFinding {
+	converted := make([]webhookFinding, 0, len(records))
+	for _, record := range records {
+		converted = append(converted, webhookFinding{
+			Fingerprint: record.Fingerprint,
+			Checker:     record.Finding.Checker,
+			Severity:    record.Finding.Severity,
+			StatusCode:  record.Finding.StatusCode,
+			Method:      record.Finding.Method,
+			Endpoint:    record.Finding.Endpoint,
+		})
+	}
+	return converted
+}
+
+// formatSlack creates the payload of a Slack incoming webhook
+// https://api.slack.com/messaging/webhooks
+func formatSlack(message string, _ Event) interface{} {
+	return map[string]interface{}{
+		"text": message,
+	}
+}
+
+// teamsColors theme colors of Teams messages per highest severity of the new findings
+var teamsColors = map[findings.Severity]string{
+	findings.HighSeverity:   "B00020",
+	findings.MediumSeverity: "C77700",
+	findings.LowSeverity:    "555555",
+}
+
+// formatTeams creates the payload of a Microsoft Teams incoming webhook
+// https://learn.microsoft.com/en-us/outlook/actionable-messages/message-card-reference
+func formatTeams(message string, event Event) interface{} {
+	color, found := teamsColors[event.HighestSeverity()]
+	if !found {
+		color = "2E7D32"
+	}
+	return map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    "cnfuzz fuzzed " + event.Target,
+		"title":      "cnfuzz fuzzed " + event.Target,
+		"themeColor": color,
+		"text":       message,
+	}
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package notify posts messages about completed fuzz runs to webhooks, Slack and Microsoft Teams
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"io"
+	"net/http"
+	"os"
+	"text/template"
+)
+
+// DefaultTemplate template of the message when the notifier doesn't have a template
+const DefaultTemplate = `cnfuzz fuzzed {{ .Target }} (pod {{ .Pod }}): {{ len .New }} new, {{ len .Fixed }} fixed and {{ len .Findings }} found findings
+{{- range .New }}
+- [{{ .Finding.Severity }}] {{ .Finding.Checker }} {{ with .Finding.Operation }}{{ . }}{{ else }}unknown operation{{ end }} ({{ .Finding.StatusCode }})
+{{- end }}
+{{- with .Reports }}
+Report: {{ index . 0 }}
+{{- end }}`
+
+// Event a completed fuzz run
+type Event struct {
+	Run       string `json:"run"`
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Target    string `json:"target"`
+	// Findings all findings of the run
+	Findings []findings.Finding `json:"findings"`
+	// New findings that weren't known or were fixed before
+	New []findings.Record `json:"new"`
+	// Fixed findings that aren't found anymore
+	Fixed   []findings.Record `json:"fixed"`
+	Reports []string          `json:"reports,omitempty"`
+}
+
+// HighestSeverity returns the highest severity of the new findings, empty without new findings
+func (e Event) HighestSeverity() findings.Severity {
+	var highest findings.Severity
+	for _, record := range e.New {
+		if severityRank(record.Finding.Severity) > severityRank(highest) {
+			highest = record.Finding.Severity
+		}
+	}
+	return highest
+}
+
+// severityRank orders severities
+func severityRank(severity findings.Severity) int {
+	switch severity {
+	case findings.HighSeverity:
+		return 3
+	case findings.MediumSeverity:
+		return 2
+	case findings.LowSeverity:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Notifier sends a message about a fuzz run
+type Notifier struct {
+	name       string
+	url        string
+	headers    map[string]string
+	on         string
+	namespaces map[string]bool
+	template   *template.Template
+	format     func(message string, event Event) interface{}
+	client     *http.Client
+}
+
+// CreateNotifier creates a notifier from its configuration
+func CreateNotifier(cnf config.NotifierConfig, client *http.Client) (*Notifier, error) {
+	if err := cnf.Validate(); err != nil {
+		return nil, err
+	}
+	url := cnf.Url
+	if len(cnf.UrlEnv) > 0 {
+		url = os.Getenv(cnf.UrlEnv)
+		if len(url) == 0 {
+			return nil, fmt.Errorf("environment variable %s with the url of notifier '%s' is empty", cnf.UrlEnv, cnf.Name)
+		}
+	}
+	text := cnf.Template
+	if len(text) == 0 {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New(cnf.Name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template of notifier '%s': %w", cnf.Name, err)
+	}
+	on := cnf.On
+	if len(on) == 0 {
+		on = config.NotifyOnNewFindings
+	}
+	namespaces := make(map[string]bool, len(cnf.Namespaces))
+	for _, namespace := range cnf.Namespaces {
+		namespaces[namespace] = true
+	}
+	formats := map[string]func(string, Event) interface{}{
+		config.WebhookNotifier: formatWebhook,
+		config.SlackNotifier:   formatSlack,
+		config.TeamsNotifier:   formatTeams,
+	}
+	return &Notifier{
+		name:       cnf.Name,
+		url:        url,
+		headers:    cnf.Headers,
+		on:         on,
+		namespaces: namespaces,
+		template:   tmpl,
+		format:     formats[cnf.Type],
+		client:     client,
+	}, nil
+}
+
+// Accepts checks if the notifier wants to be notified about an event
+// notifiers only accept events of their namespaces and, unless they notify on completion, events with new findings
+func (n *Notifier) Accepts(event Event) bool {
+	if len(n.namespaces) > 0 && !n.namespaces[event.Namespace] {
+		return false
+	}
+	return n.on == config.NotifyOnCompleted || len(event.New) > 0
+}
+
+// Message renders the message of an event with the template of the notifier
+func (n *Notifier) Message(event Event) (string, error) {
+	message := &bytes.Buffer{}
+	if err := n.template.Execute(message, event); err != nil {
+		return "", fmt.Errorf("failed to render message of notifier '%s': %w", n.name, err)
+	}
+	return message.String(), nil
+}
+
+// Notify posts the message about an event to the url of the notifier
+func (n *Notifier) Notify(ctx context.Context, event Event) error {
+	message, err := n.Message(event)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(n.format(message, event))
+	if err != nil {
+		return fmt.Errorf("failed to encode message of notifier '%s': %w", n.name, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request of notifier '%s': %w", n.name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range n.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notifier '%s' failed to post message: %w", n.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("notifier '%s' got status %d: %s", n.name, resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// Dispatcher notifies all notifiers that accept an event
+type Dispatcher struct {
+	notifiers []*Notifier
+}
+
+// CreateDispatcher creates a dispatcher for the configured notifiers
+func CreateDispatcher(cnf []config.NotifierConfig, client *http.Client) (*Dispatcher, error) {
+	dispatcher := &Dispatcher{}
+	for _, notifierCnf := range cnf {
+		notifier, err := CreateNotifier(notifierCnf, client)
+		if err != nil {
+			return nil, err
+		}
+		dispatcher.notifiers = append(dispatcher.notifiers, notifier)
+	}
+	return dispatcher, nil
+}
+
+// Dispatch notifies the notifiers that accept the event, failing notifiers don't stop the others
+func (d *Dispatcher) Dispatch(ctx context.Context, l logger.Logger, event Event) {
+	if d == nil {
+		return
+	}
+	for _, notifier := range d.notifiers {
+		if !notifier.Accepts(event) {
+			continue
+		}
+		if err := notifier.Notify(ctx, event); err != nil {
+			l.V(logger.ImportantLevel).Error(err, "failed to notify about fuzz run", "notifier", notifier.name, "fuzzRun", event.Run)
+			continue
+		}
+		l.V(logger.DebugLevel).Info("notified about fuzz run", "notifier", notifier.name, "fuzzRun", event.Run)
+	}
+}
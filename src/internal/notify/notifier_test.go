@@ -0,0 +1,159 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// receiver webhook receiver that records the requests it gets
+type receiver struct {
+	mutex    sync.Mutex
+	server   *httptest.Server
+	status   int
+	payloads []map[string]interface{}
+	headers  []http.Header
+}
+
+func createReceiver(t *testing.T) *receiver {
+	r := &receiver{status: http.StatusOK}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		payload := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+		r.payloads = append(r.payloads, payload)
+		r.headers = append(r.headers, req.Header)
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func createTestEvent() Event {
+	finding := findings.Finding{Checker: "NameSpaceRuleChecker", Severity: findings.HighSeverity, StatusCode: "20x", Method: "GET", Endpoint: "/todo/{id}"}
+	return Event{
+		Run:       "cnfuzz-run-todo-api",
+		Namespace: "shop",
+		Pod:       "todo-api",
+		Target:    "shop/todo",
+		Findings:  []findings.Finding{finding},
+		New:       []findings.Record{{Target: "shop/todo", Fingerprint: finding.Fingerprint(), Finding: finding, Status: findings.OpenStatus}},
+		Reports:   []string{"/api/v1/runs/default/cnfuzz-run-todo-api-x7k2p/report"},
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	r := createReceiver(t)
+	notifier, err := CreateNotifier(config.NotifierConfig{
+		Name:    "hook",
+		Type:    config.WebhookNotifier,
+		Url:     r.server.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}, r.server.Client())
+	require.NoError(t, err)
+
+	require.NoError(t, notifier.Notify(context.Background(), createTestEvent()))
+	require.Len(t, r.payloads, 1)
+	payload := r.payloads[0]
+	assert.Equal(t, "Bearer secret", r.headers[0].Get("Authorization"))
+	assert.Equal(t, "application/json", r.headers[0].Get("Content-Type"))
+	assert.Equal(t, "shop/todo", payload["target"])
+	assert.Equal(t, float64(1), payload["findings"])
+	require.Len(t, payload["new"], 1)
+	newFinding := payload["new"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "high", newFinding["severity"])
+	assert.Equal(t, "/todo/{id}", newFinding["endpoint"])
+	assert.Equal(t, `cnfuzz fuzzed shop/todo (pod todo-api): 1 new, 0 fixed and 1 found findings
+- [high] NameSpaceRuleChecker GET /todo/{id} (20x)
+Report: /api/v1/runs/default/cnfuzz-run-todo-api-x7k2p/report`, payload["text"])
+}
+
+func TestSlackAndTeamsNotifiers(t *testing.T) {
+	r := createReceiver(t)
+	slack, err := CreateNotifier(config.NotifierConfig{
+		Name:     "slack",
+		Type:     config.SlackNotifier,
+		Url:      r.server.URL,
+		Template: "{{ len .New }} new findings in {{ .Target }}, highest severity: {{ .HighestSeverity }}",
+	}, r.server.Client())
+	require.NoError(t, err)
+	teams, err := CreateNotifier(config.NotifierConfig{Name: "teams", Type: config.TeamsNotifier, Url: r.server.URL}, r.server.Client())
+	require.NoError(t, err)
+
+	require.NoError(t, slack.Notify(context.Background(), createTestEvent()))
+	require.NoError(t, teams.Notify(context.Background(), createTestEvent()))
+	require.Len(t, r.payloads, 2)
+	assert.Equal(t, map[string]interface{}{"text": "1 new findings in shop/todo, highest severity: high"}, r.payloads[0])
+	assert.Equal(t, "MessageCard", r.payloads[1]["@type"])
+	assert.Equal(t, "B00020", r.payloads[1]["themeColor"])
+	assert.Contains(t, r.payloads[1]["text"], "NameSpaceRuleChecker")
+}
+
+func TestNotifierErrors(t *testing.T) {
+	r := createReceiver(t)
+	r.status = http.StatusForbidden
+	notifier, err := CreateNotifier(config.NotifierConfig{Name: "hook", Type: config.WebhookNotifier, Url: r.server.URL}, r.server.Client())
+	require.NoError(t, err)
+	assert.ErrorContains(t, notifier.Notify(context.Background(), createTestEvent()), "403")
+
+	_, err = CreateNotifier(config.NotifierConfig{Name: "hook", Type: "pager", Url: r.server.URL}, r.server.Client())
+	assert.Error(t, err)
+	_, err = CreateNotifier(config.NotifierConfig{Name: "hook", Type: config.SlackNotifier}, r.server.Client())
+	assert.Error(t, err)
+	_, err = CreateNotifier(config.NotifierConfig{Name: "hook", Type: config.SlackNotifier, Url: r.server.URL, Template: "{{ .Missing"}, r.server.Client())
+	assert.Error(t, err)
+	_, err = CreateNotifier(config.NotifierConfig{Name: "hook", Type: config.SlackNotifier, UrlEnv: "CNFUZZ_TEST_UNSET_URL"}, r.server.Client())
+	assert.Error(t, err)
+}
+
+func TestDispatch(t *testing.T) {
+	newFindings := createReceiver(t)
+	completed := createReceiver(t)
+	otherNamespace := createReceiver(t)
+	t.Setenv("CNFUZZ_TEST_WEBHOOK_URL", completed.server.URL)
+	dispatcher, err := CreateDispatcher([]config.NotifierConfig{
+		{Name: "new", Type: config.WebhookNotifier, Url: newFindings.server.URL},
+		{Name: "completed", Type: config.WebhookNotifier, UrlEnv: "CNFUZZ_TEST_WEBHOOK_URL", On: config.NotifyOnCompleted, Namespaces: []string{"shop"}},
+		{Name: "other", Type: config.WebhookNotifier, Url: otherNamespace.server.URL, On: config.NotifyOnCompleted, Namespaces: []string{"billing"}},
+	}, http.DefaultClient)
+	require.NoError(t, err)
+	l := logger.CreateDebugLogger()
+
+	dispatcher.Dispatch(context.Background(), l, createTestEvent())
+	withoutNewFindings := createTestEvent()
+	withoutNewFindings.New = nil
+	dispatcher.Dispatch(context.Background(), l, withoutNewFindings)
+
+	assert.Len(t, newFindings.payloads, 1)
+	assert.Len(t, completed.payloads, 2)
+	assert.Empty(t, otherNamespace.payloads)
+
+	// a nil dispatcher doesn't notify
+	var disabled *Dispatcher
+	disabled.Dispatch(context.Background(), l, createTestEvent())
+}
@@ -19,11 +19,18 @@ package persistence
 import (
 	"context"
 	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
 	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence/configmap"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence/file"
 	"github.com/suecodelabs/cnfuzz/src/internal/persistence/in_memory"
+	"github.com/suecodelabs/cnfuzz/src/internal/persistence/postgres"
 	"github.com/suecodelabs/cnfuzz/src/internal/persistence/redis"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
 	"github.com/suecodelabs/cnfuzz/src/pkg/health"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"k8s.io/client-go/kubernetes"
+	"time"
 )
 
 // Cache is an interface with functions that are needed for a cache solution to work with CnFuzz
@@ -33,28 +40,129 @@ type Cache[T any] interface {
 	GetByKey(ctx context.Context, key string) (obj *T, found bool, err error)
 }
 
+// ContainerImageCache is a Cache for the fuzz status of container images
+type ContainerImageCache interface {
+	Cache[model.ContainerImage]
+	// GetAll returns all known container images
+	GetAll(ctx context.Context) ([]*model.ContainerImage, error)
+}
+
+// FindingsStore is a Cache for the findings of all fuzz runs, keyed by target and fingerprint
+type FindingsStore interface {
+	Cache[findings.Record]
+	// GetByTarget returns the findings of a target, sorted by fingerprint
+	GetByTarget(ctx context.Context, target string) ([]findings.Record, error)
+	// GetAll returns the findings of all targets, sorted by target and fingerprint
+	GetAll(ctx context.Context) ([]findings.Record, error)
+}
+
 // Storage is a struct that has functions for every type that needs to be cached for CnFuzz.
-// Currently only model.ContainerImage gets cached.
 type Storage struct {
-	ContainerImageCache Cache[model.ContainerImage]
+	ContainerImageCache ContainerImageCache
+	FindingsStore       FindingsStore
 }
 
 // InitRedisCache initializes cache for Redis and returns Storage that can be used to interact with the redis instance.
-func InitRedisCache(l logger.Logger, addr string, port string, hc health.Checker) *Storage {
-	if len(port) > 0 {
-		addr = fmt.Sprintf("%s:%s", addr, port)
+// Waits until Redis can be reached, so a wrong config fails at startup instead of at the first pod event.
+func InitRedisCache(l logger.Logger, cnf *config.RedisConfig, hc health.Checker) (*Storage, error) {
+	client, err := redis.CreateClient(cnf)
+	if err != nil {
+		return nil, err
+	}
+	prefix := redis.KeyPrefix(cnf)
+	l.V(logger.DebugLevel).Info(fmt.Sprintf("using redis from %s", cnf.Address()), "redisAddr", cnf.Address(), "dbId", cnf.DB, "keyPrefix", prefix,
+		"sentinel", cnf.Sentinel != nil, "cluster", cnf.Cluster != nil)
+	timeout, err := cnf.GetConnectTimeout()
+	if err != nil {
+		return nil, err
+	}
+	if err := redis.WaitForConnection(context.TODO(), l, client, timeout); err != nil {
+		return nil, err
+	}
+	cICache := redis.CreateContainerImageRedis(l, client, prefix)
+	if err := cICache.Migrate(context.TODO()); err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to migrate container images inside redis to the current format")
 	}
-	pass := ""
-	db := 0
-	l.V(logger.DebugLevel).Info(fmt.Sprintf("using redis from %s", addr), "redisAddr", addr, "dbId", db)
-	cICache := redis.CreateContainerImageRedis(l, addr, pass, db)
 
 	hc.RegisterCheck("redis", cICache)
-	return &Storage{ContainerImageCache: cICache}
+	return &Storage{
+		ContainerImageCache: cICache,
+		FindingsStore:       redis.CreateFindingsRedis(l, client, prefix),
+	}, nil
+}
+
+// InitPostgresCache initializes cache for a PostgreSQL database, the schema of the database is migrated to the current version.
+// Returns Storage that can be used to interact with the database.
+func InitPostgresCache(l logger.Logger, dataSource string, hc health.Checker) (*Storage, error) {
+	db, err := postgres.Open(context.TODO(), l, postgres.PostgresDialect, dataSource)
+	if err != nil {
+		return nil, err
+	}
+	cICache := postgres.CreateContainerImageSql(l, db)
+
+	hc.RegisterCheck("postgres", cICache)
+	return &Storage{
+		ContainerImageCache: cICache,
+		FindingsStore:       postgres.CreateFindingsSql(l, db),
+	}, nil
+}
+
+// InitKubernetesCache initializes cache for ConfigMaps inside a namespace of the cluster and returns Storage that can be used to interact with them.
+func InitKubernetesCache(l logger.Logger, client kubernetes.Interface, namespace string, hc health.Checker) *Storage {
+	l.V(logger.DebugLevel).Info(fmt.Sprintf("using ConfigMaps inside namespace %s", namespace), "namespace", namespace)
+	cICache := configmap.CreateContainerImageConfigMap(l, client, namespace)
+
+	hc.RegisterCheck("kubernetes", cICache)
+	return &Storage{
+		ContainerImageCache: cICache,
+		FindingsStore:       configmap.CreateFindingsConfigMap(l, client, namespace),
+	}
+}
+
+// InitFileCache initializes cache for files inside a directory, e.g. on a persistent volume, and returns Storage that can be used to interact with them.
+// Only one controller can use the directory at a time.
+func InitFileCache(l logger.Logger, cnf *config.FileConfig, hc health.Checker) (*Storage, error) {
+	store, err := file.OpenStore(l, cnf.Path, cnf.CompactAfter)
+	if err != nil {
+		return nil, err
+	}
+	l.V(logger.DebugLevel).Info(fmt.Sprintf("using files inside %s", cnf.Path), "path", cnf.Path)
+	cICache := file.CreateContainerImageFile(l, store)
+
+	hc.RegisterCheck("file", cICache)
+	return &Storage{
+		ContainerImageCache: cICache,
+		FindingsStore:       file.CreateFindingsFile(l, store),
+	}, nil
 }
 
 // InitMemoryCache initialize cache for InMemory and returns Storage that can be used to interact with in memory storage.
 func InitMemoryCache(l logger.Logger) *Storage {
 	cICache := in_memory.CreateContainerImageRepository(l)
-	return &Storage{ContainerImageCache: cICache}
+	return &Storage{
+		ContainerImageCache: cICache,
+		FindingsStore:       in_memory.CreateFindingsRepository(l),
+	}
+}
+
+// RecordFindings stores the findings of a fuzz run of a target and returns which findings are new, known or fixed
+func RecordFindings(ctx context.Context, store FindingsStore, run findings.Run, found []findings.Finding) (findings.Changes, error) {
+	known, err := store.GetByTarget(ctx, run.Target)
+	if err != nil {
+		return findings.Changes{}, fmt.Errorf("failed to get the known findings of %s: %w", run.Target, err)
+	}
+	changes := findings.Reconcile(known, run, found, time.Now().UTC())
+	for _, record := range changes.New {
+		if err := store.Create(ctx, record); err != nil {
+			return changes, fmt.Errorf("failed to store finding %s: %w", record.Key(), err)
+		}
+	}
+	for _, records := range [][]findings.Record{changes.Known, changes.Fixed} {
+		for _, record := range records {
+			if err := store.Update(ctx, record); err != nil {
+				return changes, fmt.Errorf("failed to update finding %s: %w", record.Key(), err)
+			}
+		}
+	}
+	return changes, nil
 }
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configmap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/pkg/health"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	imageStore     = "images"
+	imagePrefix    = "cnfuzz-image-"
+	imageRecordKey = "image.json"
+)
+
+// containerImageConfigMap stores every image as a JSON record inside its own ConfigMap
+type containerImageConfigMap struct {
+	l         logger.Logger
+	client    kubernetes.Interface
+	namespace string
+}
+
+// Create stores the image, an existing image with the same key is replaced
+func (repo containerImageConfigMap) Create(ctx context.Context, containerImage model.ContainerImage) error {
+	key, val, err := containerImage.Marshal()
+	if err != nil {
+		return err
+	}
+	configMap := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        objectName(imagePrefix, key),
+			Namespace:   repo.namespace,
+			Labels:      map[string]string{StoreLabel: imageStore},
+			Annotations: map[string]string{KeyAnnotation: key},
+		},
+		Data: map[string]string{imageRecordKey: val},
+	}
+	_, err = repo.client.CoreV1().ConfigMaps(repo.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return repo.update(ctx, key, val)
+	}
+	return err
+}
+
+func (repo containerImageConfigMap) Update(ctx context.Context, containerImage model.ContainerImage) error {
+	key, val, err := containerImage.Marshal()
+	if err != nil {
+		return err
+	}
+	return repo.update(ctx, key, val)
+}
+
+// update replaces the record of an image, the ConfigMap is read again when it changed since it was read (optimistic concurrency)
+func (repo containerImageConfigMap) update(ctx context.Context, key string, val string) error {
+	configMaps := repo.client.CoreV1().ConfigMaps(repo.namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, objectName(imagePrefix, key), metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			return errors.New("couldn't find image to update")
+		} else if err != nil {
+			return err
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[imageRecordKey] = val
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (repo containerImageConfigMap) GetByKey(ctx context.Context, key string) (obj *model.ContainerImage, found bool, err error) {
+	configMap, err := repo.client.CoreV1().ConfigMaps(repo.namespace).Get(ctx, objectName(imagePrefix, key), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	if configMap.Annotations[KeyAnnotation] != key {
+		// another key with the same name
+		return nil, false, nil
+	}
+	image, err := imageFromConfigMap(configMap)
+	if err != nil {
+		return nil, true, err
+	}
+	return &image, true, nil
+}
+
+func (repo containerImageConfigMap) GetAll(ctx context.Context) ([]*model.ContainerImage, error) {
+	configMaps, err := repo.client.CoreV1().ConfigMaps(repo.namespace).List(ctx, metav1.ListOptions{LabelSelector: storeSelector(imageStore)})
+	if err != nil {
+		return nil, err
+	}
+	images := make([]*model.ContainerImage, 0, len(configMaps.Items))
+	for i := range configMaps.Items {
+		image, err := imageFromConfigMap(&configMaps.Items[i])
+		if err != nil {
+			repo.l.V(logger.DebugLevel).Info("ignoring ConfigMap that doesn't contain a container image", "configMap", configMaps.Items[i].Name, "error", err.Error())
+			continue
+		}
+		images = append(images, &image)
+	}
+	return images, nil
+}
+
+// imageFromConfigMap decodes the image record inside a ConfigMap
+func imageFromConfigMap(configMap *apiv1.ConfigMap) (model.ContainerImage, error) {
+	key := configMap.Annotations[KeyAnnotation]
+	val, found := configMap.Data[imageRecordKey]
+	if len(key) == 0 || !found {
+		return model.ContainerImage{}, fmt.Errorf("ConfigMap %s doesn't contain a container image", configMap.Name)
+	}
+	image, _, err := model.ContainerImageFromValue(key, val)
+	return image, err
+}
+
+// CheckHealth checks whether the ConfigMaps inside the namespace can be read
+func (repo containerImageConfigMap) CheckHealth(ctx context.Context) health.Health {
+	_, err := repo.client.CoreV1().ConfigMaps(repo.namespace).List(ctx, metav1.ListOptions{LabelSelector: storeSelector(imageStore), Limit: 1})
+	if err != nil {
+		h := health.NewHealth(false)
+		h.Info[health.StatusKey] = health.UnHealthyStatus
+		h.Info["reason"] = err.Error()
+		return h
+	}
+	h := health.NewHealth(true)
+	h.Info[health.StatusKey] = health.HealthyStatus
+	return h
+}
+
+func CreateContainerImageConfigMap(l logger.Logger, client kubernetes.Interface, namespace string) *containerImageConfigMap {
+	return &containerImageConfigMap{
+		l:         l,
+		client:    client,
+		namespace: namespace,
+	}
+}
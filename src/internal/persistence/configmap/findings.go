@@ -0,0 +1,189 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configmap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"sort"
+	"strings"
+)
+
+const (
+	findingsStore  = "findings"
+	findingsPrefix = "cnfuzz-findings-"
+)
+
+// findingsConfigMap stores the findings of a target inside one ConfigMap, with the JSON record of every finding under its fingerprint
+type findingsConfigMap struct {
+	l         logger.Logger
+	client    kubernetes.Interface
+	namespace string
+}
+
+func (repo findingsConfigMap) Create(ctx context.Context, record findings.Record) error {
+	return repo.store(ctx, record, true)
+}
+
+func (repo findingsConfigMap) Update(ctx context.Context, record findings.Record) error {
+	return repo.store(ctx, record, false)
+}
+
+// store stores the record inside the ConfigMap of its target, the ConfigMap of the target is created when create is set.
+// The other findings of the target can change at the same time, so the ConfigMap is read again when it changed since it was read.
+func (repo findingsConfigMap) store(ctx context.Context, record findings.Record, create bool) error {
+	val, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode finding: %w", err)
+	}
+	configMaps := repo.client.CoreV1().ConfigMaps(repo.namespace)
+	name := objectName(findingsPrefix, record.Target)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if k8serrors.IsNotFound(err) {
+			if !create {
+				return errors.New("couldn't find finding to update")
+			}
+			configMap = &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   repo.namespace,
+					Labels:      map[string]string{StoreLabel: findingsStore},
+					Annotations: map[string]string{KeyAnnotation: record.Target},
+				},
+				Data: map[string]string{record.Fingerprint: string(val)},
+			}
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+			if k8serrors.IsAlreadyExists(err) {
+				// created by someone else in the meantime, read it again
+				return k8serrors.NewConflict(apiv1.Resource("configmaps"), name, err)
+			}
+			return err
+		} else if err != nil {
+			return err
+		}
+		if _, found := configMap.Data[record.Fingerprint]; !found && !create {
+			return errors.New("couldn't find finding to update")
+		}
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[record.Fingerprint] = string(val)
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (repo findingsConfigMap) GetByKey(ctx context.Context, key string) (record *findings.Record, found bool, err error) {
+	separator := strings.LastIndex(key, "/")
+	if separator < 0 {
+		return nil, false, nil
+	}
+	target, fingerprint := key[:separator], key[separator+1:]
+	configMap, found, err := repo.get(ctx, target)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	val, found := configMap.Data[fingerprint]
+	if !found {
+		return nil, false, nil
+	}
+	record = &findings.Record{}
+	if err := json.Unmarshal([]byte(val), record); err != nil {
+		return nil, true, fmt.Errorf("failed to decode finding %s: %w", key, err)
+	}
+	return record, true, nil
+}
+
+func (repo findingsConfigMap) GetByTarget(ctx context.Context, target string) ([]findings.Record, error) {
+	configMap, found, err := repo.get(ctx, target)
+	if err != nil || !found {
+		return nil, err
+	}
+	records, err := recordsFromConfigMap(configMap)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Fingerprint < records[j].Fingerprint
+	})
+	return records, nil
+}
+
+func (repo findingsConfigMap) GetAll(ctx context.Context) ([]findings.Record, error) {
+	configMaps, err := repo.client.CoreV1().ConfigMaps(repo.namespace).List(ctx, metav1.ListOptions{LabelSelector: storeSelector(findingsStore)})
+	if err != nil {
+		return nil, err
+	}
+	var records []findings.Record
+	for i := range configMaps.Items {
+		targetRecords, err := recordsFromConfigMap(&configMaps.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, targetRecords...)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key() < records[j].Key()
+	})
+	return records, nil
+}
+
+// get returns the ConfigMap with the findings of a target
+func (repo findingsConfigMap) get(ctx context.Context, target string) (*apiv1.ConfigMap, bool, error) {
+	configMap, err := repo.client.CoreV1().ConfigMaps(repo.namespace).Get(ctx, objectName(findingsPrefix, target), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	// another target with the same name
+	if configMap.Annotations[KeyAnnotation] != target {
+		return nil, false, nil
+	}
+	return configMap, true, nil
+}
+
+// recordsFromConfigMap decodes the records of the findings inside a ConfigMap
+func recordsFromConfigMap(configMap *apiv1.ConfigMap) ([]findings.Record, error) {
+	records := make([]findings.Record, 0, len(configMap.Data))
+	for fingerprint, val := range configMap.Data {
+		record := findings.Record{}
+		if err := json.Unmarshal([]byte(val), &record); err != nil {
+			return nil, fmt.Errorf("failed to decode finding %s of ConfigMap %s: %w", fingerprint, configMap.Name, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func CreateFindingsConfigMap(l logger.Logger, client kubernetes.Interface, namespace string) *findingsConfigMap {
+	return &findingsConfigMap{
+		l:         l,
+		client:    client,
+		namespace: namespace,
+	}
+}
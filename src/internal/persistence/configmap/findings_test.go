@@ -0,0 +1,72 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configmap
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func TestFindingsConfigMap(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	repo := CreateFindingsConfigMap(logger.CreateDebugLogger(), client, testNamespace)
+	ctx := context.TODO()
+	first := findings.Record{Target: "default/todo", Fingerprint: "b", Status: findings.OpenStatus}
+	second := findings.Record{Target: "default/todo", Fingerprint: "a", Status: findings.OpenStatus}
+	other := findings.Record{Target: "default/other", Fingerprint: "a", Status: findings.OpenStatus}
+	for _, record := range []findings.Record{first, second, other} {
+		require.NoError(t, repo.Create(ctx, record))
+	}
+
+	// one ConfigMap per target
+	configMaps, err := client.CoreV1().ConfigMaps(testNamespace).List(ctx, metav1.ListOptions{LabelSelector: storeSelector(findingsStore)})
+	require.NoError(t, err)
+	assert.Len(t, configMaps.Items, 2)
+
+	records, err := repo.GetByTarget(ctx, "default/todo")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "a", records[0].Fingerprint)
+	assert.Equal(t, "b", records[1].Fingerprint)
+
+	records, err = repo.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, other.Key(), records[0].Key())
+
+	first.Status = findings.FixedStatus
+	require.NoError(t, repo.Update(ctx, first))
+	record, found, err := repo.GetByKey(ctx, first.Key())
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, findings.FixedStatus, record.Status)
+
+	_, found, err = repo.GetByKey(ctx, "default/todo/c")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.Error(t, repo.Update(ctx, findings.Record{Target: "default/todo", Fingerprint: "c"}))
+	assert.Error(t, repo.Update(ctx, findings.Record{Target: "default/unknown", Fingerprint: "a"}))
+	records, err = repo.GetByTarget(ctx, "default/unknown")
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
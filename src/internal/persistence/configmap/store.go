@@ -0,0 +1,54 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configmap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// Labels and annotations of the ConfigMaps that store the records
+const (
+	// StoreLabel label with the kind of records inside a ConfigMap, used to list the ConfigMaps of a cache
+	StoreLabel = "cnfuzz/store"
+	// KeyAnnotation annotation with the key of the records inside a ConfigMap, names can't contain every key
+	KeyAnnotation = "cnfuzz/key"
+)
+
+// maxNameLength maximum length of a ConfigMap name
+const maxNameLength = 253
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9.-]+")
+
+// objectName returns a valid ConfigMap name for a key, the readable part of the name is suffixed with a hash of the key,
+// so keys that only differ in characters that can't be used inside a name get different names
+func objectName(prefix string, key string) string {
+	hash := sha256.Sum256([]byte(key))
+	suffix := "-" + hex.EncodeToString(hash[:4])
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(key), "-"), "-.")
+	if max := maxNameLength - len(prefix) - len(suffix); len(name) > max {
+		name = strings.TrimRight(name[:max], "-.")
+	}
+	return prefix + name + suffix
+}
+
+// storeSelector returns the label selector of the ConfigMaps of a kind of records
+func storeSelector(kind string) string {
+	return StoreLabel + "=" + kind
+}
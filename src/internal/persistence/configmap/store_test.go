@@ -0,0 +1,35 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configmap
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestObjectName(t *testing.T) {
+	name := objectName(findingsPrefix, "default/todo-api")
+	assert.True(t, strings.HasPrefix(name, "cnfuzz-findings-default-todo-api-"))
+	assert.Len(t, name, len("cnfuzz-findings-default-todo-api-")+8)
+	assert.NotEqual(t, objectName(findingsPrefix, "a-b/c"), objectName(findingsPrefix, "a/b-c"))
+	assert.Equal(t, name, objectName(findingsPrefix, "default/todo-api"))
+
+	long := objectName(imagePrefix, "sha256:"+strings.Repeat("A", 300))
+	assert.Len(t, long, maxNameLength)
+	assert.Regexp(t, "^[a-z0-9][a-z0-9.-]*[a-z0-9]$", long)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"errors"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/pkg/health"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"os"
+)
+
+const imagesBucket = "images"
+
+type containerImageFile struct {
+	l     logger.Logger
+	store *Store
+}
+
+// Create stores the image, an existing image with the same key is replaced
+func (repo containerImageFile) Create(ctx context.Context, containerImage model.ContainerImage) error {
+	return repo.store.Put(imagesBucket, containerImage.Key(), containerImage)
+}
+
+func (repo containerImageFile) Update(ctx context.Context, containerImage model.ContainerImage) error {
+	if !repo.store.Contains(imagesBucket, containerImage.Key()) {
+		return errors.New("couldn't find image to update")
+	}
+	return repo.store.Put(imagesBucket, containerImage.Key(), containerImage)
+}
+
+func (repo containerImageFile) GetByKey(ctx context.Context, key string) (obj *model.ContainerImage, found bool, err error) {
+	image := &model.ContainerImage{}
+	found, err = repo.store.Get(imagesBucket, key, image)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	return image, true, nil
+}
+
+func (repo containerImageFile) GetAll(ctx context.Context) ([]*model.ContainerImage, error) {
+	keys, _ := repo.store.Records(imagesBucket)
+	images := make([]*model.ContainerImage, 0, len(keys))
+	for _, key := range keys {
+		image, found, err := repo.GetByKey(ctx, key)
+		if err != nil {
+			return nil, err
+		} else if found {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// CheckHealth checks whether the directory of the store can still be reached, e.g. that the volume is still mounted
+func (repo containerImageFile) CheckHealth(ctx context.Context) health.Health {
+	if _, err := os.Stat(repo.store.Dir()); err != nil {
+		h := health.NewHealth(false)
+		h.Info[health.StatusKey] = health.UnHealthyStatus
+		h.Info["reason"] = err.Error()
+		return h
+	}
+	h := health.NewHealth(true)
+	h.Info[health.StatusKey] = health.HealthyStatus
+	return h
+}
+
+func CreateContainerImageFile(l logger.Logger, store *Store) *containerImageFile {
+	return &containerImageFile{
+		l:     l,
+		store: store,
+	}
+}
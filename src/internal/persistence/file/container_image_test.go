@@ -0,0 +1,66 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"testing"
+)
+
+func TestContainerImageFile(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	dir := t.TempDir()
+	store, err := OpenStore(l, dir, 0)
+	require.NoError(t, err)
+	repo := CreateContainerImageFile(l, store)
+	ctx := context.TODO()
+	img1, _ := model.CreateContainerImage("9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", "sha256", model.BeingFuzzed)
+	img2, _ := model.CreateContainerImage("afa27b44d43b02a9fea41d13cedc2e4016cfcf87c5dbf990e593669aa8ce286d", "sha256", model.Fuzzed)
+	img1.Names = []string{"localhost:5000/todo-api:latest"}
+	require.NoError(t, repo.Create(ctx, img1))
+	require.NoError(t, repo.Create(ctx, img2))
+
+	image, found, err := repo.GetByKey(ctx, img1.Key())
+	require.NoError(t, err)
+	assert.True(t, found)
+	image.Status = model.Fuzzed
+	require.NoError(t, repo.Update(ctx, *image))
+
+	// the images survive a restart of the controller
+	store, err = OpenStore(l, dir, 0)
+	require.NoError(t, err)
+	repo = CreateContainerImageFile(l, store)
+	image, found, err = repo.GetByKey(ctx, img1.Key())
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, model.Fuzzed, image.Status)
+	assert.Equal(t, img1.Names, image.Names)
+	images, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, images, 2)
+
+	_, found, err = repo.GetByKey(ctx, "sha256:unknown")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	unknown, _ := model.CreateContainerImage("unknown", "sha256", model.Fuzzed)
+	assert.Error(t, repo.Update(ctx, unknown))
+	assert.True(t, repo.CheckHealth(ctx).IsHealthy)
+}
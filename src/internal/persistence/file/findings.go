@@ -0,0 +1,92 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"sort"
+)
+
+const findingsBucket = "findings"
+
+type findingsFile struct {
+	l     logger.Logger
+	store *Store
+}
+
+func (repo findingsFile) Create(ctx context.Context, record findings.Record) error {
+	return repo.store.Put(findingsBucket, record.Key(), record)
+}
+
+func (repo findingsFile) Update(ctx context.Context, record findings.Record) error {
+	if !repo.store.Contains(findingsBucket, record.Key()) {
+		return errors.New("couldn't find finding to update")
+	}
+	return repo.store.Put(findingsBucket, record.Key(), record)
+}
+
+func (repo findingsFile) GetByKey(ctx context.Context, key string) (record *findings.Record, found bool, err error) {
+	record = &findings.Record{}
+	found, err = repo.store.Get(findingsBucket, key, record)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	return record, true, nil
+}
+
+func (repo findingsFile) GetByTarget(ctx context.Context, target string) ([]findings.Record, error) {
+	all, err := repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var records []findings.Record
+	for _, record := range all {
+		if record.Target == target {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Fingerprint < records[j].Fingerprint
+	})
+	return records, nil
+}
+
+// GetAll returns the findings of all targets, the records of the store are sorted by key already
+func (repo findingsFile) GetAll(ctx context.Context) ([]findings.Record, error) {
+	keys, values := repo.store.Records(findingsBucket)
+	records := make([]findings.Record, 0, len(values))
+	for i, value := range values {
+		record := findings.Record{}
+		if err := json.Unmarshal(value, &record); err != nil {
+			return nil, fmt.Errorf("failed to decode finding %s: %w", keys[i], err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func CreateFindingsFile(l logger.Logger, store *Store) *findingsFile {
+	return &findingsFile{
+		l:     l,
+		store: store,
+	}
+}
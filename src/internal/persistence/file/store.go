@@ -0,0 +1,283 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Files of a store inside its directory
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.jsonl"
+)
+
+// DefaultCompactAfter number of write-ahead log entries after which the log is written to the snapshot
+const DefaultCompactAfter = 1000
+
+// walEntry entry of the write-ahead log, one JSON object per line
+type walEntry struct {
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// Store keeps JSON records inside buckets in memory and persists them to a directory, every write is appended to a
+// write-ahead log and the log is compacted into a snapshot of all records once it grows too large.
+// A store must only be used by one process at a time.
+type Store struct {
+	l            logger.Logger
+	dir          string
+	compactAfter int
+	mutex        sync.RWMutex
+	buckets      map[string]map[string]json.RawMessage
+	wal          *os.File
+	walEntries   int
+}
+
+// OpenStore opens the store inside a directory, the snapshot is loaded and the write-ahead log is replayed and compacted
+func OpenStore(l logger.Logger, dir string, compactAfter int) (*Store, error) {
+	if compactAfter <= 0 {
+		compactAfter = DefaultCompactAfter
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	store := &Store{
+		l:            l,
+		dir:          dir,
+		compactAfter: compactAfter,
+		buckets:      make(map[string]map[string]json.RawMessage),
+	}
+	if err := store.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	replayed, err := store.replayWal()
+	if err != nil {
+		return nil, err
+	}
+	l.V(logger.DebugLevel).Info("opened file store", "dir", dir, "replayedEntries", replayed)
+	if err := store.compact(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Put stores the record of a key inside a bucket, the record is written to the write-ahead log before the call returns
+func (s *Store) Put(bucket string, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s %s: %w", bucket, key, err)
+	}
+	line, err := json.Marshal(walEntry{Bucket: bucket, Key: key, Value: data})
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.wal == nil {
+		return errors.New("file store is closed")
+	}
+	if _, err := s.wal.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write to the write-ahead log: %w", err)
+	}
+	if err := s.wal.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the write-ahead log: %w", err)
+	}
+	s.apply(bucket, key, data)
+	s.walEntries++
+	if s.walEntries >= s.compactAfter {
+		if err := s.compact(); err != nil {
+			// the records are safe inside the write-ahead log, compacting is tried again after the next write
+			s.l.V(logger.ImportantLevel).Error(err, "failed to compact the file store", "dir", s.dir)
+		}
+	}
+	return nil
+}
+
+// Get decodes the record of a key inside a bucket into value, returns whether the key exists
+func (s *Store) Get(bucket string, key string, value any) (bool, error) {
+	s.mutex.RLock()
+	data, found := s.buckets[bucket][key]
+	s.mutex.RUnlock()
+	if !found {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return true, fmt.Errorf("failed to decode %s %s: %w", bucket, key, err)
+	}
+	return true, nil
+}
+
+// Contains returns whether a key exists inside a bucket
+func (s *Store) Contains(bucket string, key string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, found := s.buckets[bucket][key]
+	return found
+}
+
+// Records returns the records of a bucket sorted by key
+func (s *Store) Records(bucket string) (keys []string, records []json.RawMessage) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		records = append(records, s.buckets[bucket][key])
+	}
+	return keys, records
+}
+
+// Close compacts the write-ahead log and closes the store
+func (s *Store) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.wal == nil {
+		return nil
+	}
+	err := s.compact()
+	if closeErr := s.wal.Close(); err == nil {
+		err = closeErr
+	}
+	s.wal = nil
+	return err
+}
+
+// Dir returns the directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) apply(bucket string, key string, data json.RawMessage) {
+	records, found := s.buckets[bucket]
+	if !found {
+		records = make(map[string]json.RawMessage)
+		s.buckets[bucket] = records
+	}
+	records[key] = data
+}
+
+func (s *Store) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.buckets); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return nil
+}
+
+// replayWal applies the entries of the write-ahead log to the records. A broken last entry is the result of a crash
+// while it was written and is skipped, its write never returned.
+func (s *Store) replayWal() (int, error) {
+	file, err := os.Open(filepath.Join(s.dir, walFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to open the write-ahead log: %w", err)
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	replayed := 0
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return replayed, fmt.Errorf("failed to read the write-ahead log: %w", readErr)
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			entry := walEntry{}
+			if err := json.Unmarshal(line, &entry); err != nil {
+				if readErr == io.EOF {
+					s.l.V(logger.ImportantLevel).Info("skipping incomplete last entry of the write-ahead log", "dir", s.dir, "line", lineNumber)
+					return replayed, nil
+				}
+				return replayed, fmt.Errorf("write-ahead log entry %d is broken: %w", lineNumber, err)
+			}
+			s.apply(entry.Bucket, entry.Key, entry.Value)
+			replayed++
+		}
+		if readErr == io.EOF {
+			return replayed, nil
+		}
+	}
+}
+
+// compact writes all records to a new snapshot and starts a new write-ahead log.
+// The snapshot replaces the old one with a rename, a crash before the log is emptied replays entries that are
+// already inside the snapshot, which doesn't change the records.
+func (s *Store) compact() error {
+	data, err := json.Marshal(s.buckets)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	tmp, err := os.CreateTemp(s.dir, snapshotFile+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, snapshotFile)); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+	syncDir(s.dir)
+
+	// the old log stays in use when the new one can't be opened, its entries are already inside the snapshot
+	wal, err := os.OpenFile(filepath.Join(s.dir, walFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create the write-ahead log: %w", err)
+	}
+	if s.wal != nil {
+		_ = s.wal.Close()
+	}
+	s.wal = wal
+	s.walEntries = 0
+	return s.wal.Sync()
+}
+
+// syncDir syncs a directory so a rename inside it survives a crash, not every platform supports it
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
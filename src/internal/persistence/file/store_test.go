@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package file
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testRecord struct {
+	Value string `json:"value"`
+}
+
+func TestStoreReopen(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	dir := t.TempDir()
+	store, err := OpenStore(l, dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Put("test", "a", testRecord{Value: "first"}))
+	require.NoError(t, store.Put("test", "b", testRecord{Value: "second"}))
+	require.NoError(t, store.Put("test", "a", testRecord{Value: "changed"}))
+
+	// a crash leaves the records inside the write-ahead log only
+	reopened, err := OpenStore(l, dir, 0)
+	require.NoError(t, err)
+	record := testRecord{}
+	found, err := reopened.Get("test", "a", &record)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "changed", record.Value)
+	keys, _ := reopened.Records("test")
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	// opening compacts the log into the snapshot
+	wal, err := os.ReadFile(filepath.Join(dir, walFile))
+	require.NoError(t, err)
+	assert.Empty(t, wal)
+	require.NoError(t, reopened.Close())
+	assert.Error(t, reopened.Put("test", "c", testRecord{}))
+
+	reopened, err = OpenStore(l, dir, 0)
+	require.NoError(t, err)
+	found, err = reopened.Get("test", "b", &record)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "second", record.Value)
+	found, _ = reopened.Get("test", "c", &record)
+	assert.False(t, found)
+}
+
+func TestStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenStore(logger.CreateDebugLogger(), dir, 2)
+	require.NoError(t, err)
+	require.NoError(t, store.Put("test", "a", testRecord{Value: "a"}))
+	wal, _ := os.ReadFile(filepath.Join(dir, walFile))
+	assert.Equal(t, 1, strings.Count(string(wal), "\n"))
+	require.NoError(t, store.Put("test", "b", testRecord{Value: "b"}))
+	wal, _ = os.ReadFile(filepath.Join(dir, walFile))
+	assert.Empty(t, wal)
+	snapshot, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(snapshot), `"b":{"value":"b"}`)
+}
+
+func TestStoreFailedCompact(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	dir := t.TempDir()
+	store, err := OpenStore(l, dir, 1)
+	require.NoError(t, err)
+
+	// the new write-ahead log can't be created while a directory is in its place
+	require.NoError(t, os.Remove(filepath.Join(dir, walFile)))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, walFile), 0o750))
+	require.NoError(t, store.Put("test", "a", testRecord{Value: "a"}))
+	require.NoError(t, store.Put("test", "b", testRecord{Value: "b"}), "the store keeps using the old write-ahead log")
+
+	require.NoError(t, os.Remove(filepath.Join(dir, walFile)))
+	require.NoError(t, store.Put("test", "c", testRecord{Value: "c"}))
+	require.NoError(t, store.Close())
+
+	reopened, err := OpenStore(l, dir, 1)
+	require.NoError(t, err)
+	assert.True(t, reopened.Contains("test", "a"))
+	assert.True(t, reopened.Contains("test", "b"))
+	assert.True(t, reopened.Contains("test", "c"))
+	require.NoError(t, reopened.Close())
+}
+
+func TestStoreBrokenWal(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	dir := t.TempDir()
+	entry := `{"bucket":"test","key":"a","value":{"value":"a"}}` + "\n"
+
+	// a write that was interrupted by a crash
+	require.NoError(t, os.WriteFile(filepath.Join(dir, walFile), []byte(entry+`{"bucket":"test","key":"b","val`), 0o600))
+	store, err := OpenStore(l, dir, 0)
+	require.NoError(t, err)
+	assert.True(t, store.Contains("test", "a"))
+	assert.False(t, store.Contains("test", "b"))
+	require.NoError(t, store.Close())
+
+	// a broken entry before other entries isn't the result of a crash
+	require.NoError(t, os.WriteFile(filepath.Join(dir, walFile), []byte("broken\n"+entry), 0o600))
+	_, err = OpenStore(l, dir, 0)
+	assert.Error(t, err)
+}
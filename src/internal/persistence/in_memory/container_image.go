@@ -21,10 +21,12 @@ import (
 	"errors"
 	"github.com/suecodelabs/cnfuzz/src/internal/model"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"sync"
 )
 
 type containerImageMem struct {
 	l            logger.Logger
+	mutex        sync.RWMutex
 	fuzzedImages []*model.ContainerImage
 }
 
@@ -34,21 +36,33 @@ func CreateContainerImageRepository(l logger.Logger) *containerImageMem {
 	}
 }
 
+// GetAll returns copies of all images, so changing them doesn't change the stored images
 func (repo *containerImageMem) GetAll(ctx context.Context) ([]*model.ContainerImage, error) {
-	return repo.fuzzedImages, nil
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	images := make([]*model.ContainerImage, 0, len(repo.fuzzedImages))
+	for _, image := range repo.fuzzedImages {
+		imageCopy := image.Copy()
+		images = append(images, &imageCopy)
+	}
+	return images, nil
 }
 
 func (repo *containerImageMem) Create(ctx context.Context, model model.ContainerImage) error {
-	repo.fuzzedImages = append(repo.fuzzedImages, &model)
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	imageCopy := model.Copy()
+	repo.fuzzedImages = append(repo.fuzzedImages, &imageCopy)
 	return nil
 }
 
 func (repo *containerImageMem) Update(ctx context.Context, model model.ContainerImage) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
 	for i, savedImage := range repo.fuzzedImages {
-		savedHash, _ := savedImage.String()
-		targetHash, _ := model.String()
-		if savedHash == targetHash {
-			repo.fuzzedImages[i] = &model
+		if savedImage.Key() == model.Key() {
+			imageCopy := model.Copy()
+			repo.fuzzedImages[i] = &imageCopy
 			return nil
 		}
 	}
@@ -57,10 +71,12 @@ func (repo *containerImageMem) Update(ctx context.Context, model model.Container
 }
 
 func (repo *containerImageMem) GetByKey(ctx context.Context, key string) (containerImage *model.ContainerImage, found bool, err error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
 	for _, image := range repo.fuzzedImages {
-		strHash, _ := image.String()
-		if strHash == key {
-			return image, true, nil
+		if image.Key() == key {
+			imageCopy := image.Copy()
+			return &imageCopy, true, nil
 		}
 	}
 
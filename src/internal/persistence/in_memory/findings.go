@@ -0,0 +1,94 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package in_memory
+
+import (
+	"context"
+	"errors"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"sort"
+	"sync"
+)
+
+type findingsMem struct {
+	l       logger.Logger
+	mutex   sync.RWMutex
+	records map[string]findings.Record
+}
+
+func CreateFindingsRepository(l logger.Logger) *findingsMem {
+	return &findingsMem{
+		l:       l,
+		records: make(map[string]findings.Record),
+	}
+}
+
+func (repo *findingsMem) Create(ctx context.Context, record findings.Record) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.records[record.Key()] = record
+	return nil
+}
+
+func (repo *findingsMem) Update(ctx context.Context, record findings.Record) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, found := repo.records[record.Key()]; !found {
+		return errors.New("couldn't find finding to update")
+	}
+	repo.records[record.Key()] = record
+	return nil
+}
+
+func (repo *findingsMem) GetByKey(ctx context.Context, key string) (record *findings.Record, found bool, err error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	saved, found := repo.records[key]
+	if !found {
+		return nil, false, nil
+	}
+	return &saved, true, nil
+}
+
+func (repo *findingsMem) GetByTarget(ctx context.Context, target string) ([]findings.Record, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	var records []findings.Record
+	for _, record := range repo.records {
+		if record.Target == target {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Fingerprint < records[j].Fingerprint
+	})
+	return records, nil
+}
+
+func (repo *findingsMem) GetAll(ctx context.Context) ([]findings.Record, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	records := make([]findings.Record, 0, len(repo.records))
+	for _, record := range repo.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key() < records[j].Key()
+	})
+	return records, nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/suecodelabs/cnfuzz/src/internal/model"
+	"github.com/suecodelabs/cnfuzz/src/pkg/health"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+)
+
+// upsertImage stores the record of an image, the other columns are copies of record fields to query the images with SQL
+const upsertImage = `INSERT INTO container_images (image_key, hash_type, hash, status, first_seen, last_seen, last_run, last_run_result, last_run_time, record)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+ON CONFLICT (image_key) DO UPDATE SET status = excluded.status, first_seen = excluded.first_seen, last_seen = excluded.last_seen,
+last_run = excluded.last_run, last_run_result = excluded.last_run_result, last_run_time = excluded.last_run_time, record = excluded.record`
+
+const updateImage = `UPDATE container_images SET status = $2, first_seen = $3, last_seen = $4, last_run = $5, last_run_result = $6, last_run_time = $7, record = $8
+WHERE image_key = $1`
+
+type containerImageSql struct {
+	l  logger.Logger
+	db *sql.DB
+}
+
+// Create stores the image, an existing image with the same key is replaced
+func (repo containerImageSql) Create(ctx context.Context, containerImage model.ContainerImage) error {
+	key, val, err := containerImage.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = repo.db.ExecContext(ctx, upsertImage, key, containerImage.HashType, containerImage.Hash, containerImage.Status.String(),
+		containerImage.FirstSeen, containerImage.LastSeen, containerImage.LastRun, containerImage.LastRunResult, containerImage.LastRunTime, val)
+	return err
+}
+
+func (repo containerImageSql) Update(ctx context.Context, containerImage model.ContainerImage) error {
+	key, val, err := containerImage.Marshal()
+	if err != nil {
+		return err
+	}
+	result, err := repo.db.ExecContext(ctx, updateImage, key, containerImage.Status.String(), containerImage.FirstSeen, containerImage.LastSeen,
+		containerImage.LastRun, containerImage.LastRunResult, containerImage.LastRunTime, val)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.New("couldn't find image to update")
+	}
+	return nil
+}
+
+func (repo containerImageSql) GetByKey(ctx context.Context, key string) (obj *model.ContainerImage, found bool, err error) {
+	var val string
+	err = repo.db.QueryRowContext(ctx, "SELECT record FROM container_images WHERE image_key = $1", key).Scan(&val)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	image, _, err := model.ContainerImageFromValue(key, val)
+	if err != nil {
+		return nil, true, err
+	}
+	return &image, true, nil
+}
+
+func (repo containerImageSql) GetAll(ctx context.Context) ([]*model.ContainerImage, error) {
+	rows, err := repo.db.QueryContext(ctx, "SELECT image_key, record FROM container_images")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var images []*model.ContainerImage
+	for rows.Next() {
+		var key, val string
+		if err := rows.Scan(&key, &val); err != nil {
+			return nil, err
+		}
+		image, _, err := model.ContainerImageFromValue(key, val)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, &image)
+	}
+	return images, rows.Err()
+}
+
+func (repo containerImageSql) CheckHealth(ctx context.Context) health.Health {
+	if err := repo.db.PingContext(ctx); err != nil {
+		h := health.NewHealth(false)
+		h.Info[health.StatusKey] = health.UnHealthyStatus
+		h.Info["reason"] = err.Error()
+		return h
+	}
+	h := health.NewHealth(true)
+	h.Info[health.StatusKey] = health.HealthyStatus
+	return h
+}
+
+func CreateContainerImageSql(l logger.Logger, db *sql.DB) *containerImageSql {
+	return &containerImageSql{
+		l:  l,
+		db: db,
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Dialect SQL dialect of a database, the statements of the caches are written in the subset of SQL that
+// PostgreSQL and SQLite share, only the column types and the locking of migrations differ
+type Dialect struct {
+	// Driver name of the database/sql driver
+	Driver string
+	// JsonType column type of the JSON records
+	JsonType string
+	// TimestampType column type of timestamps
+	TimestampType string
+	// LockStatement statement that prevents concurrent migrations inside the migration transaction, empty when not needed
+	LockStatement string
+}
+
+// PostgresDialect dialect of PostgreSQL
+var PostgresDialect = Dialect{
+	Driver:        "postgres",
+	JsonType:      "JSONB",
+	TimestampType: "TIMESTAMP WITH TIME ZONE",
+	LockStatement: "SELECT pg_advisory_xact_lock(7365382)",
+}
+
+// migrations schema migrations in the order they are applied, the version of a migration is its index + 1.
+// Applied migrations must never change, add a new migration instead.
+// {{json}} and {{timestamp}} are replaced with the column types of the dialect.
+var migrations = []string{
+	`CREATE TABLE container_images (
+		image_key TEXT PRIMARY KEY,
+		hash_type TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		status TEXT NOT NULL,
+		first_seen {{timestamp}},
+		last_seen {{timestamp}},
+		last_run TEXT,
+		last_run_result TEXT,
+		last_run_time {{timestamp}},
+		record {{json}} NOT NULL
+	);
+	CREATE TABLE findings (
+		finding_key TEXT PRIMARY KEY,
+		target TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		checker TEXT NOT NULL,
+		method TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		first_seen {{timestamp}},
+		last_seen {{timestamp}},
+		occurrences INTEGER NOT NULL,
+		record {{json}} NOT NULL
+	);
+	CREATE INDEX findings_target ON findings (target, fingerprint);`,
+}
+
+// Open opens the database and applies the schema migrations that weren't applied yet
+func Open(ctx context.Context, l logger.Logger, dialect Dialect, dataSource string) (*sql.DB, error) {
+	db, err := sql.Open(dialect.Driver, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", dialect.Driver, err)
+	}
+	if err := Migrate(ctx, l, db, dialect); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate applies the schema migrations that weren't applied to the database yet, every migration in its own transaction
+func Migrate(ctx context.Context, l logger.Logger, db *sql.DB, dialect Dialect) error {
+	createTable := fmt.Sprintf("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at %s NOT NULL)", dialect.TimestampType)
+	if _, err := db.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("failed to create schema migrations table: %w", err)
+	}
+	for i, migration := range migrations {
+		applied, err := applyMigration(ctx, db, dialect, i+1, migration)
+		if err != nil {
+			return fmt.Errorf("failed to apply schema migration %d: %w", i+1, err)
+		}
+		if applied {
+			l.V(logger.InfoLevel).Info("applied schema migration", "version", i+1)
+		}
+	}
+	return nil
+}
+
+// applyMigration applies a migration when its version wasn't applied yet, returns whether it was applied
+func applyMigration(ctx context.Context, db *sql.DB, dialect Dialect, version int, migration string) (applied bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil || !applied {
+			_ = tx.Rollback()
+		}
+	}()
+	if len(dialect.LockStatement) > 0 {
+		if _, err = tx.ExecContext(ctx, dialect.LockStatement); err != nil {
+			return false, err
+		}
+	}
+	var count int
+	if err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = $1", version).Scan(&count); err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	replacer := strings.NewReplacer("{{json}}", dialect.JsonType, "{{timestamp}}", dialect.TimestampType)
+	for _, statement := range strings.Split(replacer.Replace(migration), ";") {
+		if len(strings.TrimSpace(statement)) == 0 {
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			return false, err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)", version, time.Now().UTC()); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SchemaVersion returns the version of the last applied schema migration, 0 when none was applied
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// ConnectionString returns the connection string of a PostgreSQL database
+func ConnectionString(host string, port string, database string, username string, password string, sslMode string) string {
+	var options []string
+	for _, option := range [][2]string{{"host", host}, {"port", port}, {"dbname", database}, {"user", username}, {"password", password}, {"sslmode", sslMode}} {
+		if len(option[1]) > 0 {
+			options = append(options, fmt.Sprintf("%s='%s'", option[0], strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(option[1])))
+		}
+	}
+	return strings.Join(options, " ")
+}
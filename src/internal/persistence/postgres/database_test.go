@@ -0,0 +1,66 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteDialect runs the caches against SQLite, so the tests don't need a PostgreSQL server
+var sqliteDialect = Dialect{
+	Driver:        "sqlite",
+	JsonType:      "TEXT",
+	TimestampType: "TIMESTAMP",
+}
+
+// openTestDb opens a migrated SQLite database inside a temporary directory of the test
+func openTestDb(t *testing.T) *sql.DB {
+	db, err := Open(context.TODO(), logger.CreateDebugLogger(), sqliteDialect, filepath.Join(t.TempDir(), "cnfuzz.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.TODO()
+	db := openTestDb(t)
+	version, err := SchemaVersion(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+
+	// applying the migrations again doesn't change the schema
+	require.NoError(t, Migrate(ctx, logger.CreateDebugLogger(), db, sqliteDialect))
+	var count int
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&count))
+	assert.Equal(t, len(migrations), count)
+	_, err = db.ExecContext(ctx, "SELECT image_key, record FROM container_images")
+	assert.NoError(t, err)
+}
+
+func TestConnectionString(t *testing.T) {
+	assert.Equal(t, "host='db' port='5432' dbname='cnfuzz' user='cnfuzz' password='it\\'s secret' sslmode='require'",
+		ConnectionString("db", "5432", "cnfuzz", "cnfuzz", "it's secret", "require"))
+	assert.Equal(t, "host='db'", ConnectionString("db", "", "", "", "", ""))
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"sort"
+)
+
+// upsertFinding stores the record of a finding, the other columns are copies of record fields to query the findings with SQL
+const upsertFinding = `INSERT INTO findings (finding_key, target, fingerprint, status, severity, checker, method, endpoint, first_seen, last_seen, occurrences, record)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+ON CONFLICT (finding_key) DO UPDATE SET status = excluded.status, severity = excluded.severity, checker = excluded.checker, method = excluded.method,
+endpoint = excluded.endpoint, first_seen = excluded.first_seen, last_seen = excluded.last_seen, occurrences = excluded.occurrences, record = excluded.record`
+
+const updateFinding = `UPDATE findings SET status = $2, severity = $3, checker = $4, method = $5, endpoint = $6, first_seen = $7, last_seen = $8, occurrences = $9, record = $10
+WHERE finding_key = $1`
+
+type findingsSql struct {
+	l  logger.Logger
+	db *sql.DB
+}
+
+func (repo findingsSql) Create(ctx context.Context, record findings.Record) error {
+	val, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode finding: %w", err)
+	}
+	_, err = repo.db.ExecContext(ctx, upsertFinding, record.Key(), record.Target, record.Fingerprint, string(record.Status), string(record.Finding.Severity),
+		record.Finding.Checker, record.Finding.Method, record.Finding.Endpoint, record.FirstSeen, record.LastSeen, record.Occurrences, string(val))
+	return err
+}
+
+func (repo findingsSql) Update(ctx context.Context, record findings.Record) error {
+	val, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode finding: %w", err)
+	}
+	result, err := repo.db.ExecContext(ctx, updateFinding, record.Key(), string(record.Status), string(record.Finding.Severity), record.Finding.Checker,
+		record.Finding.Method, record.Finding.Endpoint, record.FirstSeen, record.LastSeen, record.Occurrences, string(val))
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return errors.New("couldn't find finding to update")
+	}
+	return nil
+}
+
+func (repo findingsSql) GetByKey(ctx context.Context, key string) (record *findings.Record, found bool, err error) {
+	var val string
+	err = repo.db.QueryRowContext(ctx, "SELECT record FROM findings WHERE finding_key = $1", key).Scan(&val)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	record = &findings.Record{}
+	if err := json.Unmarshal([]byte(val), record); err != nil {
+		return nil, true, fmt.Errorf("failed to decode finding %s: %w", key, err)
+	}
+	return record, true, nil
+}
+
+// GetByTarget returns the findings of a target, sorted in Go because the order of ORDER BY depends on the collation of the database
+func (repo findingsSql) GetByTarget(ctx context.Context, target string) ([]findings.Record, error) {
+	records, err := repo.query(ctx, "SELECT finding_key, record FROM findings WHERE target = $1", target)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Fingerprint < records[j].Fingerprint
+	})
+	return records, nil
+}
+
+func (repo findingsSql) GetAll(ctx context.Context) ([]findings.Record, error) {
+	records, err := repo.query(ctx, "SELECT finding_key, record FROM findings")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key() < records[j].Key()
+	})
+	return records, nil
+}
+
+// query returns the records of the rows of a query that selects the key and the record of findings
+func (repo findingsSql) query(ctx context.Context, query string, args ...any) ([]findings.Record, error) {
+	rows, err := repo.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []findings.Record
+	for rows.Next() {
+		var key, val string
+		if err := rows.Scan(&key, &val); err != nil {
+			return nil, err
+		}
+		record := findings.Record{}
+		if err := json.Unmarshal([]byte(val), &record); err != nil {
+			return nil, fmt.Errorf("failed to decode finding %s: %w", key, err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func CreateFindingsSql(l logger.Logger, db *sql.DB) *findingsSql {
+	return &findingsSql{
+		l:  l,
+		db: db,
+	}
+}
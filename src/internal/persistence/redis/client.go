@@ -0,0 +1,206 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultClusterPrefix hash tag of the keys inside a cluster when no key prefix is configured
+const defaultClusterPrefix = "cnfuzz"
+
+// CreateClient creates a client for a standalone redis instance, a sentinel setup or a cluster, the client is shared by the caches
+func CreateClient(cnf *config.RedisConfig) (redis.UniversalClient, error) {
+	tlsConfig, err := createTlsConfig(cnf.Tls)
+	if err != nil {
+		return nil, err
+	}
+	pool := config.RedisPoolConfig{}
+	if cnf.Pool != nil {
+		pool = *cnf.Pool
+	}
+	timeouts, err := pool.GetTimeouts()
+	if err != nil {
+		return nil, err
+	}
+	password := envValue(cnf.PasswordEnv)
+
+	switch {
+	case cnf.Sentinel != nil:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cnf.Sentinel.MasterName,
+			SentinelAddrs:    cnf.Sentinel.Addresses,
+			SentinelUsername: cnf.Sentinel.Username,
+			SentinelPassword: envValue(cnf.Sentinel.PasswordEnv),
+			Username:         cnf.Username,
+			Password:         password,
+			DB:               cnf.DB,
+			TLSConfig:        tlsConfig,
+			PoolSize:         pool.Size,
+			MinIdleConns:     pool.MinIdle,
+			MaxRetries:       pool.MaxRetries,
+			DialTimeout:      timeouts[0],
+			ReadTimeout:      timeouts[1],
+			WriteTimeout:     timeouts[2],
+			PoolTimeout:      timeouts[3],
+		}), nil
+	case cnf.Cluster != nil:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cnf.Cluster.Addresses,
+			Username:     cnf.Username,
+			Password:     password,
+			TLSConfig:    tlsConfig,
+			PoolSize:     pool.Size,
+			MinIdleConns: pool.MinIdle,
+			MaxRetries:   pool.MaxRetries,
+			DialTimeout:  timeouts[0],
+			ReadTimeout:  timeouts[1],
+			WriteTimeout: timeouts[2],
+			PoolTimeout:  timeouts[3],
+		}), nil
+	default:
+		return redis.NewClient(&redis.Options{
+			Addr:         cnf.Address(),
+			Username:     cnf.Username,
+			Password:     password,
+			DB:           cnf.DB,
+			TLSConfig:    tlsConfig,
+			PoolSize:     pool.Size,
+			MinIdleConns: pool.MinIdle,
+			MaxRetries:   pool.MaxRetries,
+			DialTimeout:  timeouts[0],
+			ReadTimeout:  timeouts[1],
+			WriteTimeout: timeouts[2],
+			PoolTimeout:  timeouts[3],
+		}), nil
+	}
+}
+
+// KeyPrefix returns the prefix of the keys of the caches. Inside a cluster the prefix is a hash tag,
+// so all keys are kept inside one hash slot and transactions and MGET over several keys keep working.
+func KeyPrefix(cnf *config.RedisConfig) string {
+	if cnf.Cluster == nil {
+		return cnf.KeyPrefix
+	}
+	if strings.Contains(cnf.KeyPrefix, "{") && strings.Contains(cnf.KeyPrefix, "}") {
+		return cnf.KeyPrefix
+	}
+	tag := strings.TrimSuffix(cnf.KeyPrefix, ":")
+	if len(tag) == 0 {
+		tag = defaultClusterPrefix
+	}
+	return "{" + tag + "}:"
+}
+
+// WaitForConnection pings redis until it answers or the timeout expires
+func WaitForConnection(ctx context.Context, l logger.Logger, client redis.UniversalClient, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		err := client.Ping(ctx).Err()
+		if err == nil {
+			return nil
+		}
+		l.V(logger.InfoLevel).Info("waiting for redis", "error", err.Error())
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("redis can't be reached within %s: %w", timeout, err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// createTlsConfig creates the TLS config of the connections, nil when TLS isn't enabled
+func createTlsConfig(cnf *config.RedisTlsConfig) (*tls.Config, error) {
+	if cnf == nil || !cnf.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cnf.ServerName,
+		InsecureSkipVerify: cnf.InsecureSkipVerify,
+	}
+	if len(cnf.CaFile) > 0 {
+		data, err := os.ReadFile(cnf.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("redis CA bundle %s doesn't contain PEM certificates", cnf.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(cnf.CertFile) > 0 || len(cnf.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(cnf.CertFile, cnf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// envValue returns the value of an environment variable, empty when no variable is given
+func envValue(name string) string {
+	if len(name) == 0 {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// scanKeys returns the keys that match the pattern, inside a cluster the keys of every master are scanned
+func scanKeys(ctx context.Context, client redis.UniversalClient, pattern string) ([]string, error) {
+	cluster, isCluster := client.(*redis.ClusterClient)
+	if !isCluster {
+		return scanNode(ctx, client, pattern)
+	}
+	var mutex sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+		nodeKeys, err := scanNode(ctx, master, pattern)
+		mutex.Lock()
+		defer mutex.Unlock()
+		keys = append(keys, nodeKeys...)
+		return err
+	})
+	return keys, err
+}
+
+func scanNode(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, pattern, 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// escapePattern escapes the glob characters of a key prefix for SCAN
+func escapePattern(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`).Replace(prefix)
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateClient(t *testing.T) {
+	t.Setenv("TEST_REDIS_PASSWORD", "secret")
+	client, err := CreateClient(&config.RedisConfig{HostName: "redis", Port: "6379", Username: "cnfuzz", PasswordEnv: "TEST_REDIS_PASSWORD", DB: 2,
+		Pool: &config.RedisPoolConfig{Size: 5, DialTimeout: "2s"}})
+	require.NoError(t, err)
+	standalone, isStandalone := client.(*redis.Client)
+	require.True(t, isStandalone)
+	assert.Equal(t, "redis:6379", standalone.Options().Addr)
+	assert.Equal(t, "cnfuzz", standalone.Options().Username)
+	assert.Equal(t, "secret", standalone.Options().Password)
+	assert.Equal(t, 2, standalone.Options().DB)
+	assert.Equal(t, 5, standalone.Options().PoolSize)
+	assert.Equal(t, 2*time.Second, standalone.Options().DialTimeout)
+
+	client, err = CreateClient(&config.RedisConfig{Sentinel: &config.RedisSentinelConfig{MasterName: "mymaster", Addresses: []string{"sentinel:26379"}}})
+	require.NoError(t, err)
+	_, isStandalone = client.(*redis.Client)
+	assert.True(t, isStandalone, "a failover client is a client of the current master")
+
+	client, err = CreateClient(&config.RedisConfig{Cluster: &config.RedisClusterConfig{Addresses: []string{"node-0:6379", "node-1:6379"}}})
+	require.NoError(t, err)
+	cluster, isCluster := client.(*redis.ClusterClient)
+	require.True(t, isCluster)
+	assert.Equal(t, []string{"node-0:6379", "node-1:6379"}, cluster.Options().Addrs)
+
+	_, err = CreateClient(&config.RedisConfig{HostName: "redis", Pool: &config.RedisPoolConfig{ReadTimeout: "soon"}})
+	assert.Error(t, err)
+}
+
+func TestCreateClientTls(t *testing.T) {
+	client, err := CreateClient(&config.RedisConfig{HostName: "redis", Tls: &config.RedisTlsConfig{Enabled: true, ServerName: "redis.cnfuzz"}})
+	require.NoError(t, err)
+	tlsConfig := client.(*redis.Client).Options().TLSConfig
+	require.NotNil(t, tlsConfig)
+	assert.Equal(t, "redis.cnfuzz", tlsConfig.ServerName)
+
+	_, err = CreateClient(&config.RedisConfig{HostName: "redis", Tls: &config.RedisTlsConfig{Enabled: true, CaFile: filepath.Join(t.TempDir(), "missing.pem")}})
+	assert.Error(t, err)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+	_, err = CreateClient(&config.RedisConfig{HostName: "redis", Tls: &config.RedisTlsConfig{Enabled: true, CaFile: caFile}})
+	assert.Error(t, err)
+
+	// TLS isn't used when it isn't enabled
+	client, err = CreateClient(&config.RedisConfig{HostName: "redis", Tls: &config.RedisTlsConfig{CaFile: caFile}})
+	require.NoError(t, err)
+	assert.Nil(t, client.(*redis.Client).Options().TLSConfig)
+}
+
+func TestKeyPrefix(t *testing.T) {
+	assert.Equal(t, "", KeyPrefix(&config.RedisConfig{}))
+	assert.Equal(t, "team-a:", KeyPrefix(&config.RedisConfig{KeyPrefix: "team-a:"}))
+	cluster := &config.RedisClusterConfig{Addresses: []string{"node-0:6379"}}
+	assert.Equal(t, "{cnfuzz}:", KeyPrefix(&config.RedisConfig{Cluster: cluster}))
+	assert.Equal(t, "{team-a}:", KeyPrefix(&config.RedisConfig{Cluster: cluster, KeyPrefix: "team-a:"}))
+	assert.Equal(t, "{team-a}.", KeyPrefix(&config.RedisConfig{Cluster: cluster, KeyPrefix: "{team-a}."}))
+}
+
+func TestEscapePattern(t *testing.T) {
+	assert.Equal(t, `\[team\]\*\?:`, escapePattern("[team]*?:"))
+	assert.Equal(t, "{cnfuzz}:", escapePattern("{cnfuzz}:"))
+}
+
+func TestWaitForConnection(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", DialTimeout: 100 * time.Millisecond})
+	defer client.Close()
+	err := WaitForConnection(context.TODO(), logger.CreateDebugLogger(), client, 500*time.Millisecond)
+	assert.Error(t, err)
+}
@@ -21,21 +21,36 @@ import (
 	"github.com/suecodelabs/cnfuzz/src/internal/model"
 	"github.com/suecodelabs/cnfuzz/src/pkg/health"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v9"
 )
 
+// migrateScript replaces a legacy value with its JSON record, unless the value changed since it was read
+var migrateScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("SET", KEYS[1], ARGV[2])
+end
+return false
+`)
+
 type containerImageRedis struct {
 	l      logger.Logger
-	client *redis.Client
+	client redis.UniversalClient
+	// prefix prefix of the keys of the images
+	prefix string
 }
 
+// Create stores the image as a JSON record under the key <prefix><hash type>:<hash>
 func (repo containerImageRedis) Create(ctx context.Context, containerImage model.ContainerImage) error {
-	key, val := containerImage.String()
+	key, val, err := containerImage.Marshal()
+	if err != nil {
+		return err
+	}
 	exp := time.Duration(0) // 0 means keep forever
 
-	err := repo.client.Set(ctx, key, val, exp).Err()
+	err = repo.client.Set(ctx, repo.prefix+key, val, exp).Err()
 	if err != nil {
 		return err
 	}
@@ -48,7 +63,7 @@ func (repo containerImageRedis) Update(ctx context.Context, containerImage model
 }
 
 func (repo containerImageRedis) GetByKey(ctx context.Context, key string) (obj *model.ContainerImage, found bool, err error) {
-	val, err := repo.client.Get(ctx, key).Result()
+	val, err := repo.client.Get(ctx, repo.prefix+key).Result()
 	if err == redis.Nil {
 		return nil, false, nil
 	} else if err != nil {
@@ -56,7 +71,7 @@ func (repo containerImageRedis) GetByKey(ctx context.Context, key string) (obj *
 	}
 	repo.l.V(logger.DebugLevel).Info("received a container image from redis", "result", val)
 
-	imgRepo, convErr := model.ContainerImageFromString(key, val)
+	imgRepo, convErr := repo.fromValue(ctx, key, val)
 	if convErr != nil {
 		return nil, true, convErr
 	}
@@ -64,6 +79,68 @@ func (repo containerImageRedis) GetByKey(ctx context.Context, key string) (obj *
 	return &imgRepo, true, nil
 }
 
+// fromValue converts a stored value to an image, legacy values that only contain the status are migrated to a JSON record
+func (repo containerImageRedis) fromValue(ctx context.Context, key string, val string) (model.ContainerImage, error) {
+	image, legacy, err := model.ContainerImageFromValue(key, val)
+	if err != nil || !legacy {
+		return image, err
+	}
+	_, record, err := image.Marshal()
+	if err != nil {
+		return image, err
+	}
+	if err := migrateScript.Run(ctx, repo.client, []string{repo.prefix + key}, val, record).Err(); err != nil && err != redis.Nil {
+		repo.l.V(logger.InfoLevel).Error(err, "failed to migrate legacy container image record", "image", key)
+	} else {
+		repo.l.V(logger.DebugLevel).Info("migrated legacy container image record", "image", key)
+	}
+	return image, nil
+}
+
+// Migrate converts all legacy container image values to JSON records, keys that aren't container image keys are left unchanged
+func (repo containerImageRedis) Migrate(ctx context.Context) error {
+	_, err := repo.GetAll(ctx)
+	return err
+}
+
+// GetAll scans redis for container image keys, these are the keys in the format <prefix><hash type>:<hex digest>
+// other keys in the database are never read, so values of other applications are left unchanged
+func (repo containerImageRedis) GetAll(ctx context.Context) ([]*model.ContainerImage, error) {
+	keys, err := scanKeys(ctx, repo.client, escapePattern(repo.prefix)+"*:*")
+	if err != nil {
+		return nil, err
+	}
+	var images []*model.ContainerImage
+	for _, prefixedKey := range keys {
+		key, ok := imageKey(repo.prefix, prefixedKey)
+		if !ok {
+			continue
+		}
+		val, err := repo.client.Get(ctx, prefixedKey).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		image, convErr := repo.fromValue(ctx, key, val)
+		if convErr != nil {
+			repo.l.V(logger.DebugLevel).Info("ignoring key that isn't a container image", "key", prefixedKey)
+			continue
+		}
+		images = append(images, &image)
+	}
+	return images, nil
+}
+
+// imageKey returns the key of the container image stored under prefixedKey and whether it is the key of a container image at all
+func imageKey(prefix string, prefixedKey string) (string, bool) {
+	if !strings.HasPrefix(prefixedKey, prefix) {
+		return "", false
+	}
+	key := strings.TrimPrefix(prefixedKey, prefix)
+	return key, model.IsImageKey(key)
+}
+
 func (repo containerImageRedis) CheckHealth(ctx context.Context) health.Health {
 	status := repo.client.Ping(ctx)
 	err := status.Err()
@@ -79,15 +156,10 @@ func (repo containerImageRedis) CheckHealth(ctx context.Context) health.Health {
 	}
 }
 
-func CreateContainerImageRedis(l logger.Logger, addr string, password string, db int) *containerImageRedis {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
-	})
-
+func CreateContainerImageRedis(l logger.Logger, client redis.UniversalClient, prefix string) *containerImageRedis {
 	return &containerImageRedis{
 		l:      l,
-		client: rdb,
+		client: client,
+		prefix: prefix,
 	}
 }
@@ -16,6 +16,37 @@
 
 package redis
 
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestImageKey(t *testing.T) {
+	hash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	key, ok := imageKey("", "sha256:"+hash)
+	assert.True(t, ok)
+	assert.Equal(t, "sha256:"+hash, key)
+	key, ok = imageKey("cnfuzz:", "cnfuzz:sha256:"+hash)
+	assert.True(t, ok)
+	assert.Equal(t, "sha256:"+hash, key)
+
+	// keys of other applications and of the findings are never read or migrated
+	for _, foreignKey := range []string{
+		"session:12345",
+		"user:1234:name",
+		"finding:" + hash,
+		"findings:target",
+		"sha256:not-a-digest",
+		"other:sha256:" + hash,
+	} {
+		_, ok = imageKey("", foreignKey)
+		assert.False(t, ok, foreignKey)
+	}
+	_, ok = imageKey("cnfuzz:", "sha256:"+hash)
+	assert.False(t, ok, "keys without the prefix belong to another application")
+}
+
 /* TODO redis mock doesn't support v9 https://github.com/go-redis/redismock/issues/37
 var testContainerImage = model.ContainerImage{
 	Hash:     "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
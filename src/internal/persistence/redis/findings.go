@@ -0,0 +1,144 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v9"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"sort"
+	"strings"
+)
+
+// Keys of the findings inside redis
+// every record is a JSON value, the keys of the records of a target are kept in a set
+const (
+	findingKeyPrefix       = "finding:"
+	targetFindingKeyPrefix = "findings:"
+)
+
+type findingsRedis struct {
+	l      logger.Logger
+	client redis.UniversalClient
+	// prefix prefix of the keys of the findings
+	prefix string
+}
+
+func (repo findingsRedis) Create(ctx context.Context, record findings.Record) error {
+	val, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode finding: %w", err)
+	}
+	_, err = repo.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, repo.prefix+findingKeyPrefix+record.Key(), val, 0)
+		pipe.SAdd(ctx, repo.prefix+targetFindingKeyPrefix+record.Target, record.Key())
+		return nil
+	})
+	return err
+}
+
+func (repo findingsRedis) Update(ctx context.Context, record findings.Record) error {
+	return repo.Create(ctx, record)
+}
+
+func (repo findingsRedis) GetByKey(ctx context.Context, key string) (record *findings.Record, found bool, err error) {
+	val, err := repo.client.Get(ctx, repo.prefix+findingKeyPrefix+key).Result()
+	if err == redis.Nil {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	record = &findings.Record{}
+	if err := json.Unmarshal([]byte(val), record); err != nil {
+		return nil, true, fmt.Errorf("failed to decode finding %s: %w", key, err)
+	}
+	return record, true, nil
+}
+
+func (repo findingsRedis) GetByTarget(ctx context.Context, target string) ([]findings.Record, error) {
+	keys, err := repo.client.SMembers(ctx, repo.prefix+targetFindingKeyPrefix+target).Result()
+	if err != nil {
+		return nil, err
+	}
+	records, err := repo.getRecords(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Fingerprint < records[j].Fingerprint
+	})
+	return records, nil
+}
+
+func (repo findingsRedis) GetAll(ctx context.Context) ([]findings.Record, error) {
+	prefixedKeys, err := scanKeys(ctx, repo.client, escapePattern(repo.prefix+findingKeyPrefix)+"*")
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(prefixedKeys))
+	for _, key := range prefixedKeys {
+		keys = append(keys, strings.TrimPrefix(key, repo.prefix+findingKeyPrefix))
+	}
+	records, err := repo.getRecords(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Key() < records[j].Key()
+	})
+	return records, nil
+}
+
+// getRecords gets the records of keys, keys of records that don't exist anymore are skipped
+func (repo findingsRedis) getRecords(ctx context.Context, keys []string) ([]findings.Record, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	redisKeys := make([]string, 0, len(keys))
+	for _, key := range keys {
+		redisKeys = append(redisKeys, repo.prefix+findingKeyPrefix+key)
+	}
+	values, err := repo.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]findings.Record, 0, len(values))
+	for i, value := range values {
+		val, isString := value.(string)
+		if !isString {
+			repo.l.V(logger.DebugLevel).Info("finding doesn't exist anymore", "key", keys[i])
+			continue
+		}
+		record := findings.Record{}
+		if err := json.Unmarshal([]byte(val), &record); err != nil {
+			return nil, fmt.Errorf("failed to decode finding %s: %w", keys[i], err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func CreateFindingsRedis(l logger.Logger, client redis.UniversalClient, prefix string) *findingsRedis {
+	return &findingsRedis{
+		l:      l,
+		client: client,
+		prefix: prefix,
+	}
+}
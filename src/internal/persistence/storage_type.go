@@ -23,12 +23,15 @@ type StorageType int
 const (
 	Redis StorageType = iota
 	InMemory
+	Postgres
+	Kubernetes
+	File
 )
 
 // StorageTypes that cnfuzz supports.
-// Currently contains Redis and InMemory support.
+// Currently contains Redis, InMemory, Postgres, Kubernetes and File support.
 // These strings are used to map the value from the config to a StorageType type.
-var StorageTypes = [2]string{"redis", "in_memory"}
+var StorageTypes = [5]string{"redis", "in_memory", "postgres", "kubernetes", "file"}
 
 // String() returns the string equivalent of the enumeration
 func (s StorageType) String() string {
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/suecodelabs/cnfuzz/src/internal/coverage"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+)
+
+// CreateMetricsRegistry creates a registry with the coverage, findings and timings of a run as metrics
+// the controller serves the registries of the newest runs
+func CreateMetricsRegistry(r RunReport) (*prometheus.Registry, error) {
+	targetLabels := prometheus.Labels{"pod": r.PodName, "namespace": r.Namespace}
+	summary := r.Coverage.Summary()
+
+	operations := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "cnfuzz_operations",
+		Help:        "Number of operations of the API per coverage status",
+		ConstLabels: targetLabels,
+	}, []string{"status"})
+	operations.WithLabelValues(string(coverage.Succeeded)).Set(float64(summary.Succeeded))
+	operations.WithLabelValues(string(coverage.Failed)).Set(float64(summary.Attempted - summary.Succeeded))
+	operations.WithLabelValues(string(coverage.NotAttempted)).Set(float64(summary.Total - summary.Attempted))
+
+	operationStatus := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "cnfuzz_operation_status",
+		Help:        "Coverage status of an operation of the API, with the reason when it never succeeded",
+		ConstLabels: targetLabels,
+	}, []string{"method", "endpoint", "status", "reason"})
+	for _, endpoint := range r.Coverage.Endpoints {
+		operationStatus.WithLabelValues(endpoint.Method, endpoint.Endpoint, string(endpoint.Status), string(endpoint.Reason)).Set(1)
+	}
+
+	foundFindings := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "cnfuzz_findings",
+		Help:        "Number of bugs found per severity",
+		ConstLabels: targetLabels,
+	}, []string{"severity"})
+	for _, severity := range []findings.Severity{findings.HighSeverity, findings.MediumSeverity, findings.LowSeverity} {
+		foundFindings.WithLabelValues(string(severity))
+	}
+	for _, finding := range r.Findings {
+		foundFindings.WithLabelValues(string(finding.Severity)).Inc()
+	}
+
+	duration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:        "cnfuzz_duration_seconds",
+		Help:        "Duration of the phases of the fuzz run",
+		ConstLabels: targetLabels,
+	}, []string{"phase"})
+	duration.WithLabelValues("compile").Set(r.Timings.Compile.Seconds())
+	duration.WithLabelValues("fuzz").Set(r.Timings.Fuzz.Seconds())
+
+	registry := prometheus.NewRegistry()
+	for _, collector := range []prometheus.Collector{operations, operationStatus, foundFindings, duration} {
+		if err := registry.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register metrics: %w", err)
+		}
+	}
+	return registry, nil
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateMetricsRegistry(t *testing.T) {
+	registry, err := CreateMetricsRegistry(createTestRunReport())
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "cnfuzz.prom")
+	require.NoError(t, prometheus.WriteToTextfile(path, registry))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	metrics := string(data)
+	assert.Contains(t, metrics, `cnfuzz_operations{namespace="default",pod="todo-api",status="succeeded"} 2`)
+	assert.Contains(t, metrics, `cnfuzz_operations{namespace="default",pod="todo-api",status="not-attempted"} 1`)
+	assert.Contains(t, metrics, `cnfuzz_operation_status{endpoint="/todo/{id}",method="DELETE",namespace="default",pod="todo-api",reason="auth",status="failed"} 1`)
+	assert.Contains(t, metrics, `cnfuzz_findings{namespace="default",pod="todo-api",severity="medium"} 2`)
+	assert.Contains(t, metrics, `cnfuzz_findings{namespace="default",pod="todo-api",severity="low"} 0`)
+	assert.Contains(t, metrics, `cnfuzz_duration_seconds{namespace="default",phase="fuzz",pod="todo-api"} 110`)
+}
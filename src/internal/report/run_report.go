@@ -0,0 +1,206 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"embed"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/coverage"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	htmltemplate "html/template"
+	"io"
+	v1 "k8s.io/api/core/v1"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// File names of the run reports inside the results directory
+const (
+	MarkdownReportFileName = "cnfuzz-report.md"
+	HtmlReportFileName     = "cnfuzz-report.html"
+)
+
+// reportPath path of the report of a fuzz run on the API of the controller, with the namespace and the name of the run
+const reportPath = "/api/v1/runs/%s/%s/report"
+
+// unknownOperation operation of findings that couldn't be matched to an operation of the API
+const unknownOperation = "Unknown operation"
+
+//go:embed templates
+var templates embed.FS
+
+var templateFuncs = map[string]any{
+	"formatTime": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+	"inc": func(i int) int {
+		return i + 1
+	},
+}
+
+var (
+	markdownTemplate = texttemplate.Must(texttemplate.New("report.md.tmpl").Funcs(templateFuncs).ParseFS(templates, "templates/report.md.tmpl"))
+	htmlTemplate     = htmltemplate.Must(htmltemplate.New("report.html.tmpl").Funcs(templateFuncs).ParseFS(templates, "templates/report.html.tmpl"))
+)
+
+// RunReport human-readable report of a single fuzz run
+type RunReport struct {
+	PodName      string
+	Namespace    string
+	Images       []Image
+	ApiTitle     string
+	ApiVersion   string
+	DiscoveryDoc string
+	Coverage     coverage.Coverage
+	Findings     []findings.Finding
+	Timings      Timings
+}
+
+// Image container image of the target pod
+type Image struct {
+	Container string
+	Name      string
+	// Digest digest of the image that is running, e.g. sha256:5add8f...
+	Digest string
+}
+
+// Timings timings of the fuzz run
+type Timings struct {
+	Started  time.Time
+	Finished time.Time
+	Compile  time.Duration
+	Fuzz     time.Duration
+}
+
+// EndpointFindings findings of a single operation
+type EndpointFindings struct {
+	Operation string
+	Findings  []findings.Finding
+}
+
+// FindingsByEndpoint groups the findings by the operation that triggered them
+// operations are sorted, findings that couldn't be matched to an operation come last
+func (r RunReport) FindingsByEndpoint() []EndpointFindings {
+	grouped := make(map[string][]findings.Finding)
+	var operations []string
+	for _, finding := range r.Findings {
+		operation := finding.Operation()
+		if len(operation) == 0 {
+			operation = unknownOperation
+		}
+		if _, found := grouped[operation]; !found {
+			operations = append(operations, operation)
+		}
+		grouped[operation] = append(grouped[operation], finding)
+	}
+	sort.Slice(operations, func(i, j int) bool {
+		if operations[i] == unknownOperation || operations[j] == unknownOperation {
+			return operations[j] == unknownOperation && operations[i] != unknownOperation
+		}
+		return operations[i] < operations[j]
+	})
+	endpoints := make([]EndpointFindings, 0, len(operations))
+	for _, operation := range operations {
+		endpoints = append(endpoints, EndpointFindings{Operation: operation, Findings: grouped[operation]})
+	}
+	return endpoints
+}
+
+// ImagesOfPod returns the images the containers of a pod are running
+func ImagesOfPod(pod *v1.Pod) []Image {
+	images := make([]Image, 0, len(pod.Status.ContainerStatuses))
+	for _, status := range pod.Status.ContainerStatuses {
+		images = append(images, Image{
+			Container: status.Name,
+			Name:      status.Image,
+			Digest:    imageDigest(status.ImageID),
+		})
+	}
+	return images
+}
+
+// imageDigest returns the digest part of an image id like docker-pullable://registry/image@sha256:5add8f...
+func imageDigest(imageId string) string {
+	if index := strings.LastIndex(imageId, "@"); index >= 0 {
+		return imageId[index+1:]
+	}
+	if index := strings.Index(imageId, "://"); index >= 0 {
+		return imageId[index+3:]
+	}
+	return imageId
+}
+
+// WriteMarkdownReport renders the report as Markdown
+func WriteMarkdownReport(w io.Writer, r RunReport) error {
+	return markdownTemplate.Execute(w, r)
+}
+
+// WriteHtmlReport renders the report as HTML
+func WriteHtmlReport(w io.Writer, r RunReport) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// WriteRunReports writes the Markdown and HTML report into dir
+// returns the paths of the written reports
+func WriteRunReports(dir string, r RunReport) ([]string, error) {
+	writers := []struct {
+		fileName string
+		write    func(io.Writer, RunReport) error
+	}{
+		{MarkdownReportFileName, WriteMarkdownReport},
+		{HtmlReportFileName, WriteHtmlReport},
+	}
+	paths := make([]string, 0, len(writers))
+	for _, writer := range writers {
+		path := filepath.Join(dir, writer.fileName)
+		if err := writeReportFile(path, r, writer.write); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// ReportLocations returns the paths of the Markdown and the HTML report of a fuzz run on the API of the controller
+// the API renders the reports from the run, so they outlive the pod of the fuzz job
+func ReportLocations(namespace string, fuzzRun string) []string {
+	path := fmt.Sprintf(reportPath, namespace, fuzzRun)
+	return []string{path, path + "?format=html"}
+}
+
+// writeReportFile renders a report into a file
+func writeReportFile(path string, r RunReport, write func(io.Writer, RunReport) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report %s: %w", path, err)
+	}
+	if err := write(file, r); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to render report %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return nil
+}
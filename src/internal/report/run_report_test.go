@@ -0,0 +1,129 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/coverage"
+	v1 "k8s.io/api/core/v1"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func createTestRunReport() RunReport {
+	started := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	return RunReport{
+		PodName:      "todo-api",
+		Namespace:    "default",
+		Images:       []Image{{Container: "api", Name: "todo-api:1.0", Digest: "sha256:5add8f"}},
+		ApiTitle:     "Todo API",
+		ApiVersion:   "1.0",
+		DiscoveryDoc: "http://10.0.0.1:8080/swagger.json",
+		Coverage: coverage.Coverage{Endpoints: []coverage.EndpointCoverage{
+			{Method: "GET", Endpoint: "/todo", Status: coverage.Succeeded, StatusCode: "200"},
+			{Method: "POST", Endpoint: "/todo", Status: coverage.Succeeded, StatusCode: "201"},
+			{Method: "DELETE", Endpoint: "/todo/{id}", Status: coverage.Failed, StatusCode: "401", Reason: coverage.AuthReason, Message: "Unauthorized"},
+			{Method: "GET", Endpoint: "/todo/{id}", Status: coverage.NotAttempted, Reason: coverage.NotRenderedReason},
+		}},
+		Findings: createTestFindings(),
+		Timings: Timings{
+			Started:  started,
+			Finished: started.Add(2 * time.Minute),
+			Compile:  10 * time.Second,
+			Fuzz:     110 * time.Second,
+		},
+	}
+}
+
+func TestFindingsByEndpoint(t *testing.T) {
+	grouped := createTestRunReport().FindingsByEndpoint()
+	require.Len(t, grouped, 3)
+	assert.Equal(t, "GET /todo/{id}", grouped[0].Operation)
+	assert.Equal(t, "POST /todo", grouped[1].Operation)
+	assert.Equal(t, unknownOperation, grouped[2].Operation)
+	assert.Len(t, grouped[0].Findings, 1)
+}
+
+func TestWriteMarkdownReport(t *testing.T) {
+	out := &bytes.Buffer{}
+	require.NoError(t, WriteMarkdownReport(out, createTestRunReport()))
+	markdown := out.String()
+
+	assert.Contains(t, markdown, "# cnfuzz report: Todo API 1.0")
+	assert.Contains(t, markdown, "`default/todo-api`")
+	assert.Contains(t, markdown, "(`sha256:5add8f`)")
+	assert.Contains(t, markdown, "2 of 4 operations succeeded (50%), 3 were attempted.")
+	assert.Contains(t, markdown, "| `DELETE /todo/{id}` | failed | 401 | auth: Unauthorized |")
+	assert.Contains(t, markdown, "### GET /todo/{id}")
+	assert.Contains(t, markdown, "1. `DELETE /todo/1` => `HTTP/1.1 204 No Content`")
+	assert.Contains(t, markdown, "| Fuzz duration | 1m50s |")
+
+	out.Reset()
+	require.NoError(t, WriteMarkdownReport(out, RunReport{ApiTitle: "Empty"}))
+	assert.Contains(t, out.String(), "No bugs found.")
+	assert.Contains(t, out.String(), "No coverage information available.")
+}
+
+func TestWriteHtmlReport(t *testing.T) {
+	runReport := createTestRunReport()
+	runReport.Findings[0].ReproSequence[0].Request = "POST /todo HTTP/1.1\n\n<script>alert(1)</script>"
+	out := &bytes.Buffer{}
+	require.NoError(t, WriteHtmlReport(out, runReport))
+	html := out.String()
+
+	assert.Contains(t, html, "<h1>cnfuzz report: Todo API 1.0</h1>")
+	assert.Contains(t, html, "<h3>GET /todo/{id}</h3>")
+	assert.Contains(t, html, "<td>DELETE /todo/{id}</td><td>failed</td><td>401</td><td>auth: Unauthorized</td>")
+	assert.Contains(t, html, `<h4 class="high">NameSpaceRuleChecker (20x, high severity)</h4>`)
+	// requests are escaped
+	assert.NotContains(t, html, "<script>")
+	assert.Contains(t, html, "&lt;script&gt;")
+}
+
+func TestWriteRunReports(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := WriteRunReports(dir, createTestRunReport())
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, MarkdownReportFileName), filepath.Join(dir, HtmlReportFileName)}, paths)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Size())
+	}
+}
+
+func TestReportLocations(t *testing.T) {
+	assert.Equal(t, []string{
+		"/api/v1/runs/default/cnfuzz-run-todo-api/report",
+		"/api/v1/runs/default/cnfuzz-run-todo-api/report?format=html",
+	}, ReportLocations("default", "cnfuzz-run-todo-api"))
+}
+
+func TestImagesOfPod(t *testing.T) {
+	pod := &v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+		{Name: "api", Image: "localhost:5000/todo-api:1.0", ImageID: "docker-pullable://localhost:5000/todo-api@sha256:5add8f"},
+		{Name: "sidecar", Image: "sidecar:latest", ImageID: "sha256:1a2b3c"},
+	}}}
+	images := ImagesOfPod(pod)
+	require.Len(t, images, 2)
+	assert.Equal(t, Image{Container: "api", Name: "localhost:5000/todo-api:1.0", Digest: "sha256:5add8f"}, images[0])
+	assert.Equal(t, "sha256:1a2b3c", images[1].Digest)
+}
@@ -0,0 +1,256 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package report creates reports from the findings of a fuzz run
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	SarifVersion = "2.1.0"
+	SarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// SarifFileName name of the SARIF report inside the results directory
+	SarifFileName = "cnfuzz.sarif"
+
+	toolName           = "cnfuzz"
+	toolInformationUri = "https://github.com/suecodelabs/cnfuzz"
+)
+
+// checkerDescriptions descriptions of the RESTler checkers, used as rule descriptions
+var checkerDescriptions = map[string]string{
+	"main_driver":                 "The API returned a server error while fuzzing",
+	"NameSpaceRuleChecker":        "A resource created by one identity is accessible by another identity",
+	"ResourceHierarchyChecker":    "A child resource is accessible through a parent resource it doesn't belong to",
+	"UseAfterFreeChecker":         "A deleted resource is still accessible",
+	"LeakageRuleChecker":          "A resource that failed to be created is still accessible",
+	"InvalidDynamicObjectChecker": "A request with an invalid resource id was handled without an error",
+	"PayloadBodyChecker":          "The API returned a server error for a fuzzed request body",
+	"ExamplesChecker":             "The API returned a server error for an example request",
+	"InvalidValueChecker":         "The API returned a server error for an invalid parameter value",
+}
+
+// securitySeverities security-severity scores of the severities, used by code scanning tools to rank results
+var securitySeverities = map[findings.Severity]string{
+	findings.HighSeverity:   "8.0",
+	findings.MediumSeverity: "5.0",
+	findings.LowSeverity:    "2.0",
+}
+
+// levels SARIF levels of the severities
+var levels = map[findings.Severity]string{
+	findings.HighSeverity:   "error",
+	findings.MediumSeverity: "warning",
+	findings.LowSeverity:    "note",
+}
+
+// SarifLog root object of a SARIF file
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type SarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SarifRun `json:"runs"`
+}
+
+type SarifRun struct {
+	Tool       SarifTool         `json:"tool"`
+	Results    []SarifResult     `json:"results"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type SarifTool struct {
+	Driver SarifDriver `json:"driver"`
+}
+
+type SarifDriver struct {
+	Name           string      `json:"name"`
+	InformationUri string      `json:"informationUri"`
+	Rules          []SarifRule `json:"rules"`
+}
+
+type SarifRule struct {
+	Id                   string                 `json:"id"`
+	Name                 string                 `json:"name"`
+	ShortDescription     SarifMessage           `json:"shortDescription"`
+	DefaultConfiguration SarifRuleConfiguration `json:"defaultConfiguration"`
+	Properties           map[string]any         `json:"properties,omitempty"`
+}
+
+type SarifRuleConfiguration struct {
+	Level string `json:"level"`
+}
+
+type SarifMessage struct {
+	Text string `json:"text"`
+}
+
+type SarifResult struct {
+	RuleId              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             SarifMessage      `json:"message"`
+	Locations           []SarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          map[string]any    `json:"properties,omitempty"`
+}
+
+type SarifLocation struct {
+	PhysicalLocation *SarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []SarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type SarifPhysicalLocation struct {
+	ArtifactLocation SarifArtifactLocation `json:"artifactLocation"`
+}
+
+type SarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+type SarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// CreateSarifLog creates a SARIF log with a result for every finding and a rule for every checker
+// results point at the operation inside the OpenAPI doc and have the repro sequence as message
+func CreateSarifLog(found []findings.Finding, apiDesc *discovery.WebApiDescription) SarifLog {
+	var checkers []string
+	ruleSeverities := make(map[string]findings.Severity)
+	for _, finding := range found {
+		if _, known := ruleSeverities[finding.Checker]; !known {
+			checkers = append(checkers, finding.Checker)
+			ruleSeverities[finding.Checker] = finding.Severity
+		}
+	}
+	sort.Strings(checkers)
+
+	rules := make([]SarifRule, 0, len(checkers))
+	ruleIndexes := make(map[string]int)
+	for i, checker := range checkers {
+		ruleIndexes[checker] = i
+		description, found := checkerDescriptions[checker]
+		if !found {
+			description = fmt.Sprintf("Bug found by the %s checker", checker)
+		}
+		rules = append(rules, SarifRule{
+			Id:                   checker,
+			Name:                 checker,
+			ShortDescription:     SarifMessage{Text: description},
+			DefaultConfiguration: SarifRuleConfiguration{Level: levels[ruleSeverities[checker]]},
+			Properties: map[string]any{
+				"security-severity": securitySeverities[ruleSeverities[checker]],
+				"tags":              []string{"security", "fuzzing"},
+			},
+		})
+	}
+
+	results := make([]SarifResult, 0, len(found))
+	for _, finding := range found {
+		result := SarifResult{
+			RuleId:    finding.Checker,
+			RuleIndex: ruleIndexes[finding.Checker],
+			Level:     levels[finding.Severity],
+			Message:   SarifMessage{Text: createSarifMessage(finding)},
+			Locations: []SarifLocation{createSarifLocation(finding, apiDesc)},
+			Properties: map[string]any{
+				"severity":     string(finding.Severity),
+				"statusCode":   finding.StatusCode,
+				"reproducible": finding.Reproducible,
+			},
+		}
+		if len(finding.BugHash) > 0 {
+			result.PartialFingerprints = map[string]string{"bugHash": finding.BugHash}
+		}
+		results = append(results, result)
+	}
+
+	run := SarifRun{
+		Tool: SarifTool{Driver: SarifDriver{
+			Name:           toolName,
+			InformationUri: toolInformationUri,
+			Rules:          rules,
+		}},
+		Results: results,
+	}
+	if apiDesc != nil {
+		run.Properties = map[string]string{"apiTitle": apiDesc.Title, "apiVersion": apiDesc.Version}
+	}
+	return SarifLog{
+		Schema:  SarifSchema,
+		Version: SarifVersion,
+		Runs:    []SarifRun{run},
+	}
+}
+
+// WriteSarifLog writes a SARIF log to path
+func WriteSarifLog(path string, log SarifLog) error {
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode SARIF log: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write SARIF log: %w", err)
+	}
+	return nil
+}
+
+// createSarifMessage creates the message of a result, holds the repro sequence of the finding
+func createSarifMessage(finding findings.Finding) string {
+	message := &strings.Builder{}
+	operation := finding.Operation()
+	if len(operation) == 0 {
+		operation = "an unknown operation"
+	}
+	fmt.Fprintf(message, "%s found a %s response for %s.", finding.Checker, finding.StatusCode, operation)
+	if len(finding.ReproSequence) == 0 {
+		return message.String()
+	}
+	message.WriteString("\n\nRepro sequence:")
+	for i, step := range finding.ReproSequence {
+		fmt.Fprintf(message, "\n\n%d. %s", i+1, step.Request)
+		if len(step.ResponseStatus) > 0 {
+			fmt.Fprintf(message, "\n=> %s", step.ResponseStatus)
+		}
+	}
+	return message.String()
+}
+
+// createSarifLocation creates a location that points at the operation of the finding inside the OpenAPI doc
+func createSarifLocation(finding findings.Finding, apiDesc *discovery.WebApiDescription) SarifLocation {
+	location := SarifLocation{}
+	if apiDesc != nil {
+		location.PhysicalLocation = &SarifPhysicalLocation{
+			ArtifactLocation: SarifArtifactLocation{Uri: apiDesc.DiscoveryDoc.String()},
+		}
+	}
+	if len(finding.Endpoint) > 0 {
+		location.LogicalLocations = []SarifLogicalLocation{{
+			Name:               finding.Operation(),
+			FullyQualifiedName: fmt.Sprintf("paths.%s.%s", finding.Endpoint, strings.ToLower(finding.Method)),
+			Kind:               "function",
+		}}
+	}
+	return location
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package report
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createTestFindings() []findings.Finding {
+	return []findings.Finding{
+		{
+			Checker:      "UseAfterFreeChecker",
+			Severity:     findings.MediumSeverity,
+			StatusCode:   "20x",
+			Method:       "GET",
+			Endpoint:     "/todo/{id}",
+			BugHash:      "hash1",
+			Reproducible: true,
+			ReproSequence: []findings.ReproStep{
+				{Method: "DELETE", Path: "/todo/1", Request: "DELETE /todo/1 HTTP/1.1", ResponseStatus: "HTTP/1.1 204 No Content"},
+				{Method: "GET", Path: "/todo/1", Request: "GET /todo/1 HTTP/1.1", ResponseStatus: "HTTP/1.1 200 OK"},
+			},
+		},
+		{Checker: "main_driver", Severity: findings.MediumSeverity, StatusCode: "500"},
+		{Checker: "NameSpaceRuleChecker", Severity: findings.HighSeverity, StatusCode: "20x", Method: "POST", Endpoint: "/todo"},
+	}
+}
+
+func TestCreateSarifLog(t *testing.T) {
+	apiDesc := &discovery.WebApiDescription{
+		DiscoveryDoc: url.URL{Scheme: "http", Host: "10.0.0.1:8080", Path: "/swagger.json"},
+		Title:        "Todo API",
+		Version:      "1.0",
+	}
+	log := CreateSarifLog(createTestFindings(), apiDesc)
+
+	assert.Equal(t, SarifVersion, log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	assert.Equal(t, "cnfuzz", run.Tool.Driver.Name)
+
+	// one rule per checker, sorted by id
+	require.Len(t, run.Tool.Driver.Rules, 3)
+	assert.Equal(t, "NameSpaceRuleChecker", run.Tool.Driver.Rules[0].Id)
+	assert.Equal(t, "error", run.Tool.Driver.Rules[0].DefaultConfiguration.Level)
+	assert.Equal(t, "UseAfterFreeChecker", run.Tool.Driver.Rules[1].Id)
+	assert.Equal(t, "main_driver", run.Tool.Driver.Rules[2].Id)
+
+	require.Len(t, run.Results, 3)
+	result := run.Results[0]
+	assert.Equal(t, "UseAfterFreeChecker", result.RuleId)
+	assert.Equal(t, 1, result.RuleIndex)
+	assert.Equal(t, "warning", result.Level)
+	assert.Equal(t, "hash1", result.PartialFingerprints["bugHash"])
+	assert.Contains(t, result.Message.Text, "GET /todo/{id}")
+	assert.Contains(t, result.Message.Text, "1. DELETE /todo/1 HTTP/1.1\n=> HTTP/1.1 204 No Content")
+	require.Len(t, result.Locations, 1)
+	assert.Equal(t, "http://10.0.0.1:8080/swagger.json", result.Locations[0].PhysicalLocation.ArtifactLocation.Uri)
+	require.Len(t, result.Locations[0].LogicalLocations, 1)
+	assert.Equal(t, "paths./todo/{id}.get", result.Locations[0].LogicalLocations[0].FullyQualifiedName)
+
+	// findings without an operation don't get a logical location
+	assert.Empty(t, run.Results[1].Locations[0].LogicalLocations)
+	assert.Equal(t, 2, run.Results[1].RuleIndex)
+	assert.Equal(t, "error", run.Results[2].Level)
+}
+
+func TestWriteSarifLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SarifFileName)
+	require.NoError(t, WriteSarifLog(path, CreateSarifLog(createTestFindings(), nil)))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, SarifSchema, decoded["$schema"])
+	assert.Equal(t, SarifVersion, decoded["version"])
+}
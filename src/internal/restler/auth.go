@@ -0,0 +1,121 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/auth"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"sort"
+	"strings"
+)
+
+// AuthInjection holds the auth tokens in the form RESTler can send them
+// Headers get printed by the token refresh command, RESTler adds them to every request.
+// QueryParameters get added to every request through the custom dictionary.
+type AuthInjection struct {
+	Headers         []string
+	QueryParameters map[string]string
+}
+
+// IsEmpty checks if there is anything to inject
+func (a AuthInjection) IsEmpty() bool {
+	return len(a.Headers) == 0 && len(a.QueryParameters) == 0
+}
+
+// CreateAuthInjection creates a token for every token source and converts them to an AuthInjection
+// token sources are handled in order of their security scheme key, tokens that fail to be created are logged and skipped
+func CreateAuthInjection(l logger.Logger, tokenSources map[string]auth.ITokenSource) AuthInjection {
+	keys := make([]string, 0, len(tokenSources))
+	for key := range tokenSources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var tokens []*auth.Token
+	for _, key := range keys {
+		// create a new auth token using the tokensource
+		tok, tokErr := tokenSources[key].Token()
+		if tokErr != nil {
+			l.V(logger.ImportantLevel).Error(tokErr, "error while getting a new auth token", "authScheme", key)
+			continue
+		}
+		tokens = append(tokens, tok)
+	}
+	return createAuthInjectionFromTokens(l, tokens)
+}
+
+// createAuthInjectionFromTokens sorts tokens by the location they need to be injected into
+// all cookies get combined into a single Cookie header
+func createAuthInjectionFromTokens(l logger.Logger, tokens []*auth.Token) AuthInjection {
+	injection := AuthInjection{
+		QueryParameters: make(map[string]string),
+	}
+	var cookies []string
+	usedHeaders := make(map[string]bool)
+	for _, tok := range tokens {
+		switch tok.Location() {
+		case auth.QueryLocation:
+			injection.QueryParameters[tok.ParameterName()] = tok.AccessToken
+		case auth.CookieLocation:
+			cookies = append(cookies, fmt.Sprintf("%s=%s", tok.ParameterName(), tok.AccessToken))
+		default:
+			headerName := tok.ParameterName()
+			if usedHeaders[strings.ToLower(headerName)] {
+				l.V(logger.ImportantLevel).Info("multiple auth tokens use the same header, the target might only read one of them", "header", headerName)
+			}
+			usedHeaders[strings.ToLower(headerName)] = true
+			injection.Headers = append(injection.Headers, fmt.Sprintf("%s: %s", headerName, tok.CreateAuthHeaderValue(l)))
+		}
+	}
+	if len(cookies) > 0 {
+		injection.Headers = append(injection.Headers, fmt.Sprintf("Cookie: %s", strings.Join(cookies, "; ")))
+	}
+	return injection
+}
+
+// UserAuth the auth headers of a single user for RESTler
+type UserAuth struct {
+	User    string
+	Headers []string
+}
+
+// CreateUserAuths creates the UserAuth for the primary user and the UserAuths for extra identities
+// RESTler needs auth headers for every user, so users without headers are skipped.
+// Query parameters can't be set per user, extra identities only get authenticated with headers.
+func CreateUserAuths(l logger.Logger, primaryUser string, primary AuthInjection, identities []auth.IdentityTokenSources, apiDesc *discovery.WebApiDescription) []UserAuth {
+	var users []UserAuth
+	if len(primary.Headers) > 0 {
+		users = append(users, UserAuth{User: primaryUser, Headers: primary.Headers})
+	}
+	for _, identity := range identities {
+		injection := CreateAuthInjection(l, identity.ForApi(l, apiDesc))
+		if len(injection.QueryParameters) > 0 {
+			l.V(logger.ImportantLevel).Info("query parameter tokens are only supported for the primary identity, ignoring them", "identity", identity.Identity)
+		}
+		if len(injection.Headers) == 0 {
+			l.V(logger.ImportantLevel).Info("identity doesn't have any auth headers, skipping the identity", "identity", identity.Identity)
+			continue
+		}
+		users = append(users, UserAuth{User: identity.Identity, Headers: injection.Headers})
+	}
+	if len(users) > 0 && len(primary.Headers) == 0 {
+		l.V(logger.ImportantLevel).Info("primary identity doesn't have any auth headers, the first extra identity is used as the primary identity", "identity", users[0].User)
+	}
+	return users
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/suecodelabs/cnfuzz/src/pkg/auth"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"testing"
+)
+
+func TestCreateAuthInjection(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	tests := []struct {
+		name        string
+		schema      discovery.SecuritySchema
+		secret      string
+		wantHeaders []string
+		wantQuery   map[string]string
+	}{
+		{name: "api-key-header", schema: discovery.SecuritySchema{Type: discovery.ApiKeySecSchemaType, In: "header", Name: "X-API-Key"}, secret: "key", wantHeaders: []string{"X-API-Key: key"}, wantQuery: map[string]string{}},
+		{name: "api-key-query", schema: discovery.SecuritySchema{Type: discovery.ApiKeySecSchemaType, In: "query", Name: "api_key"}, secret: "key", wantQuery: map[string]string{"api_key": "key"}},
+		{name: "api-key-cookie", schema: discovery.SecuritySchema{Type: discovery.ApiKeySecSchemaType, In: "cookie", Name: "session"}, secret: "key", wantHeaders: []string{"Cookie: session=key"}, wantQuery: map[string]string{}},
+		{name: "bearer-header", schema: discovery.SecuritySchema{Type: discovery.BasicSecSchemaType, Scheme: discovery.BearerHttpScheme}, secret: "jwt", wantHeaders: []string{"Authorization: Bearer jwt"}, wantQuery: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenSource, err := auth.CreateTokenSource(l, tt.schema, "", tt.secret)
+			if !assert.NoError(t, err) {
+				return
+			}
+			injection := CreateAuthInjection(l, map[string]auth.ITokenSource{"scheme": tokenSource})
+			assert.Equal(t, tt.wantHeaders, injection.Headers)
+			assert.Equal(t, tt.wantQuery, injection.QueryParameters)
+			assert.False(t, injection.IsEmpty())
+		})
+	}
+}
+
+func TestCreateAuthInjectionCombined(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	tokens := []*auth.Token{
+		{AccessToken: "a", TokenType: "api-key", In: auth.CookieLocation, Name: "first"},
+		{AccessToken: "jwt", TokenType: "bearer"},
+		{AccessToken: "b", TokenType: "api-key", In: auth.CookieLocation, Name: "second"},
+		{AccessToken: "c", TokenType: "api-key", In: auth.QueryLocation, Name: "key"},
+	}
+	injection := createAuthInjectionFromTokens(l, tokens)
+	assert.Equal(t, []string{"Authorization: Bearer jwt", "Cookie: first=a; second=b"}, injection.Headers)
+	assert.Equal(t, map[string]string{"key": "c"}, injection.QueryParameters)
+
+	dict := CreateCustomDictionary(injection)
+	assert.Equal(t, map[string][]string{"key": {"c"}}, dict.CustomPayloadQuery)
+}
+
+func TestCreateAuthInjectionEmpty(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	injection := CreateAuthInjection(l, nil)
+	assert.True(t, injection.IsEmpty())
+	assert.Empty(t, CreateCustomDictionary(injection).CustomPayloadQuery)
+	assert.Empty(t, CreateCompilerConfig(false).CustomDictionaryFilePath)
+	assert.Equal(t, CustomDictionaryPath, CreateCompilerConfig(true).CustomDictionaryFilePath)
+}
+
+func TestCreateUserAuths(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	schemas := []discovery.SecuritySchema{
+		{Key: "BearerAuth", Type: discovery.BasicSecSchemaType, Scheme: discovery.BearerHttpScheme},
+		{Key: "QueryKey", Type: discovery.ApiKeySecSchemaType, In: "query", Name: "api_key"},
+	}
+	apiDesc := &discovery.WebApiDescription{
+		SecuritySchemes: schemas,
+		Endpoints: []discovery.Endpoint{
+			{Path: "/items", Method: "GET", Security: []discovery.SecurityRequirement{{"BearerAuth": {}}}},
+			{Path: "/search", Method: "GET", Security: []discovery.SecurityRequirement{{"QueryKey": {}}}},
+		},
+	}
+	identities := auth.CreateIdentityTokenSources(l, schemas, []auth.Identity{
+		{Name: "userb", Credentials: auth.CredentialSet{Default: auth.Credentials{Secret: "b"}}},
+		{Name: "queryonly", Credentials: auth.CredentialSet{Schemes: map[string]auth.Credentials{"QueryKey": {Secret: "q"}}}},
+	}, "", auth.Options{})
+
+	primary := AuthInjection{Headers: []string{"Authorization: Bearer a"}}
+	users := CreateUserAuths(l, "myapi", primary, identities, apiDesc)
+	assert.Equal(t, []UserAuth{
+		{User: "myapi", Headers: []string{"Authorization: Bearer a"}},
+		{User: "userb", Headers: []string{"Authorization: Bearer b"}},
+	}, users)
+
+	assert.Empty(t, CreateUserAuths(l, "myapi", AuthInjection{}, nil, apiDesc))
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResultsDir directory where RESTler writes the results of the fuzz command
+const ResultsDir = "/Fuzz/RestlerResults"
+
+// Names of RESTler checkers as they appear in the bug buckets
+const (
+	MainDriverChecker           = "main_driver"
+	NamespaceRuleChecker        = "NameSpaceRuleChecker"
+	ResourceHierarchyChecker    = "ResourceHierarchyChecker"
+	UseAfterFreeChecker         = "UseAfterFreeChecker"
+	LeakageRuleChecker          = "LeakageRuleChecker"
+	InvalidDynamicObjectChecker = "InvalidDynamicObjectChecker"
+	PayloadBodyChecker          = "PayloadBodyChecker"
+)
+
+// checkerSeverities severity of the bugs found by a checker
+// namespace rule and resource hierarchy bugs mean that one identity can access resources of another identity
+var checkerSeverities = map[string]findings.Severity{
+	NamespaceRuleChecker:     findings.HighSeverity,
+	ResourceHierarchyChecker: findings.HighSeverity,
+	UseAfterFreeChecker:      findings.MediumSeverity,
+	LeakageRuleChecker:       findings.MediumSeverity,
+}
+
+// BugBucket a bug found by RESTler
+type BugBucket struct {
+	// Name name of the bucket, e.g. NameSpaceRuleChecker_20x
+	Name string
+	// Checker name of the checker that found the bug
+	Checker string
+	// StatusCode status code (class) of the response that triggered the bug, e.g. 500 or 20x
+	StatusCode string
+	// FilePath path of the file with the repro sequence of the bug
+	FilePath     string
+	BugHash      string
+	Reproducible bool
+}
+
+// Severity returns the severity of the bug
+// bugs of other checkers are medium severity when they triggered a server error, low otherwise
+func (b BugBucket) Severity() findings.Severity {
+	if severity, found := checkerSeverities[b.Checker]; found {
+		return severity
+	}
+	if strings.HasPrefix(b.StatusCode, "5") {
+		return findings.MediumSeverity
+	}
+	return findings.LowSeverity
+}
+
+// bugBucketEntry entry inside the bug_buckets.json file
+type bugBucketEntry struct {
+	FilePath     string `json:"file_path"`
+	BugHash      string `json:"bug_hash"`
+	Reproducible bool   `json:"reproducible"`
+}
+
+// FindBugBuckets gathers the bug buckets of all RESTler experiments inside resultsDir
+func FindBugBuckets(resultsDir string) ([]BugBucket, error) {
+	files, err := filepath.Glob(filepath.Join(resultsDir, "experiment*", "bug_buckets", "bug_buckets.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for RESTler bug buckets: %w", err)
+	}
+	var buckets []BugBucket
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RESTler bug buckets: %w", err)
+		}
+		fileBuckets, err := ParseBugBuckets(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RESTler bug buckets in %s: %w", file, err)
+		}
+		// bug files are relative to the bug buckets file
+		for i := range fileBuckets {
+			if len(fileBuckets[i].FilePath) > 0 && !filepath.IsAbs(fileBuckets[i].FilePath) {
+				fileBuckets[i].FilePath = filepath.Join(filepath.Dir(file), fileBuckets[i].FilePath)
+			}
+		}
+		buckets = append(buckets, fileBuckets...)
+	}
+	return buckets, nil
+}
+
+// ParseBugBuckets parses the content of a RESTler bug_buckets.json file
+// buckets are returned in order of their name
+func ParseBugBuckets(data []byte) ([]BugBucket, error) {
+	entries := make(map[string]bugBucketEntry)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	buckets := make([]BugBucket, 0, len(entries))
+	for name, entry := range entries {
+		checker, statusCode := splitBugBucketName(name)
+		buckets = append(buckets, BugBucket{
+			Name:         name,
+			Checker:      checker,
+			StatusCode:   statusCode,
+			FilePath:     entry.FilePath,
+			BugHash:      entry.BugHash,
+			Reproducible: entry.Reproducible,
+		})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+	return buckets, nil
+}
+
+// splitBugBucketName splits a bucket name like NameSpaceRuleChecker_20x or main_driver_500_1.txt
+// into the checker and the status code
+func splitBugBucketName(name string) (checker string, statusCode string) {
+	parts := strings.Split(strings.TrimSuffix(name, ".txt"), "_")
+	// drop the bug index
+	if len(parts) > 2 && isBugIndex(parts[len(parts)-1]) && isStatusCode(parts[len(parts)-2]) {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) > 1 && isStatusCode(parts[len(parts)-1]) {
+		return strings.Join(parts[:len(parts)-1], "_"), parts[len(parts)-1]
+	}
+	return strings.Join(parts, "_"), ""
+}
+
+// isBugIndex checks if a bucket name part is the index of a bug
+func isBugIndex(part string) bool {
+	_, err := strconv.Atoi(part)
+	return err == nil && !isStatusCode(part)
+}
+
+// isStatusCode checks if a bucket name part is a status code (class) like 500 or 20x
+func isStatusCode(part string) bool {
+	if len(part) != 3 || part[0] < '1' || part[0] > '5' {
+		return false
+	}
+	for _, c := range part[1:] {
+		if (c < '0' || c > '9') && c != 'x' {
+			return false
+		}
+	}
+	return true
+}
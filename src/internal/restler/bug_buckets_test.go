@@ -0,0 +1,76 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testBugBuckets = `{
+	"main_driver_500": {"bug_hash": "hash1", "file_path": "main_driver_500_1.txt", "reproducible": true},
+	"NameSpaceRuleChecker_20x": {"bug_hash": "hash2", "file_path": "NameSpaceRuleChecker_20x_1.txt", "reproducible": true},
+	"UseAfterFreeChecker_20x_2.txt": {"bug_hash": "hash3", "file_path": "UseAfterFreeChecker_20x_2.txt", "reproducible": false},
+	"InvalidDynamicObjectChecker_20x": {"bug_hash": "hash4", "file_path": "InvalidDynamicObjectChecker_20x_1.txt", "reproducible": true}
+}`
+
+func TestParseBugBuckets(t *testing.T) {
+	buckets, err := ParseBugBuckets([]byte(testBugBuckets))
+	require.NoError(t, err)
+	require.Len(t, buckets, 4)
+
+	expected := []struct {
+		checker    string
+		statusCode string
+		severity   findings.Severity
+	}{
+		{InvalidDynamicObjectChecker, "20x", findings.LowSeverity},
+		{NamespaceRuleChecker, "20x", findings.HighSeverity},
+		{UseAfterFreeChecker, "20x", findings.MediumSeverity},
+		{MainDriverChecker, "500", findings.MediumSeverity},
+	}
+	for i, want := range expected {
+		assert.Equal(t, want.checker, buckets[i].Checker)
+		assert.Equal(t, want.statusCode, buckets[i].StatusCode)
+		assert.Equal(t, want.severity, buckets[i].Severity(), buckets[i].Name)
+	}
+	assert.Equal(t, "hash2", buckets[1].BugHash)
+	assert.False(t, buckets[2].Reproducible)
+
+	_, err = ParseBugBuckets([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestFindBugBuckets(t *testing.T) {
+	resultsDir := t.TempDir()
+	bucketsDir := filepath.Join(resultsDir, "experiment123", "bug_buckets")
+	require.NoError(t, os.MkdirAll(bucketsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(bucketsDir, "bug_buckets.json"), []byte(testBugBuckets), 0644))
+
+	buckets, err := FindBugBuckets(resultsDir)
+	require.NoError(t, err)
+	assert.Len(t, buckets, 4)
+	assert.Equal(t, filepath.Join(bucketsDir, "InvalidDynamicObjectChecker_20x_1.txt"), buckets[0].FilePath)
+
+	buckets, err = FindBugBuckets(t.TempDir())
+	assert.NoError(t, err)
+	assert.Empty(t, buckets)
+}
@@ -18,24 +18,34 @@ package restler
 
 import (
 	"fmt"
-	"github.com/suecodelabs/cnfuzz/src/pkg/auth"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"strconv"
+	"strings"
 )
 
 // CreateRestlerCompileCommand creates the command that starts the restler compile command
+// the compile command uses the compiler config at CompilerConfigPath
 // Output can be used like this:
 //
 //	exec.Command(cmd, args...)
 func CreateRestlerCompileCommand(l logger.Logger) (cmd string, args []string) {
 	cmd = "dotnet"
-	args = []string{"/RESTler/restler/Restler.dll", "compile", "--api_spec", "/openapi/doc.json"}
+	args = []string{"/RESTler/restler/Restler.dll", "compile", CompilerConfigPath}
 	return cmd, args
 }
 
+// MultiUserCheckers RESTler checkers that use multiple users to find authorization bugs
+// namespacerule checks if resources of one user are accessible by another user,
+// useafterfree checks if deleted resources are still accessible
+var MultiUserCheckers = []string{"namespacerule", "useafterfree"}
+
 // CreateRestlerCommand creates command string that can be run inside the RESTler container
 // the command string consists of a compile command that analyzes the OpenAPI spec and generates a fuzzing grammar
 // and the fuzz command itself
-func CreateRestlerCommand(l logger.Logger, tokenSource auth.ITokenSource, targetIp, targetPort, targetName, targetScheme, timeBudget string) (cmd string, args []string) {
+// userCount is the number of users inside the token file, RESTler reads the auth headers of these users from the token file.
+// The MultiUserCheckers get enabled when there are multiple users.
+// settingsFile is the path to the EngineSettings, the default settings are used when it is empty
+func CreateRestlerCommand(l logger.Logger, userCount int, targetIp, targetPort, targetScheme, timeBudget, settingsFile string) (cmd string, args []string) {
 	l.V(logger.DebugLevel).Info(fmt.Sprintf("using %s:%s for restler", targetIp, targetPort), "targetIp", targetIp, "targetPort", targetPort)
 
 	// Please, UNIX philosophy people.
@@ -50,19 +60,17 @@ func CreateRestlerCommand(l logger.Logger, tokenSource auth.ITokenSource, target
 		args = append(args, "--no_ssl")
 	}
 
-	if tokenSource != nil {
-		// create a new auth token using the tokensource
-		tok, tokErr := tokenSource.Token()
-		if tokErr != nil {
-			l.V(logger.ImportantLevel).Error(tokErr, "error while getting a new auth token")
-		} else {
-			token := fmt.Sprintf("%s: %s", "Authorization", tok.CreateAuthHeaderValue(l))
-			if tokErr == nil && len(token) > 0 {
-				authCmd := fmt.Sprintf("python3 /scripts/auth.py '%s' '%s'", targetName, token)
-				// Use a high refresh interval because we have a static token (for now?)
-				args = append(args, "--token_refresh_interval", "999999", "--token_refresh_command", authCmd)
-			}
-		}
+	if len(settingsFile) > 0 {
+		args = append(args, "--settings", settingsFile)
+	}
+
+	if userCount > 0 {
+		// the token file is kept up to date while RESTler runs
+		args = append(args, "--token_refresh_interval", strconv.Itoa(TokenRefreshInterval), "--token_refresh_command", "cat "+TokenFilePath)
+	}
+	if userCount > 1 {
+		l.V(logger.DebugLevel).Info("fuzzing with multiple users, enabling multi user checkers", "users", userCount, "checkers", MultiUserCheckers)
+		args = append(args, "--enable_checkers", strings.Join(MultiUserCheckers, ","))
 	}
 	return cmd, args
 }
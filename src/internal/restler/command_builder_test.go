@@ -0,0 +1,59 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"testing"
+)
+
+func TestCreateRestlerCompileCommand(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	cmd, args := CreateRestlerCompileCommand(l)
+	assert.Equal(t, "dotnet", cmd)
+	assert.Equal(t, []string{"/RESTler/restler/Restler.dll", "compile", CompilerConfigPath}, args)
+}
+
+func TestCreateRestlerCommand(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	_, args := CreateRestlerCommand(l, 1, "10-0-0-1.default.pod", "8080", "http", "1", "")
+	assert.Contains(t, args, "--no_ssl")
+	assert.Contains(t, args, "--token_refresh_command")
+	assert.Equal(t, "cat "+TokenFilePath, args[len(args)-1])
+	assert.NotContains(t, args, "--enable_checkers")
+}
+
+func TestCreateRestlerCommandMultipleUsers(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	_, args := CreateRestlerCommand(l, 2, "10-0-0-1.default.pod", "8080", "http", "1", "")
+	assert.Contains(t, args, "cat "+TokenFilePath)
+	assert.Equal(t, []string{"--enable_checkers", "namespacerule,useafterfree"}, args[len(args)-2:])
+}
+
+func TestCreateRestlerCommandWithoutAuth(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	_, args := CreateRestlerCommand(l, 0, "10-0-0-1.default.pod", "443", "https", "1", "")
+	assert.NotContains(t, args, "--no_ssl")
+	assert.NotContains(t, args, "--token_refresh_command")
+}
+
+func TestCreateRestlerCommandWithSettings(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	_, args := CreateRestlerCommand(l, 0, "10-0-0-1.default.pod", "8080", "http", "1", EngineSettingsPath)
+	assert.Equal(t, []string{"--settings", EngineSettingsPath}, args[len(args)-2:])
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"encoding/json"
+	"os"
+)
+
+const (
+	// ApiSpecPath location of the OpenAPI doc that RESTler compiles
+	ApiSpecPath = "/openapi/doc.json"
+	// CustomDictionaryPath location of the custom fuzzing dictionary that RESTler uses while compiling
+	CustomDictionaryPath = "/openapi/dict.json"
+	// CompilerConfigPath location of the config for the RESTler compile command
+	CompilerConfigPath = "/openapi/compile.json"
+)
+
+// CustomDictionary custom RESTler fuzzing dictionary
+// https://github.com/microsoft/restler-fuzzer/blob/main/docs/user-guide/FuzzingDictionary.md
+type CustomDictionary struct {
+	CustomPayloadHeader map[string][]string `json:"restler_custom_payload_header,omitempty"`
+	CustomPayloadQuery  map[string][]string `json:"restler_custom_payload_query,omitempty"`
+}
+
+// CompilerConfig config for the RESTler compile command
+// https://github.com/microsoft/restler-fuzzer/blob/main/docs/user-guide/CompilerConfig.md
+type CompilerConfig struct {
+	SwaggerSpecFilePath      []string `json:"SwaggerSpecFilePath"`
+	CustomDictionaryFilePath string   `json:"CustomDictionaryFilePath,omitempty"`
+}
+
+// CreateCustomDictionary creates a CustomDictionary that adds the query parameters of an AuthInjection to every request
+// the dictionary is only read when the API is compiled, so only keys that don't expire can be sent as query parameter
+func CreateCustomDictionary(injection AuthInjection) CustomDictionary {
+	dict := CustomDictionary{}
+	if len(injection.QueryParameters) > 0 {
+		dict.CustomPayloadQuery = make(map[string][]string, len(injection.QueryParameters))
+		for name, value := range injection.QueryParameters {
+			dict.CustomPayloadQuery[name] = []string{value}
+		}
+	}
+	return dict
+}
+
+// CreateCompilerConfig creates a CompilerConfig for the OpenAPI doc at ApiSpecPath
+// the custom dictionary is only used when it is set
+func CreateCompilerConfig(withDictionary bool) CompilerConfig {
+	cnf := CompilerConfig{
+		SwaggerSpecFilePath: []string{ApiSpecPath},
+	}
+	if withDictionary {
+		cnf.CustomDictionaryFilePath = CustomDictionaryPath
+	}
+	return cnf
+}
+
+// writeJsonFile marshals an object to json and writes it to the file system
+func writeJsonFile(path string, obj any) error {
+	b, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, os.FileMode(0644))
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"sort"
+	"strings"
+)
+
+// EngineSettingsPath location of the settings for the RESTler fuzz command
+const EngineSettingsPath = "/openapi/engine_settings.json"
+
+// EngineSettings settings for the RESTler fuzz command
+// https://github.com/microsoft/restler-fuzzer/blob/main/docs/user-guide/SettingsFile.md
+type EngineSettings struct {
+	// IncludeRequests only these requests (and the requests they depend on) are fuzzed
+	IncludeRequests []RequestFilter `json:"include_requests,omitempty"`
+}
+
+// RequestFilter selects the requests of an endpoint
+type RequestFilter struct {
+	Endpoint string   `json:"endpoint"`
+	Methods  []string `json:"methods"`
+}
+
+// CreateEngineSettings creates the settings that limit RESTler to the given operations in the format <METHOD> <path>
+// the paths of the operations are relative to the base path of the API
+func CreateEngineSettings(basePath string, operations []string) EngineSettings {
+	methods := make(map[string][]string)
+	for _, operation := range operations {
+		method, path, found := strings.Cut(operation, " ")
+		if !found {
+			continue
+		}
+		endpoint := basePath + path
+		methods[endpoint] = append(methods[endpoint], strings.ToUpper(method))
+	}
+	settings := EngineSettings{}
+	for endpoint, endpointMethods := range methods {
+		sort.Strings(endpointMethods)
+		settings.IncludeRequests = append(settings.IncludeRequests, RequestFilter{Endpoint: endpoint, Methods: endpointMethods})
+	}
+	sort.Slice(settings.IncludeRequests, func(i, j int) bool {
+		return settings.IncludeRequests[i].Endpoint < settings.IncludeRequests[j].Endpoint
+	})
+	return settings
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCreateEngineSettings(t *testing.T) {
+	settings := CreateEngineSettings("/api", []string{"POST /todos", "GET /todos/{id}", "get /todos", "invalid"})
+	assert.Equal(t, []RequestFilter{
+		{Endpoint: "/api/todos", Methods: []string{"GET", "POST"}},
+		{Endpoint: "/api/todos/{id}", Methods: []string{"GET"}},
+	}, settings.IncludeRequests)
+	assert.Empty(t, CreateEngineSettings("", nil).IncludeRequests)
+}
@@ -17,15 +17,46 @@
 package restler
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/suecodelabs/cnfuzz/src/internal/api_info"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/internal/report"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
+// ReportEventReason reason of the pod event that links to the run report
+const ReportEventReason = "FuzzReport"
+
 // ExecuteRestlerCmds executes Restler compile and fuzz commands
-func ExecuteRestlerCmds(l logger.Logger, dryRun bool, timeBudget string, info api_info.TargetInfo) {
+// only the given operations (in the format <METHOD> <path>) are fuzzed, all operations are fuzzed when there are none
+func ExecuteRestlerCmds(l logger.Logger, dryRun bool, timeBudget string, info api_info.TargetInfo, fuzzRun string, fuzzRunNamespace string, operations []string) {
+	timings := report.Timings{Started: time.Now()}
+	tokenSources := info.TokenSources.ForApi(l, info.ApiDesc)
+	authInjection := CreateAuthInjection(l, tokenSources)
+	settingsFile := ""
+	if len(operations) > 0 {
+		l.V(logger.InfoLevel).Info("only fuzzing the selected operations", "operations", operations)
+		settingsFile = EngineSettingsPath
+	}
+	if !dryRun {
+		writeCompileFiles(l, authInjection)
+		if len(settingsFile) > 0 {
+			if err := writeJsonFile(settingsFile, CreateEngineSettings(info.ApiDesc.BasePath, operations)); err != nil {
+				l.FatalError(err, "failed to write engine settings for restler")
+			}
+		}
+	}
+
 	compileCmd, compileArgs := CreateRestlerCompileCommand(l)
 	if !dryRun {
 		out, err := exec.Command(compileCmd, compileArgs...).Output()
@@ -33,23 +64,176 @@ func ExecuteRestlerCmds(l logger.Logger, dryRun bool, timeBudget string, info ap
 			l.FatalError(err, "error while compiling restler resources")
 		}
 		l.V(logger.DebugLevel).Info(string(out[:]))
+		timings.Compile = time.Since(timings.Started)
 	} else {
 		fullCmd := compileCmd + " " + strings.Join(compileArgs, " ")
 		l.V(logger.DebugLevel).Info("(running as dry run) generated compile cmd:")
 		l.V(logger.DebugLevel).Info(fullCmd)
 	}
 
-	restlerCmd, restlerArgs := CreateRestlerCommand(l, info.TokenSource, info.TargetAddr, info.ApiDesc.DiscoveryDoc.Port(), info.ApiDesc.Title, info.ApiDesc.DiscoveryDoc.Scheme, timeBudget)
+	users := CreateUserAuths(l, info.ApiDesc.Title, authInjection, info.Identities, info.ApiDesc)
+	restlerCmd, restlerArgs := CreateRestlerCommand(l, len(users), info.TargetAddr, info.ApiDesc.DiscoveryDoc.Port(), info.ApiDesc.DiscoveryDoc.Scheme, timeBudget, settingsFile)
 	if !dryRun {
+		if len(users) > 0 {
+			if err := WriteTokenFile(TokenFilePath, users); err != nil {
+				l.FatalError(err, "failed to write the token file for restler")
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go RefreshTokenFile(ctx, l, TokenFilePath, TokenRefreshInterval*time.Second/2, len(users), func() []UserAuth {
+				return CreateUserAuths(l, info.ApiDesc.Title, CreateAuthInjection(l, tokenSources), info.Identities, info.ApiDesc)
+			})
+		}
+		fuzzStarted := time.Now()
 		out, err := exec.Command(restlerCmd, restlerArgs...).Output()
+		timings.Fuzz = time.Since(fuzzStarted)
 		if err != nil {
 			l.V(logger.InfoLevel).Info(fmt.Sprintf("restler output:\n%s", string(out[:])))
 			l.FatalError(err, "error while executing restler fuzzing", "cmd_output", string(out[:]))
 		}
 		l.V(logger.DebugLevel).Info(string(out[:]))
+		timings.Finished = time.Now()
+		writeReports(l, info, fuzzRun, fuzzRunNamespace, reportBugBuckets(l), timings)
 	} else {
 		fullCmd := restlerCmd + " " + strings.Join(restlerArgs, " ")
 		l.V(logger.DebugLevel).Info("(running as dry run) generated restler cmd:")
 		l.V(logger.DebugLevel).Info(fullCmd)
 	}
 }
+
+// writeCompileFiles writes the compiler config and the custom dictionary (if needed) for the restler compile command
+func writeCompileFiles(l logger.Logger, authInjection AuthInjection) {
+	withDictionary := len(authInjection.QueryParameters) > 0
+	if withDictionary {
+		if err := writeJsonFile(CustomDictionaryPath, CreateCustomDictionary(authInjection)); err != nil {
+			l.FatalError(err, "failed to write custom dictionary for restler")
+		}
+	}
+	if err := writeJsonFile(CompilerConfigPath, CreateCompilerConfig(withDictionary)); err != nil {
+		l.FatalError(err, "failed to write compiler config for restler")
+	}
+}
+
+// reportBugBuckets logs the bugs that RESTler found
+func reportBugBuckets(l logger.Logger) []BugBucket {
+	buckets, err := FindBugBuckets(ResultsDir)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to gather the bugs found by restler")
+		return nil
+	}
+	for _, bucket := range buckets {
+		level := logger.InfoLevel
+		if bucket.Severity() == findings.HighSeverity {
+			level = logger.ImportantLevel
+		}
+		l.V(level).Info("restler found a bug", "checker", bucket.Checker, "statusCode", bucket.StatusCode, "severity", bucket.Severity(), "file", bucket.FilePath, "reproducible", bucket.Reproducible)
+	}
+	l.V(logger.InfoLevel).Info(fmt.Sprintf("restler found %d bugs", len(buckets)))
+	return buckets
+}
+
+// writeReports writes reports of the bugs that RESTler found and the coverage into the results directory
+// the fuzz run in fuzzRunNamespace gets the results as status and keeps the run report, the target pod gets an event that links to it
+func writeReports(l logger.Logger, info api_info.TargetInfo, fuzzRun string, fuzzRunNamespace string, buckets []BugBucket, timings report.Timings) {
+	found := CreateFindings(l, buckets, info.ApiDesc)
+	sarifPath := filepath.Join(ResultsDir, report.SarifFileName)
+	if err := report.WriteSarifLog(sarifPath, report.CreateSarifLog(found, info.ApiDesc)); err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to write SARIF report")
+	} else {
+		l.V(logger.InfoLevel).Info("wrote SARIF report", "path", sarifPath)
+	}
+
+	runReport := CreateRunReport(l, info, found, timings)
+	paths, err := report.WriteRunReports(ResultsDir, runReport)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to write run report")
+	} else {
+		l.V(logger.InfoLevel).Info("wrote run report", "paths", paths)
+	}
+
+	if info.Pod == nil || len(fuzzRun) == 0 {
+		return
+	}
+	// the reports inside the pod of the job are gone with the job, the run keeps the report for the API
+	locations := report.ReportLocations(fuzzRunNamespace, fuzzRun)
+	client := k8s.CreateClientset(l, !config.RunCnf.LocalK8sConfig)
+	publishReportEvent(l, client, info.Pod, len(found), locations)
+	updateFuzzRun(l, client, fuzzRunNamespace, fuzzRun, runReport, locations)
+}
+
+// CreateRunReport creates the human-readable report of the fuzz run
+func CreateRunReport(l logger.Logger, info api_info.TargetInfo, found []findings.Finding, timings report.Timings) report.RunReport {
+	runReport := report.RunReport{
+		Findings: found,
+		Timings:  timings,
+	}
+	if info.Pod != nil {
+		runReport.PodName = info.Pod.Name
+		runReport.Namespace = info.Pod.Namespace
+		runReport.Images = report.ImagesOfPod(info.Pod)
+	}
+	if info.ApiDesc != nil {
+		runReport.ApiTitle = info.ApiDesc.Title
+		runReport.ApiVersion = info.ApiDesc.Version
+		runReport.DiscoveryDoc = info.ApiDesc.DiscoveryDoc.String()
+	}
+	entries, err := FindSpecCoverage(ResultsDir)
+	if err != nil {
+		l.V(logger.InfoLevel).Error(err, "failed to read the restler spec coverage, all operations are reported as not attempted")
+	}
+	runReport.Coverage = CreateCoverage(info.ApiDesc, entries)
+	return runReport
+}
+
+// publishReportEvent creates an event on the target pod that points at the run reports
+func publishReportEvent(l logger.Logger, client kubernetes.Interface, pod *v1.Pod, bugCount int, locations []string) {
+	message := fmt.Sprintf("fuzzing found %d bugs, report: %s", bugCount, strings.Join(locations, ","))
+	eventType := v1.EventTypeNormal
+	if bugCount > 0 {
+		eventType = v1.EventTypeWarning
+	}
+	if _, err := k8s.CreatePodEvent(context.TODO(), client, pod, eventType, ReportEventReason, message); err != nil {
+		l.V(logger.InfoLevel).Error(err, "failed to publish report event", "pod", pod.Name)
+	}
+}
+
+// updateFuzzRun completes the fuzz run with the coverage, the findings, the run report and the report locations
+func updateFuzzRun(l logger.Logger, client kubernetes.Interface, namespace string, fuzzRun string, runReport report.RunReport, locations []string) {
+	summary := runReport.Coverage.Summary()
+	runCoverage := &k8s.FuzzRunCoverage{
+		Total:     summary.Total,
+		Attempted: summary.Attempted,
+		Succeeded: summary.Succeeded,
+	}
+	for reason, count := range summary.Blocked {
+		if runCoverage.Blocked == nil {
+			runCoverage.Blocked = make(map[string]int)
+		}
+		runCoverage.Blocked[string(reason)] = count
+	}
+	runFindings := make(map[string]int)
+	for _, finding := range runReport.Findings {
+		runFindings[string(finding.Severity)]++
+	}
+	findingsData, err := json.Marshal(runReport.Findings)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to encode findings for fuzz run", "fuzzRun", fuzzRun)
+		return
+	}
+	// the findings are already stored next to the report
+	storedReport := runReport
+	storedReport.Findings = nil
+	reportData, err := json.Marshal(storedReport)
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to encode run report for fuzz run", "fuzzRun", fuzzRun)
+		return
+	}
+	err = k8s.CompleteFuzzRun(context.TODO(), l, client, namespace, fuzzRun, findingsData, reportData, func(status *k8s.FuzzRunStatus) {
+		status.Coverage = runCoverage
+		status.Findings = runFindings
+		status.Reports = locations
+	})
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to update fuzz run", "fuzzRun", fuzzRun)
+	}
+}
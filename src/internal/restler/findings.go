@@ -0,0 +1,155 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"os"
+	"strings"
+)
+
+// Prefixes of the lines inside a RESTler bug file
+const (
+	bugFileRequestPrefix  = "-> "
+	bugFileResponsePrefix = "PREVIOUS RESPONSE: "
+)
+
+// CreateFindings converts RESTler bug buckets to findings
+// the repro sequence is read from the bug file and the last request of the sequence is matched to an operation of the API
+func CreateFindings(l logger.Logger, buckets []BugBucket, apiDesc *discovery.WebApiDescription) []findings.Finding {
+	redactor := findings.CreateRedactor(apiDesc)
+	created := make([]findings.Finding, 0, len(buckets))
+	for _, bucket := range buckets {
+		finding := findings.Finding{
+			Checker:      bucket.Checker,
+			Severity:     bucket.Severity(),
+			StatusCode:   bucket.StatusCode,
+			BugHash:      bucket.BugHash,
+			Reproducible: bucket.Reproducible,
+			File:         bucket.FilePath,
+		}
+		if len(bucket.FilePath) > 0 {
+			data, err := os.ReadFile(bucket.FilePath)
+			if err != nil {
+				l.V(logger.InfoLevel).Error(err, "failed to read restler bug file", "file", bucket.FilePath)
+			} else {
+				finding.ReproSequence = ParseReproSequence(data, redactor)
+			}
+		}
+		if steps := len(finding.ReproSequence); steps > 0 {
+			last := finding.ReproSequence[steps-1]
+			if endpoint := MatchEndpoint(apiDesc, last.Method, last.Path); endpoint != nil {
+				finding.Method = endpoint.Method
+				finding.Endpoint = endpoint.Path
+			}
+		}
+		created = append(created, finding)
+	}
+	return created
+}
+
+// ParseReproSequence parses the requests and responses inside a RESTler bug file
+// the credentials inside the requests are redacted, the requests are stored and shown with the findings
+func ParseReproSequence(data []byte, redactor findings.Redactor) []findings.ReproStep {
+	var steps []findings.ReproStep
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, bugFileRequestPrefix):
+			request := redactor.Redact(unescapeHttp(strings.TrimPrefix(line, bugFileRequestPrefix)))
+			step := findings.ReproStep{Request: request}
+			requestLine := strings.SplitN(strings.SplitN(request, "\n", 2)[0], " ", 3)
+			if len(requestLine) >= 2 {
+				step.Method = requestLine[0]
+				step.Path = requestLine[1]
+			}
+			steps = append(steps, step)
+		case strings.HasPrefix(line, bugFileResponsePrefix) && len(steps) > 0:
+			response := unescapeHttp(strings.Trim(strings.TrimPrefix(line, bugFileResponsePrefix), `'"`))
+			steps[len(steps)-1].ResponseStatus = strings.TrimSpace(strings.SplitN(response, "\n", 2)[0])
+		}
+	}
+	return steps
+}
+
+// unescapeHttp converts the escaped line endings inside RESTler logs to newlines
+func unescapeHttp(value string) string {
+	return strings.TrimRight(strings.NewReplacer(`\r\n`, "\n", `\n`, "\n", `\r`, "").Replace(value), "\n")
+}
+
+// MatchEndpoint finds the endpoint of the API that handles a request
+// path parameters inside the endpoint paths match any value, endpoints with the most literal matches are preferred
+func MatchEndpoint(apiDesc *discovery.WebApiDescription, method string, path string) *discovery.Endpoint {
+	if apiDesc == nil {
+		return nil
+	}
+	path = strings.SplitN(path, "?", 2)[0]
+	if len(apiDesc.BasePath) > 0 && strings.HasPrefix(path, apiDesc.BasePath) {
+		path = strings.TrimPrefix(path, apiDesc.BasePath)
+	}
+	segments := splitPath(path)
+
+	var best *discovery.Endpoint
+	bestScore := -1
+	for i, endpoint := range apiDesc.Endpoints {
+		if !strings.EqualFold(endpoint.Method, method) {
+			continue
+		}
+		score, matches := matchPath(splitPath(endpoint.Path), segments)
+		if matches && score > bestScore {
+			best = &apiDesc.Endpoints[i]
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// matchPath matches path segments against the segments of an endpoint path and returns the number of literal matches
+func matchPath(template []string, segments []string) (int, bool) {
+	if len(template) != len(segments) {
+		return 0, false
+	}
+	score := 0
+	for i, segment := range template {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if len(segments[i]) == 0 {
+				return 0, false
+			}
+			continue
+		}
+		if segment != segments[i] {
+			return 0, false
+		}
+		score++
+	}
+	return score, true
+}
+
+// splitPath splits a URL path into its segments
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if len(trimmed) == 0 {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/findings"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testBugFile = `################################################################################
+ UseAfterFreeChecker_20x
+
+ Hash: UseAfterFreeChecker_20x_1a2b3c
+
+ To attempt to reproduce this bug using restler, run restler with the command
+ line option of --replay_log <path_to_this_log>.
+
+################################################################################
+
+-> POST /api/todo HTTP/1.1\r\nAccept: application/json\r\nHost: 10.0.0.1\r\nContent-Type: application/json\r\n\r\n{"title":"fuzzstring"}\r\n
+! producer_timing_delay 0
+! max_async_wait_time 0
+PREVIOUS RESPONSE: 'HTTP/1.1 201 Created\r\nContent-Type: application/json\r\n\r\n{"id":1}'
+
+-> DELETE /api/todo/1 HTTP/1.1\r\nAccept: application/json\r\nHost: 10.0.0.1\r\n\r\n
+! producer_timing_delay 0
+! max_async_wait_time 0
+PREVIOUS RESPONSE: 'HTTP/1.1 204 No Content\r\n\r\n'
+
+-> GET /api/todo/1?details=true HTTP/1.1\r\nAccept: application/json\r\nHost: 10.0.0.1\r\n\r\n
+! producer_timing_delay 0
+! max_async_wait_time 0
+PREVIOUS RESPONSE: 'HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n{"id":1}'
+`
+
+func createTestApiDesc() *discovery.WebApiDescription {
+	return &discovery.WebApiDescription{
+		BasePath: "/api",
+		Endpoints: []discovery.Endpoint{
+			{Path: "/todo", Method: "POST"},
+			{Path: "/todo/{id}", Method: "GET"},
+			{Path: "/todo/{id}", Method: "DELETE"},
+			{Path: "/todo/latest", Method: "GET"},
+		},
+	}
+}
+
+func TestParseReproSequence(t *testing.T) {
+	steps := ParseReproSequence([]byte(testBugFile), findings.CreateRedactor(nil))
+	require.Len(t, steps, 3)
+
+	assert.Equal(t, "POST", steps[0].Method)
+	assert.Equal(t, "/api/todo", steps[0].Path)
+	assert.Equal(t, "HTTP/1.1 201 Created", steps[0].ResponseStatus)
+	assert.Contains(t, steps[0].Request, "\n\n{\"title\":\"fuzzstring\"}")
+	assert.Equal(t, "DELETE", steps[1].Method)
+	assert.Equal(t, "HTTP/1.1 204 No Content", steps[1].ResponseStatus)
+	assert.Equal(t, "/api/todo/1?details=true", steps[2].Path)
+	assert.Equal(t, "HTTP/1.1 200 OK", steps[2].ResponseStatus)
+
+	assert.Empty(t, ParseReproSequence([]byte("no requests in here"), findings.CreateRedactor(nil)))
+}
+
+func TestParseReproSequenceRedactsCredentials(t *testing.T) {
+	apiDesc := createTestApiDesc()
+	apiDesc.SecuritySchemes = []discovery.SecuritySchema{
+		{Key: "QueryKey", Type: discovery.ApiKeySecSchemaType, In: "query", Name: "api_key"},
+		{Key: "HeaderKey", Type: discovery.ApiKeySecSchemaType, In: "header", Name: "X-API-Key"},
+	}
+	bugFile := `-> GET /api/todo/1?details=true&api_key=s3cr3t HTTP/1.1\r\nAuthorization: Bearer eyJhbGciOi\r\nx-api-key: k3y\r\nCookie: session=abc; theme=dark\r\nHost: 10.0.0.1\r\n\r\n{"token":"body"}\r\n
+PREVIOUS RESPONSE: 'HTTP/1.1 200 OK\r\n\r\n'
+`
+	steps := ParseReproSequence([]byte(bugFile), findings.CreateRedactor(apiDesc))
+	require.Len(t, steps, 1)
+	request := steps[0].Request
+	for _, secret := range []string{"s3cr3t", "eyJhbGciOi", "k3y", "session=abc"} {
+		assert.NotContains(t, request, secret)
+	}
+	// query parameter
+	assert.Equal(t, "/api/todo/1?details=true&api_key=REDACTED", steps[0].Path)
+	// headers, matched case insensitive
+	assert.Contains(t, request, "\nAuthorization: REDACTED\n")
+	assert.Contains(t, request, "\nx-api-key: REDACTED\n")
+	// cookies
+	assert.Contains(t, request, "\nCookie: REDACTED\n")
+	// everything else is kept
+	assert.Contains(t, request, "\nHost: 10.0.0.1\n\n{\"token\":\"body\"}")
+}
+
+func TestMatchEndpoint(t *testing.T) {
+	apiDesc := createTestApiDesc()
+
+	endpoint := MatchEndpoint(apiDesc, "GET", "/api/todo/1?details=true")
+	require.NotNil(t, endpoint)
+	assert.Equal(t, "/todo/{id}", endpoint.Path)
+
+	// literal segments are preferred over path parameters
+	endpoint = MatchEndpoint(apiDesc, "get", "/api/todo/latest")
+	require.NotNil(t, endpoint)
+	assert.Equal(t, "/todo/latest", endpoint.Path)
+
+	assert.Nil(t, MatchEndpoint(apiDesc, "PUT", "/api/todo/1"))
+	assert.Nil(t, MatchEndpoint(apiDesc, "GET", "/api/todo/1/items"))
+	assert.Nil(t, MatchEndpoint(nil, "GET", "/api/todo/1"))
+}
+
+func TestCreateFindings(t *testing.T) {
+	dir := t.TempDir()
+	bugFile := filepath.Join(dir, "UseAfterFreeChecker_20x_1.txt")
+	require.NoError(t, os.WriteFile(bugFile, []byte(testBugFile), 0644))
+
+	buckets := []BugBucket{
+		{Name: "UseAfterFreeChecker_20x", Checker: UseAfterFreeChecker, StatusCode: "20x", FilePath: bugFile, BugHash: "hash1", Reproducible: true},
+		{Name: "main_driver_500", Checker: MainDriverChecker, StatusCode: "500", FilePath: filepath.Join(dir, "missing.txt")},
+	}
+	created := CreateFindings(logger.CreateDebugLogger(), buckets, createTestApiDesc())
+	require.Len(t, created, 2)
+
+	assert.Equal(t, findings.MediumSeverity, created[0].Severity)
+	assert.Equal(t, "GET /todo/{id}", created[0].Operation())
+	assert.Equal(t, "hash1", created[0].BugHash)
+	assert.Len(t, created[0].ReproSequence, 3)
+
+	// a missing bug file still results in a finding, without an operation
+	assert.Equal(t, MainDriverChecker, created[1].Checker)
+	assert.Empty(t, created[1].Operation())
+	assert.Empty(t, created[1].ReproSequence)
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/internal/coverage"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SpecCoverageEntry entry inside the speccov.json file that RESTler writes for every rendered request
+type SpecCoverageEntry struct {
+	Verb     string `json:"verb"`
+	Endpoint string `json:"endpoint"`
+	// Valid 1 when the request got a 2xx response
+	Valid                       int     `json:"valid"`
+	InvalidDueToSequenceFailure int     `json:"invalid_due_to_sequence_failure"`
+	InvalidDueToResourceFailure int     `json:"invalid_due_to_resource_failure"`
+	InvalidDueToParserFailure   int     `json:"invalid_due_to_parser_failure"`
+	InvalidDueTo500             int     `json:"invalid_due_to_500"`
+	StatusCode                  string  `json:"status_code"`
+	StatusText                  string  `json:"status_text"`
+	ErrorMessage                *string `json:"error_message"`
+}
+
+// reasonPriorities order in which blocking reasons are reported when requests for an operation failed for multiple reasons
+// failing dependencies and auth hide the other reasons, so they come first
+var reasonPriorities = map[coverage.BlockingReason]int{
+	coverage.DependencyReason:  4,
+	coverage.AuthReason:        3,
+	coverage.InvalidBodyReason: 2,
+	coverage.ServerErrorReason: 1,
+	coverage.UnknownReason:     0,
+}
+
+// FindSpecCoverage gathers the speccov.json entries of all RESTler experiments inside resultsDir
+func FindSpecCoverage(resultsDir string) ([]SpecCoverageEntry, error) {
+	files, err := filepath.Glob(filepath.Join(resultsDir, "experiment*", "logs", "speccov.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for RESTler spec coverage: %w", err)
+	}
+	var entries []SpecCoverageEntry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RESTler spec coverage: %w", err)
+		}
+		fileEntries, err := ParseSpecCoverage(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RESTler spec coverage in %s: %w", file, err)
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+// ParseSpecCoverage parses the content of a RESTler speccov.json file
+func ParseSpecCoverage(data []byte) ([]SpecCoverageEntry, error) {
+	byHash := make(map[string]SpecCoverageEntry)
+	if err := json.Unmarshal(data, &byHash); err != nil {
+		return nil, err
+	}
+	entries := make([]SpecCoverageEntry, 0, len(byHash))
+	for _, entry := range byHash {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// CreateCoverage joins the spec coverage of RESTler with the operations of the API
+// operations without spec coverage entries were never attempted
+func CreateCoverage(apiDesc *discovery.WebApiDescription, entries []SpecCoverageEntry) coverage.Coverage {
+	byEndpoint := make(map[*discovery.Endpoint][]SpecCoverageEntry)
+	for _, entry := range entries {
+		if endpoint := MatchEndpoint(apiDesc, entry.Verb, entry.Endpoint); endpoint != nil {
+			byEndpoint[endpoint] = append(byEndpoint[endpoint], entry)
+		}
+	}
+
+	var result coverage.Coverage
+	if apiDesc == nil {
+		return result
+	}
+	for i := range apiDesc.Endpoints {
+		endpoint := &apiDesc.Endpoints[i]
+		endpointCoverage := coverage.EndpointCoverage{
+			Method:   strings.ToUpper(endpoint.Method),
+			Endpoint: endpoint.Path,
+			Status:   coverage.NotAttempted,
+			Reason:   coverage.NotRenderedReason,
+		}
+		for _, entry := range byEndpoint[endpoint] {
+			mergeSpecCoverageEntry(&endpointCoverage, entry)
+		}
+		result.Endpoints = append(result.Endpoints, endpointCoverage)
+	}
+	result.Sort()
+	return result
+}
+
+// mergeSpecCoverageEntry merges a spec coverage entry into the coverage of its operation
+// a single valid request makes the operation succeed, otherwise the most important blocking reason is kept
+func mergeSpecCoverageEntry(endpointCoverage *coverage.EndpointCoverage, entry SpecCoverageEntry) {
+	if endpointCoverage.Status == coverage.Succeeded {
+		return
+	}
+	if entry.Valid > 0 {
+		endpointCoverage.Status = coverage.Succeeded
+		endpointCoverage.StatusCode = entry.StatusCode
+		endpointCoverage.Reason = ""
+		endpointCoverage.Message = ""
+		return
+	}
+	reason := blockingReason(entry)
+	if endpointCoverage.Status == coverage.Failed && reasonPriorities[reason] < reasonPriorities[endpointCoverage.Reason] {
+		return
+	}
+	endpointCoverage.Status = coverage.Failed
+	endpointCoverage.StatusCode = entry.StatusCode
+	endpointCoverage.Reason = reason
+	endpointCoverage.Message = entry.StatusText
+	if entry.ErrorMessage != nil && len(*entry.ErrorMessage) > 0 {
+		endpointCoverage.Message = *entry.ErrorMessage
+	}
+}
+
+// blockingReason derives why a request didn't get a 2xx response
+func blockingReason(entry SpecCoverageEntry) coverage.BlockingReason {
+	switch {
+	case entry.InvalidDueToSequenceFailure > 0 || entry.InvalidDueToResourceFailure > 0:
+		return coverage.DependencyReason
+	case entry.InvalidDueTo500 > 0 && entry.StatusCode != "401" && entry.StatusCode != "403":
+		return coverage.ServerErrorReason
+	default:
+		return coverage.ReasonOfStatusCode(entry.StatusCode)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/internal/coverage"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testSpecCoverage = `{
+	"5d41402abc4b2a76": {
+		"verb": "POST", "endpoint": "/api/todo", "verb_endpoint": "POST /api/todo", "valid": 1,
+		"invalid_due_to_sequence_failure": 0, "invalid_due_to_resource_failure": 0, "invalid_due_to_parser_failure": 0, "invalid_due_to_500": 0,
+		"status_code": "201", "status_text": "Created", "error_message": null
+	},
+	"7d793037a0760186": {
+		"verb": "GET", "endpoint": "/api/todo/{id}", "verb_endpoint": "GET /api/todo/{id}", "valid": 0,
+		"invalid_due_to_sequence_failure": 0, "invalid_due_to_resource_failure": 0, "invalid_due_to_parser_failure": 0, "invalid_due_to_500": 0,
+		"status_code": "400", "status_text": "Bad Request", "error_message": "{\"error\":\"invalid id\"}"
+	},
+	"9e107d9d372bb682": {
+		"verb": "GET", "endpoint": "/api/todo/{id}", "verb_endpoint": "GET /api/todo/{id}", "valid": 0,
+		"invalid_due_to_sequence_failure": 1, "invalid_due_to_resource_failure": 0, "invalid_due_to_parser_failure": 0, "invalid_due_to_500": 0,
+		"status_code": "404", "status_text": "Not Found", "error_message": null
+	},
+	"e4d909c290d0fb1c": {
+		"verb": "GET", "endpoint": "/api/todo/latest", "verb_endpoint": "GET /api/todo/latest", "valid": 0,
+		"invalid_due_to_sequence_failure": 0, "invalid_due_to_resource_failure": 0, "invalid_due_to_parser_failure": 0, "invalid_due_to_500": 0,
+		"status_code": "401", "status_text": "Unauthorized", "error_message": null
+	}
+}`
+
+func TestFindSpecCoverage(t *testing.T) {
+	resultsDir := t.TempDir()
+	logsDir := filepath.Join(resultsDir, "experiment123", "logs")
+	require.NoError(t, os.MkdirAll(logsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(logsDir, "speccov.json"), []byte(testSpecCoverage), 0644))
+
+	entries, err := FindSpecCoverage(resultsDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	entries, err = FindSpecCoverage(t.TempDir())
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = ParseSpecCoverage([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestCreateCoverage(t *testing.T) {
+	entries, err := ParseSpecCoverage([]byte(testSpecCoverage))
+	require.NoError(t, err)
+	result := CreateCoverage(createTestApiDesc(), entries)
+
+	require.Len(t, result.Endpoints, 4)
+	expected := []coverage.EndpointCoverage{
+		{Method: "POST", Endpoint: "/todo", Status: coverage.Succeeded, StatusCode: "201"},
+		{Method: "GET", Endpoint: "/todo/latest", Status: coverage.Failed, StatusCode: "401", Reason: coverage.AuthReason, Message: "Unauthorized"},
+		{Method: "DELETE", Endpoint: "/todo/{id}", Status: coverage.NotAttempted, Reason: coverage.NotRenderedReason},
+		// the failing dependency is more important than the invalid body
+		{Method: "GET", Endpoint: "/todo/{id}", Status: coverage.Failed, StatusCode: "404", Reason: coverage.DependencyReason, Message: "Not Found"},
+	}
+	assert.Equal(t, expected, result.Endpoints)
+
+	summary := result.Summary()
+	assert.Equal(t, 4, summary.Total)
+	assert.Equal(t, 3, summary.Attempted)
+	assert.Equal(t, 1, summary.Succeeded)
+	assert.Equal(t, 1, summary.Blocked[coverage.DependencyReason])
+	assert.Equal(t, 25.0, summary.Percentage())
+
+	assert.Empty(t, CreateCoverage(nil, entries).Endpoints)
+}
+
+func TestBlockingReason(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry SpecCoverageEntry
+		want  coverage.BlockingReason
+	}{
+		{"failed sequence", SpecCoverageEntry{InvalidDueToSequenceFailure: 1, StatusCode: "401"}, coverage.DependencyReason},
+		{"failed resource", SpecCoverageEntry{InvalidDueToResourceFailure: 1, StatusCode: "500"}, coverage.DependencyReason},
+		{"unauthorized", SpecCoverageEntry{StatusCode: "401"}, coverage.AuthReason},
+		{"forbidden with server errors", SpecCoverageEntry{InvalidDueTo500: 1, StatusCode: "403"}, coverage.AuthReason},
+		{"server errors", SpecCoverageEntry{InvalidDueTo500: 1, StatusCode: "400"}, coverage.ServerErrorReason},
+		{"server error", SpecCoverageEntry{StatusCode: "502"}, coverage.ServerErrorReason},
+		{"invalid body", SpecCoverageEntry{StatusCode: "422"}, coverage.InvalidBodyReason},
+		{"no response", SpecCoverageEntry{}, coverage.UnknownReason},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, blockingReason(tt.entry))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"context"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TokenFilePath file that holds the auth headers of all users, the RESTler token refresh command prints this file
+const TokenFilePath = "/openapi/tokens.txt"
+
+// TokenRefreshInterval seconds between two token refreshes of RESTler, the token file gets rewritten twice as often
+const TokenRefreshInterval = 60
+
+// FormatTokenRefreshOutput formats the users in the output format of the RESTler token refresh command
+// the first line holds a dict with the users, followed by the header lines of every user separated by ---
+func FormatTokenRefreshOutput(users []UserAuth) string {
+	names := make([]string, 0, len(users))
+	headers := make([]string, 0, len(users))
+	for _, user := range users {
+		name := strings.ReplaceAll(strings.ReplaceAll(user.User, `\`, `\\`), `'`, `\'`)
+		names = append(names, fmt.Sprintf("'%s': {}", name))
+		headers = append(headers, strings.Join(user.Headers, "\n"))
+	}
+	return fmt.Sprintf("{%s}\n%s\n", strings.Join(names, ", "), strings.Join(headers, "\n---\n"))
+}
+
+// WriteTokenFile writes the users to the token file
+// the file gets replaced at once, so RESTler never reads a partially written file
+func WriteTokenFile(path string, users []UserAuth) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(FormatTokenRefreshOutput(users)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace token file: %w", err)
+	}
+	return nil
+}
+
+// RefreshTokenFile rewrites the token file with fresh tokens every interval until ctx is done
+// RESTler expects the same users on every refresh, refreshes that return a different number of users are skipped
+func RefreshTokenFile(ctx context.Context, l logger.Logger, path string, interval time.Duration, userCount int, createUsers func() []UserAuth) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			users := createUsers()
+			if len(users) != userCount {
+				l.V(logger.ImportantLevel).Info("failed to refresh the tokens of all users, keeping the old tokens", "users", len(users), "expectedUsers", userCount)
+				continue
+			}
+			if err := WriteTokenFile(path, users); err != nil {
+				l.V(logger.ImportantLevel).Error(err, "failed to refresh the token file")
+			}
+		}
+	}
+}
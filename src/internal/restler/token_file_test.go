@@ -0,0 +1,63 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFormatTokenRefreshOutput(t *testing.T) {
+	single := []UserAuth{{User: "myapi", Headers: []string{"X-API-Key: key", "Cookie: session=abc"}}}
+	assert.Equal(t, "{'myapi': {}}\nX-API-Key: key\nCookie: session=abc\n", FormatTokenRefreshOutput(single))
+
+	multiple := []UserAuth{
+		{User: "alice's api", Headers: []string{"Authorization: Bearer a"}},
+		{User: "userb", Headers: []string{"Authorization: Bearer b"}},
+	}
+	assert.Equal(t, "{'alice\\'s api': {}, 'userb': {}}\nAuthorization: Bearer a\n---\nAuthorization: Bearer b\n", FormatTokenRefreshOutput(multiple))
+}
+
+func TestRefreshTokenFile(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	path := filepath.Join(t.TempDir(), "tokens.txt")
+	require.NoError(t, WriteTokenFile(path, []UserAuth{{User: "myapi", Headers: []string{"Authorization: Bearer 0"}}}))
+
+	var refreshes int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go RefreshTokenFile(ctx, l, path, 10*time.Millisecond, 1, func() []UserAuth {
+		if atomic.AddInt32(&refreshes, 1) == 1 {
+			// a failed refresh keeps the old tokens
+			return nil
+		}
+		return []UserAuth{{User: "myapi", Headers: []string{"Authorization: Bearer 1"}}}
+	})
+
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(path)
+		return err == nil && string(content) == "{'myapi': {}}\nAuthorization: Bearer 1\n"
+	}, time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&refreshes), int32(2))
+}
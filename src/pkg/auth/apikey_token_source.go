@@ -16,7 +16,11 @@
 
 package auth
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 // apiKeyTokenSource ITokenSource for API key authentication
 type apiKeyTokenSource struct {
@@ -33,13 +37,23 @@ func (s *apiKeyTokenSource) Token() (*Token, error) {
 }
 
 // ApiKeyTokenSource creates a new apiKeyTokenSource for API key authentication
-func ApiKeyTokenSource(secret string) (ITokenSource, error) {
+// name and in are the name and location (header, query or cookie) of the API key from the security scheme,
+// when they are empty the key is sent in the Authorization header
+func ApiKeyTokenSource(secret string, name string, in string) (ITokenSource, error) {
 	if len(secret) == 0 {
 		return nil, errors.New("failed to create token because secret is empty")
 	}
+	switch strings.ToLower(in) {
+	case "", HeaderLocation, QueryLocation, CookieLocation:
+		break
+	default:
+		return nil, fmt.Errorf("failed to create token because api key location '%s' is unknown", in)
+	}
 	token := &Token{
 		AccessToken: secret,
 		TokenType:   "api-key",
+		In:          strings.ToLower(in),
+		Name:        name,
 	}
 
 	return &apiKeyTokenSource{
@@ -53,13 +53,20 @@ func TestInvalidApiKeyToken(t *testing.T) {
 
 func TestApiKeyTokenSource(t *testing.T) {
 	secret := "some-secret"
-	src, err := ApiKeyTokenSource(secret)
+	src, err := ApiKeyTokenSource(secret, "X-API-Key", "Header")
 	if assert.NoError(t, err) {
 		switch src := src.(type) {
 		case *apiKeyTokenSource:
 			assert.Equal(t, secret, src.t.AccessToken)
 			assert.Equal(t, "api-key", src.t.TokenType)
+			assert.Equal(t, HeaderLocation, src.t.In)
+			assert.Equal(t, "X-API-Key", src.t.Name)
 			assert.Nil(t, src.new)
 		}
 	}
 }
+
+func TestApiKeyTokenSourceInvalidLocation(t *testing.T) {
+	_, err := ApiKeyTokenSource("some-secret", "api_key", "body")
+	assert.EqualError(t, err, "failed to create token because api key location 'body' is unknown")
+}
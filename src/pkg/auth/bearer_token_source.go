@@ -0,0 +1,46 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import "errors"
+
+// bearerTokenSource ITokenSource for static bearer tokens
+// https://datatracker.ietf.org/doc/html/rfc6750
+type bearerTokenSource struct {
+	t *Token
+}
+
+// Token returns the static bearer token
+func (s *bearerTokenSource) Token() (*Token, error) {
+	if s.t.Valid() {
+		return s.t, nil
+	}
+	return nil, errors.New("failed to create a new bearer token because the current token is invalid and there is no token source")
+}
+
+// BearerTokenSource creates a new bearerTokenSource for bearer authentication with a static token
+func BearerTokenSource(secret string) (ITokenSource, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("failed to create token because secret is empty")
+	}
+	return &bearerTokenSource{
+		t: &Token{
+			AccessToken: secret,
+			TokenType:   "bearer",
+		},
+	}, nil
+}
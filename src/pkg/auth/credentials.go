@@ -0,0 +1,50 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+// Credentials username (or client id) and secret combination used to authenticate with a security scheme
+type Credentials struct {
+	Username string
+	Secret   string
+}
+
+// IsEmpty checks if these credentials hold any value
+func (c Credentials) IsEmpty() bool {
+	return len(c.Username) == 0 && len(c.Secret) == 0
+}
+
+// CredentialSet holds credentials for one identity
+// Schemes can hold credentials for specific security schemes (by scheme key), Default is used for every other scheme
+type CredentialSet struct {
+	Default Credentials
+	Schemes map[string]Credentials
+}
+
+// ForScheme returns the credentials that should be used for the security scheme with the given key
+func (c CredentialSet) ForScheme(key string) Credentials {
+	if creds, ok := c.Schemes[key]; ok && !creds.IsEmpty() {
+		return creds
+	}
+	return c.Default
+}
+
+// Identity a named CredentialSet
+// fuzzing with multiple identities makes it possible to find resources of one identity that are accessible by another
+type Identity struct {
+	Name        string
+	Credentials CredentialSet
+}
@@ -0,0 +1,317 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Supported JWT signing algorithms
+// https://datatracker.ietf.org/doc/html/rfc7518#section-3.1
+const (
+	HS256 = "HS256"
+	HS384 = "HS384"
+	HS512 = "HS512"
+	RS256 = "RS256"
+	RS384 = "RS384"
+	RS512 = "RS512"
+	ES256 = "ES256"
+)
+
+// DefaultJwtLifetime lifetime of minted tokens when no lifetime is configured
+const DefaultJwtLifetime = time.Hour
+
+// JwtOptions options for minting JWTs locally
+type JwtOptions struct {
+	// Algorithm signing algorithm (HS256, HS384, HS512, RS256, RS384, RS512 or ES256), defaults to HS256
+	Algorithm string
+	// Key HMAC secret or PEM encoded private key
+	Key []byte
+	// KeyId optional kid header
+	KeyId string
+	// Claims JSON claims template, can use {{ .Username }}, {{ .IssuedAt }} and {{ .ExpiresAt }}
+	Claims string
+	// Lifetime lifetime of a minted token, defaults to DefaultJwtLifetime
+	Lifetime time.Duration
+}
+
+// jwtClaimsData data that is available inside the claims template
+type jwtClaimsData struct {
+	Username  string
+	IssuedAt  int64
+	ExpiresAt int64
+}
+
+// jwtTokenSource ITokenSource that mints JWTs signed with a configured key
+// the minted token is reused until it expires
+type jwtTokenSource struct {
+	mu       sync.Mutex
+	opts     JwtOptions
+	username string
+	claims   *template.Template
+	signer   func(signingInput []byte) ([]byte, error)
+	t        *Token
+}
+
+// JwtTokenSource creates a new ITokenSource that mints JWTs for username
+func JwtTokenSource(opts JwtOptions, username string) (ITokenSource, error) {
+	if len(opts.Key) == 0 {
+		return nil, errors.New("failed to create JWT token source because the signing key is empty")
+	}
+	if len(opts.Algorithm) == 0 {
+		opts.Algorithm = HS256
+	}
+	opts.Algorithm = strings.ToUpper(opts.Algorithm)
+	if opts.Lifetime <= 0 {
+		opts.Lifetime = DefaultJwtLifetime
+	}
+	signer, err := createJwtSigner(opts.Algorithm, opts.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims *template.Template
+	if len(opts.Claims) > 0 {
+		claims, err = template.New("claims").Option("missingkey=error").Parse(opts.Claims)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT claims template: %w", err)
+		}
+	}
+
+	return &jwtTokenSource{
+		opts:     opts,
+		username: username,
+		claims:   claims,
+		signer:   signer,
+	}, nil
+}
+
+// Token returns the current JWT or mints a new one when it is expired
+func (s *jwtTokenSource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t.Valid() {
+		return s.t, nil
+	}
+	t, err := s.mint(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	s.t = t
+	return s.t, nil
+}
+
+// mint creates and signs a new JWT
+func (s *jwtTokenSource) mint(now time.Time) (*Token, error) {
+	issuedAt := now.Unix()
+	expiresAt := now.Add(s.opts.Lifetime).Unix()
+
+	claims := make(map[string]any)
+	if s.claims != nil {
+		rendered := &bytes.Buffer{}
+		err := s.claims.Execute(rendered, jwtClaimsData{
+			Username:  s.username,
+			IssuedAt:  issuedAt,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to render JWT claims template: %w", err)
+		}
+		if err := json.Unmarshal(rendered.Bytes(), &claims); err != nil {
+			return nil, fmt.Errorf("JWT claims template didn't render to a JSON object: %w", err)
+		}
+	}
+	if _, found := claims["sub"]; !found && len(s.username) > 0 {
+		claims["sub"] = s.username
+	}
+	claims["iat"] = issuedAt
+	claims["nbf"] = issuedAt
+	claims["exp"] = expiresAt
+	if _, found := claims["jti"]; !found {
+		jti := make([]byte, 16)
+		if _, err := rand.Read(jti); err != nil {
+			return nil, fmt.Errorf("failed to generate JWT id: %w", err)
+		}
+		claims["jti"] = hex.EncodeToString(jti)
+	}
+
+	header := map[string]string{"alg": s.opts.Algorithm, "typ": "JWT"}
+	if len(s.opts.KeyId) > 0 {
+		header["kid"] = s.opts.KeyId
+	}
+	encodedHeader, err := encodeJwtSegment(header)
+	if err != nil {
+		return nil, err
+	}
+	encodedClaims, err := encodeJwtSegment(claims)
+	if err != nil {
+		return nil, err
+	}
+	signingInput := encodedHeader + "." + encodedClaims
+	signature, err := s.signer([]byte(signingInput))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return &Token{
+		AccessToken: signingInput + "." + base64.RawURLEncoding.EncodeToString(signature),
+		TokenType:   "bearer",
+		Expiry:      time.Unix(expiresAt, 0),
+	}, nil
+}
+
+// encodeJwtSegment encodes a JWT header or claims object
+func encodeJwtSegment(obj any) (string, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT segment: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// createJwtSigner creates a function that signs the JWT signing input with key using algorithm
+func createJwtSigner(algorithm string, key []byte) (func([]byte) ([]byte, error), error) {
+	switch algorithm {
+	case HS256:
+		return hmacSigner(crypto.SHA256, key), nil
+	case HS384:
+		return hmacSigner(crypto.SHA384, key), nil
+	case HS512:
+		return hmacSigner(crypto.SHA512, key), nil
+	case RS256, RS384, RS512:
+		rsaKey, err := parseRsaPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		hash := map[string]crypto.Hash{RS256: crypto.SHA256, RS384: crypto.SHA384, RS512: crypto.SHA512}[algorithm]
+		return func(input []byte) ([]byte, error) {
+			return rsa.SignPKCS1v15(rand.Reader, rsaKey, hash, digest(hash, input))
+		}, nil
+	case ES256:
+		ecKey, err := parseEcPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return func(input []byte) ([]byte, error) {
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest(crypto.SHA256, input))
+			if err != nil {
+				return nil, err
+			}
+			// JWS uses the fixed size r || s encoding instead of ASN.1
+			signature := make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+			return signature, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("JWT signing algorithm %s is unsupported", algorithm)
+	}
+}
+
+// hmacSigner creates a HMAC signer
+func hmacSigner(hash crypto.Hash, key []byte) func([]byte) ([]byte, error) {
+	return func(input []byte) ([]byte, error) {
+		mac := hmac.New(hash.New, key)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	}
+}
+
+// digest hashes input with hash
+func digest(hash crypto.Hash, input []byte) []byte {
+	switch hash {
+	case crypto.SHA384:
+		sum := sha512.Sum384(input)
+		return sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512(input)
+		return sum[:]
+	default:
+		sum := sha256.Sum256(input)
+		return sum[:]
+	}
+}
+
+// decodePemKey decodes a PEM block from key
+func decodePemKey(key []byte) (*pem.Block, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, errors.New("JWT signing key isn't PEM encoded")
+	}
+	return block, nil
+}
+
+// parseRsaPrivateKey parses a PKCS #1 or PKCS #8 PEM encoded RSA private key
+func parseRsaPrivateKey(key []byte) (*rsa.PrivateKey, error) {
+	block, err := decodePemKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return rsaKey, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("JWT signing key isn't a RSA private key")
+	}
+	return rsaKey, nil
+}
+
+// parseEcPrivateKey parses a SEC 1 or PKCS #8 PEM encoded P-256 private key
+func parseEcPrivateKey(key []byte) (*ecdsa.PrivateKey, error) {
+	block, err := decodePemKey(key)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if pkcs8Err != nil {
+			return nil, fmt.Errorf("failed to parse EC private key: %w", err)
+		}
+		var ok bool
+		if ecKey, ok = parsed.(*ecdsa.PrivateKey); !ok {
+			return nil, errors.New("JWT signing key isn't a EC private key")
+		}
+	}
+	if ecKey.Curve.Params().BitSize != 256 {
+		return nil, errors.New("ES256 requires a P-256 key")
+	}
+	return ecKey, nil
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// splitJwt splits a JWT into its decoded header, claims and signature
+func splitJwt(t *testing.T, jwt string) (map[string]any, map[string]any, []byte, []byte) {
+	parts := strings.Split(jwt, ".")
+	require.Len(t, parts, 3)
+	decode := func(segment string) map[string]any {
+		raw, err := base64.RawURLEncoding.DecodeString(segment)
+		require.NoError(t, err)
+		obj := map[string]any{}
+		require.NoError(t, json.Unmarshal(raw, &obj))
+		return obj
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	return decode(parts[0]), decode(parts[1]), []byte(parts[0] + "." + parts[1]), signature
+}
+
+func TestJwtTokenSourceHS256(t *testing.T) {
+	key := []byte("very-secret-key")
+	tSource, err := JwtTokenSource(JwtOptions{
+		Key:      key,
+		KeyId:    "test-key",
+		Claims:   `{"iss": "cnfuzz", "preferred_username": "{{ .Username }}", "roles": ["admin"]}`,
+		Lifetime: 30 * time.Minute,
+	}, "alice")
+	require.NoError(t, err)
+
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "bearer", tok.TokenType)
+	assert.WithinDuration(t, time.Now().Add(30*time.Minute), tok.Expiry, 5*time.Second)
+
+	header, claims, signingInput, signature := splitJwt(t, tok.AccessToken)
+	assert.Equal(t, HS256, header["alg"])
+	assert.Equal(t, "test-key", header["kid"])
+	assert.Equal(t, "cnfuzz", claims["iss"])
+	assert.Equal(t, "alice", claims["preferred_username"])
+	assert.Equal(t, "alice", claims["sub"])
+	assert.Equal(t, []any{"admin"}, claims["roles"])
+	assert.NotEmpty(t, claims["jti"])
+	assert.Equal(t, float64(tok.Expiry.Unix()), claims["exp"])
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signingInput)
+	assert.True(t, hmac.Equal(mac.Sum(nil), signature))
+
+	// the token is reused until it expires
+	cached, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, tok.AccessToken, cached.AccessToken)
+}
+
+func TestJwtTokenSourceRS256(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	tSource, err := JwtTokenSource(JwtOptions{Algorithm: "rs256", Key: pemKey}, "bob")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+
+	header, _, signingInput, signature := splitJwt(t, tok.AccessToken)
+	assert.Equal(t, RS256, header["alg"])
+	hashed := sha256.Sum256(signingInput)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, hashed[:], signature))
+}
+
+func TestJwtTokenSourceES256(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tSource, err := JwtTokenSource(JwtOptions{Algorithm: ES256, Key: pemKey}, "carol")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+
+	_, _, signingInput, signature := splitJwt(t, tok.AccessToken)
+	require.Len(t, signature, 64)
+	hashed := sha256.Sum256(signingInput)
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	assert.True(t, ecdsa.Verify(&ecKey.PublicKey, hashed[:], r, s))
+}
+
+func TestJwtTokenSourceInvalidOptions(t *testing.T) {
+	_, err := JwtTokenSource(JwtOptions{}, "alice")
+	assert.Error(t, err, "empty key")
+	_, err = JwtTokenSource(JwtOptions{Algorithm: "none", Key: []byte("key")}, "alice")
+	assert.Error(t, err, "unsupported algorithm")
+	_, err = JwtTokenSource(JwtOptions{Algorithm: RS256, Key: []byte("not a pem key")}, "alice")
+	assert.Error(t, err, "invalid RSA key")
+
+	tSource, err := JwtTokenSource(JwtOptions{Key: []byte("key"), Claims: `["not", "an", "object"]`}, "alice")
+	require.NoError(t, err)
+	_, err = tSource.Token()
+	assert.Error(t, err, "claims that aren't an object")
+}
+
+func TestCreateTokenSourceWithJwtOptions(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	opts := Options{Jwt: &JwtOptions{Key: []byte("key")}}
+
+	for _, schema := range []discovery.SecuritySchema{
+		{Key: "oidc", Type: discovery.OpenIdConnectSecSchemaType},
+		{Key: "oauth", Type: discovery.OAuth2SecSchemaType},
+		{Key: "bearer", Type: discovery.BasicSecSchemaType, Scheme: discovery.BearerHttpScheme},
+	} {
+		tSource, err := CreateTokenSourceWithOptions(l, schema, Credentials{Username: "alice"}, opts)
+		if assert.NoError(t, err, schema.Key) {
+			tok, err := tSource.Token()
+			require.NoError(t, err)
+			assert.Len(t, strings.Split(tok.AccessToken, "."), 3, schema.Key)
+		}
+	}
+
+	// api keys and basic auth don't use JWTs
+	tSource, err := CreateTokenSourceWithOptions(l, discovery.SecuritySchema{Key: "key", Type: discovery.ApiKeySecSchemaType}, Credentials{Secret: "secret"}, opts)
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "secret", tok.AccessToken)
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JwtVerifier verifies JWTs that are signed with a configured key
+type JwtVerifier struct {
+	algorithm string
+	verify    func(signingInput []byte, signature []byte) error
+}
+
+// CreateJwtVerifier creates a verifier for JWTs signed with algorithm
+// HS algorithms use the HMAC secret, RS and ES algorithms accept a PEM encoded public key or the private key that signs the tokens
+func CreateJwtVerifier(algorithm string, key []byte) (*JwtVerifier, error) {
+	if len(key) == 0 {
+		return nil, errors.New("failed to create JWT verifier because the key is empty")
+	}
+	if len(algorithm) == 0 {
+		algorithm = HS256
+	}
+	algorithm = strings.ToUpper(algorithm)
+	verify, err := createJwtVerifyFunc(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	return &JwtVerifier{
+		algorithm: algorithm,
+		verify:    verify,
+	}, nil
+}
+
+// Verify checks the algorithm, signature and lifetime of a JWT and returns its claims
+func (v *JwtVerifier) Verify(token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("JWT should consist of three parts")
+	}
+	header := make(map[string]any)
+	if err := decodeJwtSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header["alg"] != v.algorithm {
+		return nil, fmt.Errorf("JWT is signed with algorithm %v instead of %s", header["alg"], v.algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JWT signature: %w", err)
+	}
+	if err := v.verify([]byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("JWT signature is invalid: %w", err)
+	}
+
+	claims := make(map[string]any)
+	if err := decodeJwtSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if exp, found := claims["exp"].(float64); found && now.Unix() >= int64(exp) {
+		return nil, errors.New("JWT is expired")
+	}
+	if nbf, found := claims["nbf"].(float64); found && now.Unix() < int64(nbf) {
+		return nil, errors.New("JWT isn't valid yet")
+	}
+	return claims, nil
+}
+
+// decodeJwtSegment decodes a JWT header or claims object
+func decodeJwtSegment(segment string, obj any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("failed to decode JWT segment: %w", err)
+	}
+	if err := json.Unmarshal(raw, obj); err != nil {
+		return fmt.Errorf("JWT segment isn't a JSON object: %w", err)
+	}
+	return nil
+}
+
+// createJwtVerifyFunc creates a function that verifies the signature of the JWT signing input with key using algorithm
+func createJwtVerifyFunc(algorithm string, key []byte) (func([]byte, []byte) error, error) {
+	switch algorithm {
+	case HS256, HS384, HS512:
+		hash := map[string]crypto.Hash{HS256: crypto.SHA256, HS384: crypto.SHA384, HS512: crypto.SHA512}[algorithm]
+		sign := hmacSigner(hash, key)
+		return func(input []byte, signature []byte) error {
+			expected, _ := sign(input)
+			if !hmac.Equal(expected, signature) {
+				return errors.New("HMAC doesn't match")
+			}
+			return nil
+		}, nil
+	case RS256, RS384, RS512:
+		rsaKey, err := parseRsaPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		hash := map[string]crypto.Hash{RS256: crypto.SHA256, RS384: crypto.SHA384, RS512: crypto.SHA512}[algorithm]
+		return func(input []byte, signature []byte) error {
+			return rsa.VerifyPKCS1v15(rsaKey, hash, digest(hash, input), signature)
+		}, nil
+	case ES256:
+		ecKey, err := parseEcPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return func(input []byte, signature []byte) error {
+			if len(signature) != 64 {
+				return errors.New("ES256 signature should be 64 bytes")
+			}
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if !ecdsa.Verify(ecKey, digest(crypto.SHA256, input), r, s) {
+				return errors.New("ECDSA signature doesn't match")
+			}
+			return nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("JWT signing algorithm %s is unsupported", algorithm)
+	}
+}
+
+// parseRsaPublicKey parses a PEM encoded RSA public key, or takes the public key of a RSA private key
+func parseRsaPublicKey(key []byte) (*rsa.PublicKey, error) {
+	block, err := decodePemKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if parsed, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("JWT key isn't a RSA public key")
+		}
+		return rsaKey, nil
+	}
+	if rsaKey, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return rsaKey, nil
+	}
+	privateKey, err := parseRsaPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &privateKey.PublicKey, nil
+}
+
+// parseEcPublicKey parses a PEM encoded P-256 public key, or takes the public key of a P-256 private key
+func parseEcPublicKey(key []byte) (*ecdsa.PublicKey, error) {
+	block, err := decodePemKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if parsed, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		ecKey, ok := parsed.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, errors.New("JWT key isn't a EC public key")
+		}
+		if ecKey.Curve.Params().BitSize != 256 {
+			return nil, errors.New("ES256 requires a P-256 key")
+		}
+		return ecKey, nil
+	}
+	privateKey, err := parseEcPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return &privateKey.PublicKey, nil
+}
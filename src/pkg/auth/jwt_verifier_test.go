@@ -0,0 +1,99 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestJwtVerifierHS256(t *testing.T) {
+	key := []byte("very-secret-key")
+	tSource, err := JwtTokenSource(JwtOptions{Key: key, Lifetime: time.Minute}, "alice")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+
+	verifier, err := CreateJwtVerifier("", key)
+	require.NoError(t, err)
+	claims, err := verifier.Verify(tok.AccessToken, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims["sub"])
+
+	_, err = verifier.Verify(tok.AccessToken, time.Now().Add(2*time.Minute))
+	assert.ErrorContains(t, err, "expired")
+
+	otherVerifier, err := CreateJwtVerifier(HS256, []byte("other-key"))
+	require.NoError(t, err)
+	_, err = otherVerifier.Verify(tok.AccessToken, time.Now())
+	assert.ErrorContains(t, err, "signature")
+
+	hs512Verifier, err := CreateJwtVerifier(HS512, key)
+	require.NoError(t, err)
+	_, err = hs512Verifier.Verify(tok.AccessToken, time.Now())
+	assert.ErrorContains(t, err, "algorithm")
+
+	_, err = verifier.Verify("not-a-jwt", time.Now())
+	assert.Error(t, err)
+}
+
+func TestJwtVerifierRS256(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	publicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	tSource, err := JwtTokenSource(JwtOptions{Algorithm: RS256, Key: privateKey}, "bob")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+
+	for _, key := range [][]byte{privateKey, publicKey} {
+		verifier, err := CreateJwtVerifier(RS256, key)
+		require.NoError(t, err)
+		_, err = verifier.Verify(tok.AccessToken, time.Now())
+		assert.NoError(t, err)
+	}
+}
+
+func TestJwtVerifierES256(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tSource, err := JwtTokenSource(JwtOptions{Algorithm: ES256, Key: privateKey}, "carol")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+
+	verifier, err := CreateJwtVerifier(ES256, privateKey)
+	require.NoError(t, err)
+	_, err = verifier.Verify(tok.AccessToken, time.Now())
+	assert.NoError(t, err)
+}
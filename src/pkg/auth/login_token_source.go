@@ -0,0 +1,398 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const loginTimeout = 10 * time.Second
+
+// RawTokenType token type for tokens that are sent without a prefix
+const RawTokenType = "raw"
+
+// defaultTokenPaths JSONPaths that are tried when no token path or regex is configured
+var defaultTokenPaths = []string{"access_token", "token", "accessToken", "id_token", "jwt"}
+
+// defaultExpiryPaths JSONPaths that are tried when no expiry path or regex is configured
+var defaultExpiryPaths = []string{"expires_in", "expiresIn", "expires_at", "expiresAt"}
+
+// LoginOptions options for getting a token from a login endpoint
+type LoginOptions struct {
+	// Method http method of the login request, defaults to POST
+	Method string `yaml:"method"`
+	// Url absolute URL of the login endpoint
+	Url string `yaml:"url"`
+	// Body template of the request body, can use {{ .Username }} and {{ .Password }}
+	// defaults to a JSON object with a username and password for requests that have a body
+	Body string `yaml:"body"`
+	// ContentType content type of the body, defaults to application/json
+	ContentType string            `yaml:"content_type"`
+	Headers     map[string]string `yaml:"headers"`
+	// TokenPath JSONPath to the token inside the response body, like $.data.token
+	TokenPath string `yaml:"token_path"`
+	// TokenRegex regex that matches the token inside the response body, the first capture group is used when there is one
+	TokenRegex string `yaml:"token_regex"`
+	// ExpiryPath JSONPath to the expiry of the token, the expiry can be in seconds, a unix timestamp or RFC 3339
+	ExpiryPath  string `yaml:"expiry_path"`
+	ExpiryRegex string `yaml:"expiry_regex"`
+	// TokenType prefix of the token inside the Authorization header, defaults to bearer, RawTokenType sends the token without prefix
+	TokenType string `yaml:"token_type"`
+}
+
+// loginTemplateData data that is available inside the body template
+type loginTemplateData struct {
+	Username string
+	Password string
+}
+
+// loginTokenSource ITokenSource that gets tokens by calling the login endpoint of the target
+// tokens are reused until they expire
+type loginTokenSource struct {
+	mu          sync.Mutex
+	client      *http.Client
+	opts        LoginOptions
+	creds       Credentials
+	body        *template.Template
+	tokenRegex  *regexp.Regexp
+	expiryRegex *regexp.Regexp
+	in          string
+	name        string
+	t           *Token
+}
+
+// LoginTokenSource creates a new ITokenSource that logs in with creds to get tokens
+// in and name are the location and name of the parameter the token has to be injected into, leave them empty
+// for the Authorization header
+func LoginTokenSource(opts LoginOptions, creds Credentials, in string, name string) (ITokenSource, error) {
+	if len(opts.Url) == 0 {
+		return nil, errors.New("failed to create login token source because the login URL is empty")
+	}
+	if len(opts.Method) == 0 {
+		opts.Method = http.MethodPost
+	}
+	opts.Method = strings.ToUpper(opts.Method)
+
+	source := &loginTokenSource{
+		client: &http.Client{Timeout: loginTimeout},
+		opts:   opts,
+		creds:  creds,
+		in:     in,
+		name:   name,
+	}
+	var err error
+	if len(opts.Body) > 0 {
+		source.body, err = template.New("body").Funcs(template.FuncMap{"json": jsonString}).Parse(opts.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse login body template: %w", err)
+		}
+	}
+	if len(opts.TokenRegex) > 0 {
+		if source.tokenRegex, err = regexp.Compile(opts.TokenRegex); err != nil {
+			return nil, fmt.Errorf("failed to compile login token regex: %w", err)
+		}
+	}
+	if len(opts.ExpiryRegex) > 0 {
+		if source.expiryRegex, err = regexp.Compile(opts.ExpiryRegex); err != nil {
+			return nil, fmt.Errorf("failed to compile login expiry regex: %w", err)
+		}
+	}
+	return source, nil
+}
+
+// Token returns the current token or logs in again when it is expired
+func (s *loginTokenSource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t.Valid() {
+		return s.t, nil
+	}
+	t, err := s.login()
+	if err != nil {
+		return nil, err
+	}
+	s.t = t
+	return s.t, nil
+}
+
+// login calls the login endpoint and extracts the token from the response
+func (s *loginTokenSource) login() (*Token, error) {
+	body, err := s.createBody()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(s.opts.Method, s.opts.Url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login request: %w", err)
+	}
+	if body != nil {
+		contentType := s.opts.ContentType
+		if len(contentType) == 0 {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range s.opts.Headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error while calling the login endpoint: %w", err)
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading the login response: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("login endpoint returned %d status code", res.StatusCode)
+	}
+
+	accessToken, err := s.extractToken(resBody)
+	if err != nil {
+		return nil, err
+	}
+	expiry, err := s.extractExpiry(resBody, accessToken, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	tok := &Token{
+		AccessToken: accessToken,
+		TokenType:   "bearer",
+		Expiry:      expiry,
+		In:          s.in,
+		Name:        s.name,
+	}
+	if len(s.opts.TokenType) > 0 {
+		tok.TokenType = s.opts.TokenType
+	}
+	if len(s.in) > 0 || strings.EqualFold(tok.TokenType, RawTokenType) {
+		// tokens inside api key parameters and raw tokens don't get a prefix
+		tok.TokenType = "api-key"
+	}
+	return tok, nil
+}
+
+// createBody renders the body of the login request
+func (s *loginTokenSource) createBody() (io.Reader, error) {
+	data := loginTemplateData{Username: s.creds.Username, Password: s.creds.Secret}
+	if s.body != nil {
+		rendered := &bytes.Buffer{}
+		if err := s.body.Execute(rendered, data); err != nil {
+			return nil, fmt.Errorf("failed to render login body template: %w", err)
+		}
+		return rendered, nil
+	}
+	if s.opts.Method == http.MethodGet || s.opts.Method == http.MethodHead {
+		return nil, nil
+	}
+	raw, err := json.Marshal(map[string]string{"username": data.Username, "password": data.Password})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(raw), nil
+}
+
+// extractToken gets the token from the login response with the token regex or the token path
+// when neither is configured, common token fields are tried and plain text responses are used as a whole
+func (s *loginTokenSource) extractToken(body []byte) (string, error) {
+	if s.tokenRegex != nil {
+		if value, found := matchRegex(s.tokenRegex, body); found {
+			return value, nil
+		}
+		return "", errors.New("login token regex didn't match the login response")
+	}
+	if len(s.opts.TokenPath) > 0 {
+		value, err := lookupJsonPathString(body, s.opts.TokenPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to find the token in the login response: %w", err)
+		}
+		return value, nil
+	}
+	for _, path := range defaultTokenPaths {
+		if value, err := lookupJsonPathString(body, path); err == nil && len(value) > 0 {
+			return value, nil
+		}
+	}
+	if plain := strings.TrimSpace(string(body)); len(plain) > 0 && !json.Valid(body) && !strings.ContainsAny(plain, " \n") {
+		return plain, nil
+	}
+	return "", errors.New("failed to find the token in the login response, configure a token path or regex")
+}
+
+// extractExpiry gets the expiry of the token from the login response
+// when no expiry path or regex is configured, common expiry fields and the exp claim of JWTs are tried
+// a zero time means the token doesn't expire
+func (s *loginTokenSource) extractExpiry(body []byte, accessToken string, now time.Time) (time.Time, error) {
+	if s.expiryRegex != nil {
+		value, found := matchRegex(s.expiryRegex, body)
+		if !found {
+			return time.Time{}, errors.New("login expiry regex didn't match the login response")
+		}
+		return parseExpiry(value, now)
+	}
+	if len(s.opts.ExpiryPath) > 0 {
+		value, err := lookupJsonPathString(body, s.opts.ExpiryPath)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to find the token expiry in the login response: %w", err)
+		}
+		return parseExpiry(value, now)
+	}
+	for _, path := range defaultExpiryPaths {
+		if value, err := lookupJsonPathString(body, path); err == nil {
+			if expiry, err := parseExpiry(value, now); err == nil {
+				return expiry, nil
+			}
+		}
+	}
+	if expiry, found := jwtExpiry(accessToken); found {
+		return expiry, nil
+	}
+	return time.Time{}, nil
+}
+
+// matchRegex returns the first capture group of a regex match, or the whole match when the regex doesn't have groups
+func matchRegex(regex *regexp.Regexp, body []byte) (string, bool) {
+	match := regex.FindSubmatch(body)
+	if match == nil {
+		return "", false
+	}
+	if len(match) > 1 {
+		return string(match[1]), true
+	}
+	return string(match[0]), true
+}
+
+// parseExpiry parses a token expiry
+// numbers are seconds from now, unless they are big enough to be a unix timestamp, other values have to be RFC 3339
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		// anything after 2001 is a timestamp, nobody hands out tokens that are valid for 30 years
+		if seconds > 1e9 {
+			return time.Unix(int64(seconds), 0), nil
+		}
+		return now.Add(time.Duration(seconds * float64(time.Second))), nil
+	}
+	expiry, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("token expiry '%s' is not a number or RFC 3339 time", value)
+	}
+	return expiry, nil
+}
+
+// jwtExpiry reads the exp claim of a JWT without verifying it
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	claims := struct {
+		Exp *float64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(raw, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(*claims.Exp), 0), true
+}
+
+// lookupJsonPathString looks up a value inside a JSON document and returns it as a string
+// only a subset of JSONPath is supported: dot separated keys with array indexes, like $.data.tokens[0].value
+func lookupJsonPathString(body []byte, path string) (string, error) {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", fmt.Errorf("response isn't JSON: %w", err)
+	}
+	value, err := lookupJsonPath(doc, path)
+	if err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", fmt.Errorf("value at %s is null", path)
+	default:
+		return "", fmt.Errorf("value at %s isn't a string or number", path)
+	}
+}
+
+// lookupJsonPath looks up a value inside a decoded JSON document
+func lookupJsonPath(doc any, path string) (any, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	current := doc
+	for _, segment := range strings.Split(path, ".") {
+		if len(segment) == 0 {
+			continue
+		}
+		key := segment
+		var indexes []string
+		if bracket := strings.Index(segment, "["); bracket >= 0 {
+			key = segment[:bracket]
+			for _, index := range strings.Split(segment[bracket+1:], "[") {
+				indexes = append(indexes, strings.TrimSuffix(index, "]"))
+			}
+		}
+		if len(key) > 0 {
+			obj, ok := current.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("can't look up %s because the value isn't an object", key)
+			}
+			if current, ok = obj[key]; !ok {
+				return nil, fmt.Errorf("%s not found", key)
+			}
+		}
+		for _, index := range indexes {
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("array index %s is invalid", index)
+			}
+			arr, ok := current.([]any)
+			if !ok || i < 0 || i >= len(arr) {
+				return nil, fmt.Errorf("array index %d is out of range", i)
+			}
+			current = arr[i]
+		}
+	}
+	return current, nil
+}
+
+// jsonString encodes a string as a JSON string, used inside body templates
+func jsonString(value string) (string, error) {
+	raw, err := json.Marshal(value)
+	return string(raw), err
+}
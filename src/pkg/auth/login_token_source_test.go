@@ -0,0 +1,182 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newLoginServer creates a login endpoint that checks the credentials and responds with response
+func newLoginServer(t *testing.T, contentType string, response string) (*httptest.Server, *int) {
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		creds := map[string]string{}
+		if err := json.Unmarshal(body, &creds); err != nil || creds["username"] != "alice" || creds["password"] != "s3cr\"t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		logins++
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &logins
+}
+
+var aliceCreds = Credentials{Username: "alice", Secret: "s3cr\"t"}
+
+func TestLoginTokenSourceDefaults(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	server, logins := newLoginServer(t, "application/json", `{"access_token": "abc", "expires_in": 3600}`)
+
+	tSource, err := LoginTokenSource(LoginOptions{Url: server.URL}, aliceCreds, "", "")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", tok.AccessToken)
+	assert.Equal(t, "Bearer abc", tok.CreateAuthHeaderValue(l))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), tok.Expiry, 5*time.Second)
+
+	// the token is reused until it expires
+	_, err = tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 1, *logins)
+}
+
+func TestLoginTokenSourcePathAndTemplate(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	server, _ := newLoginServer(t, "application/json", `{"data": {"tokens": [{"value": "xyz", "expires": "2099-01-02T15:04:05Z"}]}}`)
+
+	tSource, err := LoginTokenSource(LoginOptions{
+		Url:        server.URL,
+		Body:       `{"username": {{ json .Username }}, "password": {{ json .Password }}}`,
+		TokenPath:  "$.data.tokens[0].value",
+		ExpiryPath: "$.data.tokens[0].expires",
+		TokenType:  RawTokenType,
+	}, aliceCreds, "", "")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", tok.AccessToken)
+	assert.Equal(t, "xyz", tok.CreateAuthHeaderValue(l))
+	assert.Equal(t, 2099, tok.Expiry.Year())
+}
+
+func TestLoginTokenSourceRegex(t *testing.T) {
+	server, _ := newLoginServer(t, "text/html", `<p>token: tok-123 valid for 600 seconds</p>`)
+
+	tSource, err := LoginTokenSource(LoginOptions{
+		Url:         server.URL,
+		TokenRegex:  `token: (\S+)`,
+		ExpiryRegex: `valid for (\d+)`,
+	}, aliceCreds, "query", "api_key")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "tok-123", tok.AccessToken)
+	assert.Equal(t, QueryLocation, tok.Location())
+	assert.Equal(t, "api_key", tok.ParameterName())
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), tok.Expiry, 5*time.Second)
+}
+
+func TestLoginTokenSourceJwtExpiry(t *testing.T) {
+	jwtSource, err := JwtTokenSource(JwtOptions{Key: []byte("key"), Lifetime: 5 * time.Minute}, "alice")
+	require.NoError(t, err)
+	jwt, err := jwtSource.Token()
+	require.NoError(t, err)
+	server, _ := newLoginServer(t, "text/plain", jwt.AccessToken+"\n")
+
+	tSource, err := LoginTokenSource(LoginOptions{Url: server.URL}, aliceCreds, "", "")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, jwt.AccessToken, tok.AccessToken)
+	assert.Equal(t, jwt.Expiry.Unix(), tok.Expiry.Unix())
+}
+
+func TestLoginTokenSourceErrors(t *testing.T) {
+	server, _ := newLoginServer(t, "application/json", `{"something": "else"}`)
+
+	_, err := LoginTokenSource(LoginOptions{}, aliceCreds, "", "")
+	assert.Error(t, err, "empty url")
+	_, err = LoginTokenSource(LoginOptions{Url: server.URL, TokenRegex: "("}, aliceCreds, "", "")
+	assert.Error(t, err, "invalid regex")
+
+	tSource, err := LoginTokenSource(LoginOptions{Url: server.URL}, Credentials{Username: "mallory"}, "", "")
+	require.NoError(t, err)
+	_, err = tSource.Token()
+	assert.Error(t, err, "login rejected")
+
+	tSource, err = LoginTokenSource(LoginOptions{Url: server.URL}, aliceCreds, "", "")
+	require.NoError(t, err)
+	_, err = tSource.Token()
+	assert.Error(t, err, "no token in response")
+}
+
+func TestCreateTokenSourceWithLoginOptions(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	server, _ := newLoginServer(t, "application/json", `{"token": "abc"}`)
+	opts := Options{Login: &LoginOptions{Url: server.URL}}
+
+	tSource, err := CreateTokenSourceWithOptions(l, discovery.SecuritySchema{Key: "ApiKeyAuth", Type: discovery.ApiKeySecSchemaType, In: "header", Name: "Authorization"}, aliceCreds, opts)
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "abc", tok.CreateAuthHeaderValue(l))
+
+	// basic auth doesn't use tokens
+	tSource, err = CreateTokenSourceWithOptions(l, discovery.SecuritySchema{Key: "Basic", Type: discovery.BasicSecSchemaType}, aliceCreds, opts)
+	require.NoError(t, err)
+	tok, err = tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "Basic", tok.Type(l))
+}
+
+func TestLookupJsonPath(t *testing.T) {
+	body := []byte(`{"a": {"b": [{"c": "d"}, {"c": 42}]}, "n": null}`)
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "$.a.b[0].c", want: "d"},
+		{path: "a.b[1].c", want: "42"},
+		{path: "$.a.b[2].c", wantErr: true},
+		{path: "$.a.x", wantErr: true},
+		{path: "$.a", wantErr: true},
+		{path: "$.n", wantErr: true},
+	}
+	for _, tt := range tests {
+		value, err := lookupJsonPathString(body, tt.path)
+		if tt.wantErr {
+			assert.Error(t, err, tt.path)
+		} else if assert.NoError(t, err, tt.path) {
+			assert.Equal(t, tt.want, value)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenIdConfigurationPath well-known location of the OpenID Connect discovery document
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
+const OpenIdConfigurationPath = "/.well-known/openid-configuration"
+
+const oidcTimeout = 10 * time.Second
+
+// Grant types that can be used with OpenID Connect
+const (
+	ClientCredentialsGrant = "client_credentials"
+	PasswordGrant          = "password"
+)
+
+// OpenIdConnectOptions options for getting tokens from an OpenID Connect provider
+type OpenIdConnectOptions struct {
+	// GrantType client_credentials or password, picked automatically when empty
+	GrantType string
+	// ClientId and ClientSecret of the client, the Credentials are used as client credentials when these are empty
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// OpenIdConfiguration OpenID Connect provider metadata
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type OpenIdConfiguration struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JwksUri               string   `json:"jwks_uri"`
+	GrantTypesSupported   []string `json:"grant_types_supported"`
+	ScopesSupported       []string `json:"scopes_supported"`
+}
+
+// SupportsGrant checks if the provider supports a grant type
+// providers that don't advertise their grant types are assumed to support it
+func (c OpenIdConfiguration) SupportsGrant(grantType string) bool {
+	if len(c.GrantTypesSupported) == 0 {
+		return true
+	}
+	for _, supported := range c.GrantTypesSupported {
+		if supported == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchOpenIdConfiguration gets the discovery document of an OpenID Connect provider
+// discoveryUrl can either be the issuer or the full URL of the discovery document
+func FetchOpenIdConfiguration(ctx context.Context, client *http.Client, discoveryUrl string) (*OpenIdConfiguration, error) {
+	if len(discoveryUrl) == 0 {
+		return nil, errors.New("OpenID Connect discovery URL is empty")
+	}
+	if !strings.HasSuffix(discoveryUrl, OpenIdConfigurationPath) {
+		discoveryUrl = strings.TrimSuffix(discoveryUrl, "/") + OpenIdConfigurationPath
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error while creating request for the OpenID Connect discovery document: %w", err)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting the OpenID Connect discovery document: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OpenID Connect provider returned %d status code for the discovery document", res.StatusCode)
+	}
+
+	cnf := &OpenIdConfiguration{}
+	if err := json.NewDecoder(res.Body).Decode(cnf); err != nil {
+		return nil, fmt.Errorf("error while decoding the OpenID Connect discovery document: %w", err)
+	}
+	if len(cnf.TokenEndpoint) == 0 {
+		return nil, errors.New("OpenID Connect discovery document doesn't contain a token endpoint")
+	}
+	return cnf, nil
+}
+
+// oidcTokenSource ITokenSource that gets tokens from an OpenID Connect provider
+// tokens are cached until they expire, expired tokens get refreshed with the refresh token when there is one,
+// otherwise the grant is executed again
+type oidcTokenSource struct {
+	mu    sync.Mutex
+	ctx   context.Context
+	conf  oauth2.Config
+	grant func(ctx context.Context) (*oauth2.Token, error)
+	t     *oauth2.Token
+}
+
+// Token returns a cached token or requests a new one from the OpenID Connect provider
+func (s *oidcTokenSource) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.t.Valid() {
+		return tokenFromOAuth2Token(s.t), nil
+	}
+
+	if s.t != nil && len(s.t.RefreshToken) > 0 {
+		refreshed, err := s.conf.TokenSource(s.ctx, s.t).Token()
+		if err == nil {
+			s.t = refreshed
+			return tokenFromOAuth2Token(s.t), nil
+		}
+		// the refresh token is probably expired as well, fall back on the grant
+	}
+
+	tok, err := s.grant(s.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting a token from the OpenID Connect provider: %w", err)
+	}
+	s.t = tok
+	return tokenFromOAuth2Token(s.t), nil
+}
+
+// OpenIdConnectTokenSource creates an ITokenSource that gets tokens from the OpenID Connect provider behind discoveryUrl
+// runs the client credentials or password grant against the token endpoint of the provider
+func OpenIdConnectTokenSource(l logger.Logger, discoveryUrl string, creds Credentials, opts OpenIdConnectOptions) (ITokenSource, error) {
+	httpClient := &http.Client{Timeout: oidcTimeout}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+
+	providerCnf, err := FetchOpenIdConfiguration(ctx, httpClient, discoveryUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	grantType := selectOpenIdConnectGrant(creds, opts)
+	if !providerCnf.SupportsGrant(grantType) {
+		return nil, fmt.Errorf("OpenID Connect provider %s doesn't support the %s grant", providerCnf.Issuer, grantType)
+	}
+	l.V(logger.DebugLevel).Info("using OpenID Connect provider", "issuer", providerCnf.Issuer, "tokenEndpoint", providerCnf.TokenEndpoint, "grantType", grantType)
+
+	clientId, clientSecret := opts.ClientId, opts.ClientSecret
+	if len(clientId) == 0 {
+		clientId, clientSecret = creds.Username, creds.Secret
+	}
+	source := &oidcTokenSource{
+		ctx: ctx,
+		conf: oauth2.Config{
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   providerCnf.AuthorizationEndpoint,
+				TokenURL:  providerCnf.TokenEndpoint,
+				AuthStyle: oauth2.AuthStyleAutoDetect,
+			},
+			Scopes: opts.Scopes,
+		},
+	}
+
+	switch grantType {
+	case ClientCredentialsGrant:
+		ccConf := clientcredentials.Config{
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+			TokenURL:     providerCnf.TokenEndpoint,
+			Scopes:       opts.Scopes,
+			AuthStyle:    oauth2.AuthStyleAutoDetect,
+		}
+		source.grant = ccConf.Token
+	case PasswordGrant:
+		source.grant = func(ctx context.Context) (*oauth2.Token, error) {
+			return source.conf.PasswordCredentialsToken(ctx, creds.Username, creds.Secret)
+		}
+	default:
+		return nil, fmt.Errorf("OpenID Connect grant type %s is unsupported", grantType)
+	}
+
+	// Get the first token right away, so configuration errors show up early
+	if _, err := source.Token(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+// selectOpenIdConnectGrant picks the grant type for the OpenID Connect token source
+// the password grant is used when there is a separate client and a username, otherwise the client credentials grant
+func selectOpenIdConnectGrant(creds Credentials, opts OpenIdConnectOptions) string {
+	if len(opts.GrantType) > 0 {
+		return opts.GrantType
+	}
+	if len(opts.ClientId) > 0 && len(creds.Username) > 0 {
+		return PasswordGrant
+	}
+	return ClientCredentialsGrant
+}
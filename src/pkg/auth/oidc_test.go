@@ -0,0 +1,161 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeOidcServer in-process OpenID Connect provider that hands out numbered tokens
+type fakeOidcServer struct {
+	*httptest.Server
+	grants      []string
+	expiresIn   int
+	issued      int32
+	refreshed   int32
+	lastRequest http.Header
+	lastForm    map[string]string
+}
+
+func newFakeOidcServer(t *testing.T, grants []string, expiresIn int) *fakeOidcServer {
+	fake := &fakeOidcServer{grants: grants, expiresIn: expiresIn}
+	mux := http.NewServeMux()
+	mux.HandleFunc(OpenIdConfigurationPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(OpenIdConfiguration{
+			Issuer:              fake.URL,
+			TokenEndpoint:       fake.URL + "/token",
+			GrantTypesSupported: fake.grants,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		fake.lastRequest = r.Header
+		fake.lastForm = map[string]string{}
+		for key := range r.PostForm {
+			fake.lastForm[key] = r.PostForm.Get(key)
+		}
+		grantType := r.PostForm.Get("grant_type")
+		if grantType == "refresh_token" {
+			atomic.AddInt32(&fake.refreshed, 1)
+		}
+		n := atomic.AddInt32(&fake.issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  fmt.Sprintf("token-%d", n),
+			"token_type":    "Bearer",
+			"expires_in":    fake.expiresIn,
+			"refresh_token": fmt.Sprintf("refresh-%d", n),
+		})
+	})
+	fake.Server = httptest.NewServer(mux)
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func TestFetchOpenIdConfiguration(t *testing.T) {
+	fake := newFakeOidcServer(t, nil, 3600)
+	for _, discoveryUrl := range []string{fake.URL, fake.URL + "/", fake.URL + OpenIdConfigurationPath} {
+		cnf, err := FetchOpenIdConfiguration(context.Background(), fake.Client(), discoveryUrl)
+		if assert.NoError(t, err, discoveryUrl) {
+			assert.Equal(t, fake.URL+"/token", cnf.TokenEndpoint)
+		}
+	}
+
+	_, err := FetchOpenIdConfiguration(context.Background(), fake.Client(), fake.URL+"/unknown")
+	assert.Error(t, err)
+}
+
+func TestOpenIdConnectTokenSourceClientCredentials(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	fake := newFakeOidcServer(t, []string{ClientCredentialsGrant}, 3600)
+
+	tSource, err := OpenIdConnectTokenSource(l, fake.URL, Credentials{Username: "client", Secret: "secret"}, OpenIdConnectOptions{Scopes: []string{"api"}})
+	require.NoError(t, err)
+	assert.Equal(t, ClientCredentialsGrant, fake.lastForm["grant_type"])
+	assert.Equal(t, "api", fake.lastForm["scope"])
+
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", tok.AccessToken)
+	assert.Equal(t, "Bearer token-1", tok.CreateAuthHeaderValue(l))
+
+	// token is still valid, so it should come from the cache
+	tok, err = tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", tok.AccessToken)
+	assert.EqualValues(t, 1, fake.issued)
+}
+
+func TestOpenIdConnectTokenSourcePassword(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	fake := newFakeOidcServer(t, []string{ClientCredentialsGrant, PasswordGrant}, 3600)
+
+	_, err := OpenIdConnectTokenSource(l, fake.URL, Credentials{Username: "alice", Secret: "wonderland"}, OpenIdConnectOptions{ClientId: "cnfuzz"})
+	require.NoError(t, err)
+	assert.Equal(t, PasswordGrant, fake.lastForm["grant_type"])
+	assert.Equal(t, "alice", fake.lastForm["username"])
+	assert.Equal(t, "wonderland", fake.lastForm["password"])
+}
+
+func TestOpenIdConnectTokenSourceRefresh(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	// tokens expire within the expiry delta, so every call needs a new token
+	fake := newFakeOidcServer(t, nil, 1)
+
+	tSource, err := OpenIdConnectTokenSource(l, fake.URL, Credentials{Username: "client", Secret: "secret"}, OpenIdConnectOptions{})
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", tok.AccessToken)
+	assert.EqualValues(t, 1, fake.refreshed)
+	assert.Equal(t, "refresh-1", fake.lastForm["refresh_token"])
+}
+
+func TestOpenIdConnectTokenSourceUnsupportedGrant(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	fake := newFakeOidcServer(t, []string{"authorization_code"}, 3600)
+
+	_, err := OpenIdConnectTokenSource(l, fake.URL, Credentials{Username: "client", Secret: "secret"}, OpenIdConnectOptions{})
+	assert.Error(t, err)
+	assert.EqualValues(t, 0, fake.issued)
+}
+
+func TestCreateTokenSourceOpenIdConnect(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	fake := newFakeOidcServer(t, nil, 3600)
+
+	tSource, err := CreateTokenSource(l, discovery.SecuritySchema{
+		Key:              "oidc",
+		Type:             discovery.OpenIdConnectSecSchemaType,
+		OpenIdConnectUrl: fake.URL + OpenIdConfigurationPath,
+	}, "client", "secret")
+	require.NoError(t, err)
+	tok, err := tSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", tok.AccessToken)
+}
@@ -0,0 +1,27 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+// Options extra options for creating token sources
+type Options struct {
+	// OpenIdConnect options for openIdConnect security schemes
+	OpenIdConnect OpenIdConnectOptions
+	// Login when set, tokens for http bearer, apiKey, oauth2 and openIdConnect schemes are requested from a login endpoint
+	Login *LoginOptions
+	// Jwt when set, tokens for openIdConnect, oauth2 and http bearer schemes are minted locally instead
+	Jwt *JwtOptions
+}
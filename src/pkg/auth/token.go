@@ -26,12 +26,26 @@ import (
 
 const expiryDelta = 10 * time.Second
 
+// Locations where a token can be injected into a request
+const (
+	HeaderLocation = "header"
+	QueryLocation  = "query"
+	CookieLocation = "cookie"
+)
+
+// AuthorizationHeader default header for tokens
+const AuthorizationHeader = "Authorization"
+
 // Token object holding token information
 type Token struct {
 	AccessToken  string
 	TokenType    string
 	RefreshToken string
 	Expiry       time.Time
+	// In location of the token inside a request (header, query or cookie), defaults to header
+	In string
+	// Name name of the header, query parameter or cookie, defaults to the Authorization header
+	Name string
 }
 
 // Valid checks if this token is still valid
@@ -70,19 +84,54 @@ func (t *Token) Type(l logger.Logger) string {
 	return "Bearer"
 }
 
+// Location returns where this token should be injected into a request (header, query or cookie)
+func (t *Token) Location() string {
+	if len(t.In) == 0 {
+		return HeaderLocation
+	}
+	return strings.ToLower(t.In)
+}
+
+// ParameterName returns the name of the header, query parameter or cookie that holds this token
+func (t *Token) ParameterName() string {
+	if len(t.Name) == 0 {
+		return AuthorizationHeader
+	}
+	return t.Name
+}
+
+// Apply adds this token to a http Request on the location the token belongs
+func (t *Token) Apply(l logger.Logger, r *http.Request) {
+	switch t.Location() {
+	case QueryLocation:
+		query := r.URL.Query()
+		query.Set(t.ParameterName(), t.AccessToken)
+		r.URL.RawQuery = query.Encode()
+	case CookieLocation:
+		r.AddCookie(&http.Cookie{Name: t.ParameterName(), Value: t.AccessToken})
+	default:
+		r.Header.Set(t.ParameterName(), t.CreateAuthHeaderValue(l))
+	}
+}
+
 // SetAuthHeader set the authorization header in a http Request using this token
 func (t *Token) SetAuthHeader(l logger.Logger, r *http.Request) {
-	r.Header.Set("Authorization", t.CreateAuthHeaderValue(l))
+	r.Header.Set(t.ParameterName(), t.CreateAuthHeaderValue(l))
 }
 
 // CreateAuthHeader returns a http Header holding the Authorization header from this token
 func (t *Token) CreateAuthHeader(l logger.Logger) http.Header {
-	return http.Header{
-		"Authorization": {t.CreateAuthHeaderValue(l)},
-	}
+	header := http.Header{}
+	header.Set(t.ParameterName(), t.CreateAuthHeaderValue(l))
+	return header
 }
 
 // CreateAuthHeaderValue creates the value for the Authorization header from this token
+// tokens without a type prefix (like API keys) only contain the token itself
 func (t *Token) CreateAuthHeaderValue(l logger.Logger) string {
-	return t.Type(l) + " " + t.AccessToken
+	prefix := t.Type(l)
+	if len(prefix) == 0 {
+		return t.AccessToken
+	}
+	return prefix + " " + t.AccessToken
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"strings"
 )
 
 // ITokenSource interface for creating new auth tokens
@@ -30,19 +31,56 @@ type ITokenSource interface {
 // CreateTokenSource creates a new ITokenSource
 // Uses the schema type (BasicSecSchemaType) to create a ITokenSource for the proper auth source
 func CreateTokenSource(l logger.Logger, schema discovery.SecuritySchema, clientId string, secret string) (ITokenSource, error) {
+	return CreateTokenSourceWithOptions(l, schema, Credentials{Username: clientId, Secret: secret}, Options{})
+}
+
+// CreateTokenSourceWithOptions creates a new ITokenSource like CreateTokenSource, but with extra Options
+// for OpenID Connect and locally minted JWTs
+func CreateTokenSourceWithOptions(l logger.Logger, schema discovery.SecuritySchema, creds Credentials, opts Options) (ITokenSource, error) {
+	clientId, secret := creds.Username, creds.Secret
+	if opts.Login != nil && acceptsLoginToken(schema) {
+		l.V(logger.DebugLevel).Info("getting tokens from the login endpoint for auth scheme", "authScheme", schema.Key, "loginUrl", opts.Login.Url)
+		in, name := "", ""
+		if schema.Type == discovery.ApiKeySecSchemaType {
+			in, name = schema.In, schema.Name
+		}
+		if strings.EqualFold(in, QueryLocation) {
+			// RESTler only refreshes headers, query parameters are fixed when the API is compiled
+			return nil, fmt.Errorf("the %s auth scheme sends its key as query parameter '%s', tokens from the login endpoint expire and can't be refreshed there", schema.Key, name)
+		}
+		tokenSource, err := LoginTokenSource(*opts.Login, creds, in, name)
+		if err != nil {
+			return nil, fmt.Errorf("error when creating a new token source: %w", err)
+		}
+		return tokenSource, nil
+	}
+	if opts.Jwt != nil && acceptsJwt(schema) {
+		l.V(logger.DebugLevel).Info("minting JWTs locally for auth scheme", "authScheme", schema.Key)
+		tokenSource, err := JwtTokenSource(*opts.Jwt, clientId)
+		if err != nil {
+			return nil, fmt.Errorf("error when creating a new token source: %w", err)
+		}
+		return tokenSource, nil
+	}
+
 	var createdTokenSource ITokenSource
 	var err error
 	switch schema.Type {
 	case discovery.BasicSecSchemaType:
-		createdTokenSource, err = BasicAuthTokenSource(clientId, secret)
+		if strings.EqualFold(schema.Scheme, discovery.BearerHttpScheme) {
+			createdTokenSource, err = BearerTokenSource(secret)
+		} else {
+			createdTokenSource, err = BasicAuthTokenSource(clientId, secret)
+		}
 		break
 	case discovery.ApiKeySecSchemaType:
-		createdTokenSource, err = ApiKeyTokenSource(secret)
+		createdTokenSource, err = ApiKeyTokenSource(secret, schema.Name, schema.In)
 		break
 	case discovery.OAuth2SecSchemaType:
-		for _, flow := range schema.Flows {
-			createdTokenSource, err = CreateTokenFromOAuthFlow(l, flow.GrantType, clientId, secret, flow)
-		}
+		createdTokenSource, err = createTokenSourceFromOAuthFlows(l, schema, clientId, secret)
+		break
+	case discovery.OpenIdConnectSecSchemaType:
+		createdTokenSource, err = OpenIdConnectTokenSource(l, schema.OpenIdConnectUrl, creds, opts.OpenIdConnect)
 		break
 	default:
 		// unkown security schema
@@ -55,28 +93,45 @@ func CreateTokenSource(l logger.Logger, schema discovery.SecuritySchema, clientI
 	return createdTokenSource, nil
 }
 
-// CreateTokenSourceFromSchemas creates a new ITokenSource from the first schema in the slice
-func CreateTokenSourceFromSchemas(l logger.Logger, schemas []discovery.SecuritySchema, clientId string, secret string) (ITokenSource, error) {
-	// Check if there are any security schemas
-	// This function could be improved by having a smarter algorithm for picking a schema
-	if len(schemas) > 0 {
-		// Just use the first one for now ...
-		// If there are multiple schemas the situation does get weird, because the user can only pass one
-		// username/secret combination, and there is currently no way to select a preferred auth scheme
-		selScheme := 0
-		/* for i, scheme := range schemas {
-			if len(scheme.Flows) > 0 && scheme.Flows[0].GrantType == discovery.AuthorizationCode {
-				selScheme = i
-			}
-		} */
-		selectedAuthScheme := schemas[selScheme]
+// acceptsJwt checks if a security scheme expects bearer tokens that can be replaced by a locally minted JWT
+func acceptsJwt(schema discovery.SecuritySchema) bool {
+	switch schema.Type {
+	case discovery.OpenIdConnectSecSchemaType, discovery.OAuth2SecSchemaType:
+		return true
+	case discovery.BasicSecSchemaType:
+		return strings.EqualFold(schema.Scheme, discovery.BearerHttpScheme)
+	}
+	return false
+}
+
+// acceptsLoginToken checks if a security scheme takes tokens that can be requested from a login endpoint
+func acceptsLoginToken(schema discovery.SecuritySchema) bool {
+	return schema.Type == discovery.ApiKeySecSchemaType || acceptsJwt(schema)
+}
+
+// oAuthFlowPreference order in which OAuth flows get tried, flows that don't need user interaction come first
+var oAuthFlowPreference = []string{discovery.ClientCredentials, discovery.Password, discovery.AuthorizationCode, discovery.Implicit}
 
-		tokenSource, authErr := CreateTokenSource(l, selectedAuthScheme, clientId, secret)
-		if authErr != nil {
-			// Maybe if there are multiple security schemas, we could try a different one
-			l.V(logger.ImportantLevel).Error(authErr, "error while creating an auth token")
+// createTokenSourceFromOAuthFlows tries the OAuth flows of a security schema in order of preference
+// and returns the token source of the first flow that succeeds
+func createTokenSourceFromOAuthFlows(l logger.Logger, schema discovery.SecuritySchema, clientId string, secret string) (ITokenSource, error) {
+	if len(schema.Flows) == 0 {
+		return nil, fmt.Errorf("%s auth scheme doesn't contain any OAuth flows", schema.Key)
+	}
+	var lastErr error
+	for _, grantType := range oAuthFlowPreference {
+		for _, flow := range schema.Flows {
+			if flow.GrantType != grantType {
+				continue
+			}
+			tokenSource, err := CreateTokenFromOAuthFlow(l, flow.GrantType, clientId, secret, flow)
+			if err != nil {
+				l.V(logger.InfoLevel).Info("failed to create a token source for OAuth flow, trying the next flow", "authScheme", schema.Key, "grantType", flow.GrantType, "error", err.Error())
+				lastErr = err
+				continue
+			}
+			return tokenSource, nil
 		}
-		return tokenSource, nil
 	}
-	return nil, nil
+	return nil, fmt.Errorf("none of the OAuth flows of the %s auth scheme succeeded: %w", schema.Key, lastErr)
 }
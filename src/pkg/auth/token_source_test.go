@@ -68,6 +68,45 @@ func TestCreateTokenSourceApiKey(t *testing.T) {
 	}
 }
 
+func TestCreateTokenSourceLoginQuery(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	schema := discovery.SecuritySchema{Key: "ApiKey", Type: discovery.ApiKeySecSchemaType, In: "query", Name: "api_key"}
+	opts := Options{Login: &LoginOptions{Url: "http://todo-api/login"}}
+	_, err := CreateTokenSourceWithOptions(l, schema, Credentials{Username: "alice", Secret: "secret"}, opts)
+	assert.ErrorContains(t, err, "can't be refreshed")
+
+	// static keys don't expire
+	tSource, err := CreateTokenSourceWithOptions(l, schema, Credentials{Secret: "key"}, Options{})
+	assert.NoError(t, err)
+	assert.NotNil(t, tSource)
+}
+
+func TestCreateTokenSourceBearer(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	secret := "mysecret"
+	tSource, err := CreateTokenSource(l, discovery.SecuritySchema{
+		Type:   discovery.BasicSecSchemaType,
+		Scheme: discovery.BearerHttpScheme,
+	}, "", secret)
+	assert.NoError(t, err)
+	if assert.NotNil(t, tSource) {
+		tok, tErr := tSource.Token()
+		if assert.NoError(t, tErr) {
+			assert.Equal(t, secret, tok.AccessToken)
+			assert.Equal(t, "Bearer "+secret, tok.CreateAuthHeaderValue(l))
+		}
+	}
+}
+
+func TestCreateTokenSourceOAuthNoFlows(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	_, err := CreateTokenSource(l, discovery.SecuritySchema{
+		Key:  "OAuth",
+		Type: discovery.OAuth2SecSchemaType,
+	}, "client", "secret")
+	assert.Error(t, err)
+}
+
 /*
 TODO create a test for oauth token source
 func TestCreateTokenSourceOAuth(t *testing.T)
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"sort"
+)
+
+// TokenSources holds an ITokenSource for every security scheme of an API that cnfuzz was able to create one for
+type TokenSources struct {
+	sources   map[string]ITokenSource
+	preferred string
+}
+
+// CreateTokenSources creates an ITokenSource for every security scheme using the credentials from the CredentialSet
+// schemes for which no token source could be created are skipped, preferredScheme is the scheme key that
+// is picked when an endpoint accepts multiple security schemes, opts are passed on to CreateTokenSourceWithOptions
+func CreateTokenSources(l logger.Logger, schemas []discovery.SecuritySchema, creds CredentialSet, preferredScheme string, opts Options) TokenSources {
+	sources := TokenSources{
+		sources:   make(map[string]ITokenSource),
+		preferred: preferredScheme,
+	}
+	for _, schema := range schemas {
+		schemeCreds := creds.ForScheme(schema.Key)
+		tokenSource, err := CreateTokenSourceWithOptions(l, schema, schemeCreds, opts)
+		if err != nil {
+			l.V(logger.ImportantLevel).Error(err, "error while creating a token source for auth scheme, skipping the scheme", "authScheme", schema.Key)
+			continue
+		}
+		sources.sources[schema.Key] = tokenSource
+	}
+	if len(preferredScheme) > 0 {
+		if _, found := sources.sources[preferredScheme]; !found {
+			l.V(logger.ImportantLevel).Info("preferred auth scheme is unknown or no token source could be created for it", "authScheme", preferredScheme)
+		}
+	}
+	return sources
+}
+
+// IdentityTokenSources TokenSources for a single Identity
+type IdentityTokenSources struct {
+	Identity string
+	TokenSources
+}
+
+// CreateIdentityTokenSources creates TokenSources for every Identity, identities without any token sources are skipped
+func CreateIdentityTokenSources(l logger.Logger, schemas []discovery.SecuritySchema, identities []Identity, preferredScheme string, opts Options) []IdentityTokenSources {
+	var sources []IdentityTokenSources
+	for _, identity := range identities {
+		identitySources := CreateTokenSources(l, schemas, identity.Credentials, preferredScheme, opts)
+		if identitySources.IsEmpty() {
+			l.V(logger.ImportantLevel).Info("no token source could be created for identity, skipping the identity", "identity", identity.Name)
+			continue
+		}
+		sources = append(sources, IdentityTokenSources{
+			Identity:     identity.Name,
+			TokenSources: identitySources,
+		})
+	}
+	return sources
+}
+
+// IsEmpty checks if there aren't any token sources
+func (s TokenSources) IsEmpty() bool {
+	return len(s.sources) == 0
+}
+
+// Get returns the ITokenSource for the security scheme with the given key
+func (s TokenSources) Get(key string) (ITokenSource, bool) {
+	source, found := s.sources[key]
+	return source, found
+}
+
+// Keys returns the sorted keys of the security schemes that have a token source
+func (s TokenSources) Keys() []string {
+	keys := make([]string, 0, len(s.sources))
+	for key := range s.sources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ForEndpoint selects the token sources that satisfy the security requirements of an endpoint
+// returns an empty map when the endpoint doesn't need authentication,
+// and an error when none of the security requirements can be satisfied
+func (s TokenSources) ForEndpoint(endpoint discovery.Endpoint) (map[string]ITokenSource, error) {
+	if len(endpoint.Security) == 0 {
+		return map[string]ITokenSource{}, nil
+	}
+
+	var selected discovery.SecurityRequirement
+	allowsAnonymous := false
+	for _, requirement := range endpoint.Security {
+		if len(requirement) == 0 {
+			allowsAnonymous = true
+			continue
+		}
+		if !s.satisfies(requirement) {
+			continue
+		}
+		if _, hasPreferred := requirement[s.preferred]; hasPreferred && len(s.preferred) > 0 {
+			selected = requirement
+			break
+		}
+		if selected == nil {
+			selected = requirement
+		}
+	}
+
+	if selected == nil {
+		if allowsAnonymous {
+			return map[string]ITokenSource{}, nil
+		}
+		return nil, fmt.Errorf("no token source available that satisfies the security requirements of %s %s", endpoint.Method, endpoint.Path)
+	}
+
+	sources := make(map[string]ITokenSource, len(selected))
+	for key := range selected {
+		sources[key] = s.sources[key]
+	}
+	return sources, nil
+}
+
+// ForApi selects the token sources for every endpoint of the API and returns them combined
+// endpoints with security requirements that can't be satisfied are logged and skipped
+// RESTler sends the same credentials with every request, so every endpoint gets the credentials of all selected schemes,
+// also of schemes it doesn't declare. ForEndpoint only decides which schemes are part of the combination.
+func (s TokenSources) ForApi(l logger.Logger, apiDesc *discovery.WebApiDescription) map[string]ITokenSource {
+	sources := make(map[string]ITokenSource)
+	for _, endpoint := range apiDesc.Endpoints {
+		endpointSources, err := s.ForEndpoint(endpoint)
+		if err != nil {
+			l.V(logger.InfoLevel).Info(err.Error(), "method", endpoint.Method, "path", endpoint.Path)
+			continue
+		}
+		for key, source := range endpointSources {
+			sources[key] = source
+		}
+	}
+	return sources
+}
+
+// satisfies checks if there is a token source for every scheme inside the security requirement
+func (s TokenSources) satisfies(requirement discovery.SecurityRequirement) bool {
+	for key := range requirement {
+		if _, found := s.sources[key]; !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"testing"
+)
+
+var testSchemas = []discovery.SecuritySchema{
+	{Key: "ApiKeyAuth", Type: discovery.ApiKeySecSchemaType, In: "header", Name: "X-API-Key"},
+	{Key: "BearerAuth", Type: discovery.BasicSecSchemaType, Scheme: discovery.BearerHttpScheme},
+	{Key: "UnknownAuth", Type: "mutualTLS"},
+}
+
+func TestCreateTokenSources(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	creds := CredentialSet{
+		Default: Credentials{Secret: "default-secret"},
+		Schemes: map[string]Credentials{"BearerAuth": {Secret: "bearer-secret"}},
+	}
+	sources := CreateTokenSources(l, testSchemas, creds, "", Options{})
+	assert.False(t, sources.IsEmpty())
+	assert.Equal(t, []string{"ApiKeyAuth", "BearerAuth"}, sources.Keys())
+
+	apiKeySource, found := sources.Get("ApiKeyAuth")
+	if assert.True(t, found) {
+		tok, err := apiKeySource.Token()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "default-secret", tok.AccessToken)
+		}
+	}
+	bearerSource, found := sources.Get("BearerAuth")
+	if assert.True(t, found) {
+		tok, err := bearerSource.Token()
+		if assert.NoError(t, err) {
+			assert.Equal(t, "bearer-secret", tok.AccessToken)
+			assert.Equal(t, "Bearer", tok.Type(l))
+		}
+	}
+	_, found = sources.Get("UnknownAuth")
+	assert.False(t, found)
+}
+
+func TestTokenSourcesForEndpoint(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	creds := CredentialSet{Default: Credentials{Secret: "secret"}}
+	tests := []struct {
+		name      string
+		preferred string
+		security  []discovery.SecurityRequirement
+		wantKeys  []string
+		wantErr   bool
+	}{
+		{name: "no-security", security: nil, wantKeys: []string{}},
+		{name: "first-satisfiable", security: []discovery.SecurityRequirement{{"UnknownAuth": {}}, {"ApiKeyAuth": {}}, {"BearerAuth": {}}}, wantKeys: []string{"ApiKeyAuth"}},
+		{name: "preferred", preferred: "BearerAuth", security: []discovery.SecurityRequirement{{"ApiKeyAuth": {}}, {"BearerAuth": {}}}, wantKeys: []string{"BearerAuth"}},
+		{name: "combined", security: []discovery.SecurityRequirement{{"ApiKeyAuth": {}, "BearerAuth": {}}}, wantKeys: []string{"ApiKeyAuth", "BearerAuth"}},
+		{name: "optional-auth", security: []discovery.SecurityRequirement{{}, {"ApiKeyAuth": {}}}, wantKeys: []string{"ApiKeyAuth"}},
+		{name: "anonymous-fallback", security: []discovery.SecurityRequirement{{"UnknownAuth": {}}, {}}, wantKeys: []string{}},
+		{name: "unsatisfiable", security: []discovery.SecurityRequirement{{"UnknownAuth": {}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources := CreateTokenSources(l, testSchemas, creds, tt.preferred, Options{})
+			selected, err := sources.ForEndpoint(discovery.Endpoint{Method: "GET", Path: "/test", Security: tt.security})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				keys := make([]string, 0, len(selected))
+				for key := range selected {
+					keys = append(keys, key)
+				}
+				assert.ElementsMatch(t, tt.wantKeys, keys)
+			}
+		})
+	}
+}
+
+func TestTokenSourcesForApi(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	sources := CreateTokenSources(l, testSchemas, CredentialSet{Default: Credentials{Secret: "secret"}}, "", Options{})
+	apiDesc := &discovery.WebApiDescription{
+		Endpoints: []discovery.Endpoint{
+			{Method: "GET", Path: "/keys", Security: []discovery.SecurityRequirement{{"ApiKeyAuth": {}}}},
+			{Method: "GET", Path: "/bearer", Security: []discovery.SecurityRequirement{{"BearerAuth": {}}}},
+			{Method: "GET", Path: "/unknown", Security: []discovery.SecurityRequirement{{"UnknownAuth": {}}}},
+			{Method: "GET", Path: "/public"},
+		},
+	}
+	selected := sources.ForApi(l, apiDesc)
+	assert.Len(t, selected, 2)
+	assert.Contains(t, selected, "ApiKeyAuth")
+	assert.Contains(t, selected, "BearerAuth")
+}
+
+func TestCredentialSetForScheme(t *testing.T) {
+	creds := CredentialSet{
+		Default: Credentials{Username: "default", Secret: "default-secret"},
+		Schemes: map[string]Credentials{"BasicAuth": {Username: "basic", Secret: "basic-secret"}},
+	}
+	assert.Equal(t, "basic", creds.ForScheme("BasicAuth").Username)
+	assert.Equal(t, "default", creds.ForScheme("OtherAuth").Username)
+}
+
+func TestCreateIdentityTokenSources(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	identities := []Identity{
+		{Name: "userb", Credentials: CredentialSet{Default: Credentials{Secret: "userb-secret"}}},
+		{Name: "nocreds"},
+		{Name: "userc", Credentials: CredentialSet{Schemes: map[string]Credentials{"ApiKeyAuth": {Secret: "userc-key"}}}},
+	}
+	sources := CreateIdentityTokenSources(l, testSchemas, identities, "", Options{})
+	if assert.Len(t, sources, 2) {
+		assert.Equal(t, "userb", sources[0].Identity)
+		assert.Equal(t, []string{"ApiKeyAuth", "BearerAuth"}, sources[0].Keys())
+		assert.Equal(t, "userc", sources[1].Identity)
+		assert.Equal(t, []string{"ApiKeyAuth"}, sources[1].Keys())
+	}
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenApply(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	tests := []struct {
+		name       string
+		token      Token
+		wantHeader map[string]string
+		wantQuery  map[string]string
+		wantCookie map[string]string
+	}{
+		{name: "api-key-default", token: Token{AccessToken: "key", TokenType: "api-key"}, wantHeader: map[string]string{"Authorization": "key"}},
+		{name: "api-key-header", token: Token{AccessToken: "key", TokenType: "api-key", In: HeaderLocation, Name: "X-API-Key"}, wantHeader: map[string]string{"X-API-Key": "key"}},
+		{name: "api-key-query", token: Token{AccessToken: "key", TokenType: "api-key", In: QueryLocation, Name: "api_key"}, wantQuery: map[string]string{"api_key": "key"}},
+		{name: "api-key-cookie", token: Token{AccessToken: "key", TokenType: "api-key", In: CookieLocation, Name: "session"}, wantCookie: map[string]string{"session": "key"}},
+		{name: "bearer", token: Token{AccessToken: "jwt", TokenType: "bearer"}, wantHeader: map[string]string{"Authorization": "Bearer jwt"}},
+		{name: "basic", token: Token{AccessToken: "dXNlcjpwYXNz", TokenType: "basic"}, wantHeader: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://localhost/api?existing=1", nil)
+			tt.token.Apply(l, r)
+			for name, value := range tt.wantHeader {
+				assert.Equal(t, value, r.Header.Get(name))
+			}
+			for name, value := range tt.wantQuery {
+				assert.Equal(t, value, r.URL.Query().Get(name))
+				assert.Equal(t, "1", r.URL.Query().Get("existing"))
+			}
+			for name, value := range tt.wantCookie {
+				cookie, err := r.Cookie(name)
+				if assert.NoError(t, err) {
+					assert.Equal(t, value, cookie.Value)
+				}
+			}
+			if len(tt.wantHeader) == 0 {
+				assert.Empty(t, r.Header.Get(AuthorizationHeader))
+			}
+		})
+	}
+}
+
+func TestCreateAuthHeader(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	tok := &Token{AccessToken: "key", TokenType: "api-key", Name: "X-API-Key"}
+	header := tok.CreateAuthHeader(l)
+	assert.Equal(t, "key", header.Get("X-API-Key"))
+}
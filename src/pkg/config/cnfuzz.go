@@ -17,10 +17,16 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"github.com/suecodelabs/cnfuzz/src/pkg/schedule"
 	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
 	"regexp"
+	sigsyaml "sigs.k8s.io/yaml"
+	"strconv"
+	"time"
 )
 
 const imageRegex = "[a-z0-9]([-a-z0-9]*[a-z0-9])?"
@@ -32,8 +38,18 @@ type CnFuzzConfig struct {
 	ConfigmapName        string                `yaml:"configmap_name"`
 	RestlerWrapperConfig *RestlerWrapperConfig `yaml:"restlerwrapper"`
 	RedisConfig          *RedisConfig          `yaml:"redis"`
+	PostgresConfig       *PostgresConfig       `yaml:"postgres"`
+	KubernetesConfig     *KubernetesConfig     `yaml:"kubernetes"`
+	FileConfig           *FileConfig           `yaml:"file"`
 	AuthConfig           *AuthConfig           `yaml:"auth"`
 	S3Config             *S3Config             `yaml:"s3"`
+	Notifications        []NotifierConfig      `yaml:"notifications"`
+	IssuesConfig         *IssuesConfig         `yaml:"issues"`
+	ApiConfig            *ApiConfig            `yaml:"api"`
+	RefuzzConfig         *RefuzzConfig         `yaml:"refuzz"`
+	DifferentialConfig   *DifferentialConfig   `yaml:"differential"`
+	RecoveryConfig       *RecoveryConfig       `yaml:"recovery"`
+	SandboxConfig        *SandboxConfig        `yaml:"sandbox"`
 }
 
 type ImageConfig struct {
@@ -65,6 +81,29 @@ type RestlerWrapperConfig struct {
 	ImageConfig    ImageConfig    `yaml:"image"`
 	RestlerConfig  *RestlerConfig `yaml:"restler"`
 	ServiceAccount string         `yaml:"service_account"`
+	JobConfig      *JobConfig     `yaml:"job"`
+	// PodTemplate strategic merge patch in the format of a PodTemplateSpec that is applied to the pod template of the fuzz jobs
+	PodTemplate map[string]interface{} `yaml:"pod_template"`
+}
+
+// GetPodTemplatePatch returns the pod template patch as JSON, nil when there is no patch
+func (cnf RestlerWrapperConfig) GetPodTemplatePatch() ([]byte, error) {
+	if len(cnf.PodTemplate) == 0 {
+		return nil, nil
+	}
+	data, err := yaml.Marshal(cnf.PodTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the pod template of the restlerwrapper: %w", err)
+	}
+	patch, err := sigsyaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the pod template of the restlerwrapper: %w", err)
+	}
+	// catches fields with the wrong type, the patch is applied when a job is created
+	if err := json.Unmarshal(patch, &v1.PodTemplateSpec{}); err != nil {
+		return nil, fmt.Errorf("pod template of the restlerwrapper isn't a valid PodTemplateSpec: %w", err)
+	}
+	return patch, nil
 }
 
 type RestlerConfig struct {
@@ -79,11 +118,550 @@ type RestlerConfig struct {
 type RedisConfig struct {
 	HostName string `yaml:"host_name"`
 	Port     string `yaml:"port"`
+	// Username ACL user, the default user when empty
+	Username string `yaml:"username"`
+	// PasswordEnv environment variable with the password of the user, no password when empty
+	PasswordEnv string `yaml:"password_env"`
+	// DB database index, only database 0 exists in cluster mode
+	DB int `yaml:"db"`
+	// KeyPrefix prefix of every key, so several installs of cnfuzz can share one Redis
+	KeyPrefix string               `yaml:"key_prefix"`
+	Tls       *RedisTlsConfig      `yaml:"tls"`
+	Sentinel  *RedisSentinelConfig `yaml:"sentinel"`
+	Cluster   *RedisClusterConfig  `yaml:"cluster"`
+	Pool      *RedisPoolConfig     `yaml:"pool"`
+	// ConnectTimeout how long the controller waits at startup until Redis can be reached, defaults to DefaultRedisConnectTimeout
+	ConnectTimeout string `yaml:"connect_timeout"`
+}
+
+// RedisTlsConfig TLS of the connections to Redis
+type RedisTlsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// CaFile PEM bundle with the CAs of the server certificate, the CAs of the system when empty
+	CaFile string `yaml:"ca_file"`
+	// CertFile and KeyFile PEM client certificate and key for mutual TLS
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// RedisSentinelConfig Sentinel setup of Redis, the master is looked up through the sentinels
+type RedisSentinelConfig struct {
+	MasterName string `yaml:"master_name"`
+	// Addresses sentinel addresses in the format host:port
+	Addresses []string `yaml:"addresses"`
+	Username  string   `yaml:"username"`
+	// PasswordEnv environment variable with the password of the sentinels
+	PasswordEnv string `yaml:"password_env"`
+}
+
+// RedisClusterConfig Redis Cluster, the keys of cnfuzz are kept inside one hash slot
+type RedisClusterConfig struct {
+	// Addresses addresses of cluster nodes in the format host:port, the other nodes are discovered
+	Addresses []string `yaml:"addresses"`
+}
+
+// RedisPoolConfig connection pool of the Redis client, the defaults of the client are used for empty values
+type RedisPoolConfig struct {
+	Size         int    `yaml:"size"`
+	MinIdle      int    `yaml:"min_idle"`
+	MaxRetries   int    `yaml:"max_retries"`
+	DialTimeout  string `yaml:"dial_timeout"`
+	ReadTimeout  string `yaml:"read_timeout"`
+	WriteTimeout string `yaml:"write_timeout"`
+	// Timeout how long a command waits for a connection when all connections are busy
+	Timeout string `yaml:"timeout"`
+}
+
+// DefaultRedisConnectTimeout time the controller waits at startup until Redis can be reached
+const DefaultRedisConnectTimeout = 30 * time.Second
+
+// Address returns the address of the Redis instance in the format host:port
+func (cnf RedisConfig) Address() string {
+	if len(cnf.Port) > 0 {
+		return fmt.Sprintf("%s:%s", cnf.HostName, cnf.Port)
+	}
+	return cnf.HostName
+}
+
+// GetConnectTimeout returns the parsed connect timeout, DefaultRedisConnectTimeout when it isn't set
+func (cnf RedisConfig) GetConnectTimeout() (time.Duration, error) {
+	return parseRedisDuration("connect_timeout", cnf.ConnectTimeout, DefaultRedisConnectTimeout)
+}
+
+// Validate checks that at most one of sentinel and cluster is configured and that the durations can be parsed
+func (cnf RedisConfig) Validate() error {
+	if cnf.Sentinel != nil && cnf.Cluster != nil {
+		return fmt.Errorf("redis can't use sentinel and cluster at the same time")
+	}
+	if cnf.Sentinel != nil && (len(cnf.Sentinel.MasterName) == 0 || len(cnf.Sentinel.Addresses) == 0) {
+		return fmt.Errorf("redis sentinel needs a master_name and addresses")
+	}
+	if cnf.Cluster != nil {
+		if len(cnf.Cluster.Addresses) == 0 {
+			return fmt.Errorf("redis cluster needs addresses")
+		}
+		if cnf.DB != 0 {
+			return fmt.Errorf("redis cluster only supports db 0")
+		}
+	}
+	if cnf.Sentinel == nil && cnf.Cluster == nil && len(cnf.HostName) == 0 {
+		return fmt.Errorf("redis needs a host_name")
+	}
+	if cnf.DB < 0 {
+		return fmt.Errorf("redis db %d can't be negative", cnf.DB)
+	}
+	if _, err := cnf.GetConnectTimeout(); err != nil {
+		return err
+	}
+	if cnf.Pool != nil {
+		if _, err := cnf.Pool.GetTimeouts(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTimeouts returns the parsed dial, read, write and pool timeouts, 0 for timeouts that aren't set
+func (cnf RedisPoolConfig) GetTimeouts() (timeouts [4]time.Duration, err error) {
+	for i, timeout := range [][2]string{{"dial_timeout", cnf.DialTimeout}, {"read_timeout", cnf.ReadTimeout}, {"write_timeout", cnf.WriteTimeout}, {"timeout", cnf.Timeout}} {
+		if timeouts[i], err = parseRedisDuration("pool "+timeout[0], timeout[1], 0); err != nil {
+			return timeouts, err
+		}
+	}
+	return timeouts, nil
+}
+
+// parseRedisDuration parses a duration of the redis config, the default is returned when it isn't set
+func parseRedisDuration(name string, value string, defaultValue time.Duration) (time.Duration, error) {
+	if len(value) == 0 {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("redis %s '%s' should be a duration like 5s", name, value)
+	}
+	return duration, nil
+}
+
+// PostgresConfig connection to the PostgreSQL database of the postgres cache solution
+type PostgresConfig struct {
+	HostName string `yaml:"host_name"`
+	Port     string `yaml:"port"`
+	Database string `yaml:"database"`
+	Username string `yaml:"username"`
+	// PasswordEnv environment variable with the password of the user
+	PasswordEnv string `yaml:"password_env"`
+	// SslMode sslmode of the connection (disable, require, verify-ca or verify-full), the driver defaults to require
+	SslMode string `yaml:"ssl_mode"`
+}
+
+// KubernetesConfig ConfigMaps of the kubernetes cache solution
+type KubernetesConfig struct {
+	// Namespace namespace of the ConfigMaps, defaults to the namespace of the controller
+	Namespace string `yaml:"namespace"`
+}
+
+// FileConfig directory of the file cache solution, a snapshot of all records and a write-ahead log with the changes since the snapshot
+type FileConfig struct {
+	// Path directory of the files, e.g. the mount path of a persistent volume
+	Path string `yaml:"path"`
+	// CompactAfter number of changes after which the write-ahead log is written to the snapshot, defaults to 1000
+	CompactAfter int `yaml:"compact_after"`
 }
 
 type AuthConfig struct {
 	Username string `yaml:"username"`
 	Secret   string `yaml:"secret"`
+	// PreferredScheme key of the security scheme to use when an endpoint accepts multiple schemes
+	PreferredScheme string `yaml:"preferred_scheme"`
+	// Jwt mint JWTs locally instead of getting tokens from an identity provider
+	Jwt *JwtConfig `yaml:"jwt"`
+}
+
+type JwtConfig struct {
+	Algorithm string `yaml:"algorithm"`
+	KeyId     string `yaml:"key_id"`
+	// Claims JSON claims template
+	Claims   string `yaml:"claims"`
+	Lifetime string `yaml:"lifetime"`
+	// KeySecret Kubernetes secret that holds the signing key
+	KeySecret *SecretKeyRef `yaml:"key_secret"`
+}
+
+// SecretKeyRef reference to a key inside a Kubernetes secret
+type SecretKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// Notifier types
+const (
+	WebhookNotifier = "webhook"
+	SlackNotifier   = "slack"
+	TeamsNotifier   = "teams"
+)
+
+// Moments to notify on
+const (
+	// NotifyOnCompleted notify when a fuzz run is completed
+	NotifyOnCompleted = "completed"
+	// NotifyOnNewFindings notify when a fuzz run found new findings
+	NotifyOnNewFindings = "new_findings"
+)
+
+// NotifierConfig configuration of a notifier that posts a message when a fuzz run is completed
+type NotifierConfig struct {
+	Name string `yaml:"name"`
+	// Type webhook, slack or teams
+	Type string `yaml:"type"`
+	Url  string `yaml:"url"`
+	// UrlEnv environment variable that holds the url, so secret urls don't have to be inside the config
+	UrlEnv  string            `yaml:"url_env"`
+	Headers map[string]string `yaml:"headers"`
+	// On completed or new_findings (default)
+	On string `yaml:"on"`
+	// Namespaces only notify about fuzz runs inside these namespaces, all namespaces when empty
+	Namespaces []string `yaml:"namespaces"`
+	// Template Go template of the message
+	Template string `yaml:"template"`
+}
+
+// Validate validates a NotifierConfig
+func (cnf NotifierConfig) Validate() error {
+	switch cnf.Type {
+	case WebhookNotifier, SlackNotifier, TeamsNotifier:
+	default:
+		return fmt.Errorf("notifier '%s' has unknown type '%s', expected %s, %s or %s", cnf.Name, cnf.Type, WebhookNotifier, SlackNotifier, TeamsNotifier)
+	}
+	switch cnf.On {
+	case "", NotifyOnCompleted, NotifyOnNewFindings:
+	default:
+		return fmt.Errorf("notifier '%s' has unknown 'on' value '%s', expected %s or %s", cnf.Name, cnf.On, NotifyOnCompleted, NotifyOnNewFindings)
+	}
+	if len(cnf.Url) == 0 && len(cnf.UrlEnv) == 0 {
+		return fmt.Errorf("notifier '%s' has no url", cnf.Name)
+	}
+	return nil
+}
+
+// IssuesConfig configuration of the issue trackers that get an issue for every finding
+type IssuesConfig struct {
+	// Labels labels of the created issues
+	Labels []string            `yaml:"labels"`
+	Github *IssueTrackerConfig `yaml:"github"`
+	Gitlab *IssueTrackerConfig `yaml:"gitlab"`
+}
+
+// IssueTrackerConfig configuration of a GitHub or GitLab instance
+type IssueTrackerConfig struct {
+	// Host host of the repositories, github.com or gitlab.com when empty
+	Host string `yaml:"host"`
+	// ApiUrl url of the API, derived from the host when empty
+	ApiUrl string `yaml:"api_url"`
+	// TokenEnv environment variable that holds the access token
+	TokenEnv string `yaml:"token_env"`
+}
+
+const (
+	// SpecChangesFull fuzz all operations again when the OpenAPI spec of a fuzzed image changes
+	SpecChangesFull = "full"
+	// SpecChangesChanged only fuzz the new and changed operations when the OpenAPI spec of a fuzzed image changes
+	SpecChangesChanged = "changed"
+	// DefaultSpecCheckInterval default minimum time between two checks of the OpenAPI spec of a fuzzed image
+	DefaultSpecCheckInterval = time.Hour
+)
+
+// RefuzzConfig when fuzzed images are fuzzed again
+type RefuzzConfig struct {
+	// Schedule cron expression, all fuzzed images are fuzzed again at every scheduled time
+	Schedule string `yaml:"schedule"`
+	// Ttl duration after the last fuzz run of an image after which the image is fuzzed again, e.g. 168h
+	Ttl string `yaml:"ttl"`
+	// SpecChanges fuzz images again when the OpenAPI spec they serve changes, either SpecChangesFull or SpecChangesChanged
+	// changes aren't detected when empty
+	SpecChanges string `yaml:"spec_changes"`
+	// SpecCheckInterval minimum time between two checks of the OpenAPI spec of a fuzzed image, e.g. 30m
+	SpecCheckInterval string `yaml:"spec_check_interval"`
+}
+
+// Validate checks the schedule and the TTL
+func (cnf RefuzzConfig) Validate() error {
+	if len(cnf.Schedule) > 0 {
+		if _, err := schedule.ParseCron(cnf.Schedule); err != nil {
+			return fmt.Errorf("invalid refuzz schedule: %w", err)
+		}
+	}
+	if _, err := cnf.GetTtl(); err != nil {
+		return err
+	}
+	if len(cnf.SpecChanges) > 0 && cnf.SpecChanges != SpecChangesFull && cnf.SpecChanges != SpecChangesChanged {
+		return fmt.Errorf("refuzz spec_changes '%s' should be '%s' or '%s'", cnf.SpecChanges, SpecChangesFull, SpecChangesChanged)
+	}
+	if _, err := cnf.GetSpecCheckInterval(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetSpecCheckInterval returns the parsed spec check interval, DefaultSpecCheckInterval when it isn't set
+func (cnf RefuzzConfig) GetSpecCheckInterval() (time.Duration, error) {
+	if len(cnf.SpecCheckInterval) == 0 {
+		return DefaultSpecCheckInterval, nil
+	}
+	interval, err := time.ParseDuration(cnf.SpecCheckInterval)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("refuzz spec_check_interval '%s' should be a duration like 30m", cnf.SpecCheckInterval)
+	}
+	return interval, nil
+}
+
+// GetTtl returns the parsed TTL, 0 when there is no TTL
+func (cnf RefuzzConfig) GetTtl() (time.Duration, error) {
+	if len(cnf.Ttl) == 0 {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(cnf.Ttl)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("refuzz ttl '%s' should be a positive duration like 168h", cnf.Ttl)
+	}
+	return ttl, nil
+}
+
+// RecoveryConfig recovery of images that stay "being fuzzed" because the controller or their fuzz job died
+type RecoveryConfig struct {
+	// Interval time between the recovery passes after the pass at startup, defaults to DefaultRecoveryInterval, 0 only recovers at startup
+	Interval string `yaml:"interval"`
+}
+
+// DefaultRecoveryInterval time between the recovery passes of images that are being fuzzed
+const DefaultRecoveryInterval = 10 * time.Minute
+
+// GetInterval returns the parsed interval, DefaultRecoveryInterval when the config or the interval isn't set
+func (cnf *RecoveryConfig) GetInterval() (time.Duration, error) {
+	if cnf == nil || len(cnf.Interval) == 0 {
+		return DefaultRecoveryInterval, nil
+	}
+	interval, err := time.ParseDuration(cnf.Interval)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("recovery interval '%s' should be a duration like 10m", cnf.Interval)
+	}
+	return interval, nil
+}
+
+// JobConfig lifecycle of the fuzz jobs
+type JobConfig struct {
+	// BackoffLimit number of times a failed fuzz job is retried, the default of Kubernetes when not set
+	BackoffLimit *int32 `yaml:"backoff_limit"`
+	// TtlAfterFinished time Kubernetes keeps a finished fuzz job, finished jobs are only removed by the retention when empty
+	TtlAfterFinished string `yaml:"ttl_after_finished"`
+	// DeadlineMargin time a fuzz job gets on top of its time budget before it is stopped, defaults to DefaultJobDeadlineMargin
+	DeadlineMargin string `yaml:"deadline_margin"`
+	// Retention finished fuzz runs and fuzz jobs that are kept
+	Retention *JobRetentionConfig `yaml:"retention"`
+	// Namespace dedicated namespace for all fuzz jobs, the jobs run in the namespace of their target when not set
+	Namespace *JobNamespaceConfig `yaml:"namespace"`
+}
+
+// JobNamespaceConfig dedicated namespace the fuzz jobs run in, the controller creates and prepares it
+type JobNamespaceConfig struct {
+	Name string `yaml:"name"`
+	// ClusterRole cluster role that the service account of the fuzz jobs is bound to, so the jobs can read their target pods and update their fuzz runs
+	ClusterRole string `yaml:"cluster_role"`
+	// ConfigMaps names of ConfigMaps in the namespace of the controller that the fuzz jobs need, they are copied into the namespace
+	ConfigMaps []string `yaml:"config_maps"`
+	// NetworkPolicies allow traffic from the fuzz jobs to targets that only accept traffic allowed by a NetworkPolicy
+	NetworkPolicies bool `yaml:"network_policies"`
+}
+
+// GetNamespace returns the name of the dedicated namespace for the fuzz jobs, empty when the jobs run in the namespace of their target
+func (cnf *JobConfig) GetNamespace() string {
+	if cnf == nil || cnf.Namespace == nil {
+		return ""
+	}
+	return cnf.Namespace.Name
+}
+
+// JobRetentionConfig retention of finished fuzz runs and fuzz jobs, runs and jobs outside the retention are removed by the controller
+type JobRetentionConfig struct {
+	// Keep number of finished fuzz runs and fuzz jobs that are kept per namespace, all are kept when 0
+	Keep int `yaml:"keep"`
+	// MaxAge finished fuzz runs and fuzz jobs that finished longer ago are removed, they are kept regardless of their age when empty
+	MaxAge string `yaml:"max_age"`
+	// Interval time between the removals, defaults to DefaultJobRetentionInterval
+	Interval string `yaml:"interval"`
+}
+
+const (
+	// DefaultJobDeadlineMargin time for compiling the RESTler grammar and reporting the results on top of the time budget
+	DefaultJobDeadlineMargin = 30 * time.Minute
+	// DefaultJobRetentionInterval time between the removals of finished fuzz jobs
+	DefaultJobRetentionInterval = 10 * time.Minute
+)
+
+// GetTtlAfterFinished returns the ttl in seconds, nil when the config or the ttl isn't set
+func (cnf *JobConfig) GetTtlAfterFinished() (*int32, error) {
+	if cnf == nil || len(cnf.TtlAfterFinished) == 0 {
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(cnf.TtlAfterFinished)
+	if err != nil || ttl < 0 {
+		return nil, fmt.Errorf("job ttl_after_finished '%s' should be a duration like 24h", cnf.TtlAfterFinished)
+	}
+	seconds := int32(ttl.Seconds())
+	return &seconds, nil
+}
+
+// GetDeadlineMargin returns the parsed deadline margin, DefaultJobDeadlineMargin when the config or the margin isn't set
+func (cnf *JobConfig) GetDeadlineMargin() (time.Duration, error) {
+	if cnf == nil || len(cnf.DeadlineMargin) == 0 {
+		return DefaultJobDeadlineMargin, nil
+	}
+	margin, err := time.ParseDuration(cnf.DeadlineMargin)
+	if err != nil || margin < 0 {
+		return 0, fmt.Errorf("job deadline_margin '%s' should be a duration like 30m", cnf.DeadlineMargin)
+	}
+	return margin, nil
+}
+
+// Validate checks the durations and the backoff limit
+func (cnf *JobConfig) Validate() error {
+	if cnf == nil {
+		return nil
+	}
+	if cnf.BackoffLimit != nil && *cnf.BackoffLimit < 0 {
+		return fmt.Errorf("job backoff_limit %d can't be negative", *cnf.BackoffLimit)
+	}
+	if _, err := cnf.GetTtlAfterFinished(); err != nil {
+		return err
+	}
+	if _, err := cnf.GetDeadlineMargin(); err != nil {
+		return err
+	}
+	if cnf.Namespace != nil && len(cnf.Namespace.Name) == 0 {
+		return fmt.Errorf("job namespace needs a name")
+	}
+	if cnf.Retention == nil {
+		return nil
+	}
+	if cnf.Retention.Keep < 0 {
+		return fmt.Errorf("job retention keep %d can't be negative", cnf.Retention.Keep)
+	}
+	if _, err := cnf.Retention.GetMaxAge(); err != nil {
+		return err
+	}
+	_, err := cnf.Retention.GetInterval()
+	return err
+}
+
+// GetMaxAge returns the parsed max age, 0 when it isn't set
+func (cnf JobRetentionConfig) GetMaxAge() (time.Duration, error) {
+	if len(cnf.MaxAge) == 0 {
+		return 0, nil
+	}
+	maxAge, err := time.ParseDuration(cnf.MaxAge)
+	if err != nil || maxAge < 0 {
+		return 0, fmt.Errorf("job retention max_age '%s' should be a duration like 168h", cnf.MaxAge)
+	}
+	return maxAge, nil
+}
+
+// GetInterval returns the parsed interval, DefaultJobRetentionInterval when it isn't set
+func (cnf JobRetentionConfig) GetInterval() (time.Duration, error) {
+	if len(cnf.Interval) == 0 {
+		return DefaultJobRetentionInterval, nil
+	}
+	interval, err := time.ParseDuration(cnf.Interval)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("job retention interval '%s' should be a positive duration like 10m", cnf.Interval)
+	}
+	return interval, nil
+}
+
+// SandboxConfig fuzzing a copy of a workload inside an ephemeral namespace instead of the live pod,
+// workloads opt in with the sandbox annotation
+type SandboxConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// NamespacePrefix prefix of the names of the sandbox namespaces, defaults to DefaultSandboxNamespacePrefix
+	NamespacePrefix string `yaml:"namespace_prefix"`
+	// ReadyTimeout time the copy of the workload gets to become ready, defaults to DefaultSandboxReadyTimeout
+	ReadyTimeout string `yaml:"ready_timeout"`
+}
+
+const (
+	DefaultSandboxNamespacePrefix = "cnfuzz-sandbox-"
+	DefaultSandboxReadyTimeout    = 5 * time.Minute
+)
+
+// IsEnabled returns whether workloads can be fuzzed inside a sandbox
+func (cnf *SandboxConfig) IsEnabled() bool {
+	return cnf != nil && cnf.Enabled
+}
+
+// GetNamespacePrefix returns the prefix of the sandbox namespaces, DefaultSandboxNamespacePrefix when it isn't set
+func (cnf *SandboxConfig) GetNamespacePrefix() string {
+	if cnf == nil || len(cnf.NamespacePrefix) == 0 {
+		return DefaultSandboxNamespacePrefix
+	}
+	return cnf.NamespacePrefix
+}
+
+// GetReadyTimeout returns the parsed ready timeout, DefaultSandboxReadyTimeout when the config or the timeout isn't set
+func (cnf *SandboxConfig) GetReadyTimeout() (time.Duration, error) {
+	if cnf == nil || len(cnf.ReadyTimeout) == 0 {
+		return DefaultSandboxReadyTimeout, nil
+	}
+	timeout, err := time.ParseDuration(cnf.ReadyTimeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("sandbox ready_timeout '%s' should be a positive duration like 5m", cnf.ReadyTimeout)
+	}
+	return timeout, nil
+}
+
+// DifferentialConfig configuration for fuzzing the operations that changed since the previous fuzz run of a workload
+type DifferentialConfig struct {
+	// Enabled only fuzz the new and changed operations when the spec of a new image differs from the previous run
+	Enabled bool `yaml:"enabled"`
+	// TimeBudget time budget in hours of differential runs, the time budget of the RESTler config is used when empty
+	TimeBudget string `yaml:"time_budget"`
+}
+
+// Validate checks the time budget
+func (cnf DifferentialConfig) Validate() error {
+	if len(cnf.TimeBudget) == 0 {
+		return nil
+	}
+	if budget, err := strconv.ParseFloat(cnf.TimeBudget, 64); err != nil || budget <= 0 {
+		return fmt.Errorf("differential time_budget '%s' should be a positive number of hours", cnf.TimeBudget)
+	}
+	return nil
+}
+
+// ApiConfig configuration of the REST API and web UI of the controller
+type ApiConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Address address the API listens on, defaults to :8081
+	Address string `yaml:"address"`
+	// Auth credentials clients of the API have to use, the API is open when empty
+	Auth *ApiAuthConfig `yaml:"auth"`
+}
+
+// ApiAuthConfig authentication of the API, with basic auth, a bearer token and/or JWTs
+type ApiAuthConfig struct {
+	// Username username for basic auth, SecretEnv then holds the password
+	Username string `yaml:"username"`
+	// SecretEnv environment variable that holds the basic auth password, or the bearer token when there is no username
+	SecretEnv string `yaml:"secret_env"`
+	// Jwt accept JWTs signed with a key
+	Jwt *ApiJwtConfig `yaml:"jwt"`
+}
+
+// ApiJwtConfig JWTs accepted by the API
+type ApiJwtConfig struct {
+	Algorithm string `yaml:"algorithm"`
+	// KeyEnv environment variable that holds the HMAC secret or PEM encoded (public) key
+	KeyEnv string `yaml:"key_env"`
 }
 
 type S3Config struct {
@@ -116,6 +694,38 @@ func LoadCnFuzzConfig(l logger.Logger, configFile string, printFile bool) (*CnFu
 		}
 		return nil, fmt.Errorf("given restler wrapper image is invalid, needs to match '%s'", imageRegex)
 	}
+	if err := config.RestlerWrapperConfig.JobConfig.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := config.RestlerWrapperConfig.GetPodTemplatePatch(); err != nil {
+		return nil, err
+	}
+	for _, notifier := range config.Notifications {
+		if err := notifier.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.RedisConfig != nil && config.CacheSolution == "redis" {
+		if err := config.RedisConfig.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.RefuzzConfig != nil {
+		if err := config.RefuzzConfig.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.DifferentialConfig != nil {
+		if err := config.DifferentialConfig.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := config.RecoveryConfig.GetInterval(); err != nil {
+		return nil, err
+	}
+	if _, err := config.SandboxConfig.GetReadyTimeout(); err != nil {
+		return nil, err
+	}
 
 	return config, nil
 }
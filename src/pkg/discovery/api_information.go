@@ -36,12 +36,16 @@ type WebApiDescription struct {
 	DiscoverySource string
 	// DiscoveryDoc literal URL of the discovery doc
 	DiscoveryDoc url.URL
+	// BasePath path that all endpoint paths are relative to, taken from the first server inside the doc
+	BasePath string
 	// Version API version
 	Version         string
 	Title           string
 	Description     string
 	Endpoints       []Endpoint
 	SecuritySchemes []SecuritySchema
+	// Security default security requirements for endpoints that don't specify their own
+	Security []SecurityRequirement
 }
 
 // Endpoint information about an endpoint inside an API.
@@ -55,6 +59,41 @@ type Endpoint struct {
 	Responses   []Response
 	Summary     string
 	Description string
+	// Security alternative security requirements for this endpoint, only one of them has to be satisfied.
+	// An empty slice means that the endpoint doesn't require any authentication.
+	Security []SecurityRequirement
+	// Login is set when the endpoint is marked as the login operation of the API
+	Login *LoginOperation
+}
+
+// LoginExtension OpenAPI extension that marks the login operation of an API.
+// The extension is either `true` or an object with LoginOperation settings.
+const LoginExtension = "x-cnfuzz-login"
+
+// LoginOperation settings for getting a token from the login operation of an API
+type LoginOperation struct {
+	// Body template of the request body, can use {{ .Username }} and {{ .Password }}
+	Body        string `json:"body"`
+	ContentType string `json:"content_type"`
+	// TokenPath JSONPath to the token inside the response body
+	TokenPath string `json:"token_path"`
+	// TokenRegex regex that matches the token inside the response body, the first capture group is used when there is one
+	TokenRegex string `json:"token_regex"`
+	// ExpiryPath JSONPath to the expiry of the token (seconds, unix timestamp or RFC 3339) inside the response body
+	ExpiryPath  string `json:"expiry_path"`
+	ExpiryRegex string `json:"expiry_regex"`
+	// TokenType prefix of the token inside the Authorization header, 'raw' sends the token without prefix
+	TokenType string `json:"token_type"`
+}
+
+// LoginEndpoint returns the endpoint that is marked as login operation, nil when there is none
+func (d *WebApiDescription) LoginEndpoint() *Endpoint {
+	for i := range d.Endpoints {
+		if d.Endpoints[i].Login != nil {
+			return &d.Endpoints[i]
+		}
+	}
+	return nil
 }
 
 // Body for a http request
@@ -113,12 +152,18 @@ type SecuritySchema struct {
 	Description      string
 	Name             string
 	In               string
+	Scheme           string // basic, bearer, etc. only used by the http type
 	BearerFormat     string
 	OpenIdConnectUrl string
 	Flows            []OAuthFlow
-	// Scheme string?
 }
 
+// SecurityRequirement maps security scheme keys to the scopes that are required for those schemes.
+// Every scheme inside a single requirement has to be satisfied, an empty requirement means anonymous access is allowed.
+//
+// https://github.com/OAI/OpenAPI-Specification/blob/main/versions/3.0.3.md#security-requirement-object
+type SecurityRequirement map[string][]string
+
 // OAuthFlow configuration for a OAuth flow.
 //
 // https://github.com/OAI/OpenAPI-Specification/blob/main/versions/3.0.3.md#oauthFlowsObject
@@ -137,8 +182,11 @@ const (
 	ClientCredentials = "OAuth2ClientCredentials"
 
 	BasicSecSchemaType  = "http"
+	BearerHttpScheme    = "bearer"
 	ApiKeySecSchemaType = "apiKey"
 	OAuth2SecSchemaType = "oauth2"
+	// OpenIdConnectSecSchemaType https://openid.net/specs/openid-connect-discovery-1_0.html
+	OpenIdConnectSecSchemaType = "openIdConnect"
 )
 
 /* type SecuritySchemeReference struct {
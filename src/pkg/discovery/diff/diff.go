@@ -0,0 +1,320 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diff
+
+import (
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// ChangeType whether something was added, removed or changed
+type ChangeType string
+
+const (
+	Added   ChangeType = "added"
+	Removed ChangeType = "removed"
+	Changed ChangeType = "changed"
+)
+
+// Kind part of the spec that changed
+type Kind string
+
+const (
+	BasePathKind    Kind = "base_path"
+	OperationKind   Kind = "operation"
+	ParameterKind   Kind = "parameter"
+	RequestBodyKind Kind = "request_body"
+	ResponseKind    Kind = "response"
+	SchemaKind      Kind = "schema"
+	SecurityKind    Kind = "security"
+)
+
+// Change a single change between two versions of a spec
+type Change struct {
+	// Operation in the format <METHOD> <path>, empty for changes of the whole API
+	Operation string     `json:"operation,omitempty"`
+	Kind      Kind       `json:"kind"`
+	Type      ChangeType `json:"type"`
+	// Name of the changed parameter, content type, response code or schema property path
+	Name string `json:"name,omitempty"`
+	// Breaking whether clients of the old version can break because of the change
+	Breaking bool   `json:"breaking"`
+	Message  string `json:"message"`
+}
+
+// Diff differences between two versions of a spec
+type Diff struct {
+	// Added operations that only exist in the new version
+	Added []string `json:"added,omitempty"`
+	// Removed operations that only exist in the old version
+	Removed []string `json:"removed,omitempty"`
+	// Changed operations that exist in both versions, but differ
+	Changed []string `json:"changed,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// IsEmpty checks if there are no differences
+func (d Diff) IsEmpty() bool {
+	return len(d.Changes) == 0
+}
+
+// Operations returns the added and changed operations, these are the operations worth fuzzing
+// returns nil when the base path changed, because then every operation changed
+func (d Diff) Operations() []string {
+	for _, change := range d.Changes {
+		if change.Kind == BasePathKind {
+			return nil
+		}
+	}
+	operations := append(append([]string(nil), d.Added...), d.Changed...)
+	sort.Strings(operations)
+	return operations
+}
+
+// Breaking returns the breaking changes
+func (d Diff) Breaking() []Change {
+	var breaking []Change
+	for _, change := range d.Changes {
+		if change.Breaking {
+			breaking = append(breaking, change)
+		}
+	}
+	return breaking
+}
+
+// Compare finds the added, removed and changed operations, parameters, request bodies, responses and schemas between two versions of a spec
+func Compare(old *discovery.WebApiDescription, new *discovery.WebApiDescription) Diff {
+	d := &Diff{}
+	if old.BasePath != new.BasePath {
+		d.add(Change{Kind: BasePathKind, Type: Changed, Name: new.BasePath, Breaking: true,
+			Message: fmt.Sprintf("base path changed from '%s' to '%s'", old.BasePath, new.BasePath)})
+	}
+
+	oldEndpoints := endpointsByKey(old)
+	newEndpoints := endpointsByKey(new)
+	for _, key := range sortedKeys(newEndpoints) {
+		newEndpoint := newEndpoints[key]
+		oldEndpoint, found := oldEndpoints[key]
+		if !found {
+			d.Added = append(d.Added, key)
+			d.add(Change{Operation: key, Kind: OperationKind, Type: Added, Message: "operation added"})
+			continue
+		}
+		before := len(d.Changes)
+		d.compareEndpoints(key, oldEndpoint, newEndpoint)
+		if len(d.Changes) > before {
+			d.Changed = append(d.Changed, key)
+		}
+	}
+	for _, key := range sortedKeys(oldEndpoints) {
+		if _, found := newEndpoints[key]; !found {
+			d.Removed = append(d.Removed, key)
+			d.add(Change{Operation: key, Kind: OperationKind, Type: Removed, Breaking: true, Message: "operation removed"})
+		}
+	}
+	return *d
+}
+
+func (d *Diff) add(change Change) {
+	d.Changes = append(d.Changes, change)
+}
+
+func (d *Diff) compareEndpoints(operation string, old discovery.Endpoint, new discovery.Endpoint) {
+	// parameters
+	oldParams := parametersByKey(old.Parameters)
+	newParams := parametersByKey(new.Parameters)
+	for _, key := range sortedKeys(newParams) {
+		newParam := newParams[key]
+		oldParam, found := oldParams[key]
+		if !found {
+			d.add(Change{Operation: operation, Kind: ParameterKind, Type: Added, Name: key, Breaking: newParam.Required,
+				Message: fmt.Sprintf("%s parameter added", requiredText(newParam.Required))})
+			continue
+		}
+		if !oldParam.Required && newParam.Required {
+			d.add(Change{Operation: operation, Kind: ParameterKind, Type: Changed, Name: key, Breaking: true, Message: "parameter became required"})
+		} else if oldParam.Required && !newParam.Required {
+			d.add(Change{Operation: operation, Kind: ParameterKind, Type: Changed, Name: key, Message: "parameter became optional"})
+		}
+		d.compareSchemas(operation, key, oldParam.Schema, newParam.Schema, true)
+	}
+	for _, key := range sortedKeys(oldParams) {
+		if _, found := newParams[key]; !found {
+			d.add(Change{Operation: operation, Kind: ParameterKind, Type: Removed, Name: key, Breaking: true, Message: "parameter removed"})
+		}
+	}
+
+	// request body
+	if !old.Body.Required && new.Body.Required {
+		d.add(Change{Operation: operation, Kind: RequestBodyKind, Type: Changed, Breaking: true, Message: "request body became required"})
+	}
+	d.compareContent(operation, RequestBodyKind, "", old.Body.Content, new.Body.Content, true)
+
+	// responses
+	oldResponses := responsesByCode(old.Responses)
+	newResponses := responsesByCode(new.Responses)
+	for _, code := range sortedKeys(newResponses) {
+		oldResponse, found := oldResponses[code]
+		if !found {
+			d.add(Change{Operation: operation, Kind: ResponseKind, Type: Added, Name: code, Message: "response added"})
+			continue
+		}
+		d.compareContent(operation, ResponseKind, code+" ", oldResponse.Content, newResponses[code].Content, false)
+	}
+	for _, code := range sortedKeys(oldResponses) {
+		if _, found := newResponses[code]; !found {
+			// clients depend on the success responses
+			d.add(Change{Operation: operation, Kind: ResponseKind, Type: Removed, Name: code, Breaking: code[0] == '2', Message: "response removed"})
+		}
+	}
+
+	if !reflect.DeepEqual(normalizeSecurity(old.Security), normalizeSecurity(new.Security)) {
+		d.add(Change{Operation: operation, Kind: SecurityKind, Type: Changed, Breaking: true, Message: "security requirements changed"})
+	}
+}
+
+// compareContent compares the content types and their schemas of a request body or a response
+func (d *Diff) compareContent(operation string, kind Kind, prefix string, old []discovery.Content, new []discovery.Content, request bool) {
+	oldContent := contentByType(old)
+	newContent := contentByType(new)
+	for _, contentType := range sortedKeys(newContent) {
+		oldSchema, found := oldContent[contentType]
+		if !found {
+			d.add(Change{Operation: operation, Kind: kind, Type: Added, Name: prefix + contentType, Message: "content type added"})
+			continue
+		}
+		d.compareSchemas(operation, prefix+contentType, oldSchema, newContent[contentType], request)
+	}
+	for _, contentType := range sortedKeys(oldContent) {
+		if _, found := newContent[contentType]; !found {
+			d.add(Change{Operation: operation, Kind: kind, Type: Removed, Name: prefix + contentType, Breaking: true, Message: "content type removed"})
+		}
+	}
+}
+
+// compareSchemas compares two schemas and their properties, request schemas break when they accept less and response schemas when they return something else
+func (d *Diff) compareSchemas(operation string, path string, old discovery.Schema, new discovery.Schema, request bool) {
+	if old.Type != new.Type || old.Format != new.Format {
+		d.add(Change{Operation: operation, Kind: SchemaKind, Type: Changed, Name: path, Breaking: true,
+			Message: fmt.Sprintf("type changed from '%s' to '%s'", typeText(old), typeText(new))})
+	}
+	if old.Nullable != new.Nullable {
+		// requests break when null isn't accepted anymore, responses break when they can suddenly be null
+		breaking := request && old.Nullable || !request && new.Nullable
+		d.add(Change{Operation: operation, Kind: SchemaKind, Type: Changed, Name: path, Breaking: breaking,
+			Message: fmt.Sprintf("nullable changed from %t to %t", old.Nullable, new.Nullable)})
+	}
+
+	oldProps := propertiesByKey(old.Properties)
+	newProps := propertiesByKey(new.Properties)
+	for _, key := range sortedKeys(newProps) {
+		oldProp, found := oldProps[key]
+		if !found {
+			d.add(Change{Operation: operation, Kind: SchemaKind, Type: Added, Name: path + "." + key, Message: "property added"})
+			continue
+		}
+		d.compareSchemas(operation, path+"."+key, oldProp, newProps[key], request)
+	}
+	for _, key := range sortedKeys(oldProps) {
+		if _, found := newProps[key]; !found {
+			// clients can still send the property, but can't read it anymore
+			d.add(Change{Operation: operation, Kind: SchemaKind, Type: Removed, Name: path + "." + key, Breaking: !request, Message: "property removed"})
+		}
+	}
+}
+
+func endpointsByKey(desc *discovery.WebApiDescription) map[string]discovery.Endpoint {
+	endpoints := make(map[string]discovery.Endpoint, len(desc.Endpoints))
+	for _, endpoint := range desc.Endpoints {
+		endpoints[endpoint.Key()] = endpoint
+	}
+	return endpoints
+}
+
+// parametersByKey maps the parameters by their location and name in the format <in>:<name>
+func parametersByKey(params []discovery.Parameter) map[string]discovery.Parameter {
+	byKey := make(map[string]discovery.Parameter, len(params))
+	for _, param := range params {
+		byKey[param.In+":"+param.Name] = param
+	}
+	return byKey
+}
+
+func responsesByCode(responses []discovery.Response) map[string]discovery.Response {
+	byCode := make(map[string]discovery.Response, len(responses))
+	for _, response := range responses {
+		byCode[strconv.Itoa(response.Code)] = response
+	}
+	return byCode
+}
+
+func contentByType(contents []discovery.Content) map[string]discovery.Schema {
+	byType := make(map[string]discovery.Schema, len(contents))
+	for _, content := range contents {
+		byType[content.ContentType] = content.Schema
+	}
+	return byType
+}
+
+func propertiesByKey(props []discovery.Schema) map[string]discovery.Schema {
+	byKey := make(map[string]discovery.Schema, len(props))
+	for _, prop := range props {
+		byKey[prop.Key] = prop
+	}
+	return byKey
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeSecurity sorts the scopes of the requirements, so only real changes are detected
+func normalizeSecurity(requirements []discovery.SecurityRequirement) []discovery.SecurityRequirement {
+	normalized := make([]discovery.SecurityRequirement, 0, len(requirements))
+	for _, requirement := range requirements {
+		sorted := discovery.SecurityRequirement{}
+		for scheme, scopes := range requirement {
+			scopes = append([]string{}, scopes...)
+			sort.Strings(scopes)
+			sorted[scheme] = scopes
+		}
+		normalized = append(normalized, sorted)
+	}
+	return normalized
+}
+
+func requiredText(required bool) string {
+	if required {
+		return "required"
+	}
+	return "optional"
+}
+
+func typeText(schema discovery.Schema) string {
+	if len(schema.Format) > 0 {
+		return schema.Type + "/" + schema.Format
+	}
+	return schema.Type
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"testing"
+)
+
+func todoSchema(props ...discovery.Schema) discovery.Schema {
+	return discovery.Schema{Type: "object", Properties: props}
+}
+
+func createOldDescription() *discovery.WebApiDescription {
+	return &discovery.WebApiDescription{
+		BasePath: "/api",
+		Endpoints: []discovery.Endpoint{
+			{Method: "GET", Path: "/todos", Parameters: []discovery.Parameter{{Name: "limit", In: "query"}},
+				Responses: []discovery.Response{{Code: 200, Content: []discovery.Content{{ContentType: "application/json",
+					Schema: todoSchema(discovery.Schema{Key: "id", Type: "integer"}, discovery.Schema{Key: "title", Type: "string"})}}}}},
+			{Method: "POST", Path: "/todos", Body: discovery.Body{Content: []discovery.Content{{ContentType: "application/json", Schema: todoSchema(discovery.Schema{Key: "title", Type: "string"})}}},
+				Responses: []discovery.Response{{Code: 201}}},
+			{Method: "DELETE", Path: "/todos/{id}", Responses: []discovery.Response{{Code: 204}}},
+		},
+	}
+}
+
+func TestCompareWithoutChanges(t *testing.T) {
+	d := Compare(createOldDescription(), createOldDescription())
+	assert.True(t, d.IsEmpty())
+	assert.Empty(t, d.Operations())
+}
+
+func TestCompare(t *testing.T) {
+	old := createOldDescription()
+	new := createOldDescription()
+	// GET /todos: limit becomes required, a response property is removed and one is added
+	new.Endpoints[0].Parameters[0].Required = true
+	new.Endpoints[0].Parameters = append(new.Endpoints[0].Parameters, discovery.Parameter{Name: "offset", In: "query"})
+	new.Endpoints[0].Responses[0].Content[0].Schema = todoSchema(discovery.Schema{Key: "id", Type: "string"}, discovery.Schema{Key: "done", Type: "boolean"})
+	// POST /todos: request property added
+	new.Endpoints[1].Body.Content[0].Schema = todoSchema(discovery.Schema{Key: "title", Type: "string"}, discovery.Schema{Key: "done", Type: "boolean"})
+	// DELETE /todos/{id} is removed and PUT /todos/{id} is added
+	new.Endpoints[2] = discovery.Endpoint{Method: "PUT", Path: "/todos/{id}"}
+
+	d := Compare(old, new)
+	assert.Equal(t, []string{"PUT /todos/{id}"}, d.Added)
+	assert.Equal(t, []string{"DELETE /todos/{id}"}, d.Removed)
+	assert.Equal(t, []string{"GET /todos", "POST /todos"}, d.Changed)
+	assert.Equal(t, []string{"GET /todos", "POST /todos", "PUT /todos/{id}"}, d.Operations())
+
+	var breaking []string
+	for _, change := range d.Breaking() {
+		breaking = append(breaking, change.Operation+" "+string(change.Kind)+" "+change.Name+": "+change.Message)
+	}
+	assert.Equal(t, []string{
+		"GET /todos parameter query:limit: parameter became required",
+		"GET /todos schema 200 application/json.id: type changed from 'integer' to 'string'",
+		"GET /todos schema 200 application/json.title: property removed",
+		"DELETE /todos/{id} operation : operation removed",
+	}, breaking)
+	assert.Contains(t, d.Changes, Change{Operation: "POST /todos", Kind: SchemaKind, Type: Added, Name: "application/json.done", Message: "property added"})
+	assert.Contains(t, d.Changes, Change{Operation: "GET /todos", Kind: ParameterKind, Type: Added, Name: "query:offset", Message: "optional parameter added"})
+}
+
+func TestCompareBasePathAndSecurity(t *testing.T) {
+	old := createOldDescription()
+	new := createOldDescription()
+	new.BasePath = "/v2"
+	new.Endpoints[0].Security = []discovery.SecurityRequirement{{"BearerAuth": {}}}
+
+	d := Compare(old, new)
+	assert.Equal(t, []string{"GET /todos"}, d.Changed)
+	assert.Nil(t, d.Operations(), "every operation changed with the base path")
+	breaking := d.Breaking()
+	if assert.Len(t, breaking, 2) {
+		assert.Equal(t, BasePathKind, breaking[0].Kind)
+		assert.Equal(t, SecurityKind, breaking[1].Kind)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/getkin/kin-openapi/openapi2"
 	conv "github.com/getkin/kin-openapi/openapi2conv"
@@ -64,6 +65,10 @@ func UnMarshalOpenApiDoc(l logger.Logger, docFile []byte, uri *url.URL) (UnParse
 		if err != nil {
 			return UnParsedOpenApiDoc{}, fmt.Errorf("error while trying to convert the OpenAPI v2 struct to a v3 struct: %w", err)
 		}
+		// the converter only keeps the base path when the doc has a host
+		if len(doc.Servers) == 0 && len(doc2.BasePath) > 0 {
+			doc.Servers = openapi3.Servers{{URL: doc2.BasePath}}
+		}
 	} else {
 		doc, err = openapi3.NewLoader().LoadFromDataWithPath(docFile, uri)
 		if err != nil {
@@ -94,6 +99,10 @@ func ParseOpenApiDoc(l logger.Logger, doc UnParsedOpenApiDoc) (*discovery.WebApi
 		desc.DiscoverySource = discovery.OpenApiV3Source
 	}
 	desc.DiscoveryDoc = *doc.Uri
+	desc.Security = transformSecurityRequirements(doc.DocFile.Security)
+	if len(doc.DocFile.Servers) > 0 {
+		desc.BasePath = getServerBasePath(doc.DocFile.Servers[0].URL)
+	}
 
 	// Endpoints
 	for strPath, pathObj := range doc.DocFile.Paths {
@@ -105,6 +114,22 @@ func ParseOpenApiDoc(l logger.Logger, doc UnParsedOpenApiDoc) (*discovery.WebApi
 				Summary:     operation.Summary,
 			}
 
+			// Operations without their own security requirements fall back on the requirements of the document
+			if operation.Security != nil {
+				endpoint.Security = transformSecurityRequirements(*operation.Security)
+			} else {
+				endpoint.Security = desc.Security
+			}
+
+			if loginExt, found := operation.Extensions[discovery.LoginExtension]; found {
+				login, err := transformLoginExtension(loginExt)
+				if err != nil {
+					l.V(logger.ImportantLevel).Error(err, "invalid login extension in the OpenAPI doc", "path", strPath, "method", method)
+				} else {
+					endpoint.Login = login
+				}
+			}
+
 			if operation.RequestBody != nil && operation.RequestBody.Value != nil {
 				endpoint.Body = transformBody(l, operation.RequestBody.Value)
 			}
@@ -152,7 +177,12 @@ func ParseOpenApiDoc(l logger.Logger, doc UnParsedOpenApiDoc) (*discovery.WebApi
 	}
 
 	// Security
-	for key, scheme := range doc.DocFile.Components.SecuritySchemes {
+	// docs without components don't have security schemes
+	var securitySchemes openapi3.SecuritySchemes
+	if doc.DocFile.Components != nil {
+		securitySchemes = doc.DocFile.Components.SecuritySchemes
+	}
+	for key, scheme := range securitySchemes {
 		schemeValue := scheme.Value
 		newSchema := discovery.SecuritySchema{
 			Key:              key,
@@ -160,6 +190,7 @@ func ParseOpenApiDoc(l logger.Logger, doc UnParsedOpenApiDoc) (*discovery.WebApi
 			Description:      schemeValue.Description,
 			Name:             schemeValue.Name,
 			In:               schemeValue.In,
+			Scheme:           schemeValue.Scheme,
 			BearerFormat:     schemeValue.BearerFormat,
 			OpenIdConnectUrl: schemeValue.OpenIdConnectUrl,
 		}
@@ -230,6 +261,36 @@ func getMajorDocVersion(l logger.Logger, doc []byte) (version int, err error) {
 	return 0, fmt.Errorf("version of the OpenAPI doc is unknown")
 }
 
+// getServerBasePath returns the path of a server URL, server URLs can be relative and contain variables
+func getServerBasePath(serverUrl string) string {
+	parsed, err := url.Parse(serverUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(parsed.Path, "/")
+}
+
+// transformLoginExtension converts the value of the login extension to a LoginOperation
+// the extension is either a boolean or an object with the settings of the login operation
+func transformLoginExtension(ext any) (*discovery.LoginOperation, error) {
+	raw, err := json.Marshal(ext)
+	if err != nil {
+		return nil, err
+	}
+	var enabled bool
+	if err := json.Unmarshal(raw, &enabled); err == nil {
+		if !enabled {
+			return nil, nil
+		}
+		return &discovery.LoginOperation{}, nil
+	}
+	login := &discovery.LoginOperation{}
+	if err := json.Unmarshal(raw, login); err != nil {
+		return nil, fmt.Errorf("%s has to be a boolean or an object: %w", discovery.LoginExtension, err)
+	}
+	return login, nil
+}
+
 // transformOAuthFlow converts kin-openapi3 OAuthFlow to a cnfuzz OAuthFlow object
 func transformOAuthFlow(grantType string, flow *openapi3.OAuthFlow) discovery.OAuthFlow {
 	return discovery.OAuthFlow{
@@ -241,6 +302,22 @@ func transformOAuthFlow(grantType string, flow *openapi3.OAuthFlow) discovery.OA
 	}
 }
 
+// transformSecurityRequirements converts kin-openapi3 SecurityRequirements to cnfuzz SecurityRequirement objects
+func transformSecurityRequirements(requirements openapi3.SecurityRequirements) []discovery.SecurityRequirement {
+	if requirements == nil {
+		return nil
+	}
+	transformed := make([]discovery.SecurityRequirement, 0, len(requirements))
+	for _, requirement := range requirements {
+		newRequirement := discovery.SecurityRequirement{}
+		for key, scopes := range requirement {
+			newRequirement[key] = scopes
+		}
+		transformed = append(transformed, newRequirement)
+	}
+	return transformed
+}
+
 // transformBody converts kin-openapi3 RequestBody to a cnfuzz Body object
 func transformBody(l logger.Logger, rBody *openapi3.RequestBody) discovery.Body {
 	body := discovery.Body{
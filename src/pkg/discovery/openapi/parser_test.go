@@ -0,0 +1,127 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package openapi
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"net/url"
+	"testing"
+)
+
+const testSecurityDoc = `{
+  "openapi": "3.0.3",
+  "info": {"title": "test api", "version": "1.0"},
+  "security": [{"ApiKeyAuth": []}],
+  "paths": {
+    "/todo": {
+      "get": {"responses": {"200": {"description": "ok"}}},
+      "post": {"security": [{"BearerAuth": []}, {"ApiKeyAuth": []}], "responses": {"200": {"description": "ok"}}}
+    },
+    "/public": {
+      "get": {"security": [], "responses": {"200": {"description": "ok"}}}
+    }
+  },
+  "components": {
+    "securitySchemes": {
+      "ApiKeyAuth": {"type": "apiKey", "in": "header", "name": "X-API-Key"},
+      "BearerAuth": {"type": "http", "scheme": "bearer"}
+    }
+  }
+}`
+
+func TestParseOpenApiDocSecurity(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	uri, _ := url.Parse("http://localhost:8080/swagger/doc.json")
+	unparsed, err := UnMarshalOpenApiDoc(l, []byte(testSecurityDoc), uri)
+	if !assert.NoError(t, err) {
+		return
+	}
+	desc, err := ParseOpenApiDoc(l, unparsed)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, []discovery.SecurityRequirement{{"ApiKeyAuth": {}}}, desc.Security)
+	assert.Len(t, desc.SecuritySchemes, 2)
+	for _, scheme := range desc.SecuritySchemes {
+		if scheme.Key == "BearerAuth" {
+			assert.Equal(t, discovery.BearerHttpScheme, scheme.Scheme)
+		}
+	}
+
+	for _, endpoint := range desc.Endpoints {
+		switch endpoint.Method + " " + endpoint.Path {
+		case "GET /todo":
+			// inherited from the document
+			assert.Equal(t, []discovery.SecurityRequirement{{"ApiKeyAuth": {}}}, endpoint.Security)
+		case "POST /todo":
+			assert.Equal(t, []discovery.SecurityRequirement{{"BearerAuth": {}}, {"ApiKeyAuth": {}}}, endpoint.Security)
+		case "GET /public":
+			assert.NotNil(t, endpoint.Security)
+			assert.Empty(t, endpoint.Security)
+		}
+	}
+}
+
+const testLoginDoc = `{
+  "swagger": "2.0",
+  "info": {"title": "login api", "version": "1.0"},
+  "basePath": "/api",
+  "paths": {
+    "/login": {
+      "post": {"x-cnfuzz-login": {"token_path": "$.data.token", "token_type": "raw"}, "responses": {"200": {"description": "ok"}}}
+    },
+    "/session": {
+      "post": {"x-cnfuzz-login": false, "responses": {"200": {"description": "ok"}}}
+    }
+  }
+}`
+
+func TestParseOpenApiDocLogin(t *testing.T) {
+	l := logger.CreateDebugLogger()
+	uri, _ := url.Parse("http://localhost:8080/swagger/doc.json")
+	unparsed, err := UnMarshalOpenApiDoc(l, []byte(testLoginDoc), uri)
+	if !assert.NoError(t, err) {
+		return
+	}
+	desc, err := ParseOpenApiDoc(l, unparsed)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "/api", desc.BasePath)
+	login := desc.LoginEndpoint()
+	if assert.NotNil(t, login) {
+		assert.Equal(t, "/login", login.Path)
+		assert.Equal(t, &discovery.LoginOperation{TokenPath: "$.data.token", TokenType: "raw"}, login.Login)
+	}
+}
+
+func TestTransformLoginExtension(t *testing.T) {
+	login, err := transformLoginExtension(true)
+	assert.NoError(t, err)
+	assert.Equal(t, &discovery.LoginOperation{}, login)
+
+	login, err = transformLoginExtension(false)
+	assert.NoError(t, err)
+	assert.Nil(t, login)
+
+	_, err = transformLoginExtension("yes")
+	assert.Error(t, err)
+}
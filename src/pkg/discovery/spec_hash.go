@@ -0,0 +1,155 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// OperationKey returns the key of an operation in the format <METHOD> <path>
+func OperationKey(method string, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// Key returns the key of the operation of the endpoint in the format <METHOD> <path>
+func (e Endpoint) Key() string {
+	return OperationKey(e.Method, e.Path)
+}
+
+// Hash returns a hash of the normalized description, which only changes when something changes that matters for fuzzing.
+// The location of the discovery doc, descriptions and the order of endpoints, parameters etc. don't change the hash.
+func (d *WebApiDescription) Hash() string {
+	operations := d.OperationHashes()
+	keys := make([]string, 0, len(operations))
+	for key := range operations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hashed := struct {
+		BasePath        string
+		Operations      []string
+		SecuritySchemes []SecuritySchema
+		Security        []SecurityRequirement
+	}{
+		BasePath:        d.BasePath,
+		SecuritySchemes: normalizeSecuritySchemes(d.SecuritySchemes),
+		Security:        d.Security,
+	}
+	for _, key := range keys {
+		hashed.Operations = append(hashed.Operations, key+"="+operations[key])
+	}
+	return hashJson(hashed)
+}
+
+// OperationHashes returns a hash of every normalized operation, keyed by OperationKey
+func (d *WebApiDescription) OperationHashes() map[string]string {
+	hashes := make(map[string]string, len(d.Endpoints))
+	for _, endpoint := range d.Endpoints {
+		hashes[endpoint.Key()] = hashJson(normalizeEndpoint(endpoint))
+	}
+	return hashes
+}
+
+// ChangedOperations returns the operations that are new or changed compared to the previous operation hashes, sorted by key
+func ChangedOperations(previous map[string]string, current map[string]string) []string {
+	var changed []string
+	for key, hash := range current {
+		if previous[key] != hash {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func hashJson(v any) string {
+	// encoding only fails for unsupported types like channels, which descriptions don't contain
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeEndpoint returns a copy of the endpoint without descriptions and with sorted parameters, responses and content
+func normalizeEndpoint(endpoint Endpoint) Endpoint {
+	normalized := Endpoint{
+		Path:     endpoint.Path,
+		Method:   strings.ToUpper(endpoint.Method),
+		Consumes: endpoint.Consumes,
+		Produces: endpoint.Produces,
+		Security: endpoint.Security,
+		Login:    endpoint.Login,
+		Body: Body{
+			Required: endpoint.Body.Required,
+			Content:  normalizeContent(endpoint.Body.Content),
+		},
+	}
+	for _, param := range endpoint.Parameters {
+		param.Description = ""
+		param.Schema = normalizeSchema(param.Schema)
+		normalized.Parameters = append(normalized.Parameters, param)
+	}
+	sort.Slice(normalized.Parameters, func(i, j int) bool {
+		a, b := normalized.Parameters[i], normalized.Parameters[j]
+		return a.In < b.In || a.In == b.In && a.Name < b.Name
+	})
+	for _, response := range endpoint.Responses {
+		normalized.Responses = append(normalized.Responses, Response{Code: response.Code, Content: normalizeContent(response.Content)})
+	}
+	sort.Slice(normalized.Responses, func(i, j int) bool {
+		return normalized.Responses[i].Code < normalized.Responses[j].Code
+	})
+	return normalized
+}
+
+func normalizeContent(contents []Content) []Content {
+	var normalized []Content
+	for _, content := range contents {
+		normalized = append(normalized, Content{ContentType: content.ContentType, Schema: normalizeSchema(content.Schema)})
+	}
+	sort.Slice(normalized, func(i, j int) bool {
+		return normalized[i].ContentType < normalized[j].ContentType
+	})
+	return normalized
+}
+
+func normalizeSchema(schema Schema) Schema {
+	normalized := schema
+	normalized.Properties = nil
+	for _, property := range schema.Properties {
+		normalized.Properties = append(normalized.Properties, normalizeSchema(property))
+	}
+	sort.Slice(normalized.Properties, func(i, j int) bool {
+		return normalized.Properties[i].Key < normalized.Properties[j].Key
+	})
+	return normalized
+}
+
+func normalizeSecuritySchemes(schemes []SecuritySchema) []SecuritySchema {
+	var normalized []SecuritySchema
+	for _, scheme := range schemes {
+		scheme.Description = ""
+		normalized = append(normalized, scheme)
+	}
+	sort.Slice(normalized, func(i, j int) bool {
+		return normalized[i].Key < normalized[j].Key
+	})
+	return normalized
+}
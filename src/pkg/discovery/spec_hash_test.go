@@ -0,0 +1,60 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package discovery
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func createHashDescription() *WebApiDescription {
+	return &WebApiDescription{
+		DiscoveryDoc: url.URL{Scheme: "http", Host: "10.0.0.1:8080", Path: "/swagger/doc.json"},
+		BasePath:     "/api",
+		Title:        "Todo API",
+		Endpoints: []Endpoint{
+			{Method: "GET", Path: "/todos", Summary: "list todos", Responses: []Response{{Code: 200}, {Code: 400}}},
+			{Method: "POST", Path: "/todos", Parameters: []Parameter{{Name: "b", In: "query"}, {Name: "a", In: "query"}}},
+		},
+	}
+}
+
+func TestHashIgnoresOrderAndDocumentation(t *testing.T) {
+	desc := createHashDescription()
+	other := createHashDescription()
+	other.DiscoveryDoc.Host = "10.0.0.2:8080"
+	other.Title = "Todos"
+	other.Endpoints[0], other.Endpoints[1] = other.Endpoints[1], other.Endpoints[0]
+	other.Endpoints[0].Parameters[0], other.Endpoints[0].Parameters[1] = other.Endpoints[0].Parameters[1], other.Endpoints[0].Parameters[0]
+	other.Endpoints[1].Summary = "returns all todos"
+	other.Endpoints[1].Responses[0], other.Endpoints[1].Responses[1] = other.Endpoints[1].Responses[1], other.Endpoints[1].Responses[0]
+	assert.Equal(t, desc.Hash(), other.Hash())
+
+	other.BasePath = "/v2"
+	assert.NotEqual(t, desc.Hash(), other.Hash(), "a different base path exposes different endpoints")
+}
+
+func TestChangedOperations(t *testing.T) {
+	desc := createHashDescription()
+	previous := desc.OperationHashes()
+
+	desc.Endpoints[1].Parameters = append(desc.Endpoints[1].Parameters, Parameter{Name: "c", In: "header", Required: true})
+	desc.Endpoints = append(desc.Endpoints, Endpoint{Method: "delete", Path: "/todos/{id}"})
+	assert.Equal(t, []string{"DELETE /todos/{id}", "POST /todos"}, ChangedOperations(previous, desc.OperationHashes()))
+	assert.Empty(t, ChangedOperations(desc.OperationHashes(), desc.OperationHashes()))
+}
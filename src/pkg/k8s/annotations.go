@@ -19,7 +19,9 @@ package k8s
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -30,6 +32,44 @@ const (
 	OpenApiDocAnno   = "open-api-doc"
 	SecretAnno       = "secret"
 	UsernameAnno     = "username"
+	AuthSchemeAnno   = "auth-scheme"
+	IdentityAnno     = "identity"
+	RepositoryAnno   = "repository"
+	RefuzzAnno       = "refuzz"
+
+	SandboxAnno         = "sandbox"
+	SandboxSidecarsAnno = "sandbox-sidecars"
+	SandboxEnvAnno      = "sandbox-env"
+
+	OidcGrantAnno        = "oidc-grant"
+	OidcClientIdAnno     = "oidc-client-id"
+	OidcClientSecretAnno = "oidc-client-secret"
+	OidcScopesAnno       = "oidc-scopes"
+
+	LoginAnno            = "login"
+	LoginUrlAnno         = "login-url"
+	LoginMethodAnno      = "login-method"
+	LoginBodyAnno        = "login-body"
+	LoginContentTypeAnno = "login-content-type"
+	LoginTokenPathAnno   = "login-token-path"
+	LoginTokenRegexAnno  = "login-token-regex"
+	LoginExpiryPathAnno  = "login-expiry-path"
+	LoginExpiryRegexAnno = "login-expiry-regex"
+	LoginTokenTypeAnno   = "login-token-type"
+
+	// JwtKeySecretAnno name of the secret in the namespace of the pod with the signing key, the key itself is never an annotation
+	JwtKeySecretAnno    = "jwt-key-secret"
+	JwtKeySecretKeyAnno = "jwt-key-secret-key"
+	JwtKeyIdAnno        = "jwt-key-id"
+	JwtAlgorithmAnno    = "jwt-algorithm"
+	JwtClaimsAnno       = "jwt-claims"
+	JwtLifetimeAnno     = "jwt-lifetime"
+	// DefaultJwtKeySecretKey key of the signing key inside the secret of JwtKeySecretAnno when JwtKeySecretKeyAnno isn't set
+	DefaultJwtKeySecretKey = "key"
+
+	// OciImageSourceLabel OCI image label with the source repository of the image,
+	// used as repository when it is copied to the annotations or labels of the pod
+	OciImageSourceLabel = "org.opencontainers.image.source"
 )
 
 // Annotations annotation values for annotations to be used inside Kubernetes configurations
@@ -39,6 +79,78 @@ type Annotations struct {
 	OpenApiDocLocation string
 	Secret             string
 	Username           string
+	// AuthScheme key of the preferred security scheme
+	AuthScheme string
+	// SchemeSecrets secrets for specific security schemes, set with cnfuzz/secret.<scheme key>
+	SchemeSecrets map[string]string
+	// SchemeUsernames usernames for specific security schemes, set with cnfuzz/username.<scheme key>
+	SchemeUsernames map[string]string
+	// Identities extra identities to fuzz with, set with cnfuzz/identity.<name>.username and cnfuzz/identity.<name>.secret
+	// scheme specific credentials are set with cnfuzz/identity.<name>.secret.<scheme key>
+	Identities map[string]IdentityAnnotations
+	// Oidc options for getting tokens from an OpenID Connect provider
+	Oidc OidcAnnotations
+	// Jwt options for minting JWTs locally
+	Jwt JwtAnnotations
+	// Login options for getting tokens from a login endpoint
+	Login LoginAnnotations
+	// Repository source repository of the workload, issues for findings are opened in it
+	Repository string
+	// Refuzz token that forces a re-fuzz of the images of the workload whenever it changes
+	Refuzz string
+	// Sandbox options for fuzzing a copy of the workload instead of the live pod
+	Sandbox SandboxAnnotations
+}
+
+// SandboxAnnotations annotation values for fuzzing a copy of the workload inside a sandbox namespace
+type SandboxAnnotations struct {
+	Enabled bool
+	// Sidecars JSON list of containers that are added to the copy, e.g. a database the workload depends on
+	Sidecars string
+	// Env JSON object with environment variables that are set on the containers of the copy, e.g. to point it to a sidecar
+	Env string
+}
+
+// IdentityAnnotations credentials of an extra identity
+type IdentityAnnotations struct {
+	Username        string
+	Secret          string
+	SchemeSecrets   map[string]string
+	SchemeUsernames map[string]string
+}
+
+// OidcAnnotations annotation values for OpenID Connect security schemes
+type OidcAnnotations struct {
+	GrantType    string
+	ClientId     string
+	ClientSecret string
+	// Scopes comma separated list of scopes
+	Scopes []string
+}
+
+// LoginAnnotations annotation values for getting tokens from a login endpoint
+type LoginAnnotations struct {
+	// Config YAML with all login options, the other login annotations take precedence over it
+	Config      string
+	Url         string
+	Method      string
+	Body        string
+	ContentType string
+	TokenPath   string
+	TokenRegex  string
+	ExpiryPath  string
+	ExpiryRegex string
+	TokenType   string
+}
+
+// JwtAnnotations annotation values for minting JWTs locally
+type JwtAnnotations struct {
+	// KeySecret secret in the namespace of the pod with the signing key, nil when it isn't set
+	KeySecret *config.SecretKeyRef
+	KeyId     string
+	Algorithm string
+	Claims    string
+	Lifetime  string
 }
 
 // GetAnnotations gather annotations inside the metadata of a Kubernetes object
@@ -48,6 +160,7 @@ func GetAnnotations(objectMeta *metav1.ObjectMeta) Annotations {
 	oaDocLoc := getAnnotationFromMeta(objectMeta, OpenApiDocAnno)
 	secret := getAnnotationFromMeta(objectMeta, SecretAnno)
 	username := getAnnotationFromMeta(objectMeta, UsernameAnno)
+	authScheme := getAnnotationFromMeta(objectMeta, AuthSchemeAnno)
 
 	ignoreMe, err := strconv.ParseBool(strIgnoreMe)
 	if err != nil {
@@ -57,6 +170,7 @@ func GetAnnotations(objectMeta *metav1.ObjectMeta) Annotations {
 	}
 
 	fuzzMe, err := strconv.ParseBool(strFuzzMe)
+	sandbox, _ := strconv.ParseBool(getAnnotationFromMeta(objectMeta, SandboxAnno))
 
 	return Annotations{
 		IgnoreMe:           ignoreMe,
@@ -64,10 +178,128 @@ func GetAnnotations(objectMeta *metav1.ObjectMeta) Annotations {
 		OpenApiDocLocation: oaDocLoc,
 		Secret:             secret,
 		Username:           username,
+		AuthScheme:         authScheme,
+		SchemeSecrets:      getSuffixedAnnotationsFromMeta(objectMeta, SecretAnno),
+		SchemeUsernames:    getSuffixedAnnotationsFromMeta(objectMeta, UsernameAnno),
+		Identities:         getIdentityAnnotations(objectMeta),
+		Oidc: OidcAnnotations{
+			GrantType:    getAnnotationFromMeta(objectMeta, OidcGrantAnno),
+			ClientId:     getAnnotationFromMeta(objectMeta, OidcClientIdAnno),
+			ClientSecret: getAnnotationFromMeta(objectMeta, OidcClientSecretAnno),
+			Scopes:       splitList(getAnnotationFromMeta(objectMeta, OidcScopesAnno)),
+		},
+		Jwt: JwtAnnotations{
+			KeySecret: getJwtKeySecret(objectMeta),
+			KeyId:     getAnnotationFromMeta(objectMeta, JwtKeyIdAnno),
+			Algorithm: getAnnotationFromMeta(objectMeta, JwtAlgorithmAnno),
+			Claims:    getAnnotationFromMeta(objectMeta, JwtClaimsAnno),
+			Lifetime:  getAnnotationFromMeta(objectMeta, JwtLifetimeAnno),
+		},
+		Login: LoginAnnotations{
+			Config:      getAnnotationFromMeta(objectMeta, LoginAnno),
+			Url:         getAnnotationFromMeta(objectMeta, LoginUrlAnno),
+			Method:      getAnnotationFromMeta(objectMeta, LoginMethodAnno),
+			Body:        getAnnotationFromMeta(objectMeta, LoginBodyAnno),
+			ContentType: getAnnotationFromMeta(objectMeta, LoginContentTypeAnno),
+			TokenPath:   getAnnotationFromMeta(objectMeta, LoginTokenPathAnno),
+			TokenRegex:  getAnnotationFromMeta(objectMeta, LoginTokenRegexAnno),
+			ExpiryPath:  getAnnotationFromMeta(objectMeta, LoginExpiryPathAnno),
+			ExpiryRegex: getAnnotationFromMeta(objectMeta, LoginExpiryRegexAnno),
+			TokenType:   getAnnotationFromMeta(objectMeta, LoginTokenTypeAnno),
+		},
+		Repository: getRepository(objectMeta),
+		Refuzz:     getAnnotationFromMeta(objectMeta, RefuzzAnno),
+		Sandbox: SandboxAnnotations{
+			Enabled:  sandbox,
+			Sidecars: getAnnotationFromMeta(objectMeta, SandboxSidecarsAnno),
+			Env:      getAnnotationFromMeta(objectMeta, SandboxEnvAnno),
+		},
+	}
+}
+
+// getRepository gets the source repository from the repository annotation or the OCI image source label
+func getRepository(objectMeta *metav1.ObjectMeta) string {
+	if repository := getAnnotationFromMeta(objectMeta, RepositoryAnno); len(repository) > 0 {
+		return repository
 	}
+	if repository := objectMeta.Annotations[OciImageSourceLabel]; len(repository) > 0 {
+		return repository
+	}
+	return objectMeta.Labels[OciImageSourceLabel]
 }
 
 // getAnnotationFromMeta get a single annotation value from Kubernetes object meta
 func getAnnotationFromMeta(objectMeta *metav1.ObjectMeta, annotationName string) string {
 	return objectMeta.Annotations[fmt.Sprintf("%s/%s", AnnotationPrefix, annotationName)]
 }
+
+// getSuffixedAnnotationsFromMeta get all values of annotations in the format <prefix>/<annotation name>.<suffix>
+// returns a map with the suffixes as keys
+func getSuffixedAnnotationsFromMeta(objectMeta *metav1.ObjectMeta, annotationName string) map[string]string {
+	values := make(map[string]string)
+	prefix := fmt.Sprintf("%s/%s.", AnnotationPrefix, annotationName)
+	for key, value := range objectMeta.Annotations {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			values[strings.TrimPrefix(key, prefix)] = value
+		}
+	}
+	return values
+}
+
+// getIdentityAnnotations gathers the credentials of extra identities
+// annotations are in the format cnfuzz/identity.<name>.<username|secret>[.<scheme key>], other annotations are ignored
+func getIdentityAnnotations(objectMeta *metav1.ObjectMeta) map[string]IdentityAnnotations {
+	identities := make(map[string]IdentityAnnotations)
+	for suffix, value := range getSuffixedAnnotationsFromMeta(objectMeta, IdentityAnno) {
+		parts := strings.SplitN(suffix, ".", 3)
+		if len(parts) < 2 || len(parts[0]) == 0 {
+			continue
+		}
+		name, field := parts[0], parts[1]
+		identity := identities[name]
+		switch {
+		case field == UsernameAnno && len(parts) == 2:
+			identity.Username = value
+		case field == SecretAnno && len(parts) == 2:
+			identity.Secret = value
+		case field == UsernameAnno:
+			if identity.SchemeUsernames == nil {
+				identity.SchemeUsernames = make(map[string]string)
+			}
+			identity.SchemeUsernames[parts[2]] = value
+		case field == SecretAnno:
+			if identity.SchemeSecrets == nil {
+				identity.SchemeSecrets = make(map[string]string)
+			}
+			identity.SchemeSecrets[parts[2]] = value
+		default:
+			continue
+		}
+		identities[name] = identity
+	}
+	return identities
+}
+
+// splitList splits a comma separated annotation value, empty items are dropped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getJwtKeySecret returns the secret with the JWT signing key of the annotations, nil when no secret is set
+func getJwtKeySecret(objectMeta *metav1.ObjectMeta) *config.SecretKeyRef {
+	name := getAnnotationFromMeta(objectMeta, JwtKeySecretAnno)
+	if len(name) == 0 {
+		return nil
+	}
+	key := getAnnotationFromMeta(objectMeta, JwtKeySecretKeyAnno)
+	if len(key) == 0 {
+		key = DefaultJwtKeySecretKey
+	}
+	return &config.SecretKeyRef{Name: name, Key: key}
+}
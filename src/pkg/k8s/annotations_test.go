@@ -19,6 +19,7 @@ package k8s
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"strconv"
 	"testing"
@@ -30,13 +31,17 @@ func TestGetAnnotations(t *testing.T) {
 	oaDocVal := "/swagger/swagger.json"
 	secretVal := "verysecret"
 	unameVal := "me"
+	schemeVal := "BearerAuth"
+	schemeSecretVal := "bearer-secret"
 	testMeta := &metav1.ObjectMeta{
 		Annotations: map[string]string{
-			fmt.Sprintf("%s/%s", AnnotationPrefix, IgnoreMeAnno):   strconv.FormatBool(ignoreMeVal),
-			fmt.Sprintf("%s/%s", AnnotationPrefix, FuzzMeAnno):     strconv.FormatBool(fuzzMeVal),
-			fmt.Sprintf("%s/%s", AnnotationPrefix, OpenApiDocAnno): oaDocVal,
-			fmt.Sprintf("%s/%s", AnnotationPrefix, SecretAnno):     secretVal,
-			fmt.Sprintf("%s/%s", AnnotationPrefix, UsernameAnno):   unameVal,
+			fmt.Sprintf("%s/%s", AnnotationPrefix, IgnoreMeAnno):             strconv.FormatBool(ignoreMeVal),
+			fmt.Sprintf("%s/%s", AnnotationPrefix, FuzzMeAnno):               strconv.FormatBool(fuzzMeVal),
+			fmt.Sprintf("%s/%s", AnnotationPrefix, OpenApiDocAnno):           oaDocVal,
+			fmt.Sprintf("%s/%s", AnnotationPrefix, SecretAnno):               secretVal,
+			fmt.Sprintf("%s/%s", AnnotationPrefix, UsernameAnno):             unameVal,
+			fmt.Sprintf("%s/%s", AnnotationPrefix, AuthSchemeAnno):           schemeVal,
+			fmt.Sprintf("%s/%s.%s", AnnotationPrefix, SecretAnno, schemeVal): schemeSecretVal,
 		},
 	}
 	result := GetAnnotations(testMeta)
@@ -45,6 +50,9 @@ func TestGetAnnotations(t *testing.T) {
 	assert.Equal(t, oaDocVal, result.OpenApiDocLocation)
 	assert.Equal(t, secretVal, result.Secret)
 	assert.Equal(t, unameVal, result.Username)
+	assert.Equal(t, schemeVal, result.AuthScheme)
+	assert.Equal(t, map[string]string{schemeVal: schemeSecretVal}, result.SchemeSecrets)
+	assert.Empty(t, result.SchemeUsernames)
 }
 
 func TestGetAnnotationsFromMeta(t *testing.T) {
@@ -58,3 +66,77 @@ func TestGetAnnotationsFromMeta(t *testing.T) {
 	result := getAnnotationFromMeta(testMeta, testAnno)
 	assert.Equal(t, testValue, result)
 }
+
+func TestGetAnnotationsOidcAndJwt(t *testing.T) {
+	testMeta := &metav1.ObjectMeta{
+		Annotations: map[string]string{
+			fmt.Sprintf("%s/%s", AnnotationPrefix, OidcGrantAnno):    "password",
+			fmt.Sprintf("%s/%s", AnnotationPrefix, OidcClientIdAnno): "cnfuzz",
+			fmt.Sprintf("%s/%s", AnnotationPrefix, OidcScopesAnno):   "openid, profile,,email",
+			fmt.Sprintf("%s/%s", AnnotationPrefix, JwtAlgorithmAnno): "RS256",
+			fmt.Sprintf("%s/%s", AnnotationPrefix, JwtLifetimeAnno):  "30m",
+		},
+	}
+	result := GetAnnotations(testMeta)
+	assert.Equal(t, "password", result.Oidc.GrantType)
+	assert.Equal(t, "cnfuzz", result.Oidc.ClientId)
+	assert.Empty(t, result.Oidc.ClientSecret)
+	assert.Equal(t, []string{"openid", "profile", "email"}, result.Oidc.Scopes)
+	assert.Equal(t, "RS256", result.Jwt.Algorithm)
+	assert.Equal(t, "30m", result.Jwt.Lifetime)
+	assert.Nil(t, result.Jwt.KeySecret)
+	// scheme specific annotations shouldn't pick up the oidc and jwt annotations
+	assert.Empty(t, result.SchemeSecrets)
+
+	testMeta.Annotations[fmt.Sprintf("%s/%s", AnnotationPrefix, JwtKeySecretAnno)] = "todo-jwt"
+	result = GetAnnotations(testMeta)
+	assert.Equal(t, &config.SecretKeyRef{Name: "todo-jwt", Key: DefaultJwtKeySecretKey}, result.Jwt.KeySecret)
+	testMeta.Annotations[fmt.Sprintf("%s/%s", AnnotationPrefix, JwtKeySecretKeyAnno)] = "private.pem"
+	result = GetAnnotations(testMeta)
+	assert.Equal(t, &config.SecretKeyRef{Name: "todo-jwt", Key: "private.pem"}, result.Jwt.KeySecret)
+}
+
+func TestGetAnnotationsIdentities(t *testing.T) {
+	testMeta := &metav1.ObjectMeta{
+		Annotations: map[string]string{
+			fmt.Sprintf("%s/%s.userb.%s", AnnotationPrefix, IdentityAnno, UsernameAnno):       "bob",
+			fmt.Sprintf("%s/%s.userb.%s", AnnotationPrefix, IdentityAnno, SecretAnno):         "bobsecret",
+			fmt.Sprintf("%s/%s.userc.%s.ApiKey", AnnotationPrefix, IdentityAnno, SecretAnno):  "carolkey",
+			fmt.Sprintf("%s/%s.userc.%s.Basic", AnnotationPrefix, IdentityAnno, UsernameAnno): "carol",
+			fmt.Sprintf("%s/%s.userd.unknown", AnnotationPrefix, IdentityAnno):                "ignored",
+			fmt.Sprintf("%s/%s.usere", AnnotationPrefix, IdentityAnno):                        "ignored",
+		},
+	}
+	result := GetAnnotations(testMeta)
+	assert.Equal(t, map[string]IdentityAnnotations{
+		"userb": {Username: "bob", Secret: "bobsecret"},
+		"userc": {
+			SchemeSecrets:   map[string]string{"ApiKey": "carolkey"},
+			SchemeUsernames: map[string]string{"Basic": "carol"},
+		},
+	}, result.Identities)
+}
+
+func TestGetAnnotationsLogin(t *testing.T) {
+	testMeta := &metav1.ObjectMeta{
+		Annotations: map[string]string{
+			fmt.Sprintf("%s/%s", AnnotationPrefix, LoginAnno):          "url: /login",
+			fmt.Sprintf("%s/%s", AnnotationPrefix, LoginTokenPathAnno): "$.token",
+			fmt.Sprintf("%s/%s", AnnotationPrefix, LoginTokenTypeAnno): "raw",
+		},
+	}
+	result := GetAnnotations(testMeta)
+	assert.Equal(t, LoginAnnotations{Config: "url: /login", TokenPath: "$.token", TokenType: "raw"}, result.Login)
+}
+
+func TestGetAnnotationsRepository(t *testing.T) {
+	repository := "https://github.com/suecodelabs/todo-api"
+	testMeta := &metav1.ObjectMeta{
+		Annotations: map[string]string{fmt.Sprintf("%s/%s", AnnotationPrefix, RepositoryAnno): repository},
+		Labels:      map[string]string{OciImageSourceLabel: "https://github.com/suecodelabs/other"},
+	}
+	assert.Equal(t, repository, GetAnnotations(testMeta).Repository)
+
+	testMeta.Annotations = nil
+	assert.Equal(t, "https://github.com/suecodelabs/other", GetAnnotations(testMeta).Repository)
+}
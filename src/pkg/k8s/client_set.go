@@ -18,9 +18,12 @@ package k8s
 
 import (
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
 )
 
 // CreateClientset create a client to interact with the Kubernetes API
@@ -47,3 +50,15 @@ func CreateClientset(l logger.Logger, insideCluster bool) (clientset kubernetes.
 
 	return clientset
 }
+
+// namespaceFile file with the namespace of the pod inside the service account mount
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// CurrentNamespace returns the namespace cnfuzz runs in, the default namespace when it runs outside the cluster
+func CurrentNamespace() string {
+	data, err := os.ReadFile(namespaceFile)
+	if namespace := strings.TrimSpace(string(data)); err == nil && len(namespace) > 0 {
+		return namespace
+	}
+	return metav1.NamespaceDefault
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8s
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func TestCreatePodEvent(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default", UID: "1234"}}
+
+	_, err := CreatePodEvent(context.Background(), client, pod, v1.EventTypeNormal, "FuzzReport", "report written")
+	require.NoError(t, err)
+
+	events, err := client.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 1)
+	event := events.Items[0]
+	assert.Equal(t, "todo-api", event.InvolvedObject.Name)
+	assert.Equal(t, "Pod", event.InvolvedObject.Kind)
+	assert.Equal(t, "FuzzReport", event.Reason)
+	assert.Equal(t, "report written", event.Message)
+	assert.Equal(t, EventSource, event.Source.Component)
+}
@@ -20,15 +20,18 @@ import (
 	"context"
 	"fmt"
 	config "github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/diff"
 	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/openapi"
 	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/job"
 	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"time"
 )
 
-func StartFuzzJob(l logger.Logger, client kubernetes.Interface, cnfConfig *config.CnFuzzConfig, overwrites config.DDocOverwrites, pod *v1.Pod) error {
+// DiscoverOpenApiDoc gets the OpenAPI doc of a pod from the location inside its annotations or from a common location
+func DiscoverOpenApiDoc(l logger.Logger, overwrites config.DDocOverwrites, pod *v1.Pod) (openapi.UnParsedOpenApiDoc, error) {
 	annos := GetAnnotations(&pod.ObjectMeta)
 
 	var ip string
@@ -59,19 +62,92 @@ func StartFuzzJob(l logger.Logger, client kubernetes.Interface, cnfConfig *confi
 	// Check if the open api doc exists
 	apiDesc, err := openapi.TryGetOpenApiDoc(l, ip, ports, oaLocs)
 	if err != nil {
-		return fmt.Errorf("error while retrieving OpenAPI document from target %s: %w", pod.Name, err)
+		return openapi.UnParsedOpenApiDoc{}, fmt.Errorf("error while retrieving OpenAPI document from target %s: %w", pod.Name, err)
 	}
+	return apiDesc, nil
+}
+
+// FuzzJobOptions options of a single fuzz job and its fuzz run
+type FuzzJobOptions struct {
+	job.Options
+	// Spec OpenAPI doc that is fuzzed, the fuzz run keeps it so later runs can be compared with it
+	Spec []byte
+	// SpecDiff differences between the spec of the previous run of the target and Spec
+	SpecDiff *diff.Diff
+}
 
-	restlerJob := job.CreateRestlerWrapperJob(l, pod, cnfConfig, apiDesc)
-	createdJob, err := client.BatchV1().Jobs(restlerJob.Namespace).Create(context.TODO(), restlerJob, metav1.CreateOptions{})
+// StartFuzzJob starts the fuzz job and the fuzz run for a pod with the OpenAPI doc that was discovered for the pod
+// pods with the sandbox annotation aren't fuzzed directly, the job fuzzes a copy of the pod inside a sandbox namespace
+func StartFuzzJob(l logger.Logger, client kubernetes.Interface, cnfConfig *config.CnFuzzConfig, pod *v1.Pod, apiDesc openapi.UnParsedOpenApiDoc, opts FuzzJobOptions) error {
+	opts.Name = job.JobName(pod.Name)
+	fuzzRun := FuzzRunName(opts.Name)
+	annos := GetAnnotations(&pod.ObjectMeta)
+	if annos.Jwt.KeySecret != nil {
+		// secrets can only be used inside their own namespace
+		if namespace := job.Namespace(cnfConfig, pod); namespace != pod.Namespace {
+			return fmt.Errorf("the JWT key secret %s of pod %s can't be used by fuzz jobs in namespace %s", annos.Jwt.KeySecret.Name, pod.Name, namespace)
+		}
+		opts.JwtKeySecret = annos.Jwt.KeySecret
+	}
+	if annos.Sandbox.Enabled {
+		if !cnfConfig.SandboxConfig.IsEnabled() {
+			return fmt.Errorf("pod %s should be fuzzed inside a sandbox, but sandboxes aren't enabled", pod.Name)
+		}
+		sandbox, err := CloneSandboxPod(pod, SandboxNamespace(cnfConfig.SandboxConfig))
+		if err != nil {
+			return err
+		}
+		opts.Sandbox = sandbox
+	}
+	restlerJob := job.CreateRestlerWrapperJob(l, pod, cnfConfig, apiDesc, fuzzRun, opts.Options)
+	// the run exists before the sandbox, so the sandbox is removed when the controller dies while it waits for the sandbox
+	// nothing would record the results of a job without a run, so the job isn't started then
+	run, err := CreateFuzzRun(context.TODO(), l, client, pod, restlerJob.Name, restlerJob.Namespace, opts)
 	if err != nil {
-		l.V(logger.ImportantLevel).Error(err, "error while starting restler job", "restlerJobName", restlerJob.Name, "restlerJobNamespace", restlerJob.Namespace, "targetName", pod.Name)
+		return err
+	}
+	if run.Namespace == restlerJob.Namespace {
+		// the job is removed together with its run, owners can't be in another namespace
+		restlerJob.OwnerReferences = []metav1.OwnerReference{FuzzRunOwnerReference(run)}
+	}
+	var policy string
+	if opts.Sandbox != nil {
+		if _, err := CreateSandbox(context.TODO(), l, client, cnfConfig.SandboxConfig, pod, opts.Sandbox); err != nil {
+			failFuzzRun(l, client, run, err.Error())
+			return err
+		}
+	} else if policy, err = AllowFuzzJobTraffic(context.TODO(), l, client, cnfConfig, pod); err != nil {
+		l.V(logger.ImportantLevel).Error(err, "error while allowing traffic from the fuzz job to the target", "targetName", pod.Name, "targetNamespace", pod.Namespace)
+	}
+	if _, err := client.BatchV1().Jobs(restlerJob.Namespace).Create(context.TODO(), restlerJob, metav1.CreateOptions{}); err != nil {
+		err = fmt.Errorf("failed to create fuzz job %s in namespace %s: %w", restlerJob.Name, restlerJob.Namespace, err)
+		failFuzzRun(l, client, run, err.Error())
+		// nothing else uses the sandbox or the policy of this job
+		if opts.Sandbox != nil {
+			if err := DeleteSandbox(context.TODO(), client, opts.Sandbox.Namespace); err != nil {
+				l.V(logger.ImportantLevel).Error(err, "failed to remove the sandbox of the fuzz job", "namespace", opts.Sandbox.Namespace)
+			}
+		} else if len(policy) > 0 {
+			if err := RemoveFuzzJobTraffic(context.TODO(), client, pod.Namespace, policy); err != nil {
+				l.V(logger.ImportantLevel).Error(err, "failed to remove the NetworkPolicy of the fuzz job", "networkPolicy", policy, "namespace", pod.Namespace)
+			}
+		}
+		return err
 	}
 
-	// TODO wait until the job is finished
-	var _ = createdJob
-
-	l.V(logger.InfoLevel).Info("completed job", "jobName", restlerJob.Name)
-
+	l.V(logger.InfoLevel).Info("started fuzz job", "jobName", restlerJob.Name, "jobNamespace", restlerJob.Namespace)
 	return nil
 }
+
+// failFuzzRun marks a fuzz run that couldn't start as failed
+func failFuzzRun(l logger.Logger, client kubernetes.Interface, run *v1.ConfigMap, message string) {
+	err := UpdateFuzzRunStatus(context.TODO(), client, run.Namespace, run.Name, nil, func(status *FuzzRunStatus) {
+		now := time.Now().UTC()
+		status.Phase = FuzzRunFailed
+		status.Message = message
+		status.CompletionTime = &now
+	})
+	if err != nil {
+		l.V(logger.ImportantLevel).Error(err, "failed to mark fuzz run as failed", "fuzzRun", run.Name, "namespace", run.Namespace)
+	}
+}
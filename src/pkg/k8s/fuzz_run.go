@@ -0,0 +1,323 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/job"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/util"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"strings"
+	"time"
+)
+
+// A fuzz run is stored as a ConfigMap next to the target pod,
+// the controller creates it when it starts a fuzz job and the restlerwrapper updates its status when it is done
+const (
+	FuzzRunPrefix = "cnfuzz-run-"
+	// FuzzRunLabel label that marks ConfigMaps as fuzz runs
+	FuzzRunLabel = "cnfuzz/fuzz-run"
+	// FuzzRunPodLabel label with the name of the target pod
+	FuzzRunPodLabel = "cnfuzz/pod"
+	// FuzzRunStatusKey key of the status inside the ConfigMap
+	FuzzRunStatusKey = "status.json"
+	// FuzzRunFindingsKey key of the findings of a completed run inside the ConfigMap
+	FuzzRunFindingsKey = "findings.json"
+	// FuzzRunSpecKey key of the OpenAPI doc that the run fuzzes inside the ConfigMap
+	FuzzRunSpecKey = "spec.json"
+	// FuzzRunSpecDiffKey key of the differences with the spec of the previous run inside the ConfigMap
+	FuzzRunSpecDiffKey = "spec-diff.json"
+	// FuzzRunReportKey key of the run report of a completed run inside the ConfigMap, without its findings
+	FuzzRunReportKey = "report.json"
+	// maxSpecSize specs that are larger aren't kept with the run, ConfigMaps can't be larger than 1 MiB
+	maxSpecSize = 512 * 1024
+	// maxReportSize reports that are larger aren't kept with the run
+	maxReportSize = 128 * 1024
+	// maxFindingsSize findings that don't fit anymore aren't kept with the run
+	maxFindingsSize = 192 * 1024
+)
+
+// FuzzRunPhase phase of a fuzz run
+type FuzzRunPhase string
+
+const (
+	FuzzRunRunning   FuzzRunPhase = "Running"
+	FuzzRunCompleted FuzzRunPhase = "Completed"
+	FuzzRunFailed    FuzzRunPhase = "Failed"
+)
+
+// FuzzRunStatus status of a fuzz run
+type FuzzRunStatus struct {
+	Phase FuzzRunPhase `json:"phase"`
+	Pod   string       `json:"pod"`
+	// Target workload of the pod in the format <namespace>/<name>, findings are tracked per target
+	Target string `json:"target"`
+	// Images keys of the images inside the pod in the format <hash type>:<hash>
+	Images []string `json:"images,omitempty"`
+	// Repository source repository of the target
+	Repository string `json:"repository,omitempty"`
+	// RefuzzToken value of the refuzz annotation of the pod when the run started
+	RefuzzToken string `json:"refuzzToken,omitempty"`
+	// Operations operations the run is limited to in the format <METHOD> <path>, all operations are fuzzed when empty
+	Operations []string `json:"operations,omitempty"`
+	// SpecDiff summary of the differences with the spec of the previous run of the target
+	SpecDiff *FuzzRunSpecDiff `json:"specDiff,omitempty"`
+	Job      string           `json:"job,omitempty"`
+	// JobNamespace namespace of the job when it doesn't run in the namespace of the run
+	JobNamespace string `json:"jobNamespace,omitempty"`
+	// Sandbox namespace with the copy of the pod that the job fuzzes, removed when the run is done
+	Sandbox string `json:"sandbox,omitempty"`
+	// Message reason why the run failed, or why the findings of the completed run couldn't be recorded
+	Message        string           `json:"message,omitempty"`
+	StartTime      time.Time        `json:"startTime"`
+	CompletionTime *time.Time       `json:"completionTime,omitempty"`
+	Coverage       *FuzzRunCoverage `json:"coverage,omitempty"`
+	// Findings number of findings per severity
+	Findings map[string]int `json:"findings,omitempty"`
+	// Reports paths of the reports of the run on the API of the controller
+	Reports []string `json:"reports,omitempty"`
+	// OmittedFindings number of findings that were left out of the run because they didn't fit inside the ConfigMap
+	OmittedFindings int `json:"omittedFindings,omitempty"`
+	// Recorded whether the controller stored the findings of the completed run
+	Recorded      bool `json:"recorded,omitempty"`
+	NewFindings   int  `json:"newFindings,omitempty"`
+	FixedFindings int  `json:"fixedFindings,omitempty"`
+}
+
+// FuzzRunCoverage number of operations of the API that were exercised during the run
+type FuzzRunCoverage struct {
+	Total     int `json:"total"`
+	Attempted int `json:"attempted"`
+	Succeeded int `json:"succeeded"`
+	// Blocked number of operations that never succeeded per blocking reason
+	Blocked map[string]int `json:"blocked,omitempty"`
+}
+
+// FuzzRunSpecDiff number of operations that changed since the previous run of the target
+type FuzzRunSpecDiff struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+	// Breaking number of changes that can break clients
+	Breaking int `json:"breaking"`
+}
+
+// FuzzRunName returns the name of the fuzz run of a fuzz job, every job has its own run
+// the run gets the unique suffix of the job, so the runs of a pod stay next to each other
+func FuzzRunName(jobName string) string {
+	return FuzzRunPrefix + strings.TrimPrefix(jobName, job.JobPrefix)
+}
+
+// FuzzRunTarget returns the target of the fuzz runs of a pod
+func FuzzRunTarget(pod *v1.Pod) string {
+	return pod.Namespace + "/" + util.WorkloadName(&pod.ObjectMeta)
+}
+
+// CreateFuzzRun creates the fuzz run of a pod in the running phase, with the spec and the spec diff of the options
+// the run is created in the namespace of the pod, the job can run in another namespace
+// the run is named after its job and fails when it already exists, the runs of earlier jobs of the pod are kept
+func CreateFuzzRun(ctx context.Context, l logger.Logger, client kubernetes.Interface, pod *v1.Pod, jobName string, jobNamespace string, opts FuzzJobOptions) (*v1.ConfigMap, error) {
+	var images []string
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if len(containerStatus.ImageID) == 0 {
+			continue
+		}
+		hash, hashType := util.SplitImageId(l, containerStatus.ImageID)
+		images = append(images, fmt.Sprintf("%s:%s", hashType, hash))
+	}
+	annos := GetAnnotations(&pod.ObjectMeta)
+	status := FuzzRunStatus{
+		Phase:       FuzzRunRunning,
+		Pod:         pod.Name,
+		Target:      FuzzRunTarget(pod),
+		Images:      images,
+		Repository:  annos.Repository,
+		RefuzzToken: annos.Refuzz,
+		Operations:  opts.Operations,
+		Job:         jobName,
+		StartTime:   time.Now().UTC(),
+	}
+	if jobNamespace != pod.Namespace {
+		status.JobNamespace = jobNamespace
+	}
+	if opts.Sandbox != nil {
+		status.Sandbox = opts.Sandbox.Namespace
+	}
+	runData := make(map[string]string)
+	if opts.SpecDiff != nil {
+		status.SpecDiff = &FuzzRunSpecDiff{
+			Added:    len(opts.SpecDiff.Added),
+			Removed:  len(opts.SpecDiff.Removed),
+			Changed:  len(opts.SpecDiff.Changed),
+			Breaking: len(opts.SpecDiff.Breaking()),
+		}
+		diffData, err := json.Marshal(opts.SpecDiff)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode spec diff: %w", err)
+		}
+		runData[FuzzRunSpecDiffKey] = string(diffData)
+	}
+	if len(opts.Spec) > maxSpecSize {
+		l.V(logger.InfoLevel).Info("OpenAPI doc is too large to keep with the fuzz run, the next run can't be compared with it", "pod", pod.Name, "size", len(opts.Spec))
+	} else if len(opts.Spec) > 0 {
+		runData[FuzzRunSpecKey] = string(opts.Spec)
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode fuzz run status: %w", err)
+	}
+	runData[FuzzRunStatusKey] = string(data)
+	run := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      FuzzRunName(jobName),
+			Namespace: pod.Namespace,
+			Labels: map[string]string{
+				FuzzRunLabel:    "true",
+				FuzzRunPodLabel: pod.Name,
+			},
+		},
+		Data: runData,
+	}
+	created, err := client.CoreV1().ConfigMaps(pod.Namespace).Create(ctx, run, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fuzz run for pod %s: %w", pod.Name, err)
+	}
+	return created, nil
+}
+
+// FuzzRunOwnerReference returns a reference to a fuzz run for the objects that belong to the run
+func FuzzRunOwnerReference(run *v1.ConfigMap) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Name:       run.Name,
+		UID:        run.UID,
+	}
+}
+
+// GetJobNamespace returns the namespace of the job of a fuzz run in the namespace runNamespace
+func (status FuzzRunStatus) GetJobNamespace(runNamespace string) string {
+	if len(status.JobNamespace) > 0 {
+		return status.JobNamespace
+	}
+	return runNamespace
+}
+
+// GetFuzzRunStatus reads the status of a fuzz run
+func GetFuzzRunStatus(run *v1.ConfigMap) (FuzzRunStatus, error) {
+	status := FuzzRunStatus{}
+	data, found := run.Data[FuzzRunStatusKey]
+	if !found {
+		return status, fmt.Errorf("fuzz run %s has no status", run.Name)
+	}
+	if err := json.Unmarshal([]byte(data), &status); err != nil {
+		return status, fmt.Errorf("failed to decode status of fuzz run %s: %w", run.Name, err)
+	}
+	return status, nil
+}
+
+// CompleteFuzzRun moves a fuzz run to the completed phase with the findings and the run report of the job, update sets the results of the run
+// findingsData is a JSON array, the findings that don't fit inside the run are left out and counted in the status
+// a report that is too large to keep with the run is left out, the run then has no report locations
+func CompleteFuzzRun(ctx context.Context, l logger.Logger, client kubernetes.Interface, namespace string, name string, findingsData []byte, reportData []byte, update func(status *FuzzRunStatus)) error {
+	findingsData, omitted, err := truncateFindings(findingsData, maxFindingsSize)
+	if err != nil {
+		return err
+	}
+	if omitted > 0 {
+		l.V(logger.ImportantLevel).Info("findings are too large to keep with the fuzz run, left out the last findings", "fuzzRun", name, "omitted", omitted)
+	}
+	data := map[string]string{FuzzRunFindingsKey: string(findingsData)}
+	keepReport := len(reportData) <= maxReportSize
+	if keepReport {
+		data[FuzzRunReportKey] = string(reportData)
+	} else {
+		l.V(logger.InfoLevel).Info("run report is too large to keep with the fuzz run", "fuzzRun", name, "size", len(reportData))
+	}
+	return UpdateFuzzRunStatus(ctx, client, namespace, name, data, func(status *FuzzRunStatus) {
+		completed := time.Now().UTC()
+		status.Phase = FuzzRunCompleted
+		status.CompletionTime = &completed
+		update(status)
+		status.OmittedFindings = omitted
+		if !keepReport {
+			status.Reports = nil
+		}
+	})
+}
+
+// truncateFindings keeps the findings of the JSON array findingsData that fit inside maxSize
+// returns the kept findings and the number of findings that were left out
+func truncateFindings(findingsData []byte, maxSize int) ([]byte, int, error) {
+	if len(findingsData) <= maxSize {
+		return findingsData, 0, nil
+	}
+	var all []json.RawMessage
+	if err := json.Unmarshal(findingsData, &all); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode findings: %w", err)
+	}
+	// the brackets of the array and a comma between the findings
+	size := 2
+	kept := 0
+	for ; kept < len(all); kept++ {
+		size += len(all[kept]) + 1
+		if size > maxSize {
+			break
+		}
+	}
+	truncated, err := json.Marshal(all[:kept])
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to encode findings: %w", err)
+	}
+	return truncated, len(all) - kept, nil
+}
+
+// UpdateFuzzRunStatus updates the status of a fuzz run with update and stores the extra data next to it
+// retries when the run was changed in the meantime
+func UpdateFuzzRunStatus(ctx context.Context, client kubernetes.Interface, namespace string, name string, data map[string]string, update func(status *FuzzRunStatus)) error {
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		run, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get fuzz run %s: %w", name, err)
+		}
+		status, err := GetFuzzRunStatus(run)
+		if err != nil {
+			return err
+		}
+		update(&status)
+		statusData, err := json.Marshal(status)
+		if err != nil {
+			return fmt.Errorf("failed to encode fuzz run status: %w", err)
+		}
+		if run.Data == nil {
+			run.Data = make(map[string]string)
+		}
+		for key, value := range data {
+			run.Data[key] = value
+		}
+		run.Data[FuzzRunStatusKey] = string(statusData)
+		_, err = configMaps.Update(ctx, run, metav1.UpdateOptions{})
+		return err
+	})
+}
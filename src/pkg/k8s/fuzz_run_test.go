@@ -0,0 +1,167 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/diff"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/job"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"strings"
+	"testing"
+)
+
+func TestFuzzRun(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default", Labels: map[string]string{"app": "todo"}},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+			{Name: "api", ImageID: "docker-pullable://localhost:5000/todo-api@sha256:5add8f"},
+		}},
+	}
+
+	run, err := CreateFuzzRun(ctx, logger.CreateDebugLogger(), client, pod, "cnfuzz-job-todo-api", "default", FuzzJobOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "cnfuzz-run-todo-api", run.Name)
+	assert.Equal(t, "todo-api", run.Labels[FuzzRunPodLabel])
+	status, err := GetFuzzRunStatus(run)
+	require.NoError(t, err)
+	assert.Equal(t, FuzzRunRunning, status.Phase)
+	assert.Equal(t, "cnfuzz-job-todo-api", status.Job)
+	assert.Equal(t, "default/todo", status.Target)
+	assert.Equal(t, []string{"sha256:5add8f"}, status.Images)
+
+	err = UpdateFuzzRunStatus(ctx, client, "default", run.Name, map[string]string{FuzzRunFindingsKey: "[]"}, func(status *FuzzRunStatus) {
+		status.Phase = FuzzRunCompleted
+		status.Coverage = &FuzzRunCoverage{Total: 4, Attempted: 3, Succeeded: 2}
+	})
+	require.NoError(t, err)
+	run, err = client.CoreV1().ConfigMaps("default").Get(ctx, run.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	status, err = GetFuzzRunStatus(run)
+	require.NoError(t, err)
+	assert.Equal(t, FuzzRunCompleted, status.Phase)
+	assert.Equal(t, 2, status.Coverage.Succeeded)
+	assert.Equal(t, "todo-api", status.Pod)
+	assert.Equal(t, "[]", run.Data[FuzzRunFindingsKey])
+
+	// a run belongs to a single job
+	_, err = CreateFuzzRun(ctx, logger.CreateDebugLogger(), client, pod, "cnfuzz-job-todo-api", "default", FuzzJobOptions{})
+	assert.Error(t, err)
+
+	// the next job of the pod gets its own run, the previous run is kept
+	previous := run
+	run, err = CreateFuzzRun(ctx, logger.CreateDebugLogger(), client, pod, "cnfuzz-job-todo-api-x2x4z", "default", FuzzJobOptions{
+		Options:  job.Options{Operations: []string{"POST /todos"}},
+		Spec:     []byte(`{"openapi": "3.0.3"}`),
+		SpecDiff: &diff.Diff{Added: []string{"POST /todos"}, Changes: []diff.Change{{Operation: "POST /todos", Kind: diff.OperationKind, Type: diff.Added}}},
+	})
+	require.NoError(t, err)
+	status, err = GetFuzzRunStatus(run)
+	require.NoError(t, err)
+	assert.Equal(t, FuzzRunRunning, status.Phase)
+	assert.Equal(t, []string{"POST /todos"}, status.Operations)
+	assert.Equal(t, &FuzzRunSpecDiff{Added: 1}, status.SpecDiff)
+	assert.Equal(t, `{"openapi": "3.0.3"}`, run.Data[FuzzRunSpecKey])
+	assert.Contains(t, run.Data[FuzzRunSpecDiffKey], `"added":["POST /todos"]`)
+	assert.Equal(t, "cnfuzz-run-todo-api-x2x4z", run.Name)
+	assert.Nil(t, status.Coverage)
+	assert.NotContains(t, run.Data, FuzzRunFindingsKey)
+	previous, err = client.CoreV1().ConfigMaps("default").Get(ctx, previous.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	status, err = GetFuzzRunStatus(previous)
+	require.NoError(t, err)
+	assert.Equal(t, FuzzRunCompleted, status.Phase)
+	assert.Equal(t, "[]", previous.Data[FuzzRunFindingsKey])
+
+	assert.Error(t, UpdateFuzzRunStatus(ctx, client, "default", "missing", nil, func(status *FuzzRunStatus) {}))
+}
+
+func TestCompleteFuzzRun(t *testing.T) {
+	ctx := context.Background()
+	l := logger.CreateDebugLogger()
+	client := fake.NewSimpleClientset()
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default"}}
+	reports := []string{"/api/v1/runs/default/cnfuzz-run-todo-api/report"}
+
+	run, err := CreateFuzzRun(ctx, l, client, pod, "cnfuzz-job-todo-api", "default", FuzzJobOptions{})
+	require.NoError(t, err)
+	err = CompleteFuzzRun(ctx, l, client, "default", run.Name, []byte("[]"), []byte(`{"PodName": "todo-api"}`), func(status *FuzzRunStatus) {
+		status.Reports = reports
+	})
+	require.NoError(t, err)
+	run, err = client.CoreV1().ConfigMaps("default").Get(ctx, run.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	status, err := GetFuzzRunStatus(run)
+	require.NoError(t, err)
+	assert.Equal(t, FuzzRunCompleted, status.Phase)
+	assert.NotNil(t, status.CompletionTime)
+	assert.Equal(t, reports, status.Reports)
+	assert.Equal(t, "[]", run.Data[FuzzRunFindingsKey])
+	assert.Equal(t, `{"PodName": "todo-api"}`, run.Data[FuzzRunReportKey])
+
+	// a report that doesn't fit inside the run is left out, together with its locations
+	run, err = CreateFuzzRun(ctx, l, client, pod, "cnfuzz-job-todo-api-x2x4z", "default", FuzzJobOptions{})
+	require.NoError(t, err)
+	err = CompleteFuzzRun(ctx, l, client, "default", run.Name, []byte("[]"), make([]byte, maxReportSize+1), func(status *FuzzRunStatus) {
+		status.Reports = reports
+	})
+	require.NoError(t, err)
+	run, err = client.CoreV1().ConfigMaps("default").Get(ctx, run.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	status, err = GetFuzzRunStatus(run)
+	require.NoError(t, err)
+	assert.Equal(t, FuzzRunCompleted, status.Phase)
+	assert.Empty(t, status.Reports)
+	assert.NotContains(t, run.Data, FuzzRunReportKey)
+}
+
+func TestCompleteFuzzRunTruncatesFindings(t *testing.T) {
+	ctx := context.Background()
+	l := logger.CreateDebugLogger()
+	client := fake.NewSimpleClientset()
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default"}}
+	finding := `{"checker":"main_driver","request":"` + strings.Repeat("a", 1000) + `"}`
+	findings := make([]string, 0, 300)
+	for i := 0; i < 300; i++ {
+		findings = append(findings, finding)
+	}
+
+	run, err := CreateFuzzRun(ctx, l, client, pod, "cnfuzz-job-todo-api", "default", FuzzJobOptions{})
+	require.NoError(t, err)
+	err = CompleteFuzzRun(ctx, l, client, "default", run.Name, []byte("["+strings.Join(findings, ",")+"]"), nil, func(status *FuzzRunStatus) {})
+	require.NoError(t, err)
+	run, err = client.CoreV1().ConfigMaps("default").Get(ctx, run.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	status, err := GetFuzzRunStatus(run)
+	require.NoError(t, err)
+	var kept []json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(run.Data[FuzzRunFindingsKey]), &kept))
+	assert.LessOrEqual(t, len(run.Data[FuzzRunFindingsKey]), maxFindingsSize)
+	assert.NotEmpty(t, kept)
+	assert.Equal(t, 300, len(kept)+status.OmittedFindings)
+	assert.Positive(t, status.OmittedFindings)
+
+	assert.Error(t, CompleteFuzzRun(ctx, l, client, "default", run.Name, []byte("{"+strings.Repeat(" ", maxFindingsSize)), nil, func(status *FuzzRunStatus) {}))
+}
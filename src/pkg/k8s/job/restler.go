@@ -17,6 +17,7 @@
 package job
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/suecodelabs/cnfuzz/src/pkg/config"
 	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/openapi"
@@ -25,21 +26,92 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// TODO update this desc:
+const (
+	// JwtKeyEnv environment variable inside the restlerwrapper container that holds the key for minting JWTs
+	JwtKeyEnv = "CNFUZZ_JWT_KEY"
+	// JobPrefix prefix of the names of fuzz jobs
+	JobPrefix = "cnfuzz-job-"
+	// JobLabel label that marks jobs as fuzz jobs
+	JobLabel = "cnfuzz/fuzz-job"
+	// TargetNamespaceLabel label with the namespace of the target pod of a fuzz job
+	TargetNamespaceLabel = "cnfuzz/target-namespace"
+	// ContainerName name of the restlerwrapper container, so the pod template patch can refer to it
+	ContainerName = "restlerwrapper"
+	// maxJobNameLength Kubernetes copies the job name into a label of its pods, label values can't be longer
+	maxJobNameLength = 63
+	// jobSuffixLength length of the random suffix that makes the name of every fuzz job of a pod unique
+	jobSuffixLength = 5
+)
+
+// Options options of a single fuzz job
+type Options struct {
+	// Name name of the job, a unique name is generated when empty
+	Name string
+	// Operations only these operations (in the format <METHOD> <path>) are fuzzed, all operations are fuzzed when empty
+	Operations []string
+	// TimeBudget time budget in hours, overrides the time budget of the RESTler config when set
+	TimeBudget string
+	// Sandbox copy of the target pod that is fuzzed instead of the target, the job still belongs to the target
+	Sandbox *v1.Pod
+	// JwtKeySecret secret with the signing key of JWTs for this target, overrides the key secret of the auth config
+	// the secret has to exist in the namespace of the job
+	JwtKeySecret *config.SecretKeyRef
+}
+
+// JobName generates a unique name for a fuzz job of a pod
+func JobName(podName string) string {
+	name := JobPrefix + podName
+	if maxLength := maxJobNameLength - jobSuffixLength - 1; len(name) > maxLength {
+		name = strings.TrimRight(name[:maxLength], "-.")
+	}
+	return name + "-" + rand.String(jobSuffixLength)
+}
 
-// CreateRestlerWrapperJob creates a Kubernetes Job for the cnfuzz wrapper around the RESTler fuzzer
-// this includes an init container that gets the OpenAPI doc from the target API with curl and volumes for transferring the information
-// it uses values from the FuzzConfig to configure the fuzz command that runs inside the RESTler container
-// returned job hasn't started yet
-func CreateRestlerWrapperJob(l logger.Logger, targetPod *v1.Pod, cnf *config.CnFuzzConfig, dDoc openapi.UnParsedOpenApiDoc) *batchv1.Job {
+// Namespace returns the namespace the fuzz job of a pod runs in
+func Namespace(cnf *config.CnFuzzConfig, targetPod *v1.Pod) string {
+	if namespace := cnf.RestlerWrapperConfig.JobConfig.GetNamespace(); len(namespace) > 0 {
+		return namespace
+	}
+	return targetPod.Namespace
+}
+
+func jobLabels(targetPod *v1.Pod) map[string]string {
+	return map[string]string{JobLabel: "true", TargetNamespaceLabel: targetPod.Namespace}
+}
+
+// activeDeadline returns the time in seconds a job with the time budget (in hours) can run, nil when the time budget isn't a number
+func activeDeadline(timeBudget string, margin time.Duration) *int64 {
+	budget, err := strconv.ParseFloat(timeBudget, 64)
+	if err != nil || budget <= 0 {
+		return nil
+	}
+	deadline := int64((time.Duration(budget*float64(time.Hour)) + margin).Seconds())
+	return &deadline
+}
+
+// CreateRestlerWrapperJob creates a Kubernetes Job that runs the cnfuzz wrapper around the RESTler fuzzer against the target pod
+// the wrapper gets the OpenAPI doc from the target itself, the RESTler config and the auth config are passed as arguments
+// the wrapper reports its results to the fuzz run with name fuzzRun, if set
+// opts can name the job, limit the operations and the time budget of the job, and let it fuzz a sandbox copy of the target
+// the job gets a unique name (unless opts names it) and runs in the job namespace of the config or the namespace of the target,
+// it is stopped when it runs longer than its time budget plus the deadline margin of the job config
+// the pod template of the config is applied last, the returned job hasn't started yet
+func CreateRestlerWrapperJob(l logger.Logger, targetPod *v1.Pod, cnf *config.CnFuzzConfig, dDoc openapi.UnParsedOpenApiDoc, fuzzRun string, opts Options) *batchv1.Job {
 	restlerCnf := cnf.RestlerWrapperConfig.RestlerConfig
 	imgCnf := cnf.RestlerWrapperConfig.ImageConfig
 
-	jobName := "cnfuzz-job-" + targetPod.Name
-	namespace := targetPod.Namespace
-	containerName := "cnfuzz-job-" + targetPod.Name + "-restler"
+	jobName := opts.Name
+	if len(jobName) == 0 {
+		jobName = JobName(targetPod.Name)
+	}
+	namespace := Namespace(cnf, targetPod)
 	serviceAcc := cnf.RestlerWrapperConfig.ServiceAccount
 
 	var containerImage string
@@ -60,8 +132,63 @@ func CreateRestlerWrapperJob(l logger.Logger, targetPod *v1.Pod, cnf *config.CnF
 	memoryRequest := resource.MustParse(restlerCnf.MemoryRequest)
 	cpuLimit := resource.MustParse(restlerCnf.CpuLimit)
 	memoryLimit := resource.MustParse(restlerCnf.MemoryLimit)
+	timeBudget := restlerCnf.TimeBudget
+	if len(opts.TimeBudget) > 0 {
+		timeBudget = opts.TimeBudget
+	}
+	jobCnf := cnf.RestlerWrapperConfig.JobConfig
+	// the job config is validated when it is loaded
+	ttlAfterFinished, _ := jobCnf.GetTtlAfterFinished()
+	deadlineMargin, _ := jobCnf.GetDeadlineMargin()
+	var backoffLimit *int32
+	if jobCnf != nil {
+		backoffLimit = jobCnf.BackoffLimit
+	}
 
-	restlerWrapperArgs := []string{"--pod", targetPod.Name, "--ns", targetPod.Namespace, "--port", targetPort, "--d-doc", targetDiscDocLoc, "--time-budget", cnf.RestlerWrapperConfig.RestlerConfig.TimeBudget}
+	restlerWrapperArgs := []string{"--port", targetPort, "--d-doc", targetDiscDocLoc, "--time-budget", timeBudget}
+	if opts.Sandbox != nil {
+		restlerWrapperArgs = append(restlerWrapperArgs, "--pod", opts.Sandbox.Name, "--ns", opts.Sandbox.Namespace)
+		if len(fuzzRun) > 0 {
+			restlerWrapperArgs = append(restlerWrapperArgs, "--fuzz-run-namespace", targetPod.Namespace)
+		}
+	} else {
+		restlerWrapperArgs = append(restlerWrapperArgs, "--pod", targetPod.Name, "--ns", targetPod.Namespace)
+	}
+	restlerWrapperArgs = appendIfSet(restlerWrapperArgs, "--fuzz-run", fuzzRun)
+	for _, operation := range opts.Operations {
+		restlerWrapperArgs = append(restlerWrapperArgs, "--operation", operation)
+	}
+	if cnf.AuthConfig != nil && len(cnf.AuthConfig.PreferredScheme) > 0 {
+		restlerWrapperArgs = append(restlerWrapperArgs, "--auth-scheme", cnf.AuthConfig.PreferredScheme)
+	}
+	restlerWrapperEnv := []v1.EnvVar{
+		{
+			Name:  "RESTLER_TELEMETRY_OPTOUT",
+			Value: telemetryOptOut,
+		},
+	}
+	jwtKeySecret := opts.JwtKeySecret
+	if cnf.AuthConfig != nil && cnf.AuthConfig.Jwt != nil {
+		jwtCnf := cnf.AuthConfig.Jwt
+		restlerWrapperArgs = appendIfSet(restlerWrapperArgs, "--jwt-algorithm", jwtCnf.Algorithm)
+		restlerWrapperArgs = appendIfSet(restlerWrapperArgs, "--jwt-key-id", jwtCnf.KeyId)
+		restlerWrapperArgs = appendIfSet(restlerWrapperArgs, "--jwt-claims", jwtCnf.Claims)
+		restlerWrapperArgs = appendIfSet(restlerWrapperArgs, "--jwt-lifetime", jwtCnf.Lifetime)
+		if jwtKeySecret == nil {
+			jwtKeySecret = jwtCnf.KeySecret
+		}
+	}
+	if jwtKeySecret != nil && len(jwtKeySecret.Name) > 0 {
+		restlerWrapperEnv = append(restlerWrapperEnv, v1.EnvVar{
+			Name: JwtKeyEnv,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: jwtKeySecret.Name},
+					Key:                  jwtKeySecret.Key,
+				},
+			},
+		})
+	}
 	if config.RunCnf.IsDebugMode {
 		restlerWrapperArgs = append(restlerWrapperArgs, "--debug")
 	}
@@ -73,35 +200,24 @@ func CreateRestlerWrapperJob(l logger.Logger, targetPod *v1.Pod, cnf *config.CnF
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        jobName,
 			Namespace:   namespace,
+			Labels:      jobLabels(targetPod),
 			Annotations: map[string]string{"cnfuzz/ignore": "true"},
 		},
 		Spec: batchv1.JobSpec{
+			BackoffLimit:            backoffLimit,
+			ActiveDeadlineSeconds:   activeDeadline(timeBudget, deadlineMargin),
+			TTLSecondsAfterFinished: ttlAfterFinished,
 			Template: v1.PodTemplateSpec{
+				// NetworkPolicies of the target select the fuzz jobs by these labels
+				ObjectMeta: metav1.ObjectMeta{Labels: jobLabels(targetPod)},
 				Spec: v1.PodSpec{
-					Volumes: []v1.Volume{
-						{
-							Name: "auth-script-map",
-							VolumeSource: v1.VolumeSource{
-								ConfigMap: &v1.ConfigMapVolumeSource{
-									LocalObjectReference: v1.LocalObjectReference{
-										Name: "auth-script",
-									},
-								},
-							},
-						},
-					},
 					Containers: []v1.Container{
 						{
-							Name:            containerName,
+							Name:            ContainerName,
 							Image:           containerImage,
 							ImagePullPolicy: pullPolicy,
 							Args:            restlerWrapperArgs,
-							Env: []v1.EnvVar{
-								{
-									Name:  "RESTLER_TELEMETRY_OPTOUT",
-									Value: telemetryOptOut,
-								},
-							},
+							Env:             restlerWrapperEnv,
 							Resources: v1.ResourceRequirements{
 								Limits: v1.ResourceList{
 									v1.ResourceCPU:    cpuLimit,
@@ -120,5 +236,43 @@ func CreateRestlerWrapperJob(l logger.Logger, targetPod *v1.Pod, cnf *config.CnF
 			},
 		},
 	}
+	patch, err := cnf.RestlerWrapperConfig.GetPodTemplatePatch()
+	if err == nil {
+		err = PatchPodTemplate(&restlerSpec.Spec.Template, patch)
+	}
+	if err != nil {
+		// the patch is validated when the config is loaded
+		l.V(logger.ImportantLevel).Error(err, "failed to apply the pod template of the restlerwrapper, the job uses the default pod template", "jobName", jobName)
+	}
 	return restlerSpec
 }
+
+// PatchPodTemplate applies a strategic merge patch to a pod template
+// containers, env vars, volumes and image pull secrets are merged by name, other lists like tolerations are replaced
+func PatchPodTemplate(template *v1.PodTemplateSpec, patch []byte) error {
+	if len(patch) == 0 {
+		return nil
+	}
+	original, err := json.Marshal(template)
+	if err != nil {
+		return fmt.Errorf("failed to encode pod template: %w", err)
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, patch, v1.PodTemplateSpec{})
+	if err != nil {
+		return fmt.Errorf("failed to patch pod template: %w", err)
+	}
+	result := v1.PodTemplateSpec{}
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return fmt.Errorf("failed to decode patched pod template: %w", err)
+	}
+	*template = result
+	return nil
+}
+
+// appendIfSet appends a flag and its value to args when the value isn't empty
+func appendIfSet(args []string, flag string, value string) []string {
+	if len(value) > 0 {
+		return append(args, flag, value)
+	}
+	return args
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package job
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/openapi"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	"gopkg.in/yaml.v2"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const podTemplate = `
+image:
+  image: ghcr.io/suecodelabs/cnfuzz-restlerwrapper
+restler:
+  time_budget: "1"
+  cpu_limit: 1000m
+  memory_limit: 1024Mi
+  cpu_request: 500m
+  memory_request: 512Mi
+pod_template:
+  metadata:
+    labels:
+      team: security
+  spec:
+    nodeSelector:
+      pool: fuzzing
+    tolerations:
+      - key: dedicated
+        operator: Equal
+        value: fuzzing
+        effect: NoSchedule
+    priorityClassName: low
+    imagePullSecrets:
+      - name: registry
+    securityContext:
+      runAsNonRoot: true
+      runAsUser: 1000
+    containers:
+      - name: restlerwrapper
+        securityContext:
+          readOnlyRootFilesystem: true
+          allowPrivilegeEscalation: false
+        env:
+          - name: HTTPS_PROXY
+            value: http://proxy:3128
+        volumeMounts:
+          - name: tmp
+            mountPath: /tmp
+    volumes:
+      - name: tmp
+        emptyDir: {}
+`
+
+func TestJobName(t *testing.T) {
+	name := JobName("todo-api")
+	assert.True(t, strings.HasPrefix(name, "cnfuzz-job-todo-api-"))
+	assert.Len(t, name, len("cnfuzz-job-todo-api-")+jobSuffixLength)
+	assert.NotEqual(t, name, JobName("todo-api"))
+
+	long := JobName("todo-api-" + strings.Repeat("a", 40) + "-7c9d8f6b5-x2x4z")
+	assert.LessOrEqual(t, len(long), maxJobNameLength)
+	assert.NotContains(t, long, "--")
+}
+
+func TestActiveDeadline(t *testing.T) {
+	deadline := activeDeadline("0.5", 30*time.Minute)
+	require.NotNil(t, deadline)
+	assert.Equal(t, int64(3600), *deadline)
+	assert.Nil(t, activeDeadline("", 30*time.Minute))
+	assert.Nil(t, activeDeadline("one", 30*time.Minute))
+}
+
+func TestCreateRestlerWrapperJobWithPodTemplate(t *testing.T) {
+	wrapperCnf := &config.RestlerWrapperConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(podTemplate), wrapperCnf))
+	cnf := &config.CnFuzzConfig{RestlerWrapperConfig: wrapperCnf}
+	uri, _ := url.Parse("http://10.0.0.1:8080/openapi.json")
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default"}}
+
+	j := CreateRestlerWrapperJob(logger.CreateDebugLogger(), pod, cnf, openapi.UnParsedOpenApiDoc{Uri: uri}, "cnfuzz-run-todo-api", Options{})
+	spec := j.Spec.Template.Spec
+	assert.Equal(t, "security", j.Spec.Template.Labels["team"])
+	assert.Equal(t, map[string]string{"pool": "fuzzing"}, spec.NodeSelector)
+	require.Len(t, spec.Tolerations, 1)
+	assert.Equal(t, "dedicated", spec.Tolerations[0].Key)
+	assert.Equal(t, "low", spec.PriorityClassName)
+	assert.Equal(t, []v1.LocalObjectReference{{Name: "registry"}}, spec.ImagePullSecrets)
+	require.NotNil(t, spec.SecurityContext.RunAsNonRoot)
+	assert.True(t, *spec.SecurityContext.RunAsNonRoot)
+	require.Len(t, spec.Volumes, 1)
+	assert.NotNil(t, spec.Volumes[0].EmptyDir)
+	assert.Equal(t, v1.RestartPolicyNever, spec.RestartPolicy)
+
+	// the patch is merged into the restlerwrapper container
+	require.Len(t, spec.Containers, 1)
+	container := spec.Containers[0]
+	assert.Equal(t, ContainerName, container.Name)
+	assert.Equal(t, "ghcr.io/suecodelabs/cnfuzz-restlerwrapper", container.Image)
+	assert.Contains(t, container.Args, "--fuzz-run")
+	require.NotNil(t, container.SecurityContext.ReadOnlyRootFilesystem)
+	assert.True(t, *container.SecurityContext.ReadOnlyRootFilesystem)
+	assert.ElementsMatch(t, []v1.EnvVar{{Name: "RESTLER_TELEMETRY_OPTOUT"}, {Name: "HTTPS_PROXY", Value: "http://proxy:3128"}}, container.Env)
+	assert.Equal(t, []v1.VolumeMount{{Name: "tmp", MountPath: "/tmp"}}, container.VolumeMounts)
+	assert.Equal(t, "1", container.Resources.Limits.Cpu().String())
+}
+
+func TestCreateRestlerWrapperJobWithJwtKeySecret(t *testing.T) {
+	wrapperCnf := &config.RestlerWrapperConfig{}
+	require.NoError(t, yaml.Unmarshal([]byte(podTemplate), wrapperCnf))
+	cnf := &config.CnFuzzConfig{
+		RestlerWrapperConfig: wrapperCnf,
+		AuthConfig:           &config.AuthConfig{Jwt: &config.JwtConfig{KeySecret: &config.SecretKeyRef{Name: "cnfuzz-jwt", Key: "key"}}},
+	}
+	uri, _ := url.Parse("http://10.0.0.1:8080/openapi.json")
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "todo-api", Namespace: "default"}}
+	jwtKey := func(j *batchv1.Job) *v1.SecretKeySelector {
+		for _, env := range j.Spec.Template.Spec.Containers[0].Env {
+			if env.Name == JwtKeyEnv {
+				return env.ValueFrom.SecretKeyRef
+			}
+		}
+		return nil
+	}
+
+	j := CreateRestlerWrapperJob(logger.CreateDebugLogger(), pod, cnf, openapi.UnParsedOpenApiDoc{Uri: uri}, "", Options{})
+	require.NotNil(t, jwtKey(j))
+	assert.Equal(t, "cnfuzz-jwt", jwtKey(j).Name)
+
+	// the secret of the target takes precedence over the secret of the config
+	j = CreateRestlerWrapperJob(logger.CreateDebugLogger(), pod, cnf, openapi.UnParsedOpenApiDoc{Uri: uri}, "", Options{
+		JwtKeySecret: &config.SecretKeyRef{Name: "todo-jwt", Key: "private.pem"},
+	})
+	require.NotNil(t, jwtKey(j))
+	assert.Equal(t, v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "todo-jwt"}, Key: "private.pem"}, *jwtKey(j))
+}
+
+func TestPatchPodTemplateInvalid(t *testing.T) {
+	template := &v1.PodTemplateSpec{}
+	assert.Error(t, PatchPodTemplate(template, []byte(`{"spec": {"nodeSelector": "pool"}}`)))
+	assert.NoError(t, PatchPodTemplate(template, nil))
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/job"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/util"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+const (
+	// ManagedLabel label of the objects the controller creates for the fuzz jobs
+	ManagedLabel = "cnfuzz/managed"
+	// NetworkPolicyPrefix prefix of the NetworkPolicies that allow traffic from the fuzz jobs to a target workload
+	NetworkPolicyPrefix = "cnfuzz-fuzz-jobs-"
+	// namespaceNameLabel label Kubernetes gives every namespace with its name
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+// managedMeta returns the metadata of an object the controller manages for the fuzz jobs
+func managedMeta(namespace string, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{ManagedLabel: "true"}}
+}
+
+// PrepareJobNamespace creates the dedicated namespace of the fuzz jobs when it doesn't exist,
+// with the service account of the jobs bound to the cluster role and copies of the ConfigMaps and the JWT key secret the jobs need
+// does nothing when the fuzz jobs run in the namespace of their target
+func PrepareJobNamespace(ctx context.Context, l logger.Logger, client kubernetes.Interface, cnf *config.CnFuzzConfig) error {
+	jobCnf := cnf.RestlerWrapperConfig.JobConfig
+	namespace := jobCnf.GetNamespace()
+	if len(namespace) == 0 {
+		return nil
+	}
+	nsCnf := jobCnf.Namespace
+
+	_, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = client.CoreV1().Namespaces().Create(ctx, &v1.Namespace{ObjectMeta: managedMeta("", namespace)}, metav1.CreateOptions{})
+		if err == nil {
+			l.V(logger.InfoLevel).Info("created namespace for the fuzz jobs", "namespace", namespace)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create namespace %s for the fuzz jobs: %w", namespace, err)
+	}
+
+	serviceAccount := cnf.RestlerWrapperConfig.ServiceAccount
+	if len(serviceAccount) > 0 {
+		_, err = client.CoreV1().ServiceAccounts(namespace).Create(ctx, &v1.ServiceAccount{ObjectMeta: managedMeta(namespace, serviceAccount)}, metav1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create service account %s for the fuzz jobs: %w", serviceAccount, err)
+		}
+		if len(nsCnf.ClusterRole) > 0 {
+			if err := bindClusterRole(ctx, client, namespace, serviceAccount, nsCnf.ClusterRole); err != nil {
+				return err
+			}
+		}
+	}
+
+	source := CurrentNamespace()
+	if source == namespace {
+		return nil
+	}
+	for _, name := range nsCnf.ConfigMaps {
+		if err := copyConfigMap(ctx, client, source, namespace, name); err != nil {
+			return err
+		}
+	}
+	if cnf.AuthConfig != nil && cnf.AuthConfig.Jwt != nil && cnf.AuthConfig.Jwt.KeySecret != nil && len(cnf.AuthConfig.Jwt.KeySecret.Name) > 0 {
+		if err := copySecret(ctx, client, source, namespace, cnf.AuthConfig.Jwt.KeySecret.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindClusterRole binds the service account of the fuzz jobs to the cluster role, so the jobs can reach targets in other namespaces
+func bindClusterRole(ctx context.Context, client kubernetes.Interface, namespace string, serviceAccount string, clusterRole string) error {
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: managedMeta("", "cnfuzz-jobs-"+namespace),
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: clusterRole},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: serviceAccount, Namespace: namespace}},
+	}
+	bindings := client.RbacV1().ClusterRoleBindings()
+	existing, err := bindings.Get(ctx, binding.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = bindings.Create(ctx, binding, metav1.CreateOptions{})
+	} else if err == nil && existing.RoleRef != binding.RoleRef {
+		// the role of a binding can't change
+		if err = bindings.Delete(ctx, binding.Name, metav1.DeleteOptions{}); err == nil {
+			_, err = bindings.Create(ctx, binding, metav1.CreateOptions{})
+		}
+	} else if err == nil {
+		existing.Subjects = binding.Subjects
+		_, err = bindings.Update(ctx, existing, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bind cluster role %s to the fuzz jobs: %w", clusterRole, err)
+	}
+	return nil
+}
+
+// copyConfigMap copies a ConfigMap into the namespace of the fuzz jobs, an existing copy is updated
+func copyConfigMap(ctx context.Context, client kubernetes.Interface, source string, namespace string, name string) error {
+	original, err := client.CoreV1().ConfigMaps(source).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get ConfigMap %s for the fuzz jobs: %w", name, err)
+	}
+	configMap := &v1.ConfigMap{ObjectMeta: managedMeta(namespace, name), Data: original.Data, BinaryData: original.BinaryData}
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy ConfigMap %s to namespace %s: %w", name, namespace, err)
+	}
+	return nil
+}
+
+// copySecret copies a secret into the namespace of the fuzz jobs, an existing copy is updated
+func copySecret(ctx context.Context, client kubernetes.Interface, source string, namespace string, name string) error {
+	original, err := client.CoreV1().Secrets(source).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s for the fuzz jobs: %w", name, err)
+	}
+	secret := &v1.Secret{ObjectMeta: managedMeta(namespace, name), Type: original.Type, Data: original.Data}
+	secrets := client.CoreV1().Secrets(namespace)
+	_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy secret %s to namespace %s: %w", name, namespace, err)
+	}
+	return nil
+}
+
+// AllowFuzzJobTraffic creates a NetworkPolicy that allows traffic from the fuzz jobs to the workload of the pod
+// the policy is only created when NetworkPolicies already isolate the pod, a new policy would block other traffic to the pod otherwise
+// returns the name of the policy when this call created it, so it can be removed when the fuzz job doesn't start
+func AllowFuzzJobTraffic(ctx context.Context, l logger.Logger, client kubernetes.Interface, cnf *config.CnFuzzConfig, pod *v1.Pod) (string, error) {
+	jobCnf := cnf.RestlerWrapperConfig.JobConfig
+	namespace := jobCnf.GetNamespace()
+	if len(namespace) == 0 || namespace == pod.Namespace || !jobCnf.Namespace.NetworkPolicies {
+		return "", nil
+	}
+	podLabels := make(map[string]string)
+	for key, value := range pod.Labels {
+		// changes with every new version of the workload
+		if key != "pod-template-hash" && key != "controller-revision-hash" {
+			podLabels[key] = value
+		}
+	}
+	if len(podLabels) == 0 {
+		l.V(logger.InfoLevel).Info("pod has no labels to select it with a NetworkPolicy, traffic from the fuzz jobs isn't allowed explicitly", "pod", pod.Name, "namespace", pod.Namespace)
+		return "", nil
+	}
+
+	policies := client.NetworkingV1().NetworkPolicies(pod.Namespace)
+	existing, err := policies.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list the NetworkPolicies of namespace %s: %w", pod.Namespace, err)
+	}
+	if !isolatedForIngress(existing.Items, pod) {
+		return "", nil
+	}
+
+	name := NetworkPolicyPrefix + util.WorkloadName(&pod.ObjectMeta)
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-.")
+	}
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: managedMeta(pod.Namespace, name),
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: podLabels},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{namespaceNameLabel: namespace}},
+					PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{job.JobLabel: "true"}},
+				}},
+			}},
+		},
+	}
+	_, err = policies.Create(ctx, policy, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		// other fuzz jobs of the workload may depend on the existing policy
+		_, err = policies.Update(ctx, policy, metav1.UpdateOptions{})
+		name = ""
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to allow traffic from the fuzz jobs to pod %s: %w", pod.Name, err)
+	}
+	return name, nil
+}
+
+// RemoveFuzzJobTraffic removes a NetworkPolicy that AllowFuzzJobTraffic created, a policy that doesn't exist is ignored
+func RemoveFuzzJobTraffic(ctx context.Context, client kubernetes.Interface, namespace string, name string) error {
+	err := client.NetworkingV1().NetworkPolicies(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to remove NetworkPolicy %s of namespace %s: %w", name, namespace, err)
+	}
+	return nil
+}
+
+// isolatedForIngress checks whether one of the NetworkPolicies, that cnfuzz didn't create, limits the traffic to the pod
+func isolatedForIngress(policies []networkingv1.NetworkPolicy, pod *v1.Pod) bool {
+	for _, policy := range policies {
+		if policy.Labels[ManagedLabel] == "true" || !hasIngressType(policy) {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.PodSelector)
+		if err == nil && selector.Matches(labels.Set(pod.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIngressType every policy limits ingress, unless it only lists egress as policy type
+func hasIngressType(policy networkingv1.NetworkPolicy) bool {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return true
+	}
+	for _, policyType := range policy.Spec.PolicyTypes {
+		if policyType == networkingv1.PolicyTypeIngress {
+			return true
+		}
+	}
+	return false
+}
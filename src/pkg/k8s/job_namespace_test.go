@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8s
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/k8s/job"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func createJobNamespaceConfig(networkPolicies bool) *config.CnFuzzConfig {
+	return &config.CnFuzzConfig{
+		RestlerWrapperConfig: &config.RestlerWrapperConfig{
+			ServiceAccount: "restlerwrapper-job",
+			JobConfig: &config.JobConfig{Namespace: &config.JobNamespaceConfig{
+				Name:            "cnfuzz-jobs",
+				ClusterRole:     "restlerwrapper-job",
+				ConfigMaps:      []string{"auth-script"},
+				NetworkPolicies: networkPolicies,
+			}},
+		},
+		AuthConfig: &config.AuthConfig{Jwt: &config.JwtConfig{KeySecret: &config.SecretKeyRef{Name: "jwt-key", Key: "key"}}},
+	}
+}
+
+func TestPrepareJobNamespace(t *testing.T) {
+	ctx := context.Background()
+	l := logger.CreateDebugLogger()
+	client := fake.NewSimpleClientset(
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "auth-script", Namespace: CurrentNamespace()}, Data: map[string]string{"login.sh": "echo token"}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "jwt-key", Namespace: CurrentNamespace()}, Data: map[string][]byte{"key": []byte("secret")}},
+	)
+	cnf := createJobNamespaceConfig(false)
+
+	// preparing the namespace again updates the existing objects
+	for i := 0; i < 2; i++ {
+		require.NoError(t, PrepareJobNamespace(ctx, l, client, cnf))
+	}
+	_, err := client.CoreV1().Namespaces().Get(ctx, "cnfuzz-jobs", metav1.GetOptions{})
+	require.NoError(t, err)
+	_, err = client.CoreV1().ServiceAccounts("cnfuzz-jobs").Get(ctx, "restlerwrapper-job", metav1.GetOptions{})
+	require.NoError(t, err)
+	binding, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "cnfuzz-jobs-cnfuzz-jobs", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "restlerwrapper-job", binding.RoleRef.Name)
+	require.Len(t, binding.Subjects, 1)
+	assert.Equal(t, "cnfuzz-jobs", binding.Subjects[0].Namespace)
+	configMap, err := client.CoreV1().ConfigMaps("cnfuzz-jobs").Get(ctx, "auth-script", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "echo token", configMap.Data["login.sh"])
+	secret, err := client.CoreV1().Secrets("cnfuzz-jobs").Get(ctx, "jwt-key", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), secret.Data["key"])
+
+	// nothing to prepare when the jobs run next to their targets
+	client = fake.NewSimpleClientset()
+	cnf.RestlerWrapperConfig.JobConfig.Namespace = nil
+	require.NoError(t, PrepareJobNamespace(ctx, l, client, cnf))
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, namespaces.Items)
+}
+
+func TestAllowFuzzJobTraffic(t *testing.T) {
+	ctx := context.Background()
+	l := logger.CreateDebugLogger()
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "todo-api-7c9d8f6b5-x2x4z",
+		Namespace: "shop",
+		Labels:    map[string]string{"app": "todo-api", "pod-template-hash": "7c9d8f6b5"},
+	}}
+	egressOnly := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "egress", Namespace: "shop"},
+		Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}},
+	}
+	denyAll := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "deny-all", Namespace: "shop"}}
+
+	// a policy would isolate the pod when nothing limits the traffic to it yet
+	client := fake.NewSimpleClientset(egressOnly)
+	created, err := AllowFuzzJobTraffic(ctx, l, client, createJobNamespaceConfig(true), pod)
+	require.NoError(t, err)
+	assert.Empty(t, created)
+	policies, err := client.NetworkingV1().NetworkPolicies("shop").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, policies.Items, 1)
+
+	// disabled
+	client = fake.NewSimpleClientset(denyAll)
+	_, err = AllowFuzzJobTraffic(ctx, l, client, createJobNamespaceConfig(false), pod)
+	require.NoError(t, err)
+	policies, err = client.NetworkingV1().NetworkPolicies("shop").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, policies.Items, 1)
+
+	// only the first call creates the policy, the second one updates it
+	created, err = AllowFuzzJobTraffic(ctx, l, client, createJobNamespaceConfig(true), pod)
+	require.NoError(t, err)
+	assert.Equal(t, NetworkPolicyPrefix+"todo-api", created)
+	created, err = AllowFuzzJobTraffic(ctx, l, client, createJobNamespaceConfig(true), pod)
+	require.NoError(t, err)
+	assert.Empty(t, created)
+	policy, err := client.NetworkingV1().NetworkPolicies("shop").Get(ctx, NetworkPolicyPrefix+"todo-api", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "todo-api"}, policy.Spec.PodSelector.MatchLabels)
+	require.Len(t, policy.Spec.Ingress, 1)
+	from := policy.Spec.Ingress[0].From[0]
+	assert.Equal(t, map[string]string{namespaceNameLabel: "cnfuzz-jobs"}, from.NamespaceSelector.MatchLabels)
+	assert.Equal(t, map[string]string{job.JobLabel: "true"}, from.PodSelector.MatchLabels)
+
+	require.NoError(t, RemoveFuzzJobTraffic(ctx, client, "shop", NetworkPolicyPrefix+"todo-api"))
+	require.NoError(t, RemoveFuzzJobTraffic(ctx, client, "shop", NetworkPolicyPrefix+"todo-api"))
+	policies, err = client.NetworkingV1().NetworkPolicies("shop").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, policies.Items, 1)
+}
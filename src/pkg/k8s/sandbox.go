@@ -0,0 +1,308 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// SandboxLabel label of sandbox namespaces with the namespace of the workload that is copied into it
+	SandboxLabel = "cnfuzz/sandbox"
+	// serviceAccountVolumePrefix prefix of the volume with the service account token that Kubernetes adds to pods
+	serviceAccountVolumePrefix = "kube-api-access-"
+	// sandboxPollInterval time between the checks whether the copy of the workload is ready
+	sandboxPollInterval = 2 * time.Second
+)
+
+// SandboxNamespace generates a unique name for a sandbox namespace
+func SandboxNamespace(cnf *config.SandboxConfig) string {
+	return cnf.GetNamespacePrefix() + rand.String(8)
+}
+
+// CreateSandbox creates the sandbox namespace of the copy of a pod (see CloneSandboxPod) and starts the copy inside it,
+// together with the ConfigMaps and secrets it uses, then waits until the copy is ready.
+// The namespace is removed when the copy doesn't become ready.
+func CreateSandbox(ctx context.Context, l logger.Logger, client kubernetes.Interface, cnf *config.SandboxConfig, pod *v1.Pod, sandbox *v1.Pod) (*v1.Pod, error) {
+	namespace := sandbox.Namespace
+	ns := &v1.Namespace{ObjectMeta: managedMeta("", namespace)}
+	ns.Labels[SandboxLabel] = pod.Namespace
+	if _, err := client.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to create sandbox namespace %s: %w", namespace, err)
+	}
+
+	created, err := createSandboxPod(ctx, l, client, cnf, pod, sandbox)
+	if err != nil {
+		if deleteErr := DeleteSandbox(ctx, client, namespace); deleteErr != nil {
+			l.V(logger.ImportantLevel).Error(deleteErr, "failed to remove sandbox", "namespace", namespace)
+		}
+		return nil, err
+	}
+	l.V(logger.InfoLevel).Info("created sandbox copy of pod", "pod", pod.Name, "podNamespace", pod.Namespace, "sandbox", namespace)
+	return created, nil
+}
+
+func createSandboxPod(ctx context.Context, l logger.Logger, client kubernetes.Interface, cnf *config.SandboxConfig, pod *v1.Pod, sandbox *v1.Pod) (*v1.Pod, error) {
+	configMaps, secrets := referencedObjects(sandbox)
+	for _, name := range configMaps {
+		if err := copyConfigMap(ctx, client, pod.Namespace, sandbox.Namespace, name); err != nil {
+			// optional ConfigMaps don't have to exist, the pod doesn't become ready when a required one is missing
+			l.V(logger.InfoLevel).Error(err, "failed to copy ConfigMap into sandbox", "configMap", name, "sandbox", sandbox.Namespace)
+		}
+	}
+	for _, name := range secrets {
+		if err := copySecret(ctx, client, pod.Namespace, sandbox.Namespace, name); err != nil {
+			l.V(logger.InfoLevel).Error(err, "failed to copy secret into sandbox", "secret", name, "sandbox", sandbox.Namespace)
+		}
+	}
+
+	created, err := client.CoreV1().Pods(sandbox.Namespace).Create(ctx, sandbox, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sandbox copy of pod %s: %w", pod.Name, err)
+	}
+	timeout, err := cnf.GetReadyTimeout()
+	if err != nil {
+		return nil, err
+	}
+	err = wait.PollImmediate(sandboxPollInterval, timeout, func() (bool, error) {
+		created, err = client.CoreV1().Pods(sandbox.Namespace).Get(ctx, sandbox.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if created.Status.Phase == v1.PodFailed || created.Status.Phase == v1.PodSucceeded {
+			return false, fmt.Errorf("sandbox copy of pod %s stopped with phase %s", pod.Name, created.Status.Phase)
+		}
+		return isPodReady(created), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sandbox copy of pod %s didn't become ready: %w", pod.Name, err)
+	}
+	return created, nil
+}
+
+// isPodReady checks whether the pod runs, has an IP and passes its readiness probes
+func isPodReady(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning || len(pod.Status.PodIP) == 0 {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// CloneSandboxPod creates the copy of a pod for a sandbox namespace.
+// The copy runs the same images (by digest when it is known) with the same env and config, but without the service account of the pod,
+// volumes that would share data with the pod are replaced by empty dirs. The sandbox annotations add sidecars and env vars to it.
+func CloneSandboxPod(pod *v1.Pod, namespace string) (*v1.Pod, error) {
+	annos := GetAnnotations(&pod.ObjectMeta)
+	spec := pod.Spec.DeepCopy()
+	spec.NodeName = ""
+	spec.EphemeralContainers = nil
+	spec.ServiceAccountName = ""
+	spec.DeprecatedServiceAccount = ""
+	automount := false
+	spec.AutomountServiceAccountToken = &automount
+
+	volumes := spec.Volumes[:0]
+	for _, volume := range spec.Volumes {
+		if strings.HasPrefix(volume.Name, serviceAccountVolumePrefix) {
+			continue
+		}
+		if volume.PersistentVolumeClaim != nil || volume.HostPath != nil {
+			volume.VolumeSource = v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}
+		}
+		volumes = append(volumes, volume)
+	}
+	spec.Volumes = volumes
+
+	var env map[string]string
+	if len(annos.Sandbox.Env) > 0 {
+		if err := json.Unmarshal([]byte(annos.Sandbox.Env), &env); err != nil {
+			return nil, fmt.Errorf("sandbox env annotation of pod %s isn't a JSON object of strings: %w", pod.Name, err)
+		}
+	}
+	images := runningImages(pod)
+	for i := range spec.InitContainers {
+		cloneContainer(&spec.InitContainers[i], images, nil)
+	}
+	for i := range spec.Containers {
+		cloneContainer(&spec.Containers[i], images, env)
+	}
+	if len(annos.Sandbox.Sidecars) > 0 {
+		var sidecars []v1.Container
+		if err := json.Unmarshal([]byte(annos.Sandbox.Sidecars), &sidecars); err != nil {
+			return nil, fmt.Errorf("sandbox sidecars annotation of pod %s isn't a JSON list of containers: %w", pod.Name, err)
+		}
+		spec.Containers = append(spec.Containers, sidecars...)
+	}
+
+	annotations := make(map[string]string)
+	for key, value := range pod.Annotations {
+		annotations[key] = value
+	}
+	// the copy runs images that are already being fuzzed
+	annotations[AnnotationPrefix+"/"+IgnoreMeAnno] = "true"
+	labels := make(map[string]string)
+	for key, value := range pod.Labels {
+		labels[key] = value
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: namespace, Labels: labels, Annotations: annotations},
+		Spec:       *spec,
+	}, nil
+}
+
+// runningImages returns the images that the containers of the pod run by container name, pinned to their digest when it is known
+func runningImages(pod *v1.Pod) map[string]string {
+	images := make(map[string]string)
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		imageId := status.ImageID
+		if index := strings.Index(imageId, "://"); index >= 0 {
+			imageId = imageId[index+3:]
+		}
+		if strings.Contains(imageId, "@sha256:") {
+			images[status.Name] = imageId
+		}
+	}
+	return images
+}
+
+// cloneContainer pins the image of a container and removes the mounts of the service account token
+func cloneContainer(container *v1.Container, images map[string]string, env map[string]string) {
+	if image, found := images[container.Name]; found {
+		container.Image = image
+	}
+	mounts := container.VolumeMounts[:0]
+	for _, mount := range container.VolumeMounts {
+		if !strings.HasPrefix(mount.Name, serviceAccountVolumePrefix) {
+			mounts = append(mounts, mount)
+		}
+	}
+	container.VolumeMounts = mounts
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		replaced := false
+		for i := range container.Env {
+			if container.Env[i].Name == name {
+				container.Env[i] = v1.EnvVar{Name: name, Value: env[name]}
+				replaced = true
+			}
+		}
+		if !replaced {
+			container.Env = append(container.Env, v1.EnvVar{Name: name, Value: env[name]})
+		}
+	}
+}
+
+// referencedObjects returns the names of the ConfigMaps and secrets that a pod uses for its env, volumes and image pull secrets
+func referencedObjects(pod *v1.Pod) ([]string, []string) {
+	configMaps := make(map[string]bool)
+	secrets := make(map[string]bool)
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if ref := env.ValueFrom.ConfigMapKeyRef; ref != nil {
+				configMaps[ref.Name] = true
+			}
+			if ref := env.ValueFrom.SecretKeyRef; ref != nil {
+				secrets[ref.Name] = true
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.ConfigMapRef != nil {
+				configMaps[envFrom.ConfigMapRef.Name] = true
+			}
+			if envFrom.SecretRef != nil {
+				secrets[envFrom.SecretRef.Name] = true
+			}
+		}
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.ConfigMap != nil {
+			configMaps[volume.ConfigMap.Name] = true
+		}
+		if volume.Secret != nil {
+			secrets[volume.Secret.SecretName] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					configMaps[source.ConfigMap.Name] = true
+				}
+				if source.Secret != nil {
+					secrets[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+	for _, pullSecret := range pod.Spec.ImagePullSecrets {
+		secrets[pullSecret.Name] = true
+	}
+	return sortedKeys(configMaps), sortedKeys(secrets)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DeleteSandbox removes a sandbox namespace with everything inside it, namespaces that aren't sandboxes are left alone
+func DeleteSandbox(ctx context.Context, client kubernetes.Interface, namespace string) error {
+	ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get sandbox namespace %s: %w", namespace, err)
+	}
+	if _, isSandbox := ns.Labels[SandboxLabel]; !isSandbox {
+		return fmt.Errorf("namespace %s isn't a sandbox", namespace)
+	}
+	err = client.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to remove sandbox namespace %s: %w", namespace, err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suecodelabs/cnfuzz/src/pkg/config"
+	"github.com/suecodelabs/cnfuzz/src/pkg/discovery/openapi"
+	"github.com/suecodelabs/cnfuzz/src/pkg/logger"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const sandboxDigest = "sha256:5add8f3c2d0a9a6f1d0a0f5e7a1c0b6c1c5f2a9e3b3d5f0e6a7c8b9d0e1f2a3b"
+
+func createSandboxTargetPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "todo-api-7c9d8f6b5-x2x4z",
+			Namespace: "shop",
+			Labels:    map[string]string{"app": "todo-api"},
+			Annotations: map[string]string{
+				"cnfuzz/sandbox":          "true",
+				"cnfuzz/open-api-doc":     "/openapi.json",
+				"cnfuzz/sandbox-env":      `{"DB_HOST": "localhost"}`,
+				"cnfuzz/sandbox-sidecars": `[{"name": "db", "image": "postgres:15", "env": [{"name": "POSTGRES_PASSWORD", "value": "fuzz"}]}]`,
+			},
+		},
+		Spec: v1.PodSpec{
+			NodeName:           "node-1",
+			ServiceAccountName: "todo-api",
+			ImagePullSecrets:   []v1.LocalObjectReference{{Name: "registry"}},
+			Containers: []v1.Container{{
+				Name:  "api",
+				Image: "localhost:5000/todo-api:latest",
+				Env: []v1.EnvVar{
+					{Name: "DB_HOST", Value: "postgres.shop"},
+					{Name: "DB_PASSWORD", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "db"}, Key: "password"}}},
+				},
+				EnvFrom: []v1.EnvFromSource{{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "todo-config"}}}},
+				VolumeMounts: []v1.VolumeMount{
+					{Name: "data", MountPath: "/data"},
+					{Name: "kube-api-access-abcde", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount"},
+				},
+			}},
+			Volumes: []v1.Volume{
+				{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "todo-data"}}},
+				{Name: "kube-api-access-abcde", VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{}}},
+			},
+		},
+		Status: v1.PodStatus{
+			PodIP:             "10.0.0.1",
+			ContainerStatuses: []v1.ContainerStatus{{Name: "api", ImageID: "docker-pullable://localhost:5000/todo-api@" + sandboxDigest}},
+		},
+	}
+}
+
+func TestCloneSandboxPod(t *testing.T) {
+	pod := createSandboxTargetPod()
+	sandbox, err := CloneSandboxPod(pod, "cnfuzz-sandbox-test")
+	require.NoError(t, err)
+
+	assert.Equal(t, pod.Name, sandbox.Name)
+	assert.Equal(t, "cnfuzz-sandbox-test", sandbox.Namespace)
+	assert.Equal(t, "true", sandbox.Annotations["cnfuzz/ignore"])
+	assert.Equal(t, "/openapi.json", sandbox.Annotations["cnfuzz/open-api-doc"])
+	assert.Empty(t, sandbox.Spec.NodeName)
+	assert.Empty(t, sandbox.Spec.ServiceAccountName)
+	require.NotNil(t, sandbox.Spec.AutomountServiceAccountToken)
+	assert.False(t, *sandbox.Spec.AutomountServiceAccountToken)
+
+	// the data of the live pod isn't shared
+	require.Len(t, sandbox.Spec.Volumes, 1)
+	assert.Nil(t, sandbox.Spec.Volumes[0].PersistentVolumeClaim)
+	assert.NotNil(t, sandbox.Spec.Volumes[0].EmptyDir)
+
+	require.Len(t, sandbox.Spec.Containers, 2)
+	api := sandbox.Spec.Containers[0]
+	assert.Equal(t, "localhost:5000/todo-api@"+sandboxDigest, api.Image)
+	assert.Equal(t, []v1.VolumeMount{{Name: "data", MountPath: "/data"}}, api.VolumeMounts)
+	assert.Equal(t, v1.EnvVar{Name: "DB_HOST", Value: "localhost"}, api.Env[0])
+	assert.Equal(t, "db", sandbox.Spec.Containers[1].Name)
+	assert.Equal(t, "postgres:15", sandbox.Spec.Containers[1].Image)
+
+	// the live pod is left alone
+	assert.Equal(t, "postgres.shop", pod.Spec.Containers[0].Env[0].Value)
+	assert.Len(t, pod.Spec.Volumes, 2)
+
+	configMaps, secrets := referencedObjects(sandbox)
+	assert.Equal(t, []string{"todo-config"}, configMaps)
+	assert.Equal(t, []string{"db", "registry"}, secrets)
+
+	pod.Annotations["cnfuzz/sandbox-sidecars"] = `{"name": "db"}`
+	_, err = CloneSandboxPod(pod, "cnfuzz-sandbox-test")
+	assert.Error(t, err)
+}
+
+// createSandboxClient creates a client with the objects of the target pod, created pods become ready right away
+func createSandboxClient() *fake.Clientset {
+	client := fake.NewSimpleClientset(
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "todo-config", Namespace: "shop"}, Data: map[string]string{"LOG_LEVEL": "debug"}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "shop"}, Data: map[string][]byte{"password": []byte("secret")}},
+	)
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*v1.Pod)
+		pod.Status = v1.PodStatus{
+			Phase:      v1.PodRunning,
+			PodIP:      "10.0.1.1",
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}},
+		}
+		return false, nil, nil
+	})
+	return client
+}
+
+func TestCreateSandbox(t *testing.T) {
+	ctx := context.Background()
+	l := logger.CreateDebugLogger()
+	client := createSandboxClient()
+	pod := createSandboxTargetPod()
+	clone, err := CloneSandboxPod(pod, "cnfuzz-sandbox-test")
+	require.NoError(t, err)
+
+	sandbox, err := CreateSandbox(ctx, l, client, &config.SandboxConfig{Enabled: true}, pod, clone)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", sandbox.Status.PodIP)
+	ns, err := client.CoreV1().Namespaces().Get(ctx, "cnfuzz-sandbox-test", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "shop", ns.Labels[SandboxLabel])
+	configMap, err := client.CoreV1().ConfigMaps("cnfuzz-sandbox-test").Get(ctx, "todo-config", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "debug", configMap.Data["LOG_LEVEL"])
+	_, err = client.CoreV1().Secrets("cnfuzz-sandbox-test").Get(ctx, "db", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, DeleteSandbox(ctx, client, "cnfuzz-sandbox-test"))
+	_, err = client.CoreV1().Namespaces().Get(ctx, "cnfuzz-sandbox-test", metav1.GetOptions{})
+	assert.Error(t, err)
+	// removing it again is fine, namespaces that aren't sandboxes are never removed
+	require.NoError(t, DeleteSandbox(ctx, client, "cnfuzz-sandbox-test"))
+	_, err = client.CoreV1().Namespaces().Create(ctx, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop"}}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Error(t, DeleteSandbox(ctx, client, "shop"))
+}
+
+func createSandboxFuzzConfig() (*config.CnFuzzConfig, openapi.UnParsedOpenApiDoc) {
+	cnf := &config.CnFuzzConfig{
+		RestlerWrapperConfig: &config.RestlerWrapperConfig{
+			ImageConfig:   config.ImageConfig{Image: "ghcr.io/suecodelabs/cnfuzz-restlerwrapper"},
+			RestlerConfig: &config.RestlerConfig{TimeBudget: "1", CpuLimit: "1", MemoryLimit: "1Gi", CpuRequest: "1", MemoryRequest: "1Gi"},
+		},
+	}
+	uri, _ := url.Parse("http://10.0.0.1:8080/openapi.json")
+	return cnf, openapi.UnParsedOpenApiDoc{Uri: uri}
+}
+
+func TestStartFuzzJobInSandbox(t *testing.T) {
+	ctx := context.Background()
+	l := logger.CreateDebugLogger()
+	cnf, doc := createSandboxFuzzConfig()
+
+	// the live pod isn't fuzzed when sandboxes aren't enabled
+	client := createSandboxClient()
+	assert.Error(t, StartFuzzJob(l, client, cnf, createSandboxTargetPod(), doc, FuzzJobOptions{}))
+
+	cnf.SandboxConfig = &config.SandboxConfig{Enabled: true}
+	require.NoError(t, StartFuzzJob(l, client, cnf, createSandboxTargetPod(), doc, FuzzJobOptions{}))
+	runs, err := client.CoreV1().ConfigMaps("shop").List(ctx, metav1.ListOptions{LabelSelector: FuzzRunLabel})
+	require.NoError(t, err)
+	require.Len(t, runs.Items, 1)
+	status, err := GetFuzzRunStatus(&runs.Items[0])
+	require.NoError(t, err)
+	assert.Equal(t, FuzzRunName(status.Job), runs.Items[0].Name)
+	assert.True(t, strings.HasPrefix(status.Sandbox, config.DefaultSandboxNamespacePrefix))
+	_, err = client.CoreV1().Pods(status.Sandbox).Get(ctx, "todo-api-7c9d8f6b5-x2x4z", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// the job runs next to the run and fuzzes the copy
+	job, err := client.BatchV1().Jobs("shop").Get(ctx, status.Job, metav1.GetOptions{})
+	require.NoError(t, err)
+	args, _ := json.Marshal(job.Spec.Template.Spec.Containers[0].Args)
+	assert.Contains(t, string(args), `"--ns","`+status.Sandbox+`"`)
+	assert.Contains(t, string(args), `"--fuzz-run-namespace","shop"`)
+}
+
+func TestStartFuzzJobWithoutJob(t *testing.T) {
+	ctx := context.Background()
+	l := logger.CreateDebugLogger()
+	cnf, doc := createSandboxFuzzConfig()
+	cnf.SandboxConfig = &config.SandboxConfig{Enabled: true}
+	client := createSandboxClient()
+	client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("quota exceeded")
+	})
+
+	err := StartFuzzJob(l, client, cnf, createSandboxTargetPod(), doc, FuzzJobOptions{})
+	require.Error(t, err)
+	runs, err := client.CoreV1().ConfigMaps("shop").List(ctx, metav1.ListOptions{LabelSelector: FuzzRunLabel})
+	require.NoError(t, err)
+	require.Len(t, runs.Items, 1)
+	status, err := GetFuzzRunStatus(&runs.Items[0])
+	require.NoError(t, err)
+	assert.Equal(t, FuzzRunFailed, status.Phase)
+	assert.Contains(t, status.Message, "quota exceeded")
+	// the sandbox of the job is removed
+	_, err = client.CoreV1().Namespaces().Get(ctx, status.Sandbox, metav1.GetOptions{})
+	assert.Error(t, err)
+}
+
+func TestStartFuzzJobWithoutRun(t *testing.T) {
+	ctx := context.Background()
+	l := logger.CreateDebugLogger()
+	cnf, doc := createSandboxFuzzConfig()
+	cnf.SandboxConfig = &config.SandboxConfig{Enabled: true}
+	client := createSandboxClient()
+	client.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("quota exceeded")
+	})
+
+	require.Error(t, StartFuzzJob(l, client, cnf, createSandboxTargetPod(), doc, FuzzJobOptions{}))
+	// nothing would remove the sandbox or record the results of the job
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, namespaces.Items)
+	jobs, err := client.BatchV1().Jobs("shop").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, jobs.Items)
+}
@@ -29,3 +29,26 @@ func IsControlPlaneObject(object *metav1.ObjectMeta) bool {
 func IsFuzzerObject(object *metav1.ObjectMeta) bool {
 	return strings.HasPrefix(object.Name, "cnfuzz")
 }
+
+// WorkloadName returns the name of the workload that an object belongs to, which stays the same when the workload is redeployed
+// the name is taken from the app labels, the owner of the object or the name of the object itself
+func WorkloadName(object *metav1.ObjectMeta) string {
+	for _, label := range []string{"app.kubernetes.io/name", "app"} {
+		if name, found := object.Labels[label]; found && len(name) > 0 {
+			return name
+		}
+	}
+	for _, owner := range object.OwnerReferences {
+		if owner.Controller == nil || !*owner.Controller {
+			continue
+		}
+		// replica sets of deployments are suffixed with the hash of the pod template
+		if owner.Kind == "ReplicaSet" {
+			if hash, found := object.Labels["pod-template-hash"]; found {
+				return strings.TrimSuffix(owner.Name, "-"+hash)
+			}
+		}
+		return owner.Name
+	}
+	return object.Name
+}
@@ -48,3 +48,27 @@ func TestIsFuzzerObject(t *testing.T) {
 		assert.Equal(t, results[i], result)
 	}
 }
+
+func TestWorkloadName(t *testing.T) {
+	isController := true
+	testCases := []struct {
+		meta     v1.ObjectMeta
+		expected string
+	}{
+		{v1.ObjectMeta{Name: "todo-api-6d4cf56db6-tmwmh", Labels: map[string]string{"app.kubernetes.io/name": "todo", "app": "todo-api"}}, "todo"},
+		{v1.ObjectMeta{Name: "todo-api-6d4cf56db6-tmwmh", Labels: map[string]string{"app": "todo-api"}}, "todo-api"},
+		{v1.ObjectMeta{
+			Name:            "todo-api-6d4cf56db6-tmwmh",
+			Labels:          map[string]string{"pod-template-hash": "6d4cf56db6"},
+			OwnerReferences: []v1.OwnerReference{{Kind: "ReplicaSet", Name: "todo-api-6d4cf56db6", Controller: &isController}},
+		}, "todo-api"},
+		{v1.ObjectMeta{
+			Name:            "todo-db-0",
+			OwnerReferences: []v1.OwnerReference{{Kind: "StatefulSet", Name: "todo-db", Controller: &isController}},
+		}, "todo-db"},
+		{v1.ObjectMeta{Name: "todo-api"}, "todo-api"},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, WorkloadName(&testCase.meta))
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2022 Sue B.V.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package schedule
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// Wednesday
+	now := time.Date(2023, time.March, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2023, time.March, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2023, time.March, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2023, time.March, 16, 3, 0, 0, 0, time.UTC)},
+		{"30 2 * * 0", time.Date(2023, time.March, 19, 2, 30, 0, 0, time.UTC)},
+		{"30 2 * * 7", time.Date(2023, time.March, 19, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2023, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2023, time.March, 15, 13, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 1", time.Date(2023, time.March, 20, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * 4", time.Date(2023, time.March, 16, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2023, time.March, 19, 0, 0, 0, 0, time.UTC)},
+		{"5,10 10 15 3 *", time.Date(2023, time.March, 15, 10, 10, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		cron, err := ParseCron(test.expr)
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, test.next, cron.Next(now), test.expr)
+	}
+
+	never, err := ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, never.Next(now).IsZero())
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}